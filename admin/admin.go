@@ -0,0 +1,287 @@
+// Package admin is a client for the organization APIs of admin.atlassian.com, which manage the
+// users, groups and domains of an atlassian organization and are authenticated with admin API keys
+// rather than with the credentials of a connect app.
+package admin
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is where the organization APIs are served.
+const DefaultBaseURL = "https://api.atlassian.com"
+
+const defaultTimeout = 30 * time.Second
+
+// Client calls the organization APIs with an admin API key.
+type Client struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient returns a Client authenticated with the passed admin API key, these are created by
+// organization admins at admin.atlassian.com.
+func NewClient(apiKey string) *Client {
+	return NewClientWithHTTPClient(apiKey, DefaultBaseURL, &http.Client{Timeout: defaultTimeout})
+}
+
+// NewClientWithHTTPClient behaves like NewClient but uses the passed base URL and http client.
+func NewClientWithHTTPClient(apiKey, baseURL string, client *http.Client) *Client {
+	return &Client{
+		apiKey:  apiKey,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+	}
+}
+
+// Error is returned when the API answers with an unexpected status.
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("admin API answered %d: %s", e.StatusCode, e.Body)
+}
+
+// do performs a request and decodes the response into target if not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, target interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("performing %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+	if target == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// links holds the pagination cursors of list responses.
+type links struct {
+	Next string `json:"next,omitempty"`
+}
+
+// Organization is an atlassian organization the API key has access to.
+type Organization struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Name string `json:"name"`
+	} `json:"attributes"`
+}
+
+// Organizations returns the organizations the API key has access to.
+func (c *Client) Organizations(ctx context.Context) ([]Organization, error) {
+	var all []Organization
+	err := c.paginate(ctx, "/admin/v1/orgs", func(cursor string) (string, error) {
+		var page struct {
+			Data  []Organization `json:"data"`
+			Links links          `json:"links"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/admin/v1/orgs", cursorQuery(cursor), nil, &page); err != nil {
+			return "", err
+		}
+		all = append(all, page.Data...)
+		return page.Links.Next, nil
+	})
+	return all, err
+}
+
+// User is a managed account of an organization.
+type User struct {
+	AccountID      string `json:"account_id"`
+	AccountType    string `json:"account_type"`
+	AccountStatus  string `json:"account_status"`
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	AccessBillable bool   `json:"access_billable"`
+	LastActive     string `json:"last_active,omitempty"`
+}
+
+// ForEachUser invokes f for every user of the organization, it stops at the first error returned by f.
+func (c *Client) ForEachUser(ctx context.Context, orgID string, f func(*User) error) error {
+	p := "/admin/v1/orgs/" + url.PathEscape(orgID) + "/users"
+	return c.paginate(ctx, p, func(cursor string) (string, error) {
+		var page struct {
+			Data  []User `json:"data"`
+			Links links  `json:"links"`
+		}
+		if err := c.do(ctx, http.MethodGet, p, cursorQuery(cursor), nil, &page); err != nil {
+			return "", err
+		}
+		for i := range page.Data {
+			if err := f(&page.Data[i]); err != nil {
+				return "", err
+			}
+		}
+		return page.Links.Next, nil
+	})
+}
+
+// DisableUser deactivates the account in the organization, message is shown to the user.
+func (c *Client) DisableUser(ctx context.Context, accountID, message string) error {
+	p := "/users/" + url.PathEscape(accountID) + "/manage/lifecycle/disable"
+	var body interface{}
+	if message != "" {
+		body = map[string]string{"message": message}
+	}
+	return c.do(ctx, http.MethodPost, p, nil, body, nil)
+}
+
+// EnableUser reactivates an account disabled with DisableUser.
+func (c *Client) EnableUser(ctx context.Context, accountID string) error {
+	return c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(accountID)+"/manage/lifecycle/enable", nil, nil, nil)
+}
+
+// Domain is a domain claimed by an organization.
+type Domain struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Name  string `json:"name"`
+		Claim struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"claim"`
+	} `json:"attributes"`
+}
+
+// Domains returns the domains claimed by the organization.
+func (c *Client) Domains(ctx context.Context, orgID string) ([]Domain, error) {
+	p := "/admin/v1/orgs/" + url.PathEscape(orgID) + "/domains"
+	var all []Domain
+	err := c.paginate(ctx, p, func(cursor string) (string, error) {
+		var page struct {
+			Data  []Domain `json:"data"`
+			Links links    `json:"links"`
+		}
+		if err := c.do(ctx, http.MethodGet, p, cursorQuery(cursor), nil, &page); err != nil {
+			return "", err
+		}
+		all = append(all, page.Data...)
+		return page.Links.Next, nil
+	})
+	return all, err
+}
+
+// Group is a group of the organization directory.
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CreateGroup creates a group in the organization directory.
+func (c *Client) CreateGroup(ctx context.Context, orgID, name string) (*Group, error) {
+	g := &Group{}
+	p := "/admin/v1/orgs/" + url.PathEscape(orgID) + "/directory/groups"
+	if err := c.do(ctx, http.MethodPost, p, nil, map[string]string{"name": name}, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// DeleteGroup deletes a group of the organization directory.
+func (c *Client) DeleteGroup(ctx context.Context, orgID, groupID string) error {
+	p := "/admin/v1/orgs/" + url.PathEscape(orgID) + "/directory/groups/" + url.PathEscape(groupID)
+	return c.do(ctx, http.MethodDelete, p, nil, nil, nil)
+}
+
+// AddGroupMember adds the account to the group.
+func (c *Client) AddGroupMember(ctx context.Context, orgID, groupID, accountID string) error {
+	p := "/admin/v1/orgs/" + url.PathEscape(orgID) + "/directory/groups/" + url.PathEscape(groupID) + "/memberships"
+	return c.do(ctx, http.MethodPost, p, nil, map[string]string{"account_id": accountID}, nil)
+}
+
+// RemoveGroupMember removes the account from the group.
+func (c *Client) RemoveGroupMember(ctx context.Context, orgID, groupID, accountID string) error {
+	p := "/admin/v1/orgs/" + url.PathEscape(orgID) + "/directory/groups/" + url.PathEscape(groupID) +
+		"/memberships/" + url.PathEscape(accountID)
+	return c.do(ctx, http.MethodDelete, p, nil, nil, nil)
+}
+
+// paginate invokes page with each cursor, starting with "", until it returns no next cursor.
+func (c *Client) paginate(ctx context.Context, p string, page func(cursor string) (string, error)) error {
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		next, err := page(cursor)
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", p, err)
+		}
+		next = nextCursor(next)
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func cursorQuery(cursor string) url.Values {
+	if cursor == "" {
+		return nil
+	}
+	return url.Values{"cursor": {cursor}}
+}
+
+// nextCursor returns the cursor of the next page, links.next holds either the cursor or the URL
+// of the next page depending on the API version.
+func nextCursor(next string) string {
+	if u, err := url.Parse(next); err == nil && u.Query().Get("cursor") != "" {
+		return u.Query().Get("cursor")
+	}
+	return next
+}
@@ -0,0 +1,183 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeOrgAPI records the requests it serves and answers them with the handler of their path.
+type fakeOrgAPI struct {
+	t        *testing.T
+	requests []string
+	routes   map[string]func(w http.ResponseWriter, r *http.Request)
+}
+
+func (f *fakeOrgAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("Authorization"); got != "Bearer api-key" {
+		f.t.Errorf("%s %s authorized with %q", r.Method, r.URL.Path, got)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	request := r.Method + " " + r.URL.RequestURI()
+	if len(body) > 0 {
+		request += " " + string(body)
+	}
+	f.requests = append(f.requests, request)
+	route, ok := f.routes[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	route(w, r)
+}
+
+func newFakeOrgAPI(t *testing.T) (*fakeOrgAPI, *Client, func()) {
+	api := &fakeOrgAPI{t: t, routes: map[string]func(w http.ResponseWriter, r *http.Request){}}
+	srv := httptest.NewServer(api)
+	return api, NewClientWithHTTPClient("api-key", srv.URL+"/", srv.Client()), srv.Close
+}
+
+func TestClient_Organizations(t *testing.T) {
+	api, c, done := newFakeOrgAPI(t)
+	defer done()
+	api.routes["GET /admin/v1/orgs"] = func(w http.ResponseWriter, r *http.Request) {
+		// the first page links the next one by URL, as newer API versions do.
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			fmt.Fprint(w, `{"data":[{"id":"o1","attributes":{"name":"One"}}],"links":{"next":"https://api.atlassian.com/admin/v1/orgs?cursor=c2"}}`)
+		case "c2":
+			fmt.Fprint(w, `{"data":[{"id":"o2","attributes":{"name":"Two"}}],"links":{}}`)
+		}
+	}
+	orgs, err := c.Organizations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 2 || orgs[0].Attributes.Name != "One" || orgs[1].ID != "o2" {
+		t.Fatalf("listed %+v", orgs)
+	}
+	if len(api.requests) != 2 || api.requests[1] != "GET /admin/v1/orgs?cursor=c2" {
+		t.Fatalf("requested %v", api.requests)
+	}
+}
+
+func TestClient_ForEachUser(t *testing.T) {
+	api, c, done := newFakeOrgAPI(t)
+	defer done()
+	api.routes["GET /admin/v1/orgs/o 1/users"] = func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			fmt.Fprint(w, `{"data":[{"account_id":"a1","email":"one@example.com"},{"account_id":"a2"}],"links":{"next":"c2"}}`)
+		case "c2":
+			fmt.Fprint(w, `{"data":[{"account_id":"a3"}],"links":{"next":"c2"}}`)
+		}
+	}
+	var ids []string
+	err := c.ForEachUser(context.Background(), "o 1", func(u *User) error {
+		ids = append(ids, u.AccountID)
+		return nil
+	})
+	// a next cursor equal to the current one ends the listing.
+	if err != nil || strings.Join(ids, ",") != "a1,a2,a3" {
+		t.Fatalf("listed %v, %v", ids, err)
+	}
+	if api.requests[0] != "GET /admin/v1/orgs/o%201/users" {
+		t.Fatalf("requested %v", api.requests)
+	}
+
+	stop := errors.New("stop")
+	err = c.ForEachUser(context.Background(), "o 1", func(u *User) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Fatalf("stopping returned %v", err)
+	}
+}
+
+func TestClient_userLifecycle(t *testing.T) {
+	api, c, done := newFakeOrgAPI(t)
+	defer done()
+	if err := c.DisableUser(context.Background(), "a1", "left the company"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DisableUser(context.Background(), "a2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.EnableUser(context.Background(), "a1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`POST /users/a1/manage/lifecycle/disable {"message":"left the company"}`,
+		`POST /users/a2/manage/lifecycle/disable`,
+		`POST /users/a1/manage/lifecycle/enable`,
+	}
+	if strings.Join(api.requests, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("requested %q", api.requests)
+	}
+}
+
+func TestClient_groups(t *testing.T) {
+	api, c, done := newFakeOrgAPI(t)
+	defer done()
+	api.routes["POST /admin/v1/orgs/o1/directory/groups"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":"g1","name":"devs"}`)
+	}
+	g, err := c.CreateGroup(context.Background(), "o1", "devs")
+	if err != nil || g.ID != "g1" || g.Name != "devs" {
+		t.Fatalf("created %+v, %v", g, err)
+	}
+	if err := c.AddGroupMember(context.Background(), "o1", "g1", "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveGroupMember(context.Background(), "o1", "g1", "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteGroup(context.Background(), "o1", "g1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`POST /admin/v1/orgs/o1/directory/groups {"name":"devs"}`,
+		`POST /admin/v1/orgs/o1/directory/groups/g1/memberships {"account_id":"a1"}`,
+		`DELETE /admin/v1/orgs/o1/directory/groups/g1/memberships/a1`,
+		`DELETE /admin/v1/orgs/o1/directory/groups/g1`,
+	}
+	if strings.Join(api.requests, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("requested %q", api.requests)
+	}
+}
+
+func TestClient_Domains(t *testing.T) {
+	api, c, done := newFakeOrgAPI(t)
+	defer done()
+	api.routes["GET /admin/v1/orgs/o1/domains"] = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"id":"d1","attributes":{"name":"example.com","claim":{"type":"dns","status":"VERIFIED"}}}]}`)
+	}
+	domains, err := c.Domains(context.Background(), "o1")
+	if err != nil || len(domains) != 1 || domains[0].Attributes.Claim.Status != "VERIFIED" {
+		t.Fatalf("listed %+v, %v", domains, err)
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	api, c, done := newFakeOrgAPI(t)
+	defer done()
+	api.routes["POST /users/a1/manage/lifecycle/enable"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"not allowed"}`)
+	}
+	err := c.EnableUser(context.Background(), "a1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || !strings.Contains(apiErr.Body, "not allowed") {
+		t.Fatalf("forbidden call returned %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Organizations(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("listing with a canceled context returned %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Versions of the jira platform REST API, version 2 takes and returns plain text (wiki markup)
+// where version 3 uses the atlassian document format.
+const (
+	APIVersion2 = 2
+	APIVersion3 = 3
+)
+
+// platformAPIPrefix is the prefix of the platform API paths typed methods are written against.
+const platformAPIPrefix = "/rest/api/3/"
+
+// WithAPIVersion sets the version of the platform REST API used by the typed methods of the client,
+// ie SearchIssues or CreateProject, it defaults to APIVersion3 (APIVersion2 in data center).
+// Bear in mind that the types of this package follow version 3, fields holding atlassian document
+// format there hold plain text in version 2.
+func WithAPIVersion(version int) HostClientOption {
+	return func(h *HostClient) {
+		h.apiVersion = version
+	}
+}
+
+// WithMethodAPIVersion overrides the version of the platform REST API used by the typed method with
+// the passed name, ie WithMethodAPIVersion("SearchIssues", APIVersion2), for endpoints that still
+// need version 2 semantics in some tenants.
+func WithMethodAPIVersion(method string, version int) HostClientOption {
+	return func(h *HostClient) {
+		if h.methodAPIVersions == nil {
+			h.methodAPIVersions = map[string]int{}
+		}
+		h.methodAPIVersions[method] = version
+	}
+}
+
+// APIVersion returns the version of the platform REST API the typed method with the passed name uses.
+func (h *HostClient) APIVersion(method string) int {
+	if v, ok := h.methodAPIVersions[method]; ok {
+		return v
+	}
+	if h.apiVersion != 0 {
+		return h.apiVersion
+	}
+	if h.dataCenter {
+		return APIVersion2
+	}
+	return APIVersion3
+}
+
+// api returns path, a version 3 platform API path, for the version method should use.
+func (h *HostClient) api(method, path string) string {
+	v := h.APIVersion(method)
+	if v == APIVersion3 || !strings.HasPrefix(path, platformAPIPrefix) {
+		return path
+	}
+	return "/rest/api/" + strconv.Itoa(v) + "/" + strings.TrimPrefix(path, platformAPIPrefix)
+}
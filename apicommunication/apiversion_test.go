@@ -0,0 +1,24 @@
+package apicommunication
+
+import "testing"
+
+func TestHostClient_api(t *testing.T) {
+	h := &HostClient{}
+	WithAPIVersion(APIVersion2)(h)
+	WithMethodAPIVersion("SearchIssues", APIVersion3)(h)
+	tests := []struct {
+		method, path, want string
+	}{
+		{"Fields", fieldsPath, "/rest/api/2/field"},
+		{"SearchIssues", searchPath, searchPath},
+		{"CreateProject", "/rest/agile/1.0/board", "/rest/agile/1.0/board"},
+	}
+	for _, tt := range tests {
+		if got := h.api(tt.method, tt.path); got != tt.want {
+			t.Errorf("api(%q, %q) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+	if got := (&HostClient{}).APIVersion("Fields"); got != APIVersion3 {
+		t.Errorf("default APIVersion() = %d, want %d", got, APIVersion3)
+	}
+}
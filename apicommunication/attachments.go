@@ -0,0 +1,191 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// ErrAttachmentRejected is returned when an AttachmentInterceptor refuses an attachment.
+var ErrAttachmentRejected = stderrors.New("attachment rejected")
+
+// AttachmentDirection tells whether an attachment is being uploaded to or downloaded from jira.
+type AttachmentDirection int
+
+const (
+	// AttachmentUpload is set when the app attaches a file to an issue.
+	AttachmentUpload AttachmentDirection = iota
+	// AttachmentDownload is set when the app reads the content of an attachment.
+	AttachmentDownload
+)
+
+// AttachmentInfo describes the attachment an AttachmentInterceptor is passed.
+type AttachmentInfo struct {
+	Direction AttachmentDirection
+	ClientKey string
+	// IssueKeyOrID is only set for uploads.
+	IssueKeyOrID string
+	// AttachmentID and MimeType are only set for downloads.
+	AttachmentID string
+	MimeType     string
+	Filename     string
+	// Size is -1 when unknown, as is the case for uploads.
+	Size int64
+}
+
+// AttachmentInterceptor inspects the content of an attachment before it is uploaded or handed to
+// the caller, ie to scan it for malware or enforce size policies. It returns the reader the
+// content must be read from from then on, which can be content itself, or an error to refuse the
+// attachment.
+// Interceptors needing the whole content must buffer it, errors returned by the reader while the
+// content is copied also refuse the attachment.
+type AttachmentInterceptor func(info *AttachmentInfo, content io.Reader) (io.Reader, error)
+
+// WithAttachmentInterceptors makes UploadAttachment and DownloadAttachment pass the attachments
+// through interceptors, in order.
+func WithAttachmentInterceptors(interceptors ...AttachmentInterceptor) HostClientOption {
+	return func(h *HostClient) {
+		h.attachmentInterceptors = append(h.attachmentInterceptors, interceptors...)
+	}
+}
+
+// MaxAttachmentSize returns an AttachmentInterceptor refusing attachments larger than n bytes, the
+// known size of downloads is checked upfront.
+func MaxAttachmentSize(n int64) AttachmentInterceptor {
+	return func(info *AttachmentInfo, content io.Reader) (io.Reader, error) {
+		if info.Size > n {
+			return nil, fmt.Errorf("%s is %d bytes, more than the %d allowed", info.Filename, info.Size, n)
+		}
+		return &limitedReader{r: content, remaining: n, filename: info.Filename}, nil
+	}
+}
+
+// limitedReader fails, rather than stopping like io.LimitedReader, when more than remaining bytes
+// are read.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	filename  string
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, wrapSentinel(ErrAttachmentRejected, nil, "%s exceeds the allowed size", l.filename)
+	}
+	return n, err
+}
+
+// intercept passes content through the attachment interceptors of the client.
+func (h *HostClient) intercept(info *AttachmentInfo, content io.Reader) (io.Reader, error) {
+	info.ClientKey = h.Config.ClientKey
+	for _, interceptor := range h.attachmentInterceptors {
+		var err error
+		if content, err = interceptor(info, content); err != nil {
+			return nil, wrapSentinel(ErrAttachmentRejected, err, "attachment %s", info.Filename)
+		}
+	}
+	return content, nil
+}
+
+// UploadAttachment attaches content to the issue with the passed key or id as filename, after
+// passing it through the attachment interceptors.
+func (h *HostClient) UploadAttachment(issueKeyOrID, filename string, content io.Reader) ([]Attachment, error) {
+	content, err := h.intercept(&AttachmentInfo{
+		Direction:    AttachmentUpload,
+		IssueKeyOrID: issueKeyOrID,
+		Filename:     filename,
+		Size:         -1,
+	}, content)
+	if err != nil {
+		return nil, err
+	}
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("building attachment form: %w", err)
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return nil, fmt.Errorf("reading attachment %s: %w", filename, err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("building attachment form: %w", err)
+	}
+	resp, err := h.DoWithHeaders(http.MethodPost,
+		h.api("UploadAttachment", issuePath(issueKeyOrID)+"/attachments"), nil, body,
+		http.Header{
+			"Content-Type":      []string{form.FormDataContentType()},
+			"X-Atlassian-Token": []string{"no-check"},
+		})
+	if err != nil {
+		return nil, fmt.Errorf("uploading attachment %s: %w", filename, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("uploading attachment %s: %w", filename,
+			&UnexpectedResponse{obtained: resp.StatusCode, expected: []int{http.StatusOK}})
+	}
+	var attachments []Attachment
+	if err := TypeFromResponse(resp, &attachments); err != nil {
+		return nil, fmt.Errorf("uploading attachment %s: %w", filename, err)
+	}
+	return attachments, nil
+}
+
+// DownloadAttachment copies the content of the attachment with the passed id into w, through the
+// attachment interceptors, and returns its metadata.
+// Bear in mind that w may have received part of the content when an interceptor refuses it while
+// it is being read.
+func (h *HostClient) DownloadAttachment(attachmentID string, w io.Writer) (*AttachmentMetadata, error) {
+	meta := &AttachmentMetadata{}
+	_, err := h.DoWithTarget(http.MethodGet,
+		h.api("DownloadAttachment", "/rest/api/3/attachment/"+url.PathEscape(attachmentID)), nil, nil,
+		meta, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading attachment %s metadata: %w", attachmentID, err)
+	}
+	resp, err := h.DoWithHeaders(http.MethodGet,
+		h.api("DownloadAttachment", "/rest/api/3/attachment/content/"+url.PathEscape(attachmentID)), nil, nil, http.Header{"Accept": []string{"*/*"}})
+	if err != nil {
+		return nil, fmt.Errorf("downloading attachment %s: %w", attachmentID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading attachment %s: %w", attachmentID,
+			&UnexpectedResponse{obtained: resp.StatusCode, expected: []int{http.StatusOK}})
+	}
+	content, err := h.intercept(&AttachmentInfo{
+		Direction:    AttachmentDownload,
+		AttachmentID: attachmentID,
+		Filename:     meta.Filename,
+		MimeType:     meta.MimeType,
+		Size:         meta.Size,
+	}, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		return nil, fmt.Errorf("downloading attachment %s: %w", attachmentID, err)
+	}
+	return meta, nil
+}
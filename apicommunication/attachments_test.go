@@ -0,0 +1,155 @@
+package apicommunication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttachmentInterceptors(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/3/attachment/10000":
+			fmt.Fprint(w, `{"id": 10000, "filename": "report.txt", "mimeType": "text/plain", "size": 12}`)
+		case "/rest/api/3/attachment/content/10000":
+			fmt.Fprint(w, "EICAR-STRING")
+		case "/rest/api/3/issue/KEY-1/attachments":
+			if r.Header.Get("X-Atlassian-Token") != "no-check" {
+				t.Error("missing XSRF header")
+			}
+			fmt.Fprint(w, `[{"id": "10001", "filename": "clean.txt"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+
+	var scanned []string
+	scanner := func(info *AttachmentInfo, content io.Reader) (io.Reader, error) {
+		b, err := ioutil.ReadAll(content)
+		if err != nil {
+			return nil, err
+		}
+		scanned = append(scanned, info.Filename)
+		if strings.Contains(string(b), "EICAR") {
+			return nil, errors.New("malware found")
+		}
+		return bytes.NewReader(b), nil
+	}
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport,
+		WithAttachmentInterceptors(MaxAttachmentSize(64), scanner))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if _, err := hc.DownloadAttachment("10000", out); !errors.Is(err, ErrAttachmentRejected) {
+		t.Fatalf("infected download returned %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("infected content was written: %q", out.String())
+	}
+	attachments, err := hc.UploadAttachment("KEY-1", "clean.txt", strings.NewReader("all good"))
+	if err != nil || len(attachments) != 1 {
+		t.Fatalf("clean upload returned %v, %v", attachments, err)
+	}
+	_, err = hc.UploadAttachment("KEY-1", "big.txt", strings.NewReader(strings.Repeat("x", 65)))
+	if !errors.Is(err, ErrAttachmentRejected) {
+		t.Fatalf("oversized upload returned %v", err)
+	}
+	if len(scanned) != 2 || scanned[0] != "report.txt" || scanned[1] != "clean.txt" {
+		t.Fatalf("scanned %v", scanned)
+	}
+}
+
+func TestHostClient_UploadLargeAttachment(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var mu sync.Mutex
+	stored := map[string][]byte{}
+	var posts, deletes int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/3/issue/PRJ-1":
+			var attachments []Attachment
+			for id, data := range stored {
+				attachments = append(attachments, Attachment{ID: id, Filename: "dump.bin", Size: int64(len(data))})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"fields": map[string]interface{}{"attachment": attachments}})
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/3/issue/PRJ-1/attachments":
+			posts++
+			if posts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(file)
+			id := fmt.Sprint(10000 + posts)
+			if posts == 2 {
+				// same size, different content.
+				data = bytes.ToUpper(data)
+				data[0] = 'x'
+			}
+			stored[id] = data
+			if posts == 3 {
+				// the upload landed but the response is lost.
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			json.NewEncoder(w).Encode([]Attachment{{ID: id, Filename: "dump.bin", Size: int64(len(data))}})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/rest/api/3/attachment/content/"):
+			w.Write(stored[strings.TrimPrefix(r.URL.Path, "/rest/api/3/attachment/content/")])
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/rest/api/3/attachment/"):
+			deletes++
+			delete(stored, strings.TrimPrefix(r.URL.Path, "/rest/api/3/attachment/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := LargeUploadOptions{Attempts: 3, RetryBackoff: time.Millisecond, VerifyChecksum: true, TempDir: t.TempDir()}
+	attachments, err := hc.UploadLargeAttachment(context.Background(), "PRJ-1", "dump.bin", bytes.NewReader(content), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 || attachments[0].ID != "10003" || !bytes.Equal(stored["10003"], content) {
+		t.Fatalf("uploaded %+v", attachments)
+	}
+	if posts != 3 || deletes != 1 || len(stored) != 1 {
+		t.Fatalf("%d uploads, %d deletes, %d attachments", posts, deletes, len(stored))
+	}
+	if spooled, _ := ioutil.ReadDir(opts.TempDir); len(spooled) != 0 {
+		t.Fatalf("left %d spooled files behind", len(spooled))
+	}
+
+	opts.MaxSize = int64(len(content)) - 1
+	_, err = hc.UploadLargeAttachment(context.Background(), "PRJ-1", "dump.bin", bytes.NewReader(content), opts)
+	if !errors.Is(err, ErrAttachmentRejected) {
+		t.Fatalf("oversized upload returned %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package apicommunication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+type singleTenantStore struct {
+	jii *storage.JiraInstallInformation
+}
+
+func (s *singleTenantStore) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	s.jii = jii
+	return nil
+}
+
+func (s *singleTenantStore) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	if s.jii == nil || s.jii.ClientKey != clientKey {
+		return nil, nil
+	}
+	return s.jii, nil
+}
+
+var benchTenant = &storage.JiraInstallInformation{
+	Key:          "io.shiftleft.bench",
+	ClientKey:    "bench",
+	SharedSecret: "kiasjhdkajhdkajshdkiasjhdkajhdkajshd",
+	BaseURL:      "https://bench.atlassian.net",
+	ProductType:  ProductTypeJira,
+}
+
+func signedBenchRequest(b testing.TB) *http.Request {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": benchTenant.ClientKey,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"qsh": "somehash",
+	}).SignedString([]byte(benchTenant.SharedSecret))
+	if err != nil {
+		b.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	req.Header.Set("Authorization", "JWT "+token)
+	return req
+}
+
+// validateRequestAllocBudget is the allocation budget of ValidateRequest, raise it consciously.
+const validateRequestAllocBudget = 50
+
+func TestValidateRequestAllocations(t *testing.T) {
+	st := &singleTenantStore{jii: benchTenant}
+	req := signedBenchRequest(t)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := ValidateRequest(req, st); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > validateRequestAllocBudget {
+		t.Fatalf("ValidateRequest allocates %.0f times per call, the budget is %d", allocs, validateRequestAllocBudget)
+	}
+}
+
+func BenchmarkValidateRequest(b *testing.B) {
+	st := &singleTenantStore{jii: benchTenant}
+	req := signedBenchRequest(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ValidateRequest(req, st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDoWithTarget(b *testing.B) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": "10000", "key": "KEY-1", "fields": {"summary": "a summary"}}`)
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target := map[string]interface{}{}
+		if _, err := hc.DoWithTarget(http.MethodGet, "/rest/api/3/issue/KEY-1", nil, nil, &target, []int{http.StatusOK}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
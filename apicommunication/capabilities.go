@@ -0,0 +1,157 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	serverInfoPath      = "/rest/api/3/serverInfo"
+	applicationRolePath = "/rest/api/3/applicationrole"
+	agileProbePath      = "/rest/agile/1.0/board"
+	serviceDeskInfoPath = "/rest/servicedeskapi/info"
+)
+
+// Application role keys of the jira products a tenant can have.
+const (
+	ApplicationJiraSoftware          = "jira-software"
+	ApplicationJiraServiceManagement = "jira-servicedesk"
+	ApplicationJiraWorkManagement    = "jira-core"
+	ApplicationJiraProductDiscovery  = "jira-product-discovery"
+)
+
+// Capabilities describes what a tenant offers so apps can degrade gracefully across tenant types.
+type Capabilities struct {
+	// DeploymentType is Cloud, Server or DataCenter.
+	DeploymentType string
+	Version        string
+	VersionNumbers []int64
+	// Applications holds the keys of the jira products the tenant has.
+	Applications map[string]bool
+	// APIVersion is the latest version of the platform REST API the tenant serves.
+	APIVersion int
+}
+
+// IsCloud returns true for jira cloud tenants.
+func (c *Capabilities) IsCloud() bool {
+	return strings.EqualFold(c.DeploymentType, "Cloud")
+}
+
+// HasSoftware returns true if the tenant has jira software, and thus the agile API.
+func (c *Capabilities) HasSoftware() bool {
+	return c.Applications[ApplicationJiraSoftware]
+}
+
+// HasServiceManagement returns true if the tenant has jira service management, and thus the
+// service desk API.
+func (c *Capabilities) HasServiceManagement() bool {
+	return c.Applications[ApplicationJiraServiceManagement]
+}
+
+// VersionAtLeast returns true if the tenant version is the passed one or later, ie
+// VersionAtLeast(8, 14) for 8.14.0 and later.
+func (c *Capabilities) VersionAtLeast(numbers ...int64) bool {
+	for i, n := range numbers {
+		var have int64
+		if i < len(c.VersionNumbers) {
+			have = c.VersionNumbers[i]
+		}
+		if have != n {
+			return have > n
+		}
+	}
+	return true
+}
+
+// ServerInfo returns the version and deployment information of the tenant.
+func (h *HostClient) ServerInfo() (*ServerInformation, error) {
+	return h.ServerInfoCtx(context.Background())
+}
+
+// ServerInfoCtx behaves like ServerInfo bound to ctx, see DoCtx.
+func (h *HostClient) ServerInfoCtx(ctx context.Context) (*ServerInformation, error) {
+	info := &ServerInformation{}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("ServerInfo", serverInfoPath), nil, nil, info, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading server info: %w", err)
+	}
+	return info, nil
+}
+
+// ApplicationRoles returns the application roles, one per jira product, of the tenant, the app
+// needs the ADMIN scope to read them.
+func (h *HostClient) ApplicationRoles() ([]ApplicationRole, error) {
+	return h.ApplicationRolesCtx(context.Background())
+}
+
+// ApplicationRolesCtx behaves like ApplicationRoles bound to ctx, see DoCtx.
+func (h *HostClient) ApplicationRolesCtx(ctx context.Context) ([]ApplicationRole, error) {
+	var roles []ApplicationRole
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("ApplicationRoles", applicationRolePath), nil, nil, &roles, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading application roles: %w", err)
+	}
+	return roles, nil
+}
+
+// DetectCapabilities reads the server info and application roles of the tenant, if the app can not
+// read the roles the products are detected probing their APIs instead.
+func (h *HostClient) DetectCapabilities() (*Capabilities, error) {
+	return h.DetectCapabilitiesCtx(context.Background())
+}
+
+// DetectCapabilitiesCtx behaves like DetectCapabilities bound to ctx, see DoCtx.
+func (h *HostClient) DetectCapabilitiesCtx(ctx context.Context) (*Capabilities, error) {
+	info, err := h.ServerInfoCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &Capabilities{
+		DeploymentType: info.DeploymentType,
+		Version:        info.Version,
+		VersionNumbers: info.VersionNumbers,
+		Applications:   map[string]bool{},
+		APIVersion:     2,
+	}
+	if c.IsCloud() {
+		c.APIVersion = 3
+	}
+	roles, err := h.ApplicationRolesCtx(ctx)
+	if err == nil {
+		for _, role := range roles {
+			c.Applications[role.Key] = true
+		}
+		return c, nil
+	}
+	if !IsUnexpectedResponse(err) {
+		return nil, err
+	}
+	for application, probe := range map[string]string{
+		ApplicationJiraSoftware:          agileProbePath,
+		ApplicationJiraServiceManagement: serviceDeskInfoPath,
+	} {
+		code, err := h.DoWithTargetCtx(ctx, http.MethodGet, probe, map[string]string{"maxResults": "0"}, nil, nil,
+			[]int{http.StatusOK})
+		if err != nil && !IsUnexpectedResponse(err) {
+			return nil, fmt.Errorf("probing %s: %w", application, err)
+		}
+		c.Applications[application] = code == http.StatusOK
+	}
+	return c, nil
+}
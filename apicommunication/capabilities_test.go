@@ -0,0 +1,82 @@
+package apicommunication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// capabilitiesServer serves a tenant with the passed server info and application roles, roles
+// are forbidden if empty and only the probes of the products in probes answer.
+func capabilitiesServer(serverInfo, roles string, probes map[string]bool) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case serverInfoPath:
+			w.Write([]byte(serverInfo))
+		case applicationRolePath:
+			if roles == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(roles))
+		case agileProbePath, serviceDeskInfoPath:
+			if !probes[r.URL.Path] {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestHostClient_DetectCapabilities(t *testing.T) {
+	detect := func(srv *httptest.Server) *Capabilities {
+		defer srv.Close()
+		tenant := *benchTenant
+		tenant.BaseURL = srv.URL
+		hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := hc.DetectCapabilities()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	cloud := detect(capabilitiesServer(
+		`{"deploymentType":"Cloud","version":"1001.0.0","versionNumbers":[1001,0,0]}`,
+		`[{"key":"jira-software"},{"key":"jira-core"}]`, nil))
+	if !cloud.IsCloud() || cloud.APIVersion != 3 || !cloud.HasSoftware() || cloud.HasServiceManagement() ||
+		!cloud.Applications[ApplicationJiraWorkManagement] {
+		t.Fatalf("detected %+v for a cloud tenant", cloud)
+	}
+
+	// the app can not read the roles of this tenant, products are probed.
+	server := detect(capabilitiesServer(
+		`{"deploymentType":"Server","version":"8.14.1","versionNumbers":[8,14,1]}`, "",
+		map[string]bool{serviceDeskInfoPath: true}))
+	if server.IsCloud() || server.APIVersion != 2 || server.HasSoftware() || !server.HasServiceManagement() {
+		t.Fatalf("detected %+v for a server tenant", server)
+	}
+	for _, tc := range []struct {
+		version []int64
+		want    bool
+	}{
+		{[]int64{8}, true},
+		{[]int64{8, 14}, true},
+		{[]int64{8, 14, 1}, true},
+		{[]int64{8, 14, 2}, false},
+		{[]int64{8, 15}, false},
+		{[]int64{9}, false},
+		{[]int64{7, 20}, true},
+	} {
+		if got := server.VersionAtLeast(tc.version...); got != tc.want {
+			t.Errorf("8.14.1 at least %v is %v", tc.version, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// ClientManager hands HostClients for tenants, building them from the install information in the
+// store the first time they are requested and reusing them afterwards.
+type ClientManager struct {
+	ctx     context.Context
+	store   storage.Store
+	scopes  []string
+	opts    []HostClientOption
+	mu      sync.Mutex
+	clients map[string]*HostClient
+}
+
+// NewClientManager returns a ClientManager that builds clients with the passed context, scopes and options.
+func NewClientManager(ctx context.Context, st storage.Store, scopes []string, opts ...HostClientOption) *ClientManager {
+	return &ClientManager{
+		ctx:     ctx,
+		store:   st,
+		scopes:  scopes,
+		opts:    opts,
+		clients: map[string]*HostClient{},
+	}
+}
+
+// Client returns the HostClient for the tenant with the passed client key.
+func (m *ClientManager) Client(clientKey string) (*HostClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hc, ok := m.clients[clientKey]; ok {
+		return hc, nil
+	}
+	jii, err := LoadInstallInformation(m.store, clientKey)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := NewHostClient(m.ctx, jii, "", m.scopes, m.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating host client for %s: %w", clientKey, err)
+	}
+	m.clients[clientKey] = hc
+	return hc, nil
+}
+
+// Forget drops the cached client for the tenant, call it when its install information changes.
+func (m *ClientManager) Forget(clientKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clients, clientKey)
+}
@@ -0,0 +1,53 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// NewPATClient returns a client for the instance at baseURL authenticated with a personal access
+// token, it needs no connect install so internal tooling can use the typed methods too.
+// Pass WithDataCenter for jira server and data center instances.
+func NewPATClient(baseURL, token string, opts ...HostClientOption) (*HostClient, error) {
+	if token == "" {
+		return nil, fmt.Errorf("personal access token must not be blank")
+	}
+	return newCredentialsClient(context.Background(), baseURL, bearerAuth(token), defaultJiraTransport, opts...)
+}
+
+// NewBasicAuthClient returns a client for the instance at baseURL authenticated with basic auth,
+// in jira cloud username is the email of the account and password one of its API tokens.
+// Pass WithDataCenter for jira server and data center instances.
+func NewBasicAuthClient(baseURL, username, password string, opts ...HostClientOption) (*HostClient, error) {
+	if username == "" {
+		return nil, fmt.Errorf("username must not be blank")
+	}
+	return newCredentialsClient(context.Background(), baseURL, basicAuth(username, password), defaultJiraTransport, opts...)
+}
+
+func bearerAuth(token string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func basicAuth(username, password string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.SetBasicAuth(username, password)
+	}
+}
@@ -0,0 +1,237 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// DefaultCursorPageSize is the page size used by IssueCursor if none is set.
+const DefaultCursorPageSize = 50
+
+// CursorState is the progress of an IssueCursor for a tenant, it is persisted as JSON in the tenant
+// settings after every page.
+type CursorState struct {
+	// UpdatedSince is the updated timestamp of the last issue processed.
+	UpdatedSince time.Time `json:"updatedSince"`
+	// SeenIDs holds the IDs of the processed issues updated exactly at UpdatedSince, they are
+	// skipped when the sync resumes.
+	SeenIDs []string `json:"seenIds,omitempty"`
+}
+
+// IssueCursor syncs the issues matching a JQL query in updated order, persisting its progress in the
+// store so jobs can be stopped at any point and resumed later, or run periodically to get the issues
+// updated since the last run.
+// Processing is at least once, the function passed to Run should be idempotent.
+type IssueCursor struct {
+	// Name identifies the cursor in the tenant settings, it must be unique per sync job.
+	Name string
+	// JQL restricts the issues synced, it must not contain an ORDER BY clause.
+	JQL string
+	// Fields restricts the returned fields, leave it empty to get jira's defaults, "updated" is
+	// always requested.
+	Fields   []string
+	PageSize int64
+	// Overlap is subtracted from the progress when querying, JQL dates have minute precision and are
+	// interpreted in the timezone of the app user, so set it to the offset of that timezone from the
+	// one of the timestamps jira returns if they might differ. Already processed issues are skipped.
+	Overlap time.Duration
+	// PageDelay is waited between pages to stay below the tenant rate limits, rate limited searches
+	// are retried as the RateLimitPolicy of the client says, see WithRateLimitPolicy.
+	PageDelay time.Duration
+	Settings  storage.TenantSettings
+}
+
+func (c *IssueCursor) settingKey() string {
+	return "cursor." + c.Name
+}
+
+// State returns the progress persisted for the tenant, which is empty if the cursor never ran.
+func (c *IssueCursor) State(clientKey string) (*CursorState, error) {
+	raw, err := c.Settings.GetSetting(clientKey, c.settingKey())
+	if err != nil {
+		return nil, fmt.Errorf("reading cursor %s: %w", c.Name, err)
+	}
+	state := &CursorState{}
+	if raw == "" {
+		return state, nil
+	}
+	if err := json.Unmarshal([]byte(raw), state); err != nil {
+		return nil, fmt.Errorf("decoding cursor %s: %w", c.Name, err)
+	}
+	return state, nil
+}
+
+// SaveState persists state as the progress for the tenant, ie to start syncing from a given time.
+func (c *IssueCursor) SaveState(clientKey string, state *CursorState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding cursor %s: %w", c.Name, err)
+	}
+	if err := c.Settings.SetSetting(clientKey, c.settingKey(), string(raw)); err != nil {
+		return fmt.Errorf("saving cursor %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// Reset discards the progress for the tenant so the next Run starts from the beginning.
+func (c *IssueCursor) Reset(clientKey string) error {
+	return c.SaveState(clientKey, &CursorState{})
+}
+
+// Run invokes f for each issue updated since the persisted progress of the tenant h talks to, it
+// returns the number of issues processed. Progress is saved after each page and when f or a request
+// fails, so calling Run again resumes from the last processed issue.
+func (c *IssueCursor) Run(ctx context.Context, h *HostClient, f func(issue *IssueBean) error) (int, error) {
+	clientKey := h.Config.ClientKey
+	state, err := c.State(clientKey)
+	if err != nil {
+		return 0, err
+	}
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultCursorPageSize
+	}
+	fields := c.Fields
+	if len(fields) > 0 {
+		fields = append(append([]string{}, fields...), "updated")
+	}
+
+	var processed int
+	dirty := false
+	save := func() error {
+		if !dirty {
+			return nil
+		}
+		dirty = false
+		return c.SaveState(clientKey, state)
+	}
+
+	// the query is rebuilt from the progress whenever it moves to a later minute, so issues updated
+	// while syncing don't shift the pages, within the same minute pagination uses offsets.
+	var queryFrom time.Time
+	var startAt int64
+	for first := true; ; first = false {
+		if !first && c.PageDelay > 0 {
+			if err := sleepCtx(ctx, c.PageDelay); err != nil {
+				return processed, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		from := state.UpdatedSince.Add(-c.Overlap).Truncate(time.Minute)
+		if first || from.After(queryFrom) {
+			queryFrom, startAt = from, 0
+		}
+		page, err := h.SearchIssuesCtx(ctx, c.query(state.UpdatedSince, queryFrom), startAt, pageSize, fields)
+		if err != nil {
+			if saveErr := save(); saveErr != nil {
+				return processed, saveErr
+			}
+			return processed, err
+		}
+		for i := range page.Issues {
+			issue := &page.Issues[i]
+			updated, err := issueUpdated(issue)
+			if err != nil {
+				return processed, err
+			}
+			if state.seen(issue.ID, updated) {
+				continue
+			}
+			if err := f(issue); err != nil {
+				if saveErr := save(); saveErr != nil {
+					return processed, saveErr
+				}
+				return processed, fmt.Errorf("processing issue %s: %w", issue.Key, err)
+			}
+			state.advance(issue.ID, updated)
+			dirty = true
+			processed++
+		}
+		if err := save(); err != nil {
+			return processed, err
+		}
+		startAt += int64(len(page.Issues))
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			return processed, nil
+		}
+	}
+}
+
+// query returns the JQL for the issues updated from the passed minute on.
+func (c *IssueCursor) query(since, from time.Time) string {
+	jql := c.JQL
+	if !since.IsZero() {
+		updated := fmt.Sprintf(`updated >= "%s"`, JQLTime(from))
+		if jql == "" {
+			jql = updated
+		} else {
+			jql = "(" + jql + ") AND " + updated
+		}
+	}
+	return jql + " ORDER BY updated ASC, key ASC"
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// issueUpdated returns the updated field of issue.
+func issueUpdated(issue *IssueBean) (time.Time, error) {
+	raw, _ := issue.Fields["updated"].(string)
+	updated, err := time.Parse(JiraTimeLayout, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading updated of issue %s: %w", issue.Key, err)
+	}
+	return updated, nil
+}
+
+// seen returns true if the issue with the passed id and updated time was already processed.
+func (s *CursorState) seen(id string, updated time.Time) bool {
+	if updated.Before(s.UpdatedSince) {
+		return true
+	}
+	if !updated.Equal(s.UpdatedSince) {
+		return false
+	}
+	for _, seen := range s.SeenIDs {
+		if seen == id {
+			return true
+		}
+	}
+	return false
+}
+
+// advance records the issue with the passed id and updated time as processed.
+func (s *CursorState) advance(id string, updated time.Time) {
+	if updated.After(s.UpdatedSince) {
+		s.UpdatedSince, s.SeenIDs = updated, nil
+	}
+	s.SeenIDs = append(s.SeenIDs, id)
+}
@@ -0,0 +1,109 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type settingsMap struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (s *settingsMap) GetSetting(clientKey, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[clientKey+"/"+key], nil
+}
+
+func (s *settingsMap) SetSetting(clientKey, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[clientKey+"/"+key] = value
+	return nil
+}
+
+func TestIssueCursor(t *testing.T) {
+	issues := []map[string]interface{}{
+		{"id": "1", "key": "KEY-1", "fields": map[string]interface{}{"updated": "2020-04-30T15:04:05.000+0000"}},
+		{"id": "2", "key": "KEY-2", "fields": map[string]interface{}{"updated": "2020-04-30T15:04:05.000+0000"}},
+		{"id": "3", "key": "KEY-3", "fields": map[string]interface{}{"updated": "2020-04-30T15:05:00.000+0000"}},
+	}
+	var requests int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		search := SearchRequestBean{}
+		if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+			t.Fatal(err)
+		}
+		end := search.StartAt + search.MaxResults
+		if end > int64(len(issues)) {
+			end = int64(len(issues))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":  len(issues),
+			"issues": issues[search.StartAt:end],
+		})
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport,
+		WithRateLimitPolicy(RateLimitPolicy{Retries: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := &IssueCursor{
+		Name:     "sync",
+		JQL:      "project = KEY",
+		PageSize: 2,
+		Settings: &settingsMap{m: map[string]string{}},
+	}
+
+	// the first run fails processing KEY-2, KEY-1 must not be processed again
+	var got []string
+	_, err = cursor.Run(context.Background(), hc, func(issue *IssueBean) error {
+		if issue.Key == "KEY-2" && len(got) == 1 {
+			return errors.New("failed")
+		}
+		got = append(got, issue.Key)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the processing error")
+	}
+	n, err := cursor.Run(context.Background(), hc, func(issue *IssueBean) error {
+		got = append(got, issue.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(got) != 3 || got[0] != "KEY-1" || got[1] != "KEY-2" || got[2] != "KEY-3" {
+		t.Fatalf("processed %d, %v", n, got)
+	}
+	n, err = cursor.Run(context.Background(), hc, func(issue *IssueBean) error {
+		t.Errorf("%s processed again", issue.Key)
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("processed %d again, %v", n, err)
+	}
+	state, err := cursor.State(tenant.ClientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.SeenIDs) != 1 || state.SeenIDs[0] != "3" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
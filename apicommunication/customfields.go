@@ -0,0 +1,154 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Custom field types, as found in the schema.custom attribute of fields returned by /rest/api/3/field.
+const (
+	CustomFieldCascadingSelect = "com.atlassian.jira.plugin.system.customfieldtypes:cascadingselect"
+	CustomFieldSelect          = "com.atlassian.jira.plugin.system.customfieldtypes:select"
+	CustomFieldMultiSelect     = "com.atlassian.jira.plugin.system.customfieldtypes:multiselect"
+	CustomFieldUserPicker      = "com.atlassian.jira.plugin.system.customfieldtypes:userpicker"
+	CustomFieldMultiUserPicker = "com.atlassian.jira.plugin.system.customfieldtypes:multiuserpicker"
+	CustomFieldTextField       = "com.atlassian.jira.plugin.system.customfieldtypes:textfield"
+	CustomFieldFloat           = "com.atlassian.jira.plugin.system.customfieldtypes:float"
+	CustomFieldURL             = "com.atlassian.jira.plugin.system.customfieldtypes:url"
+	CustomFieldLabels          = "com.atlassian.jira.plugin.system.customfieldtypes:labels"
+	CustomFieldDatePicker      = "com.atlassian.jira.plugin.system.customfieldtypes:datepicker"
+	CustomFieldDateTime        = "com.atlassian.jira.plugin.system.customfieldtypes:datetime"
+	CustomFieldSprint          = "com.pyxis.greenhopper.jira:gh-sprint"
+)
+
+// FieldOption is the value of select like custom fields.
+type FieldOption struct {
+	ID    string `json:"id,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// CascadingSelectValue is the value of cascading select custom fields, Child is the option chosen
+// in the second level, if any.
+type CascadingSelectValue struct {
+	FieldOption
+	Child *FieldOption `json:"child,omitempty"`
+}
+
+// UserValue is the value of user picker custom fields, only AccountID is used when writing.
+type UserValue struct {
+	AccountID   string `json:"accountId"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// SprintValue is a sprint as read from the sprint custom field.
+type SprintValue struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name,omitempty"`
+	State     string `json:"state,omitempty"`
+	BoardID   int    `json:"boardId,omitempty"`
+	StartDate *Time  `json:"startDate,omitempty"`
+	EndDate   *Time  `json:"endDate,omitempty"`
+}
+
+// CustomFieldCodec describes how the values of a custom field type are read and written.
+type CustomFieldCodec struct {
+	// Type is the go type values of the field decode to.
+	Type reflect.Type
+	// Encode converts a value of Type to what the API expects when writing the field, if nil values
+	// are written as they are read.
+	Encode func(v interface{}) (interface{}, error)
+}
+
+var (
+	customFieldCodecsMu sync.RWMutex
+	customFieldCodecs   = map[string]CustomFieldCodec{
+		CustomFieldCascadingSelect: {Type: reflect.TypeOf(CascadingSelectValue{})},
+		CustomFieldSelect:          {Type: reflect.TypeOf(FieldOption{})},
+		CustomFieldMultiSelect:     {Type: reflect.TypeOf([]FieldOption{})},
+		CustomFieldUserPicker:      {Type: reflect.TypeOf(UserValue{})},
+		CustomFieldMultiUserPicker: {Type: reflect.TypeOf([]UserValue{})},
+		CustomFieldTextField:       {Type: reflect.TypeOf("")},
+		CustomFieldFloat:           {Type: reflect.TypeOf(float64(0))},
+		CustomFieldURL:             {Type: reflect.TypeOf("")},
+		CustomFieldLabels:          {Type: reflect.TypeOf([]string{})},
+		CustomFieldDatePicker:      {Type: reflect.TypeOf(Date{})},
+		CustomFieldDateTime:        {Type: reflect.TypeOf(Time{})},
+		// the sprint field reads as every sprint the issue was in but is written with a sprint id.
+		CustomFieldSprint: {
+			Type: reflect.TypeOf([]SprintValue{}),
+			Encode: func(v interface{}) (interface{}, error) {
+				sprints := v.([]SprintValue)
+				if len(sprints) == 0 {
+					return nil, nil
+				}
+				return sprints[len(sprints)-1].ID, nil
+			},
+		},
+	}
+)
+
+// RegisterCustomFieldCodec registers, or replaces, the codec of a custom field type, so apps can
+// support the custom fields of marketplace apps.
+func RegisterCustomFieldCodec(fieldType string, codec CustomFieldCodec) {
+	customFieldCodecsMu.Lock()
+	defer customFieldCodecsMu.Unlock()
+	customFieldCodecs[fieldType] = codec
+}
+
+func customFieldCodec(fieldType string) (CustomFieldCodec, error) {
+	customFieldCodecsMu.RLock()
+	defer customFieldCodecsMu.RUnlock()
+	codec, ok := customFieldCodecs[fieldType]
+	if !ok {
+		return CustomFieldCodec{}, fmt.Errorf("there is no codec for custom field type %s", fieldType)
+	}
+	return codec, nil
+}
+
+// DecodeCustomField decodes raw, the value of a custom field of the passed type, into target which
+// must be a pointer to the type of the field codec.
+func DecodeCustomField(fieldType string, raw json.RawMessage, target interface{}) error {
+	codec, err := customFieldCodec(fieldType)
+	if err != nil {
+		return err
+	}
+	if t := reflect.TypeOf(target); t == nil || t.Kind() != reflect.Ptr || t.Elem() != codec.Type {
+		return fmt.Errorf("values of %s decode into *%s, not %T", fieldType, codec.Type, target)
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("decoding %s value: %w", fieldType, err)
+	}
+	return nil
+}
+
+// EncodeCustomField returns what must be sent to the API to set a custom field of the passed type
+// to v, which must be of the type of the field codec.
+func EncodeCustomField(fieldType string, v interface{}) (interface{}, error) {
+	codec, err := customFieldCodec(fieldType)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.TypeOf(v) != codec.Type {
+		return nil, fmt.Errorf("values of %s are %s, not %T", fieldType, codec.Type, v)
+	}
+	if codec.Encode == nil {
+		return v, nil
+	}
+	return codec.Encode(v)
+}
@@ -0,0 +1,34 @@
+package apicommunication
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCustomFieldCodecs(t *testing.T) {
+	var cascading CascadingSelectValue
+	raw := json.RawMessage(`{"id":"1","value":"Hardware","child":{"id":"2","value":"Keyboard"}}`)
+	if err := DecodeCustomField(CustomFieldCascadingSelect, raw, &cascading); err != nil {
+		t.Fatal(err)
+	}
+	if cascading.Value != "Hardware" || cascading.Child == nil || cascading.Child.Value != "Keyboard" {
+		t.Fatalf("decoded %+v", cascading)
+	}
+	var wrong []UserValue
+	if err := DecodeCustomField(CustomFieldCascadingSelect, raw, &wrong); err == nil {
+		t.Fatal("decoded a cascading select into users")
+	}
+
+	var sprints []SprintValue
+	raw = json.RawMessage(`[{"id":1,"name":"S1","state":"closed"},{"id":2,"name":"S2","state":"active"}]`)
+	if err := DecodeCustomField(CustomFieldSprint, raw, &sprints); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := EncodeCustomField(CustomFieldSprint, sprints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded != 2 {
+		t.Fatalf("sprint field encoded as %v", encoded)
+	}
+}
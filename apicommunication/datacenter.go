@@ -0,0 +1,140 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// DataCenterCredentials authenticate calls to a jira server or data center instance, Token is a
+// personal access token and takes precedence over Username and Password, which use basic auth.
+type DataCenterCredentials struct {
+	Username string
+	Password string
+	Token    string
+}
+
+func (c DataCenterCredentials) authorize() func(*http.Request) {
+	if c.Token != "" {
+		return bearerAuth(c.Token)
+	}
+	return basicAuth(c.Username, c.Password)
+}
+
+// WithDataCenter makes the client talk to jira server or data center instead of jira cloud, the
+// typed methods default to version 2 of the REST API, which is the only one data center has, and
+// identify users by username rather than account ID. Impersonation is not available.
+func WithDataCenter() HostClientOption {
+	return func(h *HostClient) {
+		h.dataCenter = true
+	}
+}
+
+// DataCenter returns true if the client talks to jira server or data center, see WithDataCenter.
+func (h *HostClient) DataCenter() bool {
+	return h.dataCenter
+}
+
+// NewDataCenterClient returns a client for the jira server or data center instance at baseURL,
+// it shares the typed methods of the jira cloud clients, see WithDataCenter.
+func NewDataCenterClient(ctx context.Context, baseURL string, credentials DataCenterCredentials,
+	opts ...HostClientOption) (*HostClient, error) {
+	return NewDataCenterClientWithRoundtripper(ctx, baseURL, credentials, defaultJiraTransport, opts...)
+}
+
+// NewDataCenterClientWithRoundtripper is the same as NewDataCenterClient but allows the caller to
+// specify a custom transport.
+func NewDataCenterClientWithRoundtripper(ctx context.Context, baseURL string, credentials DataCenterCredentials,
+	roundtripper http.RoundTripper, opts ...HostClientOption) (*HostClient, error) {
+	if credentials.Token == "" && credentials.Username == "" {
+		return nil, fmt.Errorf("data center credentials need either a token or a username")
+	}
+	return newCredentialsClient(ctx, baseURL, credentials.authorize(), roundtripper,
+		append([]HostClientOption{WithDataCenter()}, opts...)...)
+}
+
+// newCredentialsClient returns a client for the instance at baseURL whose requests are authorized
+// by authorize rather than signed with the secret of a connect install.
+func newCredentialsClient(ctx context.Context, baseURL string, authorize func(*http.Request),
+	roundtripper http.RoundTripper, opts ...HostClientOption) (*HostClient, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	if base.Host == "" {
+		return nil, fmt.Errorf("base URL %q is not absolute", baseURL)
+	}
+	hostClient := &HostClient{
+		ctx: ctx,
+		// there is no install so the instance is its own client key, ie for UsageStats.
+		Config: &storage.JiraInstallInformation{
+			ClientKey:   baseURL,
+			BaseURL:     baseURL,
+			ProductType: ProductTypeJira,
+		},
+		baseURL:      baseURL,
+		roundtripper: roundtripper,
+		opts:         opts,
+		localCache:   map[string]*HostClient{},
+	}
+	for _, opt := range opts {
+		opt(hostClient)
+	}
+	if err := hostClient.checkBaseURL(); err != nil {
+		return nil, err
+	}
+	roundtripper, err = hostClient.proxiedRoundtripper(roundtripper)
+	if err != nil {
+		return nil, err
+	}
+	if roundtripper == nil {
+		roundtripper = http.DefaultTransport
+	}
+	hostClient.client = &http.Client{
+		Transport: &credentialsTransport{
+			host:      base.Host,
+			authorize: authorize,
+			transport: roundtripper,
+		},
+		CheckRedirect: hostClient.checkRedirect,
+		Timeout:       hostClient.profile.Timeout,
+	}
+	return hostClient, nil
+}
+
+// credentialsTransport authorizes requests to host, credentials are not sent to other hosts
+// we may be redirected to.
+type credentialsTransport struct {
+	host      string
+	authorize func(*http.Request)
+	transport http.RoundTripper
+}
+
+func (t *credentialsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(r.URL.Host, t.host) {
+		return t.transport.RoundTrip(r)
+	}
+	// RoundTrippers must not modify the request.
+	r = r.Clone(r.Context())
+	t.authorize(r)
+	return t.transport.RoundTrip(r)
+}
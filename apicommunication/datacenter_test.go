@@ -0,0 +1,66 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDataCenterClient_AssignIssue(t *testing.T) {
+	var assignee map[string]string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer pat" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPut || r.URL.Path != "/jira/rest/api/2/issue/KEY-1/assignee" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&assignee)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	hc, err := NewDataCenterClientWithRoundtripper(context.Background(), srv.URL+"/jira/",
+		DataCenterCredentials{Token: "pat"}, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hc.AssignIssue("KEY-1", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	if assignee["name"] != "jdoe" {
+		t.Fatalf("assigned %v", assignee)
+	}
+	if _, err := hc.AsUserByAccountID("someone"); err == nil {
+		t.Fatal("impersonating in data center succeeded")
+	}
+}
+
+func TestNewBasicAuthClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "api-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != fieldsPath {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]FieldDetails{{ID: "summary", Name: "Summary"}})
+	}))
+	defer srv.Close()
+	hc, err := NewBasicAuthClient(srv.URL, "bot@example.com", "api-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := hc.Fields()
+	if err != nil || len(fields) != 1 || fields[0].ID != "summary" {
+		t.Fatalf("listed %+v, %v", fields, err)
+	}
+	if _, err := NewPATClient(srv.URL, ""); err == nil {
+		t.Fatal("creating a client without token succeeded")
+	}
+}
@@ -0,0 +1,82 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	stderrors "errors"
+	"fmt"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	// ErrNoInstallInfo is returned when there is no install information for a tenant.
+	ErrNoInstallInfo = stderrors.New("no jira install information")
+	// ErrInvalidJWT is returned when a JWT is missing, malformed or its signature is not valid.
+	ErrInvalidJWT = stderrors.New("invalid jwt")
+	// ErrExpiredToken is returned when a JWT is past its expiration.
+	ErrExpiredToken = stderrors.New("expired jwt")
+	// ErrStoreUnavailable is returned when the store fails to answer.
+	ErrStoreUnavailable = stderrors.New("store unavailable")
+)
+
+// sentinelError wraps an error adding a sentinel to its chain, so both can be found with errors.Is.
+type sentinelError struct {
+	sentinel error
+	msg      string
+	err      error
+}
+
+func (e *sentinelError) Error() string {
+	if e.err == nil {
+		return storage.Redact(e.msg)
+	}
+	return storage.Redact(e.msg + ": " + e.err.Error())
+}
+
+func (e *sentinelError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.err
+}
+
+func wrapSentinel(sentinel, err error, format string, v ...interface{}) error {
+	return &sentinelError{sentinel: sentinel, msg: fmt.Sprintf(format, v...), err: err}
+}
+
+// tokenError wraps errors from the jwt package as ErrExpiredToken or ErrInvalidJWT.
+func tokenError(err error, msg string) error {
+	var vErr *jwt.ValidationError
+	if stderrors.As(err, &vErr) && vErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return wrapSentinel(ErrExpiredToken, err, msg)
+	}
+	return wrapSentinel(ErrInvalidJWT, err, msg)
+}
+
+// LoadInstallInformation reads the install information for clientKey from st, failing with
+// ErrStoreUnavailable or ErrNoInstallInfo as appropriate.
+func LoadInstallInformation(st storage.Store, clientKey string) (*storage.JiraInstallInformation, error) {
+	jii, err := st.JiraInstallInformation(clientKey)
+	if err != nil {
+		return nil, wrapSentinel(ErrStoreUnavailable, err, "reading jira install information from storage")
+	}
+	if jii == nil {
+		return nil, wrapSentinel(ErrNoInstallInfo, nil, "no jira install information for client key: %s", clientKey)
+	}
+	return jii, nil
+}
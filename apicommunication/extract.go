@@ -0,0 +1,94 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// TokenSource represents a place in a request where we look for a JWT, they can be combined
+// with | to accept more than one and are tried in the order they are declared.
+type TokenSource int
+
+const (
+	// TokenSourceQuery is the jwt query string argument, used by jira when loading iframes.
+	TokenSourceQuery TokenSource = 1 << iota
+	// TokenSourceJWTHeader is the `Authorization: JWT <token>` header, used by jira for webhooks
+	// and lifecycle events.
+	TokenSourceJWTHeader
+	// TokenSourceBearerHeader is the `Authorization: Bearer <token>` header, commonly used by
+	// front ends sending the context token obtained with AP.context.getToken().
+	TokenSourceBearerHeader
+	// TokenSourceCookie is a cookie named JWTCookieName.
+	TokenSourceCookie
+)
+
+// DefaultTokenSources are the sources ValidateRequest accepts.
+const DefaultTokenSources = TokenSourceQuery | TokenSourceJWTHeader
+
+// JWTCookieName is the name of the cookie read when TokenSourceCookie is accepted.
+const JWTCookieName = "jwt"
+
+// ExtractToken returns the first JWT found in the request among the passed sources.
+func ExtractToken(r *http.Request, sources TokenSource) (string, error) {
+	if sources&TokenSourceQuery != 0 {
+		if token := r.URL.Query().Get("jwt"); token != "" {
+			return token, nil
+		}
+	}
+	authHeader := r.Header.Get("Authorization")
+	if sources&TokenSourceJWTHeader != 0 && strings.HasPrefix(authHeader, "JWT ") {
+		return strings.TrimPrefix(authHeader, "JWT "), nil
+	}
+	if sources&TokenSourceBearerHeader != 0 && strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer "), nil
+	}
+	if sources&TokenSourceCookie != 0 {
+		if c, err := r.Cookie(JWTCookieName); err == nil && c.Value != "" {
+			return c.Value, nil
+		}
+	}
+	return "", wrapSentinel(ErrInvalidJWT, nil, "jwt was expected in one of: %s", sources)
+}
+
+func (s TokenSource) String() string {
+	var names []string
+	if s&TokenSourceQuery != 0 {
+		names = append(names, "query string")
+	}
+	if s&TokenSourceJWTHeader != 0 {
+		names = append(names, "JWT authorization header")
+	}
+	if s&TokenSourceBearerHeader != 0 {
+		names = append(names, "Bearer authorization header")
+	}
+	if s&TokenSourceCookie != 0 {
+		names = append(names, JWTCookieName+" cookie")
+	}
+	return strings.Join(names, ", ")
+}
+
+// ParseUnverifiedClaims returns the claims of the passed token without verifying its signature,
+// only use it to decide how to handle a request, never to trust it.
+func ParseUnverifiedClaims(token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, claims); err != nil {
+		return nil, tokenError(err, "malformed token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,186 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fieldsPath = "/rest/api/3/field"
+
+// Fields returns every system and custom field of the tenant.
+func (h *HostClient) Fields() ([]FieldDetails, error) {
+	return h.FieldsCtx(context.Background())
+}
+
+// FieldsCtx behaves like Fields bound to ctx, see DoCtx.
+func (h *HostClient) FieldsCtx(ctx context.Context) ([]FieldDetails, error) {
+	var fields []FieldDetails
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("Fields", fieldsPath), nil, nil, &fields, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("listing fields: %w", err)
+	}
+	return fields, nil
+}
+
+type tenantFields struct {
+	fetched time.Time
+	byID    map[string]*FieldDetails
+	byName  map[string][]*FieldDetails
+}
+
+// FieldResolver translates field names to the ids each tenant knows them by, custom fields in
+// particular have tenant specific ids (customfield_10010). Fields are cached per tenant for a ttl.
+type FieldResolver struct {
+	clients *ClientManager
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	tenants  map[string]*tenantFields
+	inflight map[string]*fieldsFetch
+}
+
+// fieldsFetch is a listing of the fields of a tenant in progress, concurrent lookups of the same
+// tenant wait for it instead of listing again while those of other tenants go ahead.
+type fieldsFetch struct {
+	done chan struct{}
+	tf   *tenantFields
+	err  error
+}
+
+// NewFieldResolver returns a FieldResolver listing fields with clients from the passed manager.
+func NewFieldResolver(clients *ClientManager, ttl time.Duration) *FieldResolver {
+	return &FieldResolver{
+		clients:  clients,
+		ttl:      ttl,
+		tenants:  map[string]*tenantFields{},
+		inflight: map[string]*fieldsFetch{},
+	}
+}
+
+func (r *FieldResolver) tenant(clientKey string) (*tenantFields, error) {
+	r.mu.Lock()
+	if tf, ok := r.tenants[clientKey]; ok && time.Since(tf.fetched) < r.ttl {
+		r.mu.Unlock()
+		return tf, nil
+	}
+	if fetch, ok := r.inflight[clientKey]; ok {
+		r.mu.Unlock()
+		<-fetch.done
+		return fetch.tf, fetch.err
+	}
+	fetch := &fieldsFetch{done: make(chan struct{})}
+	r.inflight[clientKey] = fetch
+	r.mu.Unlock()
+
+	fetch.tf, fetch.err = r.fetch(clientKey)
+
+	r.mu.Lock()
+	// forgetting the tenant while listing removes the fetch from inflight, what we listed may be stale.
+	if r.inflight[clientKey] == fetch {
+		delete(r.inflight, clientKey)
+		if fetch.err == nil {
+			r.tenants[clientKey] = fetch.tf
+		}
+	}
+	r.mu.Unlock()
+	close(fetch.done)
+	return fetch.tf, fetch.err
+}
+
+// fetch lists the fields of the tenant.
+func (r *FieldResolver) fetch(clientKey string) (*tenantFields, error) {
+	client, err := r.clients.Client(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := client.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tf := &tenantFields{
+		fetched: time.Now(),
+		byID:    make(map[string]*FieldDetails, len(fields)),
+		byName:  make(map[string][]*FieldDetails, len(fields)),
+	}
+	for i := range fields {
+		f := &fields[i]
+		tf.byID[f.ID] = f
+		name := strings.ToLower(f.Name)
+		tf.byName[name] = append(tf.byName[name], f)
+	}
+	return tf, nil
+}
+
+// Field returns the field of the tenant with the passed id or name, names are matched ignoring case
+// and must not be shared by more than one field.
+func (r *FieldResolver) Field(clientKey, nameOrID string) (*FieldDetails, error) {
+	tf, err := r.tenant(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := tf.byID[nameOrID]; ok {
+		return f, nil
+	}
+	matches := tf.byName[strings.ToLower(nameOrID)]
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("tenant %s has no field called %q", clientKey, nameOrID)
+	case 1:
+		return matches[0], nil
+	}
+	ids := make([]string, 0, len(matches))
+	for _, f := range matches {
+		ids = append(ids, f.ID)
+	}
+	return nil, fmt.Errorf("tenant %s has more than one field called %q: %s", clientKey, nameOrID,
+		strings.Join(ids, ", "))
+}
+
+// FieldID returns the id of the field of the tenant with the passed name or id, see Field.
+func (r *FieldResolver) FieldID(clientKey, nameOrID string) (string, error) {
+	f, err := r.Field(clientKey, nameOrID)
+	if err != nil {
+		return "", err
+	}
+	return f.ID, nil
+}
+
+// ResolveFields returns a copy of fields keyed by field id, so issues can be written with
+// fields["Severity"] rather than the tenant specific id of the field.
+func (r *FieldResolver) ResolveFields(clientKey string, fields map[string]interface{}) (map[string]interface{}, error) {
+	resolved := make(map[string]interface{}, len(fields))
+	for nameOrID, v := range fields {
+		id, err := r.FieldID(clientKey, nameOrID)
+		if err != nil {
+			return nil, err
+		}
+		resolved[id] = v
+	}
+	return resolved, nil
+}
+
+// Forget drops the fields cached for the tenant, ie after creating a custom field.
+func (r *FieldResolver) Forget(clientKey string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tenants, clientKey)
+	delete(r.inflight, clientKey)
+}
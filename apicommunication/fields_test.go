@@ -0,0 +1,136 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// fieldsServer serves the passed fields, holding each listing until release is closed, and counts
+// the listings.
+func fieldsServer(fields []FieldDetails, release <-chan struct{}, listings *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fieldsPath {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(listings, 1)
+		if release != nil {
+			<-release
+		}
+		json.NewEncoder(w).Encode(fields)
+	}))
+}
+
+// fieldsResolver returns a resolver for tenants installed at the passed base urls, by client key.
+func fieldsResolver(t *testing.T, baseURLs map[string]string) *FieldResolver {
+	st := storage.NewMemoryStore(0)
+	for clientKey, baseURL := range baseURLs {
+		tenant := *benchTenant
+		tenant.ClientKey = clientKey
+		tenant.BaseURL = baseURL
+		if err := st.SaveJiraInstallInformation(&tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewFieldResolver(NewClientManager(context.Background(), st, nil), time.Hour)
+}
+
+func TestFieldResolver(t *testing.T) {
+	var listings int32
+	srv := fieldsServer([]FieldDetails{
+		{ID: "summary", Name: "Summary"},
+		{ID: "customfield_10001", Name: "Severity", Custom: true},
+		{ID: "customfield_10002", Name: "Team", Custom: true},
+		{ID: "customfield_10003", Name: "team", Custom: true},
+	}, nil, &listings)
+	defer srv.Close()
+	r := fieldsResolver(t, map[string]string{"a": srv.URL})
+
+	if id, err := r.FieldID("a", "severity"); err != nil || id != "customfield_10001" {
+		t.Fatalf("resolved severity to %q, %v", id, err)
+	}
+	if id, err := r.FieldID("a", "summary"); err != nil || id != "summary" {
+		t.Fatalf("resolved summary to %q, %v", id, err)
+	}
+	if _, err := r.FieldID("a", "Team"); err == nil {
+		t.Fatal("resolved a name shared by two fields")
+	}
+	if _, err := r.FieldID("a", "Priority"); err == nil {
+		t.Fatal("resolved a missing field")
+	}
+	resolved, err := r.ResolveFields("a", map[string]interface{}{"Severity": "high", "summary": "it broke"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved["customfield_10001"] != "high" || resolved["summary"] != "it broke" || len(resolved) != 2 {
+		t.Fatalf("resolved fields to %v", resolved)
+	}
+	if n := atomic.LoadInt32(&listings); n != 1 {
+		t.Fatalf("fields were listed %d times, want 1", n)
+	}
+	r.Forget("a")
+	if _, err := r.FieldID("a", "Severity"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&listings); n != 2 {
+		t.Fatalf("fields were listed %d times after forgetting them, want 2", n)
+	}
+}
+
+func TestFieldResolver_concurrentTenants(t *testing.T) {
+	release := make(chan struct{})
+	var slowListings, fastListings int32
+	slow := fieldsServer([]FieldDetails{{ID: "customfield_1", Name: "Severity"}}, release, &slowListings)
+	defer slow.Close()
+	// the slow listings are released before closing the server, which waits for them.
+	defer close(release)
+	fast := fieldsServer([]FieldDetails{{ID: "customfield_2", Name: "Severity"}}, nil, &fastListings)
+	defer fast.Close()
+	r := fieldsResolver(t, map[string]string{"slow": slow.URL, "fast": fast.URL})
+
+	var wg sync.WaitGroup
+	ids := make([]string, 5)
+	errs := make([]error, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = r.FieldID("slow", "Severity")
+		}(i)
+	}
+	for atomic.LoadInt32(&slowListings) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if id, err := r.FieldID("fast", "Severity"); err != nil || id != "customfield_2" {
+			t.Errorf("resolved severity of fast to %q, %v", id, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listing the fields of one tenant blocked the lookups of another")
+	}
+
+	release <- struct{}{}
+	wg.Wait()
+	for i := range ids {
+		if errs[i] != nil || ids[i] != "customfield_1" {
+			t.Fatalf("resolved severity of slow to %q, %v", ids[i], errs[i])
+		}
+	}
+	if n := atomic.LoadInt32(&slowListings); n != 1 {
+		t.Fatalf("concurrent lookups listed the fields %d times, want 1", n)
+	}
+}
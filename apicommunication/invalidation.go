@@ -0,0 +1,136 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// Broadcaster carries tenant invalidations across replicas, it is meant to be implemented on top
+// of a pub/sub system such as redis pub/sub or NATS.
+type Broadcaster interface {
+	// Publish notifies every subscriber, including the ones in this replica, that the tenant changed.
+	Publish(ctx context.Context, clientKey string) error
+	// Subscribe invokes f with the client key of every published invalidation until ctx is done.
+	Subscribe(ctx context.Context, f func(clientKey string)) error
+}
+
+// Invalidation drops the state cached for a tenant, such as its install information and HostClients,
+// in every replica when the tenant re-installs, so they don't keep using a stale shared secret.
+type Invalidation struct {
+	broadcaster Broadcaster
+	logger      Logger
+
+	mu      sync.Mutex
+	targets []func(clientKey string)
+}
+
+// NewInvalidation returns an Invalidation distributed through b, Run must be invoked for it to
+// receive invalidations published by other replicas.
+func NewInvalidation(b Broadcaster, logger Logger) *Invalidation {
+	return &Invalidation{
+		broadcaster: b,
+		logger:      NewRedactingLogger(logger),
+	}
+}
+
+// Watch registers f to be invoked with the client key of each invalidated tenant.
+func (i *Invalidation) Watch(f func(clientKey string)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.targets = append(i.targets, f)
+}
+
+// WatchClients drops the clients cached by m for invalidated tenants.
+func (i *Invalidation) WatchClients(m *ClientManager) {
+	i.Watch(m.Forget)
+}
+
+// WatchStore drops the install information cached by st for invalidated tenants, it does nothing
+// if st does not implement storage.Invalidator.
+func (i *Invalidation) WatchStore(st storage.Store) {
+	if inv, ok := st.(storage.Invalidator); ok {
+		i.Watch(inv.Invalidate)
+	}
+}
+
+// Invalidate publishes the invalidation of the tenant, targets in this replica are invalidated
+// right away too so they don't depend on the broadcaster delivering messages to their sender.
+func (i *Invalidation) Invalidate(ctx context.Context, clientKey string) error {
+	i.invalidate(clientKey)
+	if err := i.broadcaster.Publish(ctx, clientKey); err != nil {
+		return fmt.Errorf("publishing invalidation of %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// Run receives invalidations published by every replica until ctx is done.
+func (i *Invalidation) Run(ctx context.Context) error {
+	return i.broadcaster.Subscribe(ctx, func(clientKey string) {
+		Debugf(i.logger, "DEBUG: invalidating cached state of %s", clientKey)
+		i.invalidate(clientKey)
+	})
+}
+
+func (i *Invalidation) invalidate(clientKey string) {
+	i.mu.Lock()
+	targets := append([]func(string){}, i.targets...)
+	i.mu.Unlock()
+	for _, f := range targets {
+		f(clientKey)
+	}
+}
+
+// localBroadcaster is a Broadcaster for single replica deployments and tests.
+type localBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[int]func(string)
+	next        int
+}
+
+// NewLocalBroadcaster returns a Broadcaster that only reaches subscribers in this process.
+func NewLocalBroadcaster() Broadcaster {
+	return &localBroadcaster{subscribers: map[int]func(string){}}
+}
+
+func (b *localBroadcaster) Publish(_ context.Context, clientKey string) error {
+	b.mu.Lock()
+	subscribers := make([]func(string), 0, len(b.subscribers))
+	for _, f := range b.subscribers {
+		subscribers = append(subscribers, f)
+	}
+	b.mu.Unlock()
+	for _, f := range subscribers {
+		f(clientKey)
+	}
+	return nil
+}
+
+func (b *localBroadcaster) Subscribe(ctx context.Context, f func(string)) error {
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = f
+	b.mu.Unlock()
+	<-ctx.Done()
+	b.mu.Lock()
+	delete(b.subscribers, id)
+	b.mu.Unlock()
+	return nil
+}
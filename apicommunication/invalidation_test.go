@@ -0,0 +1,82 @@
+package apicommunication
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestInvalidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := log.New(ioutil.Discard, "", 0)
+	b := NewLocalBroadcaster()
+
+	// the second replica caches the install information of the tenant.
+	backing := storage.NewMemoryStore(0)
+	tenant := *benchTenant
+	if err := backing.SaveJiraInstallInformation(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	cached := storage.NewCachedStore(backing, time.Hour)
+	if _, err := cached.JiraInstallInformation(tenant.ClientKey); err != nil {
+		t.Fatal(err)
+	}
+	first, second := NewInvalidation(b, logger), NewInvalidation(b, logger)
+	second.WatchStore(cached)
+	// stores without a cache have nothing to drop.
+	second.WatchStore(backing)
+	var mu sync.Mutex
+	var invalidated []string
+	received := make(chan struct{}, 10)
+	for _, inv := range []*Invalidation{first, second} {
+		inv.Watch(func(clientKey string) {
+			mu.Lock()
+			invalidated = append(invalidated, clientKey)
+			mu.Unlock()
+			received <- struct{}{}
+		})
+		go inv.Run(ctx)
+	}
+	for subscribed := 0; subscribed < 2; {
+		time.Sleep(time.Millisecond)
+		lb := b.(*localBroadcaster)
+		lb.mu.Lock()
+		subscribed = len(lb.subscribers)
+		lb.mu.Unlock()
+	}
+
+	// the tenant re-installed with a new secret through the first replica.
+	tenant.SharedSecret = "rotated"
+	if err := backing.SaveJiraInstallInformation(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Invalidate(ctx, tenant.ClientKey); err != nil {
+		t.Fatal(err)
+	}
+	// the first replica is invalidated right away and again once its own message arrives.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d invalidations were received", i)
+		}
+	}
+	mu.Lock()
+	if len(invalidated) != 3 || invalidated[0] != tenant.ClientKey {
+		t.Fatalf("invalidated %q", invalidated)
+	}
+	mu.Unlock()
+	jii, err := cached.JiraInstallInformation(tenant.ClientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jii.SharedSecret != "rotated" {
+		t.Fatal("the second replica kept the stale shared secret cached")
+	}
+}
@@ -0,0 +1,251 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	searchPath = "/rest/api/3/search"
+	// jqlTimeLayout is the format JQL accepts for dates with time, it is interpreted in the
+	// timezone of the user performing the search.
+	jqlTimeLayout = "2006/01/02 15:04"
+)
+
+// issuePath returns the API path of the issue with the passed key or id.
+func issuePath(issueKeyOrID string) string {
+	return "/rest/api/3/issue/" + url.PathEscape(issueKeyOrID)
+}
+
+// JQLTime formats t in a way that can be used in JQL comparisons such as `updated >= "..."`.
+func JQLTime(t time.Time) string {
+	return t.Format(jqlTimeLayout)
+}
+
+// SearchIssues runs the passed JQL query and returns the page of results starting at startAt, fields
+// restricts the returned fields, leave it empty to get jira's defaults.
+func (h *HostClient) SearchIssues(jql string, startAt, maxResults int64, fields []string) (*SearchResults, error) {
+	return h.SearchIssuesCtx(context.Background(), jql, startAt, maxResults, fields)
+}
+
+// SearchIssuesCtx behaves like SearchIssues bound to ctx, see DoCtx.
+func (h *HostClient) SearchIssuesCtx(ctx context.Context, jql string, startAt, maxResults int64, fields []string) (*SearchResults, error) {
+	body, err := json.Marshal(SearchRequestBean{
+		Jql:           jql,
+		StartAt:       startAt,
+		MaxResults:    maxResults,
+		Fields:        fields,
+		Expand:        []string{},
+		Properties:    []string{},
+		ValidateQuery: "strict",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling search request: %w", err)
+	}
+	results := &SearchResults{}
+	_, err = h.DoWithTargetCtx(ctx, http.MethodPost, h.api("SearchIssues", searchPath), nil, bytes.NewReader(body), results,
+		[]int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("searching issues: %w", err)
+	}
+	return results, nil
+}
+
+// ForEachIssue runs the passed JQL query paginating through all the results and invokes f for
+// each of them, it stops at the first error returned by f.
+func (h *HostClient) ForEachIssue(jql string, fields []string, f func(issue *IssueBean) error) error {
+	return h.ForEachIssueCtx(context.Background(), jql, fields, f)
+}
+
+// ForEachIssueCtx behaves like ForEachIssue bound to ctx, see DoCtx.
+func (h *HostClient) ForEachIssueCtx(ctx context.Context, jql string, fields []string, f func(issue *IssueBean) error) error {
+	const pageSize = 50
+	var startAt int64
+	for {
+		page, err := h.SearchIssuesCtx(ctx, jql, startAt, pageSize, fields)
+		if err != nil {
+			return err
+		}
+		for i := range page.Issues {
+			if err := f(&page.Issues[i]); err != nil {
+				return err
+			}
+		}
+		startAt += int64(len(page.Issues))
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			return nil
+		}
+	}
+}
+
+// AssignIssue assigns the issue with the passed key or id to the user with the passed account ID,
+// or username in data center, an empty account ID unassigns it.
+func (h *HostClient) AssignIssue(issueKeyOrID, accountID string) error {
+	return h.AssignIssueCtx(context.Background(), issueKeyOrID, accountID)
+}
+
+// AssignIssueCtx behaves like AssignIssue bound to ctx, see DoCtx.
+func (h *HostClient) AssignIssueCtx(ctx context.Context, issueKeyOrID, accountID string) error {
+	userField := "accountId"
+	if h.dataCenter {
+		userField = "name"
+	}
+	assignee := map[string]interface{}{userField: nil}
+	if accountID != "" {
+		assignee[userField] = accountID
+	}
+	body, err := json.Marshal(assignee)
+	if err != nil {
+		return fmt.Errorf("marshaling assignee: %w", err)
+	}
+	_, err = h.DoWithTargetCtx(ctx, http.MethodPut, h.api("AssignIssue", issuePath(issueKeyOrID)+"/assignee"), nil, bytes.NewReader(body), nil,
+		[]int{http.StatusNoContent})
+	if err != nil {
+		return fmt.Errorf("assigning issue %s: %w", issueKeyOrID, err)
+	}
+	return nil
+}
+
+// IssueTransitions returns the transitions the client can perform on the issue in its current status.
+func (h *HostClient) IssueTransitions(issueKeyOrID string) ([]IssueTransition, error) {
+	return h.IssueTransitionsCtx(context.Background(), issueKeyOrID)
+}
+
+// IssueTransitionsCtx behaves like IssueTransitions bound to ctx, see DoCtx.
+func (h *HostClient) IssueTransitionsCtx(ctx context.Context, issueKeyOrID string) ([]IssueTransition, error) {
+	transitions := &Transitions{}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("IssueTransitions", issuePath(issueKeyOrID)+"/transitions"), nil, nil, transitions,
+		[]int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("listing transitions of issue %s: %w", issueKeyOrID, err)
+	}
+	return transitions.Transitions, nil
+}
+
+// TransitionIssue performs the transition with the passed name, matched ignoring case, or id on the
+// issue, failing if it is not available from the issue current status.
+func (h *HostClient) TransitionIssue(issueKeyOrID, transition string) error {
+	return h.TransitionIssueCtx(context.Background(), issueKeyOrID, transition)
+}
+
+// TransitionIssueCtx behaves like TransitionIssue bound to ctx, see DoCtx.
+func (h *HostClient) TransitionIssueCtx(ctx context.Context, issueKeyOrID, transition string) error {
+	available, err := h.IssueTransitionsCtx(ctx, issueKeyOrID)
+	if err != nil {
+		return err
+	}
+	id := ""
+	for _, t := range available {
+		if t.ID == transition || strings.EqualFold(t.Name, transition) {
+			id = t.ID
+			break
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("transition %q is not available for issue %s", transition, issueKeyOrID)
+	}
+	body, err := json.Marshal(map[string]interface{}{"transition": map[string]string{"id": id}})
+	if err != nil {
+		return fmt.Errorf("marshaling transition: %w", err)
+	}
+	_, err = h.DoWithTargetCtx(ctx, http.MethodPost, h.api("TransitionIssue", issuePath(issueKeyOrID)+"/transitions"), nil, bytes.NewReader(body), nil,
+		[]int{http.StatusNoContent})
+	if err != nil {
+		return fmt.Errorf("transitioning issue %s: %w", issueKeyOrID, err)
+	}
+	return nil
+}
+
+// BulkResult reports the outcome of an operation applied to every issue matching a query.
+type BulkResult struct {
+	// Succeeded holds the keys of the issues the operation was applied to.
+	Succeeded []string
+	// Failed holds the error of each issue the operation failed for, by key.
+	Failed map[string]error
+}
+
+// Err returns an error summarizing the failures or nil if there were none.
+func (r *BulkResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(r.Failed))
+	for k := range r.Failed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("failed for %d of %d issues: %s", len(r.Failed), len(r.Failed)+len(r.Succeeded),
+		strings.Join(keys, ", "))
+}
+
+// bulk applies f to every issue matching jql, failures for an issue don't stop the rest.
+func (h *HostClient) bulk(ctx context.Context, jql string, f func(issue *IssueBean) error) (*BulkResult, error) {
+	result := &BulkResult{Failed: map[string]error{}}
+	// issues are collected first since the operation may make them stop matching the query,
+	// which would shift the pages.
+	var issues []string
+	err := h.ForEachIssueCtx(ctx, jql, []string{"key"}, func(issue *IssueBean) error {
+		issues = append(issues, issue.Key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range issues {
+		if err := f(&IssueBean{Key: key}); err != nil {
+			result.Failed[key] = err
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, key)
+	}
+	return result, nil
+}
+
+// BulkAssign assigns every issue matching jql to the user with the passed account ID, see AssignIssue.
+// The returned error is only set if the issues could not be searched, failures of individual issues
+// are reported in the result.
+func (h *HostClient) BulkAssign(jql, accountID string) (*BulkResult, error) {
+	return h.BulkAssignCtx(context.Background(), jql, accountID)
+}
+
+// BulkAssignCtx behaves like BulkAssign bound to ctx, see DoCtx.
+func (h *HostClient) BulkAssignCtx(ctx context.Context, jql, accountID string) (*BulkResult, error) {
+	return h.bulk(ctx, jql, func(issue *IssueBean) error {
+		return h.AssignIssueCtx(ctx, issue.Key, accountID)
+	})
+}
+
+// BulkTransition performs the transition with the passed name or id on every issue matching jql,
+// see TransitionIssue. The returned error is only set if the issues could not be searched, failures
+// of individual issues, ie those without the transition available, are reported in the result.
+func (h *HostClient) BulkTransition(jql, transition string) (*BulkResult, error) {
+	return h.BulkTransitionCtx(context.Background(), jql, transition)
+}
+
+// BulkTransitionCtx behaves like BulkTransition bound to ctx, see DoCtx.
+func (h *HostClient) BulkTransitionCtx(ctx context.Context, jql, transition string) (*BulkResult, error) {
+	return h.bulk(ctx, jql, func(issue *IssueBean) error {
+		return h.TransitionIssueCtx(ctx, issue.Key, transition)
+	})
+}
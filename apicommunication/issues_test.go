@@ -0,0 +1,78 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHostClient_BulkTransition(t *testing.T) {
+	var transitioned []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == searchPath:
+			fmt.Fprint(w, `{"total": 2, "issues": [{"key": "KEY-1"}, {"key": "KEY-2"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/3/issue/KEY-1/transitions":
+			fmt.Fprint(w, `{"transitions": [{"id": "31", "name": "Done"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/3/issue/KEY-2/transitions":
+			fmt.Fprint(w, `{"transitions": [{"id": "11", "name": "To Do"}]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/3/issue/KEY-1/transitions":
+			body := struct {
+				Transition struct {
+					ID string `json:"id"`
+				} `json:"transition"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			transitioned = append(transitioned, "KEY-1:"+body.Transition.ID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := hc.BulkTransition("project = KEY", "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Succeeded) != 1 || result.Succeeded[0] != "KEY-1" || result.Failed["KEY-2"] == nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Err() == nil {
+		t.Fatal("partial failure was not reported")
+	}
+	if len(transitioned) != 1 || transitioned[0] != "KEY-1:31" {
+		t.Fatalf("transitioned %v", transitioned)
+	}
+}
+
+func TestHostClient_ForEachIssueCtx(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = hc.ForEachIssueCtx(ctx, "project = KEY", nil, func(*IssueBean) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("search outliving its context returned %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// JiraTimeLayout is the layout of timestamps in the jira API, ie 2020-04-30T15:04:05.000+0000.
+	JiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+	// JiraDateLayout is the layout of date only fields in the jira API, such as due dates.
+	JiraDateLayout = "2006-01-02"
+)
+
+// Time is a timestamp as the jira API reads and writes it, the zero value marshals to null.
+type Time struct {
+	time.Time
+}
+
+// MarshalJSON implements json.Marshaler
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Format(JiraTimeLayout))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, RFC 3339 timestamps are accepted too.
+func (t *Time) UnmarshalJSON(b []byte) error {
+	s, null, err := unmarshalJSONString(b)
+	if err != nil || null {
+		t.Time = time.Time{}
+		return err
+	}
+	for _, layout := range []string{JiraTimeLayout, time.RFC3339Nano} {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a jira timestamp", s)
+}
+
+// Date is a date only field of the jira API, the zero value marshals to null.
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the Date t falls in, in the location of t.
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// String implements fmt.Stringer
+func (d Date) String() string {
+	return d.Format(JiraDateLayout)
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Format(JiraDateLayout))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Date) UnmarshalJSON(b []byte) error {
+	s, null, err := unmarshalJSONString(b)
+	if err != nil || null {
+		d.Time = time.Time{}
+		return err
+	}
+	parsed, err := time.Parse(JiraDateLayout, s)
+	if err != nil {
+		return fmt.Errorf("%q is not a jira date: %w", s, err)
+	}
+	d.Time = parsed
+	return nil
+}
+
+func unmarshalJSONString(b []byte) (string, bool, error) {
+	if string(b) == "null" {
+		return "", true, nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", false, err
+	}
+	return s, s == "", nil
+}
+
+// Working time used to convert jira durations, these are the jira defaults and can be changed by
+// site administrators in the time tracking settings.
+var (
+	HoursPerDay = 8
+	DaysPerWeek = 5
+)
+
+// Duration is a time tracking duration such as "3d 4h", jira counts days and weeks in working time
+// (see HoursPerDay and DaysPerWeek). It marshals to the jira format and unmarshals from it or from
+// a number of seconds, as in timeSpentSeconds.
+type Duration time.Duration
+
+// ParseDuration parses a jira duration made of space separated components with the units w, d,
+// h and m, a bare number is a number of minutes.
+func ParseDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var total time.Duration
+	for _, component := range strings.Fields(s) {
+		unit, number := time.Minute, component
+		suffix := component[len(component)-1]
+		switch suffix {
+		case 'w':
+			unit = time.Duration(HoursPerDay*DaysPerWeek) * time.Hour
+		case 'd':
+			unit = time.Duration(HoursPerDay) * time.Hour
+		case 'h':
+			unit = time.Hour
+		}
+		if strings.IndexByte("wdhm", suffix) >= 0 {
+			number = component[:len(component)-1]
+		}
+		n, err := strconv.ParseFloat(number, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a jira duration", s)
+		}
+		total += time.Duration(n * float64(unit))
+	}
+	return Duration(total), nil
+}
+
+// String returns the duration in the jira format, ie "1w 2d 3h 30m".
+func (d Duration) String() string {
+	if d <= 0 {
+		return "0m"
+	}
+	remaining := time.Duration(d)
+	var parts []string
+	for _, u := range []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"w", time.Duration(HoursPerDay*DaysPerWeek) * time.Hour},
+		{"d", time.Duration(HoursPerDay) * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+	} {
+		if n := remaining / u.size; n > 0 {
+			parts = append(parts, strconv.FormatInt(int64(n), 10)+u.suffix)
+			remaining -= n * u.size
+		}
+	}
+	if len(parts) == 0 {
+		return "0m"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Seconds returns the duration in seconds, as fields such as timeSpentSeconds expect.
+func (d Duration) Seconds() int64 {
+	return int64(time.Duration(d) / time.Second)
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*d = 0
+		return nil
+	}
+	var seconds int64
+	if err := json.Unmarshal(b, &seconds); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
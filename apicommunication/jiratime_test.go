@@ -0,0 +1,50 @@
+package apicommunication
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	d, err := ParseDuration("1w 2d 3h 30m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Duration(40*time.Hour + 16*time.Hour + 3*time.Hour + 30*time.Minute)
+	if d != want {
+		t.Fatalf("parsed %v, want %v", time.Duration(d), time.Duration(want))
+	}
+	if d.String() != "1w 2d 3h 30m" {
+		t.Fatalf("formatted as %s", d)
+	}
+	var fromSeconds Duration
+	if err := json.Unmarshal([]byte("5400"), &fromSeconds); err != nil {
+		t.Fatal(err)
+	}
+	if fromSeconds.String() != "1h 30m" {
+		t.Fatalf("5400 seconds formatted as %s", fromSeconds)
+	}
+	if _, err := ParseDuration("3x"); err == nil {
+		t.Fatal("3x parsed as a duration")
+	}
+}
+
+func TestTime(t *testing.T) {
+	var v struct {
+		Created Time `json:"created"`
+		Due     Date `json:"duedate"`
+		Updated Time `json:"updated"`
+	}
+	in := `{"created":"2020-04-30T15:04:05.000+0200","duedate":"2020-05-01","updated":null}`
+	if err := json.Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Fatalf("round tripped to %s", out)
+	}
+}
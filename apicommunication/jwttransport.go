@@ -0,0 +1,162 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// defaultJWTValidity is the lifetime of the tokens we sign for calls to jira.
+const defaultJWTValidity = defaultJWTValidityInMinutes * time.Minute
+
+// WithTokenLifetime sets the validity of the JWTs signed for each call to jira, it defaults to
+// three minutes.
+func WithTokenLifetime(d time.Duration) HostClientOption {
+	return func(h *HostClient) {
+		h.tokenLifetime = d
+	}
+}
+
+// WithTokenClaims adds the passed claims to the JWTs signed for each call to jira, the ones
+// computed by the client (iss, iat, exp and qsh) can not be overridden.
+func WithTokenClaims(claims map[string]interface{}) HostClientOption {
+	return func(h *HostClient) {
+		h.tokenClaims = claims
+	}
+}
+
+// WithTokenAudience sets the aud claim of the JWTs signed for each call to jira, some proxies
+// and endpoints require it.
+func WithTokenAudience(audience ...string) HostClientOption {
+	return func(h *HostClient) {
+		h.tokenAudience = audience
+	}
+}
+
+// jwtTransport signs each request with a JWT as described in
+// https://developer.atlassian.com/cloud/jira/platform/understanding-jwt-for-connect-apps/
+type jwtTransport struct {
+	secret    []byte
+	issuer    string
+	lifetime  time.Duration
+	claims    map[string]interface{}
+	audience  []string
+	basePath  string
+	transport http.RoundTripper
+}
+
+func (h *HostClient) newJWTTransport(roundtripper http.RoundTripper) (*jwtTransport, error) {
+	base, err := url.Parse(h.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jira install information base URL: %w", err)
+	}
+	lifetime := h.tokenLifetime
+	if lifetime <= 0 {
+		lifetime = defaultJWTValidity
+	}
+	if roundtripper == nil {
+		roundtripper = http.DefaultTransport
+	}
+	return &jwtTransport{
+		secret:    []byte(h.Config.SharedSecret),
+		issuer:    h.Config.Key,
+		lifetime:  lifetime,
+		claims:    h.tokenClaims,
+		audience:  h.tokenAudience,
+		basePath:  strings.TrimRight(base.Path, "/"),
+		transport: roundtripper,
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range t.claims {
+		claims[k] = v
+	}
+	switch len(t.audience) {
+	case 0:
+	case 1:
+		claims["aud"] = t.audience[0]
+	default:
+		claims["aud"] = t.audience
+	}
+	claims["iss"] = t.issuer
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(t.lifetime).Unix()
+	claims["qsh"] = QueryStringHash(req.Method, req.URL, t.basePath)
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+	if err != nil {
+		return nil, fmt.Errorf("signing jwt: %w", err)
+	}
+	req2 := req.Clone(req.Context()) // per RoundTripper contract
+	req2.Header.Set("Authorization", "JWT "+signed)
+	return t.transport.RoundTrip(req2)
+}
+
+// QueryStringHash computes the qsh claim for a request, basePath is the path of the tenant base URL
+// (ie /wiki for confluence) which is not part of the canonical request.
+func QueryStringHash(method string, u *url.URL, basePath string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest(method, u, basePath)))
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalRequest(method string, u *url.URL, basePath string) string {
+	p := strings.TrimPrefix(u.Path, basePath)
+	p = strings.TrimRight(p, "/")
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	p = strings.ReplaceAll(p, "&", "%26")
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if k == "jwt" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for i := range values {
+			values[i] = percentEncode(values[i])
+		}
+		params = append(params, percentEncode(k)+"="+strings.Join(values, ","))
+	}
+	return strings.ToUpper(method) + "&" + p + "&" + strings.Join(params, "&")
+}
+
+// percentEncode encodes as RFC 3986 requires, which is what atlassian expects in the qsh.
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
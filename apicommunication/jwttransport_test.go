@@ -0,0 +1,34 @@
+package apicommunication
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		rawURL   string
+		basePath string
+		want     string
+	}{
+		{"no query", "get", "https://x.atlassian.net/rest/api/3/myself", "", "GET&/rest/api/3/myself&"},
+		{"sorted and joined", "GET", "https://x.atlassian.net/rest/api/3/search?b=2&a=1&a=0&jwt=abc", "",
+			"GET&/rest/api/3/search&a=0,1&b=2"},
+		{"context path", "POST", "https://x.atlassian.net/wiki/rest/api/content/", "/wiki", "POST&/rest/api/content&"},
+		{"encoding", "GET", "https://x.atlassian.net/a&b?q=a+b%2Ac~", "", "GET&/a%26b&q=a%20b%2Ac~"},
+		{"empty path", "GET", "https://x.atlassian.net", "", "GET&/&"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := canonicalRequest(tt.method, u, tt.basePath); got != tt.want {
+				t.Errorf("canonicalRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
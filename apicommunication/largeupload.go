@@ -0,0 +1,298 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultMaxUploadSize is the largest attachment UploadLargeAttachment accepts if
+	// LargeUploadOptions has no MaxSize, it is the default limit of jira cloud sites.
+	DefaultMaxUploadSize int64 = 1 << 30
+	// DefaultLargeUploadAttempts is how many times UploadLargeAttachment tries to upload if
+	// LargeUploadOptions has no Attempts.
+	DefaultLargeUploadAttempts = 3
+	// DefaultLargeUploadBackoff is the wait before the first retry of UploadLargeAttachment if
+	// LargeUploadOptions has no RetryBackoff.
+	DefaultLargeUploadBackoff = 5 * time.Second
+)
+
+// LargeUploadOptions customizes UploadLargeAttachment, the zero value is usable.
+type LargeUploadOptions struct {
+	// MaxSize refuses content larger than it with ErrAttachmentRejected.
+	MaxSize int64
+	// Attempts is how many times the upload is tried from scratch.
+	Attempts int
+	// RetryBackoff is the wait before the first retry, it doubles for each of the following.
+	RetryBackoff time.Duration
+	// VerifyChecksum downloads the uploaded attachment to compare its SHA-256 with the one of the
+	// content, rather than only its size.
+	VerifyChecksum bool
+	// TempDir is where content is spooled, the default directory for temporary files if empty.
+	TempDir string
+}
+
+// UploadLargeAttachment behaves like UploadAttachment for content too large to be held in memory
+// or to make it in one go over slow links. content is spooled to a temporary file, after the
+// attachment interceptors, which is streamed to jira on each attempt.
+// Jira has no resumable uploads, so attempts failing with network errors or 429 and 5xx statuses
+// are tried again from scratch, unless the attachment landed in the issue even though the response
+// was lost. Attachments whose size, or checksum if VerifyChecksum is set, differ from the content
+// are deleted and uploaded again.
+func (h *HostClient) UploadLargeAttachment(ctx context.Context, issueKeyOrID, filename string,
+	content io.Reader, opts LargeUploadOptions) ([]Attachment, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxUploadSize
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = DefaultLargeUploadAttempts
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultLargeUploadBackoff
+	}
+	content, err := h.intercept(&AttachmentInfo{
+		Direction:    AttachmentUpload,
+		IssueKeyOrID: issueKeyOrID,
+		Filename:     filename,
+		Size:         -1,
+	}, content)
+	if err != nil {
+		return nil, err
+	}
+	spool, size, checksum, err := spoolUpload(content, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	current, err := h.issueAttachments(ctx, issueKeyOrID)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, a := range current {
+		existing[a.ID] = true
+	}
+	var cause error
+	for attempt := 0; attempt < opts.Attempts; attempt++ {
+		if attempt > 0 {
+			wait := time.NewTimer(opts.RetryBackoff << uint(attempt-1))
+			select {
+			case <-ctx.Done():
+				wait.Stop()
+				return nil, fmt.Errorf("uploading attachment %s: %w", filename, ctx.Err())
+			case <-wait.C:
+			}
+		}
+		var attachments []Attachment
+		var retry bool
+		attachments, retry, cause = h.uploadSpooled(ctx, issueKeyOrID, filename, spool)
+		if cause != nil && !retry {
+			return nil, cause
+		}
+		if cause != nil {
+			// the upload may have completed with the response lost on the way back.
+			if attachments, err = h.landedAttachments(ctx, issueKeyOrID, filename, existing); err != nil {
+				return nil, err
+			}
+		}
+		if len(attachments) == 0 {
+			continue
+		}
+		intact, err := h.verifyUpload(ctx, attachments, size, checksum, opts.VerifyChecksum)
+		if err != nil {
+			return nil, err
+		}
+		if intact {
+			return attachments, nil
+		}
+		cause = fmt.Errorf("attachment %s was corrupted while uploading", filename)
+		for _, a := range attachments {
+			existing[a.ID] = true
+			if err := h.deleteAttachment(ctx, a.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("uploading attachment %s failed %d times: %w", filename, opts.Attempts, cause)
+}
+
+// spoolUpload copies content into a temporary file, refusing it if larger than opts.MaxSize, and
+// returns it with its size and SHA-256.
+func spoolUpload(content io.Reader, filename string, opts LargeUploadOptions) (*os.File, int64, []byte, error) {
+	spool, err := ioutil.TempFile(opts.TempDir, "attachment-")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("creating spool for attachment %s: %w", filename, err)
+	}
+	fail := func(err error) (*os.File, int64, []byte, error) {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, nil, err
+	}
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, sum), io.LimitReader(content, opts.MaxSize+1))
+	if err != nil {
+		return fail(fmt.Errorf("reading attachment %s: %w", filename, err))
+	}
+	if size > opts.MaxSize {
+		return fail(wrapSentinel(ErrAttachmentRejected, nil, "%s is larger than the %d bytes allowed", filename, opts.MaxSize))
+	}
+	return spool, size, sum.Sum(nil), nil
+}
+
+// uploadSpooled makes one upload attempt streaming spool, it returns whether failures are worth
+// retrying.
+func (h *HostClient) uploadSpooled(ctx context.Context, issueKeyOrID, filename string,
+	spool *os.File) ([]Attachment, bool, error) {
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("rewinding attachment %s: %w", filename, err)
+	}
+	body, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		part, err := form.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(part, spool)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	// the piped body can not be sent again, attempts are retried whole.
+	resp, err := h.DoWithHeadersCtx(ctx, http.MethodPost,
+		h.api("UploadAttachment", issuePath(issueKeyOrID)+"/attachments"), nil, body,
+		http.Header{
+			"Content-Type":      []string{form.FormDataContentType()},
+			"X-Atlassian-Token": []string{"no-check"},
+		})
+	// unblocks the writer if the request gave up before reading the whole body, and waits for it to
+	// be done with spool before it is rewound or removed.
+	body.Close()
+	<-written
+	if err != nil {
+		return nil, ctx.Err() == nil, fmt.Errorf("uploading attachment %s: %w", filename, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return nil, retry, fmt.Errorf("uploading attachment %s: %w", filename,
+			&UnexpectedResponse{obtained: resp.StatusCode, expected: []int{http.StatusOK}})
+	}
+	var attachments []Attachment
+	if err := TypeFromResponse(resp, &attachments); err != nil {
+		return nil, true, fmt.Errorf("uploading attachment %s: %w", filename, err)
+	}
+	return attachments, false, nil
+}
+
+// issueAttachments returns the attachments of the issue.
+func (h *HostClient) issueAttachments(ctx context.Context, issueKeyOrID string) ([]Attachment, error) {
+	var issue struct {
+		Fields struct {
+			Attachment []Attachment `json:"attachment"`
+		} `json:"fields"`
+	}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("UploadLargeAttachment", issuePath(issueKeyOrID)),
+		map[string]string{"fields": "attachment"}, nil, &issue, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading attachments of %s: %w", issueKeyOrID, err)
+	}
+	return issue.Fields.Attachment, nil
+}
+
+// landedAttachments returns the attachments of the issue named filename that are not in existing.
+func (h *HostClient) landedAttachments(ctx context.Context, issueKeyOrID, filename string,
+	existing map[string]bool) ([]Attachment, error) {
+	attachments, err := h.issueAttachments(ctx, issueKeyOrID)
+	if err != nil {
+		return nil, err
+	}
+	var landed []Attachment
+	for _, a := range attachments {
+		if !existing[a.ID] && a.Filename == filename {
+			landed = append(landed, a)
+		}
+	}
+	return landed, nil
+}
+
+// verifyUpload returns true if every attachment has the passed size and, if verifyChecksum is set,
+// content with the passed SHA-256.
+func (h *HostClient) verifyUpload(ctx context.Context, attachments []Attachment, size int64,
+	checksum []byte, verifyChecksum bool) (bool, error) {
+	for _, a := range attachments {
+		if a.Size != size {
+			return false, nil
+		}
+		if !verifyChecksum {
+			continue
+		}
+		sum, err := h.attachmentChecksum(ctx, a.ID)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(sum, checksum) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// attachmentChecksum returns the SHA-256 of the content of the attachment, it is not passed
+// through the attachment interceptors.
+func (h *HostClient) attachmentChecksum(ctx context.Context, attachmentID string) ([]byte, error) {
+	resp, err := h.DoWithHeadersCtx(ctx, http.MethodGet,
+		h.api("UploadLargeAttachment", "/rest/api/3/attachment/content/"+url.PathEscape(attachmentID)), nil, nil,
+		http.Header{"Accept": []string{"*/*"}})
+	if err != nil {
+		return nil, fmt.Errorf("downloading attachment %s: %w", attachmentID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading attachment %s: %w", attachmentID,
+			&UnexpectedResponse{obtained: resp.StatusCode, expected: []int{http.StatusOK}})
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, resp.Body); err != nil {
+		return nil, fmt.Errorf("downloading attachment %s: %w", attachmentID, err)
+	}
+	return sum.Sum(nil), nil
+}
+
+// deleteAttachment deletes the attachment with the passed id.
+func (h *HostClient) deleteAttachment(ctx context.Context, attachmentID string) error {
+	_, err := h.DoWithTargetCtx(ctx, http.MethodDelete,
+		h.api("UploadLargeAttachment", "/rest/api/3/attachment/"+url.PathEscape(attachmentID)), nil, nil,
+		nil, []int{http.StatusNoContent})
+	if err != nil {
+		return fmt.Errorf("deleting corrupted attachment %s: %w", attachmentID, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// appPath is the path of the app information endpoint of the connect REST API, it takes the app key.
+const appPath = "/rest/atlassian-connect/1/addons/"
+
+// AppLicense is the marketplace license of the app in a tenant.
+type AppLicense struct {
+	Active bool `json:"active"`
+	// Type is the kind of license, ie COMMERCIAL, ACADEMIC or COMMUNITY.
+	Type                     string `json:"type"`
+	Evaluation               bool   `json:"evaluation"`
+	SupportEntitlementNumber string `json:"supportEntitlementNumber"`
+}
+
+// AppLicense returns the license of the app with the passed key in the tenant, nil if it has none,
+// as is the case for apps that are not paid via the marketplace.
+func (h *HostClient) AppLicense(appKey string) (*AppLicense, error) {
+	return h.AppLicenseCtx(context.Background(), appKey)
+}
+
+// AppLicenseCtx behaves like AppLicense bound to ctx, see DoCtx.
+func (h *HostClient) AppLicenseCtx(ctx context.Context, appKey string) (*AppLicense, error) {
+	var app struct {
+		License *AppLicense `json:"license"`
+	}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, appPath+url.PathEscape(appKey), nil, nil, &app, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading license of %s: %w", appKey, err)
+	}
+	return app.License, nil
+}
@@ -0,0 +1,56 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// hostLink returns the URL of p in the tenant site with the passed query.
+func hostLink(jii *storage.JiraInstallInformation, p string, query url.Values) string {
+	link := strings.TrimRight(jii.BaseURL, "/") + p
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// BrowseIssueURL returns the URL of the page of the issue with the passed key.
+func BrowseIssueURL(jii *storage.JiraInstallInformation, issueKey string) string {
+	return hostLink(jii, "/browse/"+url.PathEscape(issueKey), nil)
+}
+
+// IssueSearchURL returns the URL of the issue navigator showing the results of jql.
+func IssueSearchURL(jii *storage.JiraInstallInformation, jql string) string {
+	return hostLink(jii, "/issues/", url.Values{"jql": {jql}})
+}
+
+// CreateIssueURL returns the URL of the create issue screen for the passed project and issue type
+// ids with fields prefilled, fields are keyed by field id (summary, description, priority, labels,
+// components, customfield_10010...) and fields admitting many values, like labels, can hold more than one.
+func CreateIssueURL(jii *storage.JiraInstallInformation, projectID, issueTypeID string, fields url.Values) string {
+	query := url.Values{}
+	for k, v := range fields {
+		query[k] = append([]string(nil), v...)
+	}
+	query.Set("pid", projectID)
+	if issueTypeID != "" {
+		query.Set("issuetype", issueTypeID)
+	}
+	return hostLink(jii, "/secure/CreateIssueDetails!init.jspa", query)
+}
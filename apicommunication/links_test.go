@@ -0,0 +1,24 @@
+package apicommunication
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestCreateIssueURL(t *testing.T) {
+	jii := &storage.JiraInstallInformation{BaseURL: "https://example.atlassian.net/"}
+	got := CreateIssueURL(jii, "10000", "10001", url.Values{
+		"summary": {"a summary & more"},
+		"labels":  {"one", "two"},
+	})
+	want := "https://example.atlassian.net/secure/CreateIssueDetails!init.jspa?" +
+		"issuetype=10001&labels=one&labels=two&pid=10000&summary=a+summary+%26+more"
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got := IssueSearchURL(jii, `project = "A B"`); got != "https://example.atlassian.net/issues/?jql=project+%3D+%22A+B%22" {
+		t.Fatalf("search url is %s", got)
+	}
+}
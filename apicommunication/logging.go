@@ -0,0 +1,157 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// Logger is what this library uses to log, *log.Logger satisfies it. Messages are prefixed
+// with their level, ie "ERROR: ...".
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+const (
+	// LogDebug is for high volume messages such as successful validations, dropped unless
+	// the logger is a LeveledLogger with it enabled.
+	LogDebug LogLevel = iota
+	// LogInfo is for informative messages.
+	LogInfo
+	// LogWarning is for unexpected but handled situations.
+	LogWarning
+	// LogError is for failures.
+	LogError
+)
+
+var levelPrefixes = []struct {
+	prefix string
+	level  LogLevel
+}{
+	{"DEBUG:", LogDebug},
+	{"INFO:", LogInfo},
+	{"WARNING:", LogWarning},
+	{"ERROR:", LogError},
+}
+
+// levelOf returns the level of a message from its prefix, unprefixed messages are LogInfo.
+func levelOf(format string) LogLevel {
+	for _, lp := range levelPrefixes {
+		if strings.HasPrefix(format, lp.prefix) {
+			return lp.level
+		}
+	}
+	return LogInfo
+}
+
+// LeveledLogger wraps a Logger dropping messages below a minimum level and sampling the
+// ones of the levels with a sample rate set, which helps keeping webhook noise at bay.
+type LeveledLogger struct {
+	out Logger
+	min LogLevel
+
+	mu    sync.Mutex
+	rates map[LogLevel]float64
+	rnd   *rand.Rand
+}
+
+// NewLeveledLogger returns a LeveledLogger writing to out messages of level min and above.
+func NewLeveledLogger(out Logger, min LogLevel) *LeveledLogger {
+	return &LeveledLogger{
+		out:   out,
+		min:   min,
+		rates: map[LogLevel]float64{},
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetSampleRate makes the logger write only a rate (0 to 1) of the messages of the passed level,
+// ie SetSampleRate(LogDebug, 0.01) logs 1% of the successful validations.
+func (l *LeveledLogger) SetSampleRate(level LogLevel, rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rates[level] = rate
+}
+
+// Enabled returns true if messages of the passed level can be logged.
+func (l *LeveledLogger) Enabled(level LogLevel) bool {
+	return level >= l.min
+}
+
+// Printf implements Logger.
+func (l *LeveledLogger) Printf(format string, v ...interface{}) {
+	level := levelOf(format)
+	if !l.Enabled(level) || !l.sampled(level) {
+		return
+	}
+	l.out.Printf(format, v...)
+}
+
+func (l *LeveledLogger) sampled(level LogLevel) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rate, ok := l.rates[level]
+	if !ok {
+		return true
+	}
+	return l.rnd.Float64() < rate
+}
+
+// Debugf logs a debug message, only if logger is a LeveledLogger with debug enabled so plain
+// loggers are not flooded.
+func Debugf(logger Logger, format string, v ...interface{}) {
+	ll, ok := logger.(interface{ Enabled(LogLevel) bool })
+	if !ok || !ll.Enabled(LogDebug) {
+		return
+	}
+	logger.Printf("DEBUG: "+format, v...)
+}
+
+// redactingLogger sanitizes messages with storage.Redact before passing them on.
+type redactingLogger struct {
+	out Logger
+}
+
+// NewRedactingLogger returns a Logger that removes secrets from the messages before writing them
+// to out, the plugin wraps its logger with it. A nil out discards everything.
+func NewRedactingLogger(out Logger) Logger {
+	if rl, ok := out.(*redactingLogger); ok {
+		return rl
+	}
+	return &redactingLogger{out: out}
+}
+
+// Printf implements Logger.
+func (l *redactingLogger) Printf(format string, v ...interface{}) {
+	if l.out == nil {
+		return
+	}
+	l.out.Printf("%s", storage.Redact(fmt.Sprintf(format, v...)))
+}
+
+// Enabled forwards to the wrapped logger, see Debugf.
+func (l *redactingLogger) Enabled(level LogLevel) bool {
+	ll, ok := l.out.(interface{ Enabled(LogLevel) bool })
+	return ok && ll.Enabled(level)
+}
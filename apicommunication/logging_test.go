@@ -0,0 +1,80 @@
+package apicommunication
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+// recordingLogger keeps the messages logged.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func TestLeveledLogger(t *testing.T) {
+	out := &recordingLogger{}
+	l := NewLeveledLogger(out, LogInfo)
+	l.Printf("DEBUG: validated %s", "ck")
+	l.Printf("INFO: installed %s", "ck")
+	l.Printf("unprefixed")
+	l.Printf("ERROR: failed")
+	want := []string{"INFO: installed ck", "unprefixed", "ERROR: failed"}
+	if !reflect.DeepEqual(out.messages, want) {
+		t.Fatalf("logged %q, want %q", out.messages, want)
+	}
+
+	out.messages = nil
+	l.SetSampleRate(LogInfo, 0)
+	l.SetSampleRate(LogError, 1)
+	for i := 0; i < 10; i++ {
+		l.Printf("INFO: webhook received")
+		l.Printf("ERROR: webhook failed")
+	}
+	if len(out.messages) != 10 || out.messages[0] != "ERROR: webhook failed" {
+		t.Fatalf("sampled logger wrote %q", out.messages)
+	}
+}
+
+func TestDebugf(t *testing.T) {
+	out := &recordingLogger{}
+	Debugf(out, "validated %s", "ck")
+	Debugf(log.New(ioutil.Discard, "", 0), "validated %s", "ck")
+	Debugf(NewLeveledLogger(out, LogInfo), "validated %s", "ck")
+	if len(out.messages) != 0 {
+		t.Fatalf("debug messages reached loggers without debug enabled: %q", out.messages)
+	}
+	Debugf(NewLeveledLogger(out, LogDebug), "validated %s", "ck")
+	if len(out.messages) != 1 || out.messages[0] != "DEBUG: validated ck" {
+		t.Fatalf("logged %q", out.messages)
+	}
+}
+
+func TestNewRedactingLogger(t *testing.T) {
+	out := &recordingLogger{}
+	l := NewRedactingLogger(out)
+	if NewRedactingLogger(l) != l {
+		t.Fatal("wrapped a redacting logger twice")
+	}
+	l.Printf("ERROR: refusing %s", `{"sharedSecret":"s3cr3t"}`)
+	if len(out.messages) != 1 || out.messages[0] != `ERROR: refusing {"sharedSecret":"[REDACTED]"}` {
+		t.Fatalf("logged %q", out.messages)
+	}
+	NewRedactingLogger(nil).Printf("discarded")
+
+	Debugf(l, "validated %s", "ck")
+	Debugf(NewRedactingLogger(NewLeveledLogger(out, LogDebug)), "validated %s", "ck")
+	if len(out.messages) != 2 || out.messages[1] != "DEBUG: validated ck" {
+		t.Fatalf("debug messages went through as %q", out.messages)
+	}
+
+	err := wrapSentinel(ErrInvalidJWT, nil, "token %s", "eyJhbGciOiJIUzI1NiJ9.eyJpc3MiOiJjayJ9.c2ln")
+	if got := err.Error(); got != "token [REDACTED]" {
+		t.Fatalf("error reads %q", got)
+	}
+}
@@ -0,0 +1,161 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	stderrors "errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTenantInMaintenance is returned by clients using a MaintenanceTracker instead of calling a
+// tenant that is in a maintenance window.
+var ErrTenantInMaintenance = stderrors.New("tenant in maintenance")
+
+// maintenanceBodyPeek bounds how much of a 503 response is read looking for a maintenance notice.
+const maintenanceBodyPeek = 4096
+
+// MaintenanceCallback is invoked when a tenant enters a maintenance window that lasts until until.
+type MaintenanceCallback func(clientKey string, until time.Time)
+
+// MaintenanceTracker pauses calls to tenants undergoing atlassian maintenance, which jira signals
+// answering http.StatusServiceUnavailable with a Retry-After header or a maintenance notice. Once
+// one is seen calls to the tenant fail with ErrTenantInMaintenance, without reaching jira or being
+// retried, until the window passes. It can be shared by many clients and is safe for concurrent use.
+type MaintenanceTracker struct {
+	backoff       time.Duration
+	onMaintenance MaintenanceCallback
+	now           func() time.Time
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// NewMaintenanceTracker returns a MaintenanceTracker pausing tenants for the time jira asks in the
+// Retry-After header or for backoff if it does not, onMaintenance can be nil.
+func NewMaintenanceTracker(backoff time.Duration, onMaintenance MaintenanceCallback) *MaintenanceTracker {
+	return &MaintenanceTracker{
+		backoff:       backoff,
+		onMaintenance: onMaintenance,
+		now:           time.Now,
+		until:         map[string]time.Time{},
+	}
+}
+
+// WithMaintenanceTracker makes the client pause calls to tenants in maintenance as seen by m.
+func WithMaintenanceTracker(m *MaintenanceTracker) HostClientOption {
+	return func(h *HostClient) {
+		h.maintenance = m
+	}
+}
+
+// InMaintenance returns the end of the maintenance window of the tenant, if it is in one.
+func (m *MaintenanceTracker) InMaintenance(clientKey string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, ok := m.until[clientKey]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !m.now().Before(until) {
+		delete(m.until, clientKey)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// Clear ends the maintenance window of the tenant, ie when told by atlassian it is over.
+func (m *MaintenanceTracker) Clear(clientKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.until, clientKey)
+}
+
+// check returns ErrTenantInMaintenance if the tenant is in a maintenance window.
+func (m *MaintenanceTracker) check(clientKey string) error {
+	if until, ok := m.InMaintenance(clientKey); ok {
+		return wrapSentinel(ErrTenantInMaintenance, nil, "tenant %s is in maintenance until %s",
+			clientKey, until.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// observe starts a maintenance window for the tenant if resp announces one and returns whether it did.
+func (m *MaintenanceTracker) observe(clientKey string, resp *http.Response) bool {
+	if resp == nil || !isMaintenanceResponse(resp) {
+		return false
+	}
+	wait, ok := retryAfterHeader(resp, m.now())
+	if !ok {
+		wait = m.backoff
+	}
+	until := m.now().Add(wait)
+	m.mu.Lock()
+	current, inMaintenance := m.until[clientKey]
+	inMaintenance = inMaintenance && m.now().Before(current)
+	if !inMaintenance || until.After(current) {
+		m.until[clientKey] = until
+	}
+	m.mu.Unlock()
+	if !inMaintenance && m.onMaintenance != nil {
+		m.onMaintenance(clientKey, until)
+	}
+	return true
+}
+
+// isMaintenanceResponse returns true for 503 responses with a Retry-After header or a body
+// mentioning maintenance, the body is left unread for the caller.
+func isMaintenanceResponse(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	if resp.Header.Get("Retry-After") != "" {
+		return true
+	}
+	if resp.Body == nil {
+		return false
+	}
+	peek, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maintenanceBodyPeek))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+	return strings.Contains(strings.ToLower(string(peek)), "maintenance")
+}
+
+// retryAfterHeader returns the wait asked for in the Retry-After header of resp, which can be a
+// number of seconds or a date.
+func retryAfterHeader(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,87 @@
+package apicommunication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithMaintenanceTracker(t *testing.T) {
+	calls := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "Jira is undergoing scheduled Maintenance")
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	var notified []time.Time
+	m := NewMaintenanceTracker(time.Hour, func(clientKey string, until time.Time) {
+		if clientKey != tenant.ClientKey {
+			t.Errorf("notified of maintenance of %s", clientKey)
+		}
+		notified = append(notified, until)
+	})
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport,
+		WithTimeoutProfile(ProfileBatch), WithMaintenanceTracker(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := hc.Do(http.MethodGet, myselfPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || string(body) != "Jira is undergoing scheduled Maintenance" {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+	if calls != 1 {
+		t.Fatalf("maintenance response was retried, %d calls", calls)
+	}
+	if _, err := hc.Do(http.MethodGet, myselfPath, nil, nil); !errors.Is(err, ErrTenantInMaintenance) {
+		t.Fatalf("calling during maintenance returned %v", err)
+	}
+	if calls != 1 || len(notified) != 1 {
+		t.Fatalf("%d calls and %d notifications", calls, len(notified))
+	}
+	if until, ok := m.InMaintenance(tenant.ClientKey); !ok || time.Until(until) < 59*time.Minute {
+		t.Fatalf("maintenance window ends at %v, %v", until, ok)
+	}
+
+	m.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, ok := m.InMaintenance(tenant.ClientKey); ok {
+		t.Fatal("maintenance window did not end")
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{now.Add(time.Hour).Format(http.TimeFormat), time.Hour, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		if got, ok := retryAfterHeader(resp, now); got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfterHeader(%q) = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	userBulkPath   = "/rest/api/3/user/bulk"
+	userSearchPath = "/rest/api/3/user/search"
+)
+
+// userBulkBatch is the number of account ids read per request, jira caps the page size of the
+// bulk user API.
+const userBulkBatch = 50
+
+// adfMentionType is the type of the ADF nodes mentioning users, their attrs hold the accountId in
+// id and the display name, prefixed with @, in text.
+const adfMentionType = "mention"
+
+// walkADF invokes f with every node of the ADF document node, as decoded by encoding/json, parents
+// before their content.
+func walkADF(node interface{}, f func(node map[string]interface{})) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		f(n)
+		walkADF(n["content"], f)
+	case []interface{}:
+		for _, c := range n {
+			walkADF(c, f)
+		}
+	}
+}
+
+// walkMentions invokes f with the attrs of every mention in the ADF document doc.
+func walkMentions(doc interface{}, f func(attrs map[string]interface{})) {
+	walkADF(doc, func(node map[string]interface{}) {
+		if node["type"] != adfMentionType {
+			return
+		}
+		if attrs, ok := node["attrs"].(map[string]interface{}); ok {
+			f(attrs)
+		}
+	})
+}
+
+// MentionedAccountIDs returns the accountId of the users mentioned in the ADF document doc, such as
+// the body of a comment decoded by encoding/json, in order of first mention.
+func MentionedAccountIDs(doc interface{}) []string {
+	var ids []string
+	seen := map[string]bool{}
+	walkMentions(doc, func(attrs map[string]interface{}) {
+		id, _ := attrs["id"].(string)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	})
+	return ids
+}
+
+// UsersByAccountID returns the users with the passed account ids, read in batches from the bulk
+// user API. Users jira does not know are missing from the result.
+func (h *HostClient) UsersByAccountID(accountIDs []string) (map[string]*User, error) {
+	return h.UsersByAccountIDCtx(context.Background(), accountIDs)
+}
+
+// UsersByAccountIDCtx behaves like UsersByAccountID bound to ctx, see DoCtx.
+func (h *HostClient) UsersByAccountIDCtx(ctx context.Context, accountIDs []string) (map[string]*User, error) {
+	users := map[string]*User{}
+	for start := 0; start < len(accountIDs); start += userBulkBatch {
+		end := start + userBulkBatch
+		if end > len(accountIDs) {
+			end = len(accountIDs)
+		}
+		// the ids are repeated query arguments, which Do can only take as part of the path.
+		query := url.Values{"accountId": accountIDs[start:end]}
+		page := &PageBeanUser{}
+		_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("UsersByAccountID", userBulkPath)+"?"+query.Encode(),
+			map[string]string{"maxResults": fmt.Sprint(end - start)}, nil, page, []int{http.StatusOK})
+		if err != nil {
+			return nil, fmt.Errorf("reading users: %w", err)
+		}
+		for i := range page.Values {
+			users[page.Values[i].AccountID] = &page.Values[i]
+		}
+	}
+	return users, nil
+}
+
+// NameMentions sets the text of every mention in the ADF document doc to @ followed by the current
+// display name of the user, jira keeps the name the user had when mentioned or none at all, so
+// documents mirrored into external systems show who was mentioned. Users are resolved with a single
+// batch of requests, mentions of users jira does not know are left as they are.
+func (h *HostClient) NameMentions(doc interface{}) error {
+	return h.NameMentionsCtx(context.Background(), doc)
+}
+
+// NameMentionsCtx behaves like NameMentions bound to ctx, see DoCtx.
+func (h *HostClient) NameMentionsCtx(ctx context.Context, doc interface{}) error {
+	ids := MentionedAccountIDs(doc)
+	if len(ids) == 0 {
+		return nil
+	}
+	users, err := h.UsersByAccountIDCtx(ctx, ids)
+	if err != nil {
+		return err
+	}
+	walkMentions(doc, func(attrs map[string]interface{}) {
+		id, _ := attrs["id"].(string)
+		if u, ok := users[id]; ok && u.DisplayName != "" {
+			attrs["text"] = "@" + u.DisplayName
+		}
+	})
+	return nil
+}
+
+// AccountIDsByName returns the accountId of the users with the passed display names, searching jira
+// once per name. Names matching no user, or more than one exactly (ignoring case), are missing from
+// the result since they can not be mentioned unambiguously.
+func (h *HostClient) AccountIDsByName(names []string) (map[string]string, error) {
+	return h.AccountIDsByNameCtx(context.Background(), names)
+}
+
+// AccountIDsByNameCtx behaves like AccountIDsByName bound to ctx, see DoCtx.
+func (h *HostClient) AccountIDsByNameCtx(ctx context.Context, names []string) (map[string]string, error) {
+	ids := map[string]string{}
+	for _, name := range names {
+		if _, done := ids[name]; done || name == "" {
+			continue
+		}
+		var users []User
+		_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("AccountIDsByName", userSearchPath),
+			map[string]string{"query": name}, nil, &users, []int{http.StatusOK})
+		if err != nil {
+			return nil, fmt.Errorf("searching user %q: %w", name, err)
+		}
+		var matches []string
+		for _, u := range users {
+			if strings.EqualFold(u.DisplayName, name) {
+				matches = append(matches, u.AccountID)
+			}
+		}
+		if len(matches) == 1 {
+			ids[name] = matches[0]
+		}
+	}
+	return ids, nil
+}
+
+// MentionDocument returns an ADF document with a paragraph per line of text, as written in an
+// external system, where @ followed by a name in accountIDs, ie from AccountIDsByName, is a mention
+// of the user. Longer names are matched first, so "@Ann Lee" is not taken for a mention of "Ann".
+func MentionDocument(text string, accountIDs map[string]string) map[string]interface{} {
+	names := make([]string, 0, len(accountIDs))
+	for name := range accountIDs {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	paragraphs := []interface{}{}
+	for _, line := range strings.Split(text, "\n") {
+		paragraph := map[string]interface{}{"type": "paragraph"}
+		if content := mentionInlines(line, names, accountIDs); len(content) > 0 {
+			paragraph["content"] = content
+		}
+		paragraphs = append(paragraphs, paragraph)
+	}
+	return map[string]interface{}{"type": "doc", "version": 1, "content": paragraphs}
+}
+
+// mentionInlines splits line into text and mention nodes, see MentionDocument.
+func mentionInlines(line string, names []string, accountIDs map[string]string) []interface{} {
+	var nodes []interface{}
+	var pending strings.Builder
+	flush := func() {
+		if pending.Len() > 0 {
+			nodes = append(nodes, map[string]interface{}{"type": "text", "text": pending.String()})
+			pending.Reset()
+		}
+	}
+	for i := 0; i < len(line); {
+		if line[i] == '@' {
+			if name := mentionAt(line[i+1:], names); name != "" {
+				flush()
+				nodes = append(nodes, map[string]interface{}{
+					"type":  adfMentionType,
+					"attrs": map[string]interface{}{"id": accountIDs[name], "text": "@" + name},
+				})
+				i += 1 + len(name)
+				continue
+			}
+		}
+		pending.WriteByte(line[i])
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// mentionAt returns the name, of the ones passed, rest starts with as a whole word, "" if none.
+func mentionAt(rest string, names []string) string {
+	for _, name := range names {
+		if !strings.HasPrefix(rest, name) {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(rest[len(name):])
+		if next == utf8.RuneError || !(unicode.IsLetter(next) || unicode.IsDigit(next)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// ADFText returns the text of the ADF document doc with mentions as their text, ie "@Ann Lee",
+// and a line per block, for external systems that only take plain text.
+func ADFText(doc interface{}) string {
+	var b strings.Builder
+	walkADF(doc, func(node map[string]interface{}) {
+		switch node["type"] {
+		case "text":
+			text, _ := node["text"].(string)
+			b.WriteString(text)
+		case adfMentionType:
+			attrs, _ := node["attrs"].(map[string]interface{})
+			text, _ := attrs["text"].(string)
+			b.WriteString(text)
+		case "hardBreak":
+			b.WriteString("\n")
+		case "paragraph", "heading", "codeBlock", "listItem":
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString("\n")
+			}
+		}
+	})
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	directory := []User{
+		{AccountID: "id-ann", DisplayName: "Ann"},
+		{AccountID: "id-ann-lee", DisplayName: "Ann Lee"},
+		{AccountID: "id-bob-1", DisplayName: "Bob"},
+		{AccountID: "id-bob-2", DisplayName: "Bob"},
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var found []User
+		switch r.URL.Path {
+		case userBulkPath:
+			for _, id := range r.URL.Query()["accountId"] {
+				for _, u := range directory {
+					if u.AccountID == id {
+						found = append(found, u)
+					}
+				}
+			}
+			json.NewEncoder(w).Encode(PageBeanUser{Values: found, IsLast: true})
+		case userSearchPath:
+			for _, u := range directory {
+				if u.DisplayName == r.URL.Query().Get("query") {
+					found = append(found, u)
+				}
+			}
+			json.NewEncoder(w).Encode(found)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := hc.AccountIDsByName([]string{"Ann", "Ann Lee", "Bob", "Carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Ann": "id-ann", "Ann Lee": "id-ann-lee"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("resolved %v", ids)
+	}
+	doc := MentionDocument("hi @Ann Lee and @Ann,\n@Annette and @Bob", ids)
+	if got := MentionedAccountIDs(doc); !reflect.DeepEqual(got, []string{"id-ann-lee", "id-ann"}) {
+		t.Fatalf("mentioned %v", got)
+	}
+
+	// a document as jira sends it, with names as they were when mentioned.
+	var body interface{}
+	raw, _ := json.Marshal(doc)
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatal(err)
+	}
+	walkMentions(body, func(attrs map[string]interface{}) { attrs["text"] = "@someone" })
+	if err := hc.NameMentions(body); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ADFText(body), "hi @Ann Lee and @Ann,\n@Annette and @Bob"; got != want {
+		t.Fatalf("text is %q, want %q", got, want)
+	}
+}
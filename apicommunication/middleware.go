@@ -0,0 +1,124 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+type tenantContextKey struct{}
+
+type claimsContextKey struct{}
+
+// ContextWithTenant returns a copy of ctx carrying the passed install information and claims,
+// claims can be nil if the tenant was not obtained from a JWT.
+func ContextWithTenant(ctx context.Context, jii *storage.JiraInstallInformation, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, tenantContextKey{}, jii)
+	if claims != nil {
+		ctx = context.WithValue(ctx, claimsContextKey{}, claims)
+	}
+	return ctx
+}
+
+// TenantFromContext returns the validated install information stored in the context, if any.
+func TenantFromContext(ctx context.Context) (*storage.JiraInstallInformation, bool) {
+	jii, ok := ctx.Value(tenantContextKey{}).(*storage.JiraInstallInformation)
+	return jii, ok && jii != nil
+}
+
+// ClaimsFromContext returns the claims of the validated JWT stored in the context, if any.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// AccountIDFromContext returns the accountId of the user the validated JWT stored in the context
+// was signed for, if any, so handlers can authorize users without parsing the token again.
+func AccountIDFromContext(ctx context.Context) (string, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	id := claims.AccountID()
+	return id, id != ""
+}
+
+// StatusForError returns the status code to answer with when validating a request failed with err.
+func StatusForError(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidJWT), errors.Is(err, ErrExpiredToken), errors.Is(err, ErrNoInstallInfo):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrStoreUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// MiddlewareOptions customizes the handler returned by Middleware, the zero value is usable.
+type MiddlewareOptions struct {
+	// Sources are where the JWT is looked for, DefaultTokenSources if unset.
+	Sources TokenSource
+	// ReplayCache, if set, rejects tokens presented more than once.
+	ReplayCache ReplayCache
+	// Logger receives validation failures, they are not logged if unset.
+	Logger Logger
+	// OnError answers requests that failed validation, by default only the status is written.
+	OnError func(w http.ResponseWriter, r *http.Request, status int, err error)
+}
+
+// Middleware returns a standard middleware validating the connect JWT of requests against the
+// install information in st, the tenant and claims are stored in the request context (see
+// TenantFromContext) before invoking the wrapped handler. It can be used with any router, without
+// a handling.Plugin.
+func Middleware(st storage.Store, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	sources := opts.Sources
+	if sources == 0 {
+		sources = DefaultTokenSources
+	}
+	fail := func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		if opts.Logger != nil {
+			opts.Logger.Printf("ERROR: [%s] Validating jira JWT: %v", RequestIDFromContext(r.Context()), err)
+		}
+		if opts.OnError != nil {
+			opts.OnError(w, r, status, err)
+			return
+		}
+		w.WriteHeader(status)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			jii, claims, err := ValidateRequestFrom(r, st, sources)
+			if err != nil {
+				fail(w, r, StatusForError(err), err)
+				return
+			}
+			if jii == nil {
+				fail(w, r, http.StatusUnauthorized, ErrNoInstallInfo)
+				return
+			}
+			if opts.ReplayCache != nil {
+				if err := CheckReplay(opts.ReplayCache, claims); err != nil {
+					fail(w, r, http.StatusUnauthorized, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithTenant(r.Context(), jii, claims)))
+		})
+	}
+}
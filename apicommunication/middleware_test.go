@@ -0,0 +1,183 @@
+package apicommunication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestMiddleware(t *testing.T) {
+	var tenant string
+	h := Middleware(&singleTenantStore{jii: benchTenant}, MiddlewareOptions{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			jii, ok := TenantFromContext(r.Context())
+			if !ok {
+				t.Fatal("no tenant in context")
+			}
+			if _, ok := ClaimsFromContext(r.Context()); !ok {
+				t.Fatal("no claims in context")
+			}
+			tenant = jii.ClientKey
+		}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, signedBenchRequest(t))
+	if rec.Code != http.StatusOK || tenant != benchTenant.ClientKey {
+		t.Fatalf("signed request got %d for tenant %q", rec.Code, tenant)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned request got %d", rec.Code)
+	}
+
+	unknown := Middleware(&singleTenantStore{}, MiddlewareOptions{})(http.NotFoundHandler())
+	rec = httptest.NewRecorder()
+	unknown.ServeHTTP(rec, signedBenchRequest(t))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("request of unknown tenant got %d", rec.Code)
+	}
+}
+
+func TestValidateToken_rotatedSecret(t *testing.T) {
+	sign := func(secret string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": benchTenant.ClientKey,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	rotated := *benchTenant
+	rotated.SharedSecret = "rotated-secret"
+	rotated.PreviousSharedSecret = benchTenant.SharedSecret
+	rotated.PreviousSharedSecretExpiry = time.Now().Add(time.Minute).Unix()
+	if _, _, err := ValidateToken(sign(benchTenant.SharedSecret), &singleTenantStore{jii: &rotated}); err != nil {
+		t.Fatalf("token signed with the previous secret was refused: %v", err)
+	}
+	rotated.PreviousSharedSecretExpiry = time.Now().Add(-time.Minute).Unix()
+	if _, _, err := ValidateToken(sign(benchTenant.SharedSecret), &singleTenantStore{jii: &rotated}); !errors.Is(err, ErrInvalidJWT) {
+		t.Fatalf("token signed with an expired previous secret returned %v", err)
+	}
+
+	// a replica caching the secret from before the rotation reads it again.
+	backing := storage.NewMemoryStore(0)
+	cached := storage.NewCachedStore(backing, time.Hour)
+	if err := cached.SaveJiraInstallInformation(benchTenant); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.JiraInstallInformation(benchTenant.ClientKey); err != nil {
+		t.Fatal(err)
+	}
+	backing.Preload(&rotated)
+	jii, _, err := ValidateToken(sign(rotated.SharedSecret), cached)
+	if err != nil {
+		t.Fatalf("token signed with a secret rotated elsewhere was refused: %v", err)
+	}
+	if jii.SharedSecret != rotated.SharedSecret {
+		t.Fatalf("validated with %+v", jii)
+	}
+	if _, _, err := ValidateToken(sign("forged"), cached); !errors.Is(err, ErrInvalidJWT) {
+		t.Fatalf("forged token returned %v", err)
+	}
+}
+
+// countingStore counts the reads of the wrapped store.
+type countingStore struct {
+	storage.Store
+	mu    sync.Mutex
+	reads int
+}
+
+func (c *countingStore) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	c.mu.Lock()
+	c.reads++
+	c.mu.Unlock()
+	return c.Store.JiraInstallInformation(clientKey)
+}
+
+func TestValidateToken_rotationRefreshDebounced(t *testing.T) {
+	defer func(d *refreshDebouncer) { rotationRefreshes = d }(rotationRefreshes)
+	rotationRefreshes = newRefreshDebouncer(time.Minute)
+	now := time.Now()
+	rotationRefreshes.now = func() time.Time { return now }
+
+	tenant := *benchTenant
+	tenant.ClientKey = "debounced"
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": tenant.ClientKey,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("forged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backing := &countingStore{Store: storage.NewMemoryStore(0)}
+	cached := storage.NewCachedStore(backing, time.Hour)
+	if err := cached.SaveJiraInstallInformation(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.JiraInstallInformation(tenant.ClientKey); err != nil {
+		t.Fatal(err)
+	}
+	backing.reads = 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := ValidateToken(forged, cached); !errors.Is(err, ErrInvalidJWT) {
+				t.Errorf("forged token returned %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if _, _, err := ValidateToken(forged, cached); !errors.Is(err, ErrInvalidJWT) {
+			t.Fatalf("forged token returned %v", err)
+		}
+	}
+	if backing.reads != 1 {
+		t.Fatalf("forged tokens caused %d reads of the backing store", backing.reads)
+	}
+
+	now = now.Add(time.Minute)
+	if _, _, err := ValidateToken(forged, cached); !errors.Is(err, ErrInvalidJWT) {
+		t.Fatalf("forged token returned %v", err)
+	}
+	if backing.reads != 2 {
+		t.Fatalf("the tenant was not read again once the interval elapsed, %d reads", backing.reads)
+	}
+}
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid jwt", ErrInvalidJWT, http.StatusUnauthorized},
+		{"expired token", ErrExpiredToken, http.StatusUnauthorized},
+		{"no install info", ErrNoInstallInfo, http.StatusUnauthorized},
+		{"wrapped", fmt.Errorf("validating: %w", ErrExpiredToken), http.StatusUnauthorized},
+		{"store unavailable", fmt.Errorf("reading tenant: %w", ErrStoreUnavailable), http.StatusServiceUnavailable},
+		{"other", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusForError(tt.err); got != tt.want {
+				t.Errorf("StatusForError() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const notificationSchemePath = "/rest/api/3/notificationscheme"
+
+// Jira system events notification schemes send emails for, see
+// https://confluence.atlassian.com/adminjiracloud/creating-a-notification-scheme-776636482.html
+const (
+	EventIssueCreated   int64 = 1
+	EventIssueUpdated   int64 = 2
+	EventIssueAssigned  int64 = 3
+	EventIssueResolved  int64 = 4
+	EventIssueClosed    int64 = 5
+	EventIssueCommented int64 = 6
+	EventIssueReopened  int64 = 7
+	EventIssueDeleted   int64 = 8
+	EventIssueMoved     int64 = 9
+	EventWorkLogged     int64 = 10
+	EventWorkStarted    int64 = 11
+	EventWorkStopped    int64 = 12
+	EventGeneric        int64 = 13
+	EventCommentEdited  int64 = 14
+	EventWorklogUpdated int64 = 15
+	EventWorklogDeleted int64 = 16
+	EventCommentDeleted int64 = 17
+	EventIssueArchived  int64 = 18
+	EventIssueRestored  int64 = 19
+)
+
+// Notification types of the recipients of an event, the meaning of EventNotification.Parameter
+// depends on them.
+const (
+	NotifyCurrentAssignee  = "CurrentAssignee"
+	NotifyReporter         = "Reporter"
+	NotifyCurrentUser      = "CurrentUser"
+	NotifyProjectLead      = "ProjectLead"
+	NotifyComponentLead    = "ComponentLead"
+	NotifyUser             = "User"
+	NotifyGroup            = "Group"
+	NotifyProjectRole      = "ProjectRole"
+	NotifyEmailAddress     = "EmailAddress"
+	NotifyAllWatchers      = "AllWatchers"
+	NotifyUserCustomField  = "UserCustomField"
+	NotifyGroupCustomField = "GroupCustomField"
+)
+
+// NotificationSchemes returns every notification scheme of the tenant with their events and
+// recipients.
+func (h *HostClient) NotificationSchemes() ([]NotificationScheme, error) {
+	return h.NotificationSchemesCtx(context.Background())
+}
+
+// NotificationSchemesCtx behaves like NotificationSchemes bound to ctx, see DoCtx.
+func (h *HostClient) NotificationSchemesCtx(ctx context.Context) ([]NotificationScheme, error) {
+	var schemes []NotificationScheme
+	var startAt int64
+	for {
+		page := &PageBeanNotificationScheme{}
+		_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("NotificationSchemes", notificationSchemePath), map[string]string{
+			"startAt": strconv.FormatInt(startAt, 10),
+			"expand":  "all",
+		}, nil, page, []int{http.StatusOK})
+		if err != nil {
+			return nil, fmt.Errorf("listing notification schemes: %w", err)
+		}
+		schemes = append(schemes, page.Values...)
+		startAt += int64(len(page.Values))
+		if page.IsLast || len(page.Values) == 0 {
+			return schemes, nil
+		}
+	}
+}
+
+// NotificationScheme returns the notification scheme with the passed id with its events and
+// recipients.
+func (h *HostClient) NotificationScheme(id int64) (*NotificationScheme, error) {
+	return h.NotificationSchemeCtx(context.Background(), id)
+}
+
+// NotificationSchemeCtx behaves like NotificationScheme bound to ctx, see DoCtx.
+func (h *HostClient) NotificationSchemeCtx(ctx context.Context, id int64) (*NotificationScheme, error) {
+	scheme := &NotificationScheme{}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("NotificationScheme", fmt.Sprintf("%s/%d", notificationSchemePath, id)),
+		map[string]string{"expand": "all"}, nil, scheme, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading notification scheme %d: %w", id, err)
+	}
+	return scheme, nil
+}
+
+// ProjectNotificationScheme returns the notification scheme used by the project with the passed
+// key or id, with its events and recipients.
+func (h *HostClient) ProjectNotificationScheme(projectKeyOrID string) (*NotificationScheme, error) {
+	return h.ProjectNotificationSchemeCtx(context.Background(), projectKeyOrID)
+}
+
+// ProjectNotificationSchemeCtx behaves like ProjectNotificationScheme bound to ctx, see DoCtx.
+func (h *HostClient) ProjectNotificationSchemeCtx(ctx context.Context, projectKeyOrID string) (*NotificationScheme, error) {
+	scheme := &NotificationScheme{}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet,
+		h.api("ProjectNotificationScheme",
+			fmt.Sprintf("%s/%s/notificationscheme", projectPath, url.PathEscape(projectKeyOrID))),
+		map[string]string{"expand": "all"}, nil, scheme, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading notification scheme of project %s: %w", projectKeyOrID, err)
+	}
+	return scheme, nil
+}
+
+// Recipients returns who the scheme notifies of the event with the passed id, it is empty if the
+// event sends no emails.
+func (s *NotificationScheme) Recipients(eventID int64) []EventNotification {
+	for _, e := range s.NotificationSchemeEvents {
+		if e.Event.ID == eventID {
+			return e.Notifications
+		}
+	}
+	return nil
+}
+
+// Describe returns a human readable description of the recipient, ie to explain in an app why a
+// user did or did not get an email.
+func (n *EventNotification) Describe() string {
+	switch n.NotificationType {
+	case NotifyUser:
+		if n.User.UserDetails != nil && n.User.DisplayName != "" {
+			return "user " + n.User.DisplayName
+		}
+		return "user " + n.Parameter
+	case NotifyGroup:
+		return "members of group " + n.Parameter
+	case NotifyProjectRole:
+		if n.ProjectRole.ProjectRole != nil && n.ProjectRole.Name != "" {
+			return "members of project role " + n.ProjectRole.Name
+		}
+		return "members of project role " + n.Parameter
+	case NotifyEmailAddress:
+		return "email address " + n.EmailAddress
+	case NotifyUserCustomField, NotifyGroupCustomField:
+		if n.Field.FieldDetails != nil && n.Field.Name != "" {
+			return "users in field " + n.Field.Name
+		}
+		return "users in field " + n.Parameter
+	case NotifyCurrentAssignee:
+		return "the assignee"
+	case NotifyReporter:
+		return "the reporter"
+	case NotifyCurrentUser:
+		return "the user who made the change"
+	case NotifyProjectLead:
+		return "the project lead"
+	case NotifyComponentLead:
+		return "the component lead"
+	case NotifyAllWatchers:
+		return "all watchers"
+	}
+	if n.Parameter != "" {
+		return n.NotificationType + " " + n.Parameter
+	}
+	return n.NotificationType
+}
+
+// NotificationRecipient adds a recipient to an event of a notification scheme, Parameter holds the
+// account id, group name, project role id or custom field id as required by NotificationType.
+type NotificationRecipient struct {
+	NotificationType string `json:"notificationType"`
+	Parameter        string `json:"parameter,omitempty"`
+}
+
+type notificationSchemeEventUpdate struct {
+	Event struct {
+		ID string `json:"id"`
+	} `json:"event"`
+	Notifications []NotificationRecipient `json:"notifications"`
+}
+
+// AddNotificationRecipients makes the scheme with the passed id notify recipients of the event with
+// the passed id, which requires the ADMIN scope.
+func (h *HostClient) AddNotificationRecipients(schemeID, eventID int64, recipients ...NotificationRecipient) error {
+	return h.AddNotificationRecipientsCtx(context.Background(), schemeID, eventID, recipients...)
+}
+
+// AddNotificationRecipientsCtx behaves like AddNotificationRecipients bound to ctx, see DoCtx.
+func (h *HostClient) AddNotificationRecipientsCtx(ctx context.Context, schemeID, eventID int64, recipients ...NotificationRecipient) error {
+	update := notificationSchemeEventUpdate{Notifications: recipients}
+	update.Event.ID = strconv.FormatInt(eventID, 10)
+	body, err := json.Marshal(map[string]interface{}{
+		"notificationSchemeEvents": []notificationSchemeEventUpdate{update},
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling notification recipients: %w", err)
+	}
+	_, err = h.DoWithTargetCtx(ctx, http.MethodPut,
+		h.api("AddNotificationRecipients", fmt.Sprintf("%s/%d/notification", notificationSchemePath, schemeID)),
+		nil, bytes.NewReader(body), nil, []int{http.StatusNoContent, http.StatusOK})
+	if err != nil {
+		return fmt.Errorf("adding recipients to notification scheme %d: %w", schemeID, err)
+	}
+	return nil
+}
+
+// RemoveNotificationRecipient removes the recipient with the passed id, EventNotification.ID, from
+// the scheme with the passed id, which requires the ADMIN scope.
+func (h *HostClient) RemoveNotificationRecipient(schemeID, notificationID int64) error {
+	return h.RemoveNotificationRecipientCtx(context.Background(), schemeID, notificationID)
+}
+
+// RemoveNotificationRecipientCtx behaves like RemoveNotificationRecipient bound to ctx, see DoCtx.
+func (h *HostClient) RemoveNotificationRecipientCtx(ctx context.Context, schemeID, notificationID int64) error {
+	_, err := h.DoWithTargetCtx(ctx, http.MethodDelete,
+		h.api("RemoveNotificationRecipient",
+			fmt.Sprintf("%s/%d/notification/%d", notificationSchemePath, schemeID, notificationID)),
+		nil, nil, nil, []int{http.StatusNoContent, http.StatusOK})
+	if err != nil {
+		return fmt.Errorf("removing recipient %d from notification scheme %d: %w", notificationID, schemeID, err)
+	}
+	return nil
+}
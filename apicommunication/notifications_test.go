@@ -0,0 +1,34 @@
+package apicommunication
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNotificationScheme_Recipients(t *testing.T) {
+	scheme := &NotificationScheme{}
+	err := json.Unmarshal([]byte(`{"id": 10000, "name": "Default", "notificationSchemeEvents": [
+		{"event": {"id": 1, "name": "Issue created"}, "notifications": [
+			{"id": 1, "notificationType": "Group", "parameter": "jira-administrators"},
+			{"id": 2, "notificationType": "CurrentAssignee"},
+			{"id": 3, "notificationType": "ProjectRole", "parameter": "10360",
+			 "projectRole": {"name": "Developers"}}
+		]}
+	]}`), scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scheme.Recipients(EventIssueDeleted); len(got) != 0 {
+		t.Fatalf("issue deleted notifies %v", got)
+	}
+	want := []string{"members of group jira-administrators", "the assignee", "members of project role Developers"}
+	got := scheme.Recipients(EventIssueCreated)
+	if len(got) != len(want) {
+		t.Fatalf("got %d recipients, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if d := got[i].Describe(); d != want[i] {
+			t.Errorf("recipient %d described as %q, want %q", i, d, want[i])
+		}
+	}
+}
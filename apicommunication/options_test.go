@@ -0,0 +1,138 @@
+package apicommunication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestHostAllowed(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.atlassian.net", true},
+		{"EXAMPLE.atlassian.net:443", true},
+		{"atlassian.net", false},
+		{"example.atlassian.net.evil.com", false},
+		{"evilatlassian.net", false},
+		{"169.254.169.254", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := HostAllowed(tt.host, AtlassianHostSuffixes); got != tt.want {
+				t.Errorf("HostAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithAuthorizationServer(t *testing.T) {
+	var tokenRequests int
+	var authorization string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/staging/token":
+			tokenRequests++
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"user-token","token_type":"Bearer","expires_in":900}`))
+		case myselfPath:
+			authorization = r.Header.Get("Authorization")
+			w.Write([]byte(`{"accountId":"someaccountid"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	tenant.OauthClientID = "oauth-client"
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "someaccountid", []string{"READ"},
+		srv.Client().Transport, WithAuthorizationServer(srv.URL+"/staging", "/token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hc.DoWithTarget(http.MethodGet, myselfPath, nil, nil, nil, []int{http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	if tokenRequests != 1 || authorization != "Bearer user-token" {
+		t.Fatalf("asked the overridden server for %d tokens and sent %q", tokenRequests, authorization)
+	}
+	// clients of a manager are built with its options.
+	st := storage.NewMemoryStore(0)
+	if err := st.SaveJiraInstallInformation(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	managed, err := NewClientManager(context.Background(), st, nil, WithAuthorizationServer(srv.URL+"/staging", "/token")).
+		Client(tenant.ClientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if managed.authorizationServerBaseURL != srv.URL+"/staging" || managed.authorizationPath != "/token" {
+		t.Fatal("the client manager dropped the authorization server")
+	}
+}
+
+func TestWithProxyFunc(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := (&http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}).BasicAuth()
+		proxied = append(proxied, r.URL.Host+" "+user+":"+pass)
+		w.Write([]byte(`{}`))
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL.User = url.UserPassword("acme", "s3cr3t")
+	proxies := func(jii *storage.JiraInstallInformation) (*url.URL, error) {
+		switch jii.ClientKey {
+		case "proxied":
+			return proxyURL, nil
+		case "broken":
+			return nil, errors.New("no proxy for you")
+		}
+		return nil, nil
+	}
+	client := func(clientKey string, roundtripper http.RoundTripper) (*HostClient, error) {
+		tenant := *benchTenant
+		tenant.ClientKey = clientKey
+		tenant.BaseURL = "http://" + clientKey + ".jira.invalid"
+		return NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, roundtripper, WithProxyFunc(proxies))
+	}
+
+	hc, err := client("proxied", &http.Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hc.DoWithTarget(http.MethodGet, myselfPath, nil, nil, nil, []int{http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 1 || proxied[0] != "proxied.jira.invalid acme:s3cr3t" {
+		t.Fatalf("proxy got %q", proxied)
+	}
+	if _, err := client("broken", &http.Transport{}); err == nil {
+		t.Fatal("created a client whose proxy could not be obtained")
+	}
+	if _, err := client("proxied", roundTripperFunc(http.DefaultTransport.RoundTrip)); err == nil {
+		t.Fatal("created a proxied client with a transport that can not use proxies")
+	}
+	// tenants without a proxy keep any transport.
+	if _, err := client("direct", roundTripperFunc(http.DefaultTransport.RoundTrip)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper that is not an *http.Transport.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
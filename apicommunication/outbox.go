@@ -0,0 +1,208 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+const (
+	defaultOutboxBatch     = 50
+	maxOutboxRetryInterval = time.Hour
+	// outboxLease is held by the dispatcher sending a batch, so dispatchers of other replicas
+	// don't send the same messages, it is renewed for outboxLeaseTTL before each message.
+	outboxLease    = "outbox"
+	outboxLeaseTTL = 5 * time.Minute
+)
+
+// OutboxDispatcher performs the jira writes enqueued in an outbox, retrying them with exponential
+// backoff, so a crash between receiving a webhook and writing to jira does not lose the write.
+type OutboxDispatcher struct {
+	store       storage.Store
+	outbox      storage.OutboxStore
+	leases      storage.LeaseStore
+	owner       string
+	logger      Logger
+	scopes      []string
+	maxAttempts int
+	retryAfter  time.Duration
+}
+
+// NewOutboxDispatcher returns a dispatcher for the messages in outbox, install information for the
+// tenants is read from st. Failed writes are retried after retryAfter, doubling each time, until
+// maxAttempts is reached.
+// If outbox also implements storage.LeaseStore, as MemoryStore does, batches are sent holding a
+// lease so dispatchers running in several replicas don't send the same messages, otherwise only one
+// replica must run a dispatcher.
+func NewOutboxDispatcher(st storage.Store, outbox storage.OutboxStore, logger Logger,
+	scopes []string, maxAttempts int, retryAfter time.Duration) *OutboxDispatcher {
+	var leases storage.LeaseStore
+	if st, ok := outbox.(storage.Store); !ok || storage.Supports(st, (*storage.LeaseStore)(nil)) {
+		leases, _ = outbox.(storage.LeaseStore)
+	}
+	return &OutboxDispatcher{
+		store:  st,
+		outbox: outbox,
+		leases: leases,
+		// any random id unique to the dispatcher identifies it as the owner of the lease.
+		owner:       NewRequestID(),
+		logger:      NewRedactingLogger(logger),
+		scopes:      scopes,
+		maxAttempts: maxAttempts,
+		retryAfter:  retryAfter,
+	}
+}
+
+// Enqueue stores a write to jira for the passed tenant to be performed by the dispatcher.
+func (d *OutboxDispatcher) Enqueue(clientKey, method, path string, queryArgs map[string]string, body []byte) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("generating outbox message id: %w", err)
+	}
+	now := time.Now().UTC()
+	msg := &storage.OutboxMessage{
+		ID:          hex.EncodeToString(id),
+		ClientKey:   clientKey,
+		Method:      method,
+		Path:        path,
+		Query:       queryArgs,
+		Body:        body,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+	if err := d.outbox.EnqueueOutboxMessage(msg); err != nil {
+		return fmt.Errorf("enqueuing outbox message: %w", err)
+	}
+	return nil
+}
+
+// Run dispatches pending messages every interval until ctx is done.
+func (d *OutboxDispatcher) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DispatchPending(ctx); err != nil {
+			d.logger.Printf("ERROR: dispatching outbox: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending performs one batch of pending writes and returns how many succeeded, failures
+// are rescheduled and only reported through the logger. Nothing is sent while the dispatcher of
+// another replica holds the outbox lease.
+func (d *OutboxDispatcher) DispatchPending(ctx context.Context) (int, error) {
+	if held, err := d.claim(); err != nil || !held {
+		return 0, err
+	}
+	defer d.release()
+	pending, err := d.outbox.PendingOutboxMessages(time.Now().UTC(), defaultOutboxBatch)
+	if err != nil {
+		return 0, fmt.Errorf("reading pending outbox messages: %w", err)
+	}
+	var done int
+	for _, msg := range pending {
+		if ctx.Err() != nil {
+			return done, ctx.Err()
+		}
+		if held, err := d.claim(); err != nil || !held {
+			return done, err
+		}
+		if err := d.dispatch(ctx, msg); err != nil {
+			d.logger.Printf("ERROR: outbox message %s for %s failed: %v", msg.ID, msg.ClientKey, err)
+			if err := d.reschedule(msg, err); err != nil {
+				return done, err
+			}
+			continue
+		}
+		if err := d.outbox.DeleteOutboxMessage(msg.ID); err != nil {
+			return done, fmt.Errorf("deleting dispatched outbox message %s: %w", msg.ID, err)
+		}
+		done++
+	}
+	return done, nil
+}
+
+// claim acquires or renews the outbox lease, it returns false if another dispatcher holds it.
+func (d *OutboxDispatcher) claim() (bool, error) {
+	if d.leases == nil {
+		return true, nil
+	}
+	held, err := d.leases.AcquireLease(outboxLease, d.owner, outboxLeaseTTL)
+	if err != nil {
+		return false, fmt.Errorf("acquiring outbox lease: %w", err)
+	}
+	return held, nil
+}
+
+// release gives up the outbox lease.
+func (d *OutboxDispatcher) release() {
+	if d.leases == nil {
+		return
+	}
+	if err := d.leases.ReleaseLease(outboxLease, d.owner); err != nil {
+		d.logger.Printf("ERROR: releasing outbox lease: %v", err)
+	}
+}
+
+func (d *OutboxDispatcher) dispatch(ctx context.Context, msg *storage.OutboxMessage) error {
+	jii, err := LoadInstallInformation(d.store, msg.ClientKey)
+	if err != nil {
+		return err
+	}
+	client, err := NewHostClient(ctx, jii, "", d.scopes)
+	if err != nil {
+		return fmt.Errorf("creating host client: %w", err)
+	}
+	resp, err := client.DoCtx(ctx, msg.Method, msg.Path, msg.Query, bytes.NewReader(msg.Body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &UnexpectedResponse{obtained: resp.StatusCode, expected: []int{http.StatusOK}}
+	}
+	return nil
+}
+
+func (d *OutboxDispatcher) reschedule(msg *storage.OutboxMessage, cause error) error {
+	msg.Attempts++
+	msg.LastError = cause.Error()
+	if msg.Attempts >= d.maxAttempts {
+		msg.GaveUp = true
+	} else {
+		wait := d.retryAfter << uint(msg.Attempts-1)
+		if wait <= 0 || wait > maxOutboxRetryInterval {
+			wait = maxOutboxRetryInterval
+		}
+		msg.NextAttempt = time.Now().UTC().Add(wait)
+	}
+	if err := d.outbox.UpdateOutboxMessage(msg); err != nil {
+		return fmt.Errorf("rescheduling outbox message %s: %w", msg.ID, err)
+	}
+	return nil
+}
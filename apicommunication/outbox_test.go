@@ -0,0 +1,149 @@
+package apicommunication
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestOutboxDispatcher(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]string{}
+	failing := map[string]bool{"/rest/api/3/issue/KEY-2": true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		received[r.URL.Path] = append(received[r.URL.Path], r.Method+" "+string(body))
+		if failing[r.URL.Path] {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	st := storage.NewMemoryStore(0)
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	if err := st.SaveJiraInstallInformation(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	d := NewOutboxDispatcher(st, st, log.New(ioutil.Discard, "", 0), nil, 2, time.Millisecond)
+	for _, key := range []string{"KEY-1", "KEY-2"} {
+		if err := d.Enqueue(tenant.ClientKey, http.MethodPut, "/rest/api/3/issue/"+key, nil, []byte(`{"fields":{}}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// delivered messages leave the outbox, failed ones are rescheduled.
+	if done, err := d.DispatchPending(context.Background()); err != nil || done != 1 {
+		t.Fatalf("dispatched %d messages, %v", done, err)
+	}
+	if got := received["/rest/api/3/issue/KEY-1"]; len(got) != 1 || got[0] != `PUT {"fields":{}}` {
+		t.Fatalf("jira received %v", got)
+	}
+	pending, err := st.PendingOutboxMessages(time.Now().UTC().Add(time.Minute), 10)
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("pending messages are %+v, %v", pending, err)
+	}
+	if !pending[0].NextAttempt.After(pending[0].CreatedAt) {
+		t.Fatalf("failed message was not rescheduled: %+v", pending[0])
+	}
+
+	// the failed message is delivered again once due.
+	mu.Lock()
+	failing["/rest/api/3/issue/KEY-2"] = false
+	mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	if done, err := d.DispatchPending(context.Background()); err != nil || done != 1 {
+		t.Fatalf("redelivered %d messages, %v", done, err)
+	}
+	if got := received["/rest/api/3/issue/KEY-2"]; len(got) != 2 || got[1] != `PUT {"fields":{}}` {
+		t.Fatalf("jira received %v", got)
+	}
+	if pending, _ := st.PendingOutboxMessages(time.Now().UTC().Add(time.Hour), 10); len(pending) != 0 {
+		t.Fatalf("redelivered message still pending: %+v", pending[0])
+	}
+
+	// messages failing maxAttempts times are given up on.
+	mu.Lock()
+	failing["/rest/api/3/issue/KEY-3"] = true
+	mu.Unlock()
+	if err := d.Enqueue(tenant.ClientKey, http.MethodDelete, "/rest/api/3/issue/KEY-3", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if done, err := d.DispatchPending(context.Background()); err != nil || done != 0 {
+			t.Fatalf("dispatched %d messages, %v", done, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := received["/rest/api/3/issue/KEY-3"]; len(got) != 2 {
+		t.Fatalf("failing message was sent %d times", len(got))
+	}
+	if pending, _ := st.PendingOutboxMessages(time.Now().UTC().Add(time.Hour), 10); len(pending) != 0 {
+		t.Fatalf("message still pending after exhausting its attempts: %+v", pending[0])
+	}
+}
+
+func TestOutboxDispatcher_replicas(t *testing.T) {
+	var sent int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	defer close(release)
+	st := storage.NewMemoryStore(0)
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	if err := st.SaveJiraInstallInformation(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+	first := NewOutboxDispatcher(st, st, logger, nil, 2, time.Hour)
+	second := NewOutboxDispatcher(st, st, logger, nil, 2, time.Hour)
+	if err := first.Enqueue(tenant.ClientKey, http.MethodPut, "/rest/api/3/issue/KEY-1", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatched := make(chan error)
+	go func() {
+		_, err := first.DispatchPending(ctx)
+		dispatched <- err
+	}()
+	for atomic.LoadInt32(&sent) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the second replica does not send the message the first one is sending.
+	if done, err := second.DispatchPending(context.Background()); err != nil || done != 0 {
+		t.Fatalf("second dispatcher sent %d messages, %v", done, err)
+	}
+	// cancelling aborts the message in flight.
+	cancel()
+	select {
+	case <-dispatched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled dispatch did not return")
+	}
+	if n := atomic.LoadInt32(&sent); n != 1 {
+		t.Fatalf("message was sent %d times", n)
+	}
+	if held, err := st.AcquireLease(outboxLease, "other", time.Minute); err != nil || !held {
+		t.Fatalf("outbox lease was kept: %v, %v", held, err)
+	}
+}
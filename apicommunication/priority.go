@@ -0,0 +1,223 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// RequestPriority orders the calls waiting on a RequestScheduler, higher ones go first.
+type RequestPriority int
+
+const (
+	// PriorityBackground is for calls nobody is waiting on, such as syncs and backfills.
+	PriorityBackground RequestPriority = iota - 1
+	// PriorityNormal is the priority of calls made with contexts that carry none.
+	PriorityNormal
+	// PriorityInteractive is for calls a user is waiting on, such as those rendering a panel.
+	PriorityInteractive
+)
+
+type priorityContextKey struct{}
+
+// ContextWithPriority returns a copy of ctx carrying the passed priority, HostClients created with
+// it, or calls made with it, wait on their RequestScheduler with that priority.
+func ContextWithPriority(ctx context.Context, p RequestPriority) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, p)
+}
+
+// PriorityFromContext returns the priority in ctx and whether there is one.
+func PriorityFromContext(ctx context.Context) (RequestPriority, bool) {
+	if ctx == nil {
+		return PriorityNormal, false
+	}
+	p, ok := ctx.Value(priorityContextKey{}).(RequestPriority)
+	if !ok {
+		return PriorityNormal, false
+	}
+	return p, true
+}
+
+// priority returns the priority of ctx, or else of the context the client was created with.
+func (h *HostClient) priority(ctx context.Context) RequestPriority {
+	if p, ok := PriorityFromContext(ctx); ok {
+		return p
+	}
+	p, _ := PriorityFromContext(h.ctx)
+	return p
+}
+
+// RequestScheduler caps how many calls clients make to each tenant at once, calls beyond the limit
+// wait in a queue ordered by their RequestPriority and then by arrival, so interactive calls
+// overtake background ones when a tenant is saturated. A call holds its slot until the response
+// body is closed. It can be shared by many clients and is safe for concurrent use.
+type RequestScheduler struct {
+	limit int
+
+	mu      sync.Mutex
+	tenants map[string]*tenantQueue
+}
+
+// tenantQueue holds the calls to a tenant in flight and waiting, in order of arrival.
+type tenantQueue struct {
+	inFlight int
+	waiting  []*queuedCall
+}
+
+// queuedCall is a call waiting for a slot, ready is closed once it is granted one.
+type queuedCall struct {
+	priority RequestPriority
+	granted  bool
+	ready    chan struct{}
+}
+
+// NewRequestScheduler returns a RequestScheduler letting perTenant calls to each tenant run at once.
+func NewRequestScheduler(perTenant int) *RequestScheduler {
+	if perTenant < 1 {
+		perTenant = 1
+	}
+	return &RequestScheduler{
+		limit:   perTenant,
+		tenants: map[string]*tenantQueue{},
+	}
+}
+
+// WithRequestScheduler makes the client wait for a slot in s before every call.
+func WithRequestScheduler(s *RequestScheduler) HostClientOption {
+	return func(h *HostClient) {
+		h.scheduler = s
+	}
+}
+
+// InFlight returns how many calls to the tenant are running.
+func (s *RequestScheduler) InFlight(clientKey string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.tenants[clientKey]; ok {
+		return q.inFlight
+	}
+	return 0
+}
+
+// Waiting returns how many calls to the tenant are waiting for a slot.
+func (s *RequestScheduler) Waiting(clientKey string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.tenants[clientKey]; ok {
+		return len(q.waiting)
+	}
+	return 0
+}
+
+// acquire waits for a slot to call the tenant, or for ctx to be done, and returns the func giving
+// it back.
+func (s *RequestScheduler) acquire(ctx context.Context, clientKey string, p RequestPriority) (func(), error) {
+	s.mu.Lock()
+	q, ok := s.tenants[clientKey]
+	if !ok {
+		q = &tenantQueue{}
+		s.tenants[clientKey] = q
+	}
+	if q.inFlight < s.limit && len(q.waiting) == 0 {
+		q.inFlight++
+		s.mu.Unlock()
+		return s.releaser(clientKey), nil
+	}
+	call := &queuedCall{priority: p, ready: make(chan struct{})}
+	q.waiting = append(q.waiting, call)
+	s.mu.Unlock()
+
+	select {
+	case <-call.ready:
+		return s.releaser(clientKey), nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	granted := call.granted
+	if !granted {
+		for i, c := range q.waiting {
+			if c == call {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	if granted {
+		// the slot was handed over as ctx was done, it goes to the next in line.
+		s.releaser(clientKey)()
+	}
+	return nil, ctx.Err()
+}
+
+// releaser returns a func giving back a slot to call the tenant, which is safe to invoke many times.
+func (s *RequestScheduler) releaser(clientKey string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.release(clientKey) })
+	}
+}
+
+// release hands the slot over to the first call in line or frees it.
+func (s *RequestScheduler) release(clientKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.tenants[clientKey]
+	if !ok {
+		return
+	}
+	if len(q.waiting) == 0 {
+		q.inFlight--
+		if q.inFlight <= 0 {
+			delete(s.tenants, clientKey)
+		}
+		return
+	}
+	next := 0
+	for i, c := range q.waiting {
+		if c.priority > q.waiting[next].priority {
+			next = i
+		}
+	}
+	call := q.waiting[next]
+	q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+	call.granted = true
+	close(call.ready)
+}
+
+// releasingBody gives back the slot of a call once its response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// holdUntilClosed makes resp give back the slot of its call when its body is closed, or right away
+// if there is no response.
+func holdUntilClosed(resp *http.Response, release func()) {
+	if resp == nil || resp.Body == nil {
+		release()
+		return
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+}
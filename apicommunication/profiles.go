@@ -0,0 +1,95 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// TimeoutProfile is a combination of timeout and retries suited for a kind of call to jira.
+type TimeoutProfile struct {
+	Name string
+	// Timeout bounds each attempt, including reading the response body.
+	Timeout time.Duration
+	// Retries is how many times idempotent requests failing with network errors or a 502, 503
+	// or 504 are retried.
+	Retries int
+	// RetryBackoff is the wait before the first retry, it doubles for each of the following.
+	RetryBackoff time.Duration
+}
+
+var (
+	// ProfileInteractive is for calls made while a user waits, ie rendering a panel; fail fast.
+	ProfileInteractive = TimeoutProfile{Name: "interactive", Timeout: 10 * time.Second, Retries: 0}
+	// ProfileBatch is for background syncs where latency does not matter but completion does.
+	ProfileBatch = TimeoutProfile{Name: "batch", Timeout: 2 * time.Minute, Retries: 5, RetryBackoff: 2 * time.Second}
+	// ProfileWebhookSideEffect is for writes caused by a webhook, which should finish before
+	// jira gives up on the webhook delivery.
+	ProfileWebhookSideEffect = TimeoutProfile{Name: "webhook-side-effect", Timeout: 20 * time.Second,
+		Retries: 2, RetryBackoff: 500 * time.Millisecond}
+)
+
+// WithTimeoutProfile sets the timeout profile for all calls made by the client, by default there
+// are no retries and only the transport timeouts apply.
+func WithTimeoutProfile(p TimeoutProfile) HostClientOption {
+	return func(h *HostClient) {
+		h.profile = p
+	}
+}
+
+// WithProfile returns a copy of the client that uses the passed timeout profile, use it to change the
+// profile of a single call ie h.WithProfile(ProfileBatch).Do(...).
+func (h *HostClient) WithProfile(p TimeoutProfile) *HostClient {
+	c := *h
+	c.profile = p
+	if h.client != nil {
+		client := *h.client
+		client.Timeout = p.Timeout
+		c.client = &client
+	}
+	return &c
+}
+
+// shouldRetry returns true if a request made with ctx that obtained resp or err in its attempt-th
+// (0 based) try should be tried again, errors caused by ctx ending are not.
+func (h *HostClient) shouldRetry(ctx context.Context, attempt int, method string, resp *http.Response, err error) bool {
+	if attempt >= h.profile.Retries || !idempotent(method) {
+		return false
+	}
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent returns true for the methods of requests that can be safely retried.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryWait returns the wait before the attempt-th retry (1 based).
+func (h *HostClient) retryWait(attempt int) time.Duration {
+	return h.profile.RetryBackoff << uint(attempt-1)
+}
@@ -0,0 +1,43 @@
+package apicommunication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestHostClient_shouldRetry(t *testing.T) {
+	clientCtx, cancelClient := context.WithCancel(context.Background())
+	defer cancelClient()
+	hc, err := NewHostClient(clientCtx, benchTenant, "", nil, WithTimeoutProfile(ProfileBatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	callCtx, cancelCall := context.WithCancel(context.Background())
+	netErr := errors.New("connection reset")
+	if !hc.shouldRetry(callCtx, 0, http.MethodGet, nil, netErr) {
+		t.Fatal("network error was not retried")
+	}
+	if hc.shouldRetry(callCtx, 0, http.MethodPost, nil, netErr) {
+		t.Fatal("POST was retried")
+	}
+	if hc.shouldRetry(callCtx, ProfileBatch.Retries, http.MethodGet, nil, netErr) {
+		t.Fatal("retried past the retries of the profile")
+	}
+	if !hc.shouldRetry(callCtx, 0, http.MethodGet, &http.Response{StatusCode: http.StatusBadGateway}, nil) {
+		t.Fatal("502 was not retried")
+	}
+	if hc.shouldRetry(callCtx, 0, http.MethodGet, &http.Response{StatusCode: http.StatusBadRequest}, nil) {
+		t.Fatal("400 was retried")
+	}
+
+	cancelCall()
+	if hc.shouldRetry(callCtx, 0, http.MethodGet, nil, context.Canceled) {
+		t.Fatal("retried a call whose context was cancelled")
+	}
+	cancelClient()
+	if !hc.shouldRetry(context.Background(), 0, http.MethodGet, nil, netErr) {
+		t.Fatal("the context of the client decided whether to retry a call with its own context")
+	}
+}
@@ -0,0 +1,180 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const projectPath = "/rest/api/3/project"
+
+// Project types, the template of a project must belong to its type.
+const (
+	ProjectTypeBusiness         = "business"
+	ProjectTypeSoftware         = "software"
+	ProjectTypeServiceDesk      = "service_desk"
+	ProjectTypeProductDiscovery = "product_discovery"
+)
+
+// Project templates, see https://developer.atlassian.com/cloud/jira/platform/rest/v3/api-group-projects/#api-rest-api-3-project-post
+const (
+	TemplateBusinessProjectManagement = "com.atlassian.jira-core-project-templates:jira-core-simplified-project-management"
+	TemplateBusinessTaskTracking      = "com.atlassian.jira-core-project-templates:jira-core-simplified-task-tracking"
+	TemplateBusinessProcessControl    = "com.atlassian.jira-core-project-templates:jira-core-simplified-process-control"
+	TemplateSoftwareKanban            = "com.pyxis.greenhopper.jira:gh-simplified-kanban-classic"
+	TemplateSoftwareScrum             = "com.pyxis.greenhopper.jira:gh-simplified-scrum-classic"
+	TemplateSoftwareBasic             = "com.pyxis.greenhopper.jira:gh-simplified-basic"
+	TemplateSoftwareTeamManagedKanban = "com.pyxis.greenhopper.jira:gh-simplified-agility-kanban"
+	TemplateSoftwareTeamManagedScrum  = "com.pyxis.greenhopper.jira:gh-simplified-agility-scrum"
+	TemplateServiceDeskITIL           = "com.atlassian.servicedesk:simplified-it-service-management"
+	TemplateServiceDeskGeneral        = "com.atlassian.servicedesk:simplified-general-service-desk"
+	TemplateServiceDeskInternal       = "com.atlassian.servicedesk:simplified-internal-service-desk"
+	TemplateServiceDeskExternal       = "com.atlassian.servicedesk:simplified-external-service-desk"
+)
+
+// projectTemplateTypes holds the project type of the known templates.
+var projectTemplateTypes = map[string]string{
+	TemplateBusinessProjectManagement: ProjectTypeBusiness,
+	TemplateBusinessTaskTracking:      ProjectTypeBusiness,
+	TemplateBusinessProcessControl:    ProjectTypeBusiness,
+	TemplateSoftwareKanban:            ProjectTypeSoftware,
+	TemplateSoftwareScrum:             ProjectTypeSoftware,
+	TemplateSoftwareBasic:             ProjectTypeSoftware,
+	TemplateSoftwareTeamManagedKanban: ProjectTypeSoftware,
+	TemplateSoftwareTeamManagedScrum:  ProjectTypeSoftware,
+	TemplateServiceDeskITIL:           ProjectTypeServiceDesk,
+	TemplateServiceDeskGeneral:        ProjectTypeServiceDesk,
+	TemplateServiceDeskInternal:       ProjectTypeServiceDesk,
+	TemplateServiceDeskExternal:       ProjectTypeServiceDesk,
+}
+
+// Default assignee of the issues of a project.
+const (
+	AssigneeProjectLead = "PROJECT_LEAD"
+	AssigneeUnassigned  = "UNASSIGNED"
+)
+
+var projectKeyRe = regexp.MustCompile(`^[A-Z][A-Z0-9]{1,9}$`)
+
+// CreateProjectRequest describes a project to create, unlike ProjectInputBean unset schemes are
+// omitted so jira applies its defaults.
+type CreateProjectRequest struct {
+	// Key must start with an uppercase letter followed by uppercase letters or digits, 2 to 10 long.
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	// TemplateKey is one of the Template constants or any other template available in the tenant,
+	// ProjectTypeKey can be omitted for the known templates.
+	TemplateKey    string `json:"projectTemplateKey"`
+	ProjectTypeKey string `json:"projectTypeKey"`
+	// LeadAccountID is the account ID of the project lead, it is required.
+	LeadAccountID       string `json:"leadAccountId"`
+	Description         string `json:"description,omitempty"`
+	URL                 string `json:"url,omitempty"`
+	AssigneeType        string `json:"assigneeType,omitempty"`
+	AvatarID            int64  `json:"avatarId,omitempty"`
+	CategoryID          int64  `json:"categoryId,omitempty"`
+	PermissionScheme    int64  `json:"permissionScheme,omitempty"`
+	NotificationScheme  int64  `json:"notificationScheme,omitempty"`
+	IssueSecurityScheme int64  `json:"issueSecurityScheme,omitempty"`
+}
+
+// Validate returns an error if jira would reject the request for lacking or malformed fields.
+func (r *CreateProjectRequest) Validate() error {
+	var problems []string
+	if !projectKeyRe.MatchString(r.Key) {
+		problems = append(problems, fmt.Sprintf("key %q must be 2 to 10 uppercase letters or digits starting with a letter", r.Key))
+	}
+	if r.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if r.TemplateKey == "" {
+		problems = append(problems, "template key is required")
+	}
+	if r.LeadAccountID == "" {
+		problems = append(problems, "lead account id is required")
+	}
+	templateType, known := projectTemplateTypes[r.TemplateKey]
+	switch {
+	case r.ProjectTypeKey == "" && !known && r.TemplateKey != "":
+		problems = append(problems, fmt.Sprintf("project type is required for template %s", r.TemplateKey))
+	case r.ProjectTypeKey != "" && known && r.ProjectTypeKey != templateType:
+		problems = append(problems, fmt.Sprintf("template %s is for %s projects, not %s",
+			r.TemplateKey, templateType, r.ProjectTypeKey))
+	}
+	switch r.AssigneeType {
+	case "", AssigneeProjectLead, AssigneeUnassigned:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown assignee type %q", r.AssigneeType))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid project: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// CreateProject creates the project described by req, which requires the ADMIN scope, and
+// returns its identifiers.
+func (h *HostClient) CreateProject(req CreateProjectRequest) (*ProjectIdentifiers, error) {
+	return h.CreateProjectCtx(context.Background(), req)
+}
+
+// CreateProjectCtx behaves like CreateProject bound to ctx, see DoCtx.
+func (h *HostClient) CreateProjectCtx(ctx context.Context, req CreateProjectRequest) (*ProjectIdentifiers, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.ProjectTypeKey == "" {
+		req.ProjectTypeKey = projectTemplateTypes[req.TemplateKey]
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling project: %w", err)
+	}
+	created := &ProjectIdentifiers{}
+	_, err = h.DoWithTargetCtx(ctx, http.MethodPost, h.api("CreateProject", projectPath), nil, bytes.NewReader(body), created,
+		[]int{http.StatusCreated})
+	if err != nil {
+		return nil, fmt.Errorf("creating project %s: %w", req.Key, err)
+	}
+	return created, nil
+}
+
+// PermissionSchemeID returns the id of the permission scheme called name, so it can be assigned
+// to projects created with CreateProject.
+func (h *HostClient) PermissionSchemeID(name string) (int64, error) {
+	return h.PermissionSchemeIDCtx(context.Background(), name)
+}
+
+// PermissionSchemeIDCtx behaves like PermissionSchemeID bound to ctx, see DoCtx.
+func (h *HostClient) PermissionSchemeIDCtx(ctx context.Context, name string) (int64, error) {
+	schemes := &PermissionSchemes{}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("PermissionSchemeID", "/rest/api/3/permissionscheme"), nil, nil, schemes,
+		[]int{http.StatusOK})
+	if err != nil {
+		return 0, fmt.Errorf("listing permission schemes: %w", err)
+	}
+	for _, s := range schemes.PermissionSchemes {
+		if strings.EqualFold(s.Name, name) {
+			return s.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("there is no permission scheme called %q", name)
+}
@@ -0,0 +1,37 @@
+package apicommunication
+
+import "testing"
+
+func TestCreateProjectRequest_Validate(t *testing.T) {
+	valid := CreateProjectRequest{
+		Key:           "SEC",
+		Name:          "Security",
+		TemplateKey:   TemplateSoftwareKanban,
+		LeadAccountID: "5b10a2844c20165700ede21g",
+	}
+	tests := []struct {
+		name    string
+		modify  func(r *CreateProjectRequest)
+		wantErr bool
+	}{
+		{"valid", func(r *CreateProjectRequest) {}, false},
+		{"lowercase key", func(r *CreateProjectRequest) { r.Key = "sec" }, true},
+		{"long key", func(r *CreateProjectRequest) { r.Key = "SECURITY123" }, true},
+		{"no lead", func(r *CreateProjectRequest) { r.LeadAccountID = "" }, true},
+		{"mismatched type", func(r *CreateProjectRequest) { r.ProjectTypeKey = ProjectTypeBusiness }, true},
+		{"unknown template without type", func(r *CreateProjectRequest) { r.TemplateKey = "custom:template" }, true},
+		{"unknown template with type", func(r *CreateProjectRequest) {
+			r.TemplateKey, r.ProjectTypeKey = "custom:template", ProjectTypeSoftware
+		}, false},
+		{"bad assignee", func(r *CreateProjectRequest) { r.AssigneeType = "ANYONE" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			tt.modify(&r)
+			if err := r.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
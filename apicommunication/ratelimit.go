@@ -0,0 +1,189 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitWait is the wait before the first retry of rate limited calls if
+// RateLimitPolicy has no DefaultWait and jira sends no Retry-After header.
+const defaultRateLimitWait = time.Second
+
+// RateLimitPolicy makes clients retry calls jira answered with http.StatusTooManyRequests, any
+// method is retried since jira did not process them.
+type RateLimitPolicy struct {
+	// Retries is how many times a rate limited call is retried, they do not count against the
+	// retries of the TimeoutProfile.
+	Retries int
+	// MaxWait bounds the time a call spends waiting on rate limits, once a wait would exceed it the
+	// 429 response is returned; zero means no bound.
+	MaxWait time.Duration
+	// DefaultWait is the wait before the first retry if jira sends no Retry-After header, it
+	// doubles for each of the following.
+	DefaultWait time.Duration
+}
+
+// WithRateLimitPolicy makes the client retry rate limited calls as p says, by default they are
+// not retried. Bodies are sent again by seeking back to where they started, calls with bodies that
+// are not an io.Seeker, such as streamed uploads, are not retried.
+func WithRateLimitPolicy(p RateLimitPolicy) HostClientOption {
+	return func(h *HostClient) {
+		h.rateLimitPolicy = p
+	}
+}
+
+// RateLimitState is what jira said about the rate limits of a tenant in its last response.
+type RateLimitState struct {
+	// Limit and Remaining are the X-RateLimit-Limit and X-RateLimit-Remaining headers, -1 if absent.
+	Limit     int
+	Remaining int
+	// Reset is when the limit is replenished as per the X-RateLimit-Reset header, zero if absent.
+	Reset time.Time
+	// NearLimit is set when jira warns that less than a fifth of the limit is left.
+	NearLimit bool
+	// LimitedUntil is the end of the Retry-After wait of the last 429 response, zero if there was
+	// none.
+	LimitedUntil time.Time
+	// Observed is when the response was received.
+	Observed time.Time
+}
+
+// Limited returns true if calls to the tenant are rate limited at now.
+func (s RateLimitState) Limited(now time.Time) bool {
+	return now.Before(s.LimitedUntil)
+}
+
+// RateLimitTracker keeps the rate limit state of tenants as seen in jira responses, clients using
+// one with a RateLimitPolicy hold calls to tenants that are rate limited rather than send them to
+// be refused. It can be shared by many clients and is safe for concurrent use.
+type RateLimitTracker struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	states map[string]RateLimitState
+}
+
+// NewRateLimitTracker returns an empty RateLimitTracker.
+func NewRateLimitTracker() *RateLimitTracker {
+	return &RateLimitTracker{
+		now:    time.Now,
+		states: map[string]RateLimitState{},
+	}
+}
+
+// WithRateLimitTracker makes the client record the rate limit state of its tenant in t.
+func WithRateLimitTracker(t *RateLimitTracker) HostClientOption {
+	return func(h *HostClient) {
+		h.rateLimits = t
+	}
+}
+
+// State returns the rate limit state of the tenant, if any response of it was seen.
+func (t *RateLimitTracker) State(clientKey string) (RateLimitState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.states[clientKey]
+	return s, ok
+}
+
+// RateLimit returns the rate limit state of the tenant of the client, if it has a RateLimitTracker
+// that saw any response of it.
+func (h *HostClient) RateLimit() (RateLimitState, bool) {
+	if h.rateLimits == nil {
+		return RateLimitState{}, false
+	}
+	return h.rateLimits.State(h.Config.ClientKey)
+}
+
+// pause returns how long calls to the tenant should wait for its rate limit to lift.
+func (t *RateLimitTracker) pause(clientKey string) time.Duration {
+	s, ok := t.State(clientKey)
+	if !ok {
+		return 0
+	}
+	if wait := s.LimitedUntil.Sub(t.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// observe records the rate limit headers of resp, responses without them are ignored.
+func (t *RateLimitTracker) observe(clientKey string, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	now := t.now()
+	s := RateLimitState{
+		Limit:     rateLimitHeader(resp, "X-RateLimit-Limit"),
+		Remaining: rateLimitHeader(resp, "X-RateLimit-Remaining"),
+		NearLimit: strings.EqualFold(resp.Header.Get("X-RateLimit-NearLimit"), "true"),
+		Observed:  now,
+	}
+	if reset, err := time.Parse(time.RFC3339, resp.Header.Get("X-RateLimit-Reset")); err == nil {
+		s.Reset = reset
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := retryAfterHeader(resp, now); ok {
+			s.LimitedUntil = now.Add(wait)
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && s.Limit < 0 && s.Remaining < 0 && !s.NearLimit {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// a response to a call sent before the tenant was limited does not lift the limit.
+	if previous, ok := t.states[clientKey]; ok && s.LimitedUntil.IsZero() && previous.Limited(now) {
+		s.LimitedUntil = previous.LimitedUntil
+	}
+	t.states[clientKey] = s
+}
+
+// rateLimitHeader returns the value of the numeric header, -1 if absent or not a number.
+func rateLimitHeader(resp *http.Response, name string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get(name)))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// rateLimitWait returns how long to wait before retrying a call that obtained resp, if it was
+// rate limited and the policy allows another retry, limited is how many retries the call made for
+// rate limits and waited how long it spent waiting on them. Calls whose bodies can not be sent
+// again are not retried.
+func (h *HostClient) rateLimitWait(limited int, waited time.Duration, resp *http.Response,
+	replayable bool) (time.Duration, bool) {
+	p := h.rateLimitPolicy
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests || limited >= p.Retries || !replayable {
+		return 0, false
+	}
+	wait, ok := retryAfterHeader(resp, time.Now())
+	if !ok {
+		if p.DefaultWait <= 0 {
+			p.DefaultWait = defaultRateLimitWait
+		}
+		wait = p.DefaultWait << uint(limited)
+	}
+	if p.MaxWait > 0 && waited+wait > p.MaxWait {
+		return 0, false
+	}
+	return wait, true
+}
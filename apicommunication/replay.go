@@ -0,0 +1,101 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ReplayCache records the tokens that were already accepted so they can be rejected if presented
+// again, implementations shared across replicas (ie redis SETNX) give full protection while the
+// in memory one only protects each process.
+type ReplayCache interface {
+	// Seen records id as seen until expiresAt and returns true if it had already been recorded.
+	Seen(id string, expiresAt time.Time) (bool, error)
+}
+
+// ReplayForgetter can be implemented by a ReplayCache to forget an id recorded by Seen, ie when
+// what it identifies could not be processed and will be presented again.
+type ReplayForgetter interface {
+	Forget(id string) error
+}
+
+// defaultReplayWindow is used for tokens without expiration.
+const defaultReplayWindow = defaultJWTValidityInMinutes * time.Minute
+
+// TokenID returns the identifier used to detect replays of a token, the jti claim if present or
+// a combination of issuer, query string hash and issue time if not.
+func (c *Claims) TokenID() string {
+	if c.ID != "" {
+		return c.Issuer + ":" + c.ID
+	}
+	return c.Issuer + ":" + c.QueryStringHash + ":" + strconv.FormatInt(c.IssuedAt, 10)
+}
+
+// CheckReplay returns an error if the token the claims belong to was already seen by rc.
+func CheckReplay(rc ReplayCache, claims *Claims) error {
+	expiresAt := time.Unix(claims.ExpiresIn, 0)
+	if claims.ExpiresIn == 0 {
+		expiresAt = time.Now().Add(defaultReplayWindow)
+	}
+	seen, err := rc.Seen(claims.TokenID(), expiresAt)
+	if err != nil {
+		return fmt.Errorf("checking token for replay: %w", err)
+	}
+	if seen {
+		return fmt.Errorf("token %s was already used", claims.TokenID())
+	}
+	return nil
+}
+
+// NewMemoryReplayCache returns a ReplayCache that keeps seen tokens in memory.
+func NewMemoryReplayCache() ReplayCache {
+	return &memoryReplayCache{seen: map[string]time.Time{}}
+}
+
+type memoryReplayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPurge time.Time
+}
+
+func (m *memoryReplayCache) Seen(id string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastPurge) > defaultReplayWindow {
+		for k, exp := range m.seen {
+			if now.After(exp) {
+				delete(m.seen, k)
+			}
+		}
+		m.lastPurge = now
+	}
+	if exp, ok := m.seen[id]; ok && now.Before(exp) {
+		return true, nil
+	}
+	m.seen[id] = expiresAt
+	return false, nil
+}
+
+func (m *memoryReplayCache) Forget(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.seen, id)
+	return nil
+}
@@ -0,0 +1,226 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// DefaultSchedulerConcurrency is how many tenants a Scheduler runs a job for at once, unless
+// changed with SetConcurrency.
+const DefaultSchedulerConcurrency = 4
+
+// ScheduledJob is the work performed periodically for each tenant.
+type ScheduledJob func(ctx context.Context, clientKey string, client *HostClient) error
+
+// TenantsFunc returns the client keys of the tenants scheduled jobs should run for.
+type TenantsFunc func() ([]string, error)
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	job      ScheduledJob
+}
+
+// Scheduler runs jobs periodically for every tenant, using leases from a storage.LeaseStore so
+// each job runs once per interval and tenant regardless of how many replicas run the scheduler.
+// Leases are renewed while a job runs, so a run outlasting the interval is not started again
+// elsewhere before it ends.
+type Scheduler struct {
+	clients     *ClientManager
+	leases      storage.LeaseStore
+	owner       string
+	tenants     TenantsFunc
+	logger      Logger
+	concurrency int
+
+	mu   sync.Mutex
+	jobs []*scheduledJob
+}
+
+// NewScheduler returns a Scheduler, owner must be unique per replica (ie the hostname).
+func NewScheduler(clients *ClientManager, leases storage.LeaseStore, owner string,
+	tenants TenantsFunc, logger Logger) *Scheduler {
+	return &Scheduler{
+		clients: clients,
+		leases:  leases,
+		owner:   owner,
+		tenants: tenants,
+		logger:  NewRedactingLogger(logger),
+
+		concurrency: DefaultSchedulerConcurrency,
+	}
+}
+
+// SetConcurrency sets how many tenants a job runs for at once, a slow tenant only holds up the
+// others once n of them are running. It must be invoked before Run.
+func (s *Scheduler) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.concurrency = n
+}
+
+// Every registers job to be run every interval for each tenant, name must be unique.
+func (s *Scheduler) Every(name string, interval time.Duration, job ScheduledJob) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval for job %s must be positive", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %s is already scheduled", name)
+		}
+	}
+	s.jobs = append(s.jobs, &scheduledJob{name: name, interval: interval, job: job})
+	return nil
+}
+
+// Run runs the registered jobs until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	jobs := append([]*scheduledJob{}, s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *scheduledJob) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *scheduledJob) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		s.runOnce(ctx, j)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, j *scheduledJob) {
+	tenants, err := s.tenants()
+	if err != nil {
+		s.logger.Printf("ERROR: listing tenants for job %s: %v", j.name, err)
+		return
+	}
+	slots := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	for _, clientKey := range tenants {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(clientKey string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.runForTenant(ctx, j, clientKey)
+		}(clientKey)
+	}
+	wg.Wait()
+}
+
+// runForTenant runs j for the tenant if its lease can be acquired.
+func (s *Scheduler) runForTenant(ctx context.Context, j *scheduledJob, clientKey string) {
+	lease := j.name + "/" + clientKey
+	start := time.Now()
+	acquired, err := s.leases.AcquireLease(lease, s.owner, j.interval)
+	if err != nil {
+		s.logger.Printf("ERROR: acquiring lease for job %s on %s: %v", j.name, clientKey, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	done, renewed := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.renewLease(lease, j.interval, done)
+	}()
+	client, err := s.clients.Client(clientKey)
+	panicked := false
+	if err == nil {
+		panicked, err = runJob(ctx, j, clientKey, client)
+	}
+	if err != nil {
+		s.logger.Printf("ERROR: job %s on %s: %v", j.name, clientKey, err)
+	}
+	close(done)
+	<-renewed
+
+	// the lease is kept until the job is due again, so other replicas don't run it before, unless
+	// the job panicked.
+	if left := j.interval - time.Since(start); left > 0 && !panicked {
+		_, err = s.leases.AcquireLease(lease, s.owner, left)
+	} else {
+		err = s.leases.ReleaseLease(lease, s.owner)
+	}
+	if err != nil {
+		s.logger.Printf("ERROR: updating lease for job %s on %s: %v", j.name, clientKey, err)
+	}
+}
+
+// runJob runs j for the tenant, recovering from panics which are returned as errors.
+func runJob(ctx context.Context, j *scheduledJob, clientKey string, client *HostClient) (panicked bool, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			panicked, err = true, fmt.Errorf("panic: %v\n%s", recovered, debug.Stack())
+		}
+	}()
+	return false, j.job(ctx, clientKey, client)
+}
+
+// renewLease extends the lease for another ttl every half of it until done is closed.
+func (s *Scheduler) renewLease(lease string, ttl time.Duration, done <-chan struct{}) {
+	every := ttl / 2
+	if every <= 0 {
+		every = ttl
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		acquired, err := s.leases.AcquireLease(lease, s.owner, ttl)
+		if err != nil {
+			s.logger.Printf("ERROR: renewing lease %s: %v", lease, err)
+		} else if !acquired {
+			s.logger.Printf("WARNING: lease %s was taken over while its job was running", lease)
+		}
+	}
+}
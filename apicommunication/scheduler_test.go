@@ -0,0 +1,116 @@
+package apicommunication
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// schedulerStore returns a store with the passed tenants installed.
+func schedulerStore(t *testing.T, clientKeys ...string) *storage.MemoryStore {
+	st := storage.NewMemoryStore(0)
+	for _, clientKey := range clientKeys {
+		tenant := *benchTenant
+		tenant.ClientKey = clientKey
+		if err := st.SaveJiraInstallInformation(&tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+func TestScheduler_exclusive(t *testing.T) {
+	st := schedulerStore(t, "a", "b")
+	tenants := func() ([]string, error) { return []string{"a", "b"}, nil }
+	logger := log.New(ioutil.Discard, "", 0)
+
+	var mu sync.Mutex
+	running, runs := map[string]int{}, map[string]int{}
+	job := func(ctx context.Context, clientKey string, _ *HostClient) error {
+		mu.Lock()
+		running[clientKey]++
+		runs[clientKey]++
+		if running[clientKey] > 1 {
+			t.Errorf("job is running %d times at once for %s", running[clientKey], clientKey)
+		}
+		mu.Unlock()
+		// runs outlast the interval, the lease must be renewed meanwhile.
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		running[clientKey]--
+		mu.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, owner := range []string{"one", "two"} {
+		s := NewScheduler(NewClientManager(ctx, st, nil), st, owner, tenants, logger)
+		if err := s.Every("sync", 10*time.Millisecond, job); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(ctx)
+		}()
+	}
+	wg.Wait()
+	if runs["a"] < 2 || runs["b"] < 2 {
+		t.Fatalf("jobs ran %v times", runs)
+	}
+}
+
+func TestScheduler_tenantsConcurrently(t *testing.T) {
+	st := schedulerStore(t, "slow", "fast")
+	tenants := func() ([]string, error) { return []string{"slow", "fast"}, nil }
+	fastRan := make(chan struct{})
+	var once sync.Once
+	job := func(ctx context.Context, clientKey string, _ *HostClient) error {
+		if clientKey == "fast" {
+			once.Do(func() { close(fastRan) })
+			return nil
+		}
+		select {
+		case <-fastRan:
+		case <-time.After(time.Second):
+			t.Error("the slow tenant held up the fast one")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(NewClientManager(ctx, st, nil), st, "one", tenants, log.New(ioutil.Discard, "", 0))
+	if err := s.Every("sync", time.Hour, job); err != nil {
+		t.Fatal(err)
+	}
+	go s.Run(ctx)
+	select {
+	case <-fastRan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the job did not run for the fast tenant")
+	}
+}
+
+func TestScheduler_panickingJob(t *testing.T) {
+	st := schedulerStore(t, "a")
+	tenants := func() ([]string, error) { return []string{"a"}, nil }
+	logger := &recordingLogger{}
+	s := NewScheduler(NewClientManager(context.Background(), st, nil), st, "one", tenants, logger)
+	job := &scheduledJob{name: "sync", interval: time.Hour, job: func(context.Context, string, *HostClient) error {
+		panic("boom")
+	}}
+	s.runForTenant(context.Background(), job, "a")
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "ERROR: job sync on a: panic: boom") {
+		t.Fatalf("logged %q", logger.messages)
+	}
+	if acquired, err := st.AcquireLease("sync/a", "two", time.Hour); err != nil || !acquired {
+		t.Fatalf("lease of the panicked job was kept: %v, %v", acquired, err)
+	}
+}
@@ -0,0 +1,70 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// scopeLevels ranks the hierarchical connect scopes, each one implies those ranked below it.
+// Scopes not listed, such as ACT_AS_USER, only imply themselves.
+var scopeLevels = map[string]int{
+	"READ":          1,
+	"WRITE":         2,
+	"DELETE":        3,
+	"PROJECT_ADMIN": 4,
+	"ADMIN":         5,
+}
+
+// scopeGranted returns true if scope is one of granted or implied by one of them.
+func scopeGranted(scope string, granted []string) bool {
+	scope = strings.ToUpper(scope)
+	for _, g := range granted {
+		g = strings.ToUpper(g)
+		if g == scope {
+			return true
+		}
+		if level, ok := scopeLevels[scope]; ok && scopeLevels[g] >= level {
+			return true
+		}
+	}
+	return false
+}
+
+// AsUserWithScopes is like AsUserByAccountID but the tokens of the returned client are requested for
+// the passed scopes only, which must be granted to the app, so each call impersonates the user with
+// the least privileges it needs. Clients are cached per user and scope set.
+func (h *HostClient) AsUserWithScopes(userAccountID string, scopes ...string) (*HostClient, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	narrowed := make([]string, 0, len(scopes))
+	seen := map[string]bool{}
+	for _, s := range scopes {
+		s = strings.ToUpper(s)
+		if !scopeGranted(s, h.scopes) {
+			return nil, fmt.Errorf("scope %s is not granted to the app, it has %s", s, ScopesFromStrings(h.scopes))
+		}
+		if !seen[s] {
+			seen[s] = true
+			narrowed = append(narrowed, s)
+		}
+	}
+	// sorted so the cache hits regardless of the order scopes are passed in.
+	sort.Strings(narrowed)
+	return h.asUser(userAccountID, narrowed)
+}
@@ -0,0 +1,33 @@
+package apicommunication
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHostClient_AsUserWithScopes(t *testing.T) {
+	hc, err := NewHostClient(context.Background(), benchTenant, "", []string{"WRITE", "ACT_AS_USER"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readWrite, err := hc.AsUserWithScopes("user-1", "write", "READ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ScopesFromStrings(readWrite.scopes); got != "READ WRITE" {
+		t.Fatalf("impersonating client has scopes %q", got)
+	}
+	again, err := hc.AsUserWithScopes("user-1", "READ", "WRITE", "READ")
+	if err != nil || again != readWrite {
+		t.Fatalf("the same scope set was not cached: %v", err)
+	}
+	read, err := hc.AsUserWithScopes("user-1", "READ")
+	if err != nil || read == readWrite {
+		t.Fatalf("a narrower scope set reused the client: %v", err)
+	}
+	for _, scopes := range [][]string{{"DELETE"}, {"ADMIN"}, {}} {
+		if _, err := hc.AsUserWithScopes("user-1", scopes...); err == nil {
+			t.Errorf("scopes %v were not rejected", scopes)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const myselfPath = "/rest/api/3/myself"
+
+// TenantSnapshot records the context of a tenant at a point in time, so support engineers can
+// tell what they are dealing with without querying it live.
+type TenantSnapshot struct {
+	CapturedAt     time.Time `json:"capturedAt"`
+	ServerTitle    string    `json:"serverTitle"`
+	DeploymentType string    `json:"deploymentType"`
+	Version        string    `json:"version"`
+	// Applications are the keys of the licensed jira products, sorted.
+	Applications []string `json:"applications"`
+	// Locale and TimeZone are those of the app user, which follow the tenant defaults.
+	Locale   string `json:"locale"`
+	TimeZone string `json:"timeZone"`
+}
+
+// Myself returns the user the client acts as, the app user unless it impersonates somebody.
+func (h *HostClient) Myself() (*User, error) {
+	return h.MyselfCtx(context.Background())
+}
+
+// MyselfCtx behaves like Myself bound to ctx, see DoCtx.
+func (h *HostClient) MyselfCtx(ctx context.Context) (*User, error) {
+	user := &User{}
+	_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("Myself", myselfPath), nil, nil, user, []int{http.StatusOK})
+	if err != nil {
+		return nil, fmt.Errorf("reading current user: %w", err)
+	}
+	return user, nil
+}
+
+// CaptureSnapshot reads the capabilities, locale and timezone of the tenant.
+func (h *HostClient) CaptureSnapshot() (*TenantSnapshot, error) {
+	return h.CaptureSnapshotCtx(context.Background())
+}
+
+// CaptureSnapshotCtx behaves like CaptureSnapshot bound to ctx, see DoCtx.
+func (h *HostClient) CaptureSnapshotCtx(ctx context.Context) (*TenantSnapshot, error) {
+	info, err := h.ServerInfoCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	capabilities, err := h.DetectCapabilitiesCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	me, err := h.MyselfCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &TenantSnapshot{
+		CapturedAt:     time.Now().UTC(),
+		ServerTitle:    info.ServerTitle,
+		DeploymentType: capabilities.DeploymentType,
+		Version:        capabilities.Version,
+		Applications:   []string{},
+		Locale:         me.Locale,
+		TimeZone:       me.TimeZone,
+	}
+	for application, licensed := range capabilities.Applications {
+		if licensed {
+			s.Applications = append(s.Applications, application)
+		}
+	}
+	sort.Strings(s.Applications)
+	return s, nil
+}
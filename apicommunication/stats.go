@@ -0,0 +1,113 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TenantUsage holds the statistics of the calls made to a tenant.
+type TenantUsage struct {
+	Calls int64 `json:"calls"`
+	// Errors counts network errors and 5xx responses.
+	Errors int64 `json:"errors"`
+	// ClientErrors counts 4xx responses other than 429.
+	ClientErrors int64 `json:"clientErrors"`
+	// RateLimited counts 429 responses.
+	RateLimited int64     `json:"rateLimited"`
+	LastCall    time.Time `json:"lastCall"`
+	// LastError is when the last error was counted, nil if there was none.
+	LastError *time.Time `json:"lastError,omitempty"`
+}
+
+// ErrorRate returns the fraction of calls that failed with network errors or 5xx responses.
+func (t TenantUsage) ErrorRate() float64 {
+	if t.Calls == 0 {
+		return 0
+	}
+	return float64(t.Errors) / float64(t.Calls)
+}
+
+// UsageStats tracks in memory the calls made by HostClients to each tenant, it can be shared by
+// many clients and is safe for concurrent use. Use it to show integration health to tenant admins.
+type UsageStats struct {
+	mu      sync.Mutex
+	tenants map[string]*TenantUsage
+}
+
+// NewUsageStats returns an empty UsageStats.
+func NewUsageStats() *UsageStats {
+	return &UsageStats{tenants: map[string]*TenantUsage{}}
+}
+
+// WithUsageStats makes the client record its calls in u.
+func WithUsageStats(u *UsageStats) HostClientOption {
+	return func(h *HostClient) {
+		h.stats = u
+	}
+}
+
+func (u *UsageStats) record(clientKey string, resp *http.Response, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	t, ok := u.tenants[clientKey]
+	if !ok {
+		t = &TenantUsage{}
+		u.tenants[clientKey] = t
+	}
+	now := time.Now().UTC()
+	t.Calls++
+	t.LastCall = now
+	switch {
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		t.Errors++
+		t.LastError = &now
+	case resp.StatusCode == http.StatusTooManyRequests:
+		t.RateLimited++
+	case resp.StatusCode >= http.StatusBadRequest:
+		t.ClientErrors++
+	}
+}
+
+// Tenant returns the statistics for the passed tenant.
+func (u *UsageStats) Tenant(clientKey string) (TenantUsage, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	t, ok := u.tenants[clientKey]
+	if !ok {
+		return TenantUsage{}, false
+	}
+	return *t, true
+}
+
+// Snapshot returns a copy of the statistics of all tenants keyed by client key.
+func (u *UsageStats) Snapshot() map[string]TenantUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	snapshot := make(map[string]TenantUsage, len(u.tenants))
+	for k, v := range u.tenants {
+		snapshot[k] = *v
+	}
+	return snapshot
+}
+
+// Reset drops the statistics of the passed tenant, ie after it uninstalled the app.
+func (u *UsageStats) Reset(clientKey string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.tenants, clientKey)
+}
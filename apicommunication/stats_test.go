@@ -0,0 +1,68 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUsageStats(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}))
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	stats := NewUsageStats()
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport,
+		WithUsageStats(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []int{http.StatusOK, http.StatusNotFound, http.StatusTooManyRequests, http.StatusBadGateway} {
+		resp, err := hc.Do(http.MethodGet, myselfPath, map[string]string{"status": strconv.Itoa(status)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	srv.Close()
+	if _, err := hc.Do(http.MethodGet, myselfPath, nil, nil); err == nil {
+		t.Fatal("called a closed server")
+	}
+
+	usage, ok := stats.Tenant(tenant.ClientKey)
+	if !ok {
+		t.Fatal("no statistics were recorded")
+	}
+	if usage.Calls != 5 || usage.Errors != 2 || usage.ClientErrors != 1 || usage.RateLimited != 1 {
+		t.Fatalf("recorded %+v", usage)
+	}
+	if usage.LastCall.IsZero() || usage.LastError == nil || usage.ErrorRate() != 0.4 {
+		t.Fatalf("recorded %+v with error rate %v", usage, usage.ErrorRate())
+	}
+	if snapshot := stats.Snapshot(); len(snapshot) != 1 || snapshot[tenant.ClientKey] != usage {
+		t.Fatalf("snapshot is %+v", snapshot)
+	}
+	stats.Reset(tenant.ClientKey)
+	if _, ok := stats.Tenant(tenant.ClientKey); ok {
+		t.Fatal("statistics were kept after resetting them")
+	}
+	if (TenantUsage{}).ErrorRate() != 0 {
+		t.Fatal("a tenant without calls has errors")
+	}
+}
+
+func TestTenantUsage_json(t *testing.T) {
+	b, err := json.Marshal(TenantUsage{Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "lastError") {
+		t.Fatalf("usage without errors was encoded as %s", b)
+	}
+}
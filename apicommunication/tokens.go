@@ -0,0 +1,83 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jira"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// persistedTokenMargin is how long before expiring persisted tokens are no longer handed out, so
+// they don't expire mid request.
+const persistedTokenMargin = 30 * time.Second
+
+// WithTokenStore makes clients impersonating users (see AsUserByAccountID) look for their access
+// tokens in ts before negotiating them, and save the negotiated ones there, so replicas and restarted
+// processes share them.
+func WithTokenStore(ts storage.TokenStore) HostClientOption {
+	return func(h *HostClient) {
+		h.tokenStore = ts
+	}
+}
+
+// persistedTokenSource hands out the token in store while valid and negotiates, and saves, a new
+// one with source otherwise. Failing to read or save tokens does not fail the calls, it only costs
+// negotiating tokens more often.
+type persistedTokenSource struct {
+	store                        storage.TokenStore
+	clientKey, accountID, scopes string
+	source                       oauth2.TokenSource
+}
+
+func (p *persistedTokenSource) Token() (*oauth2.Token, error) {
+	stored, err := p.store.AccessToken(p.clientKey, p.accountID, p.scopes)
+	if err == nil && stored != nil && time.Until(stored.Expiry) > persistedTokenMargin {
+		return &oauth2.Token{
+			AccessToken: stored.AccessToken,
+			TokenType:   stored.TokenType,
+			Expiry:      stored.Expiry,
+		}, nil
+	}
+	token, err := p.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	_ = p.store.SaveAccessToken(p.clientKey, p.accountID, p.scopes, &storage.AccessToken{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      token.Expiry,
+	})
+	return token, nil
+}
+
+// tokenSource returns the source of the access tokens of the user the client impersonates.
+func (h *HostClient) tokenSource(ctx context.Context, cfg *jira.Config, userAccountID string,
+	scopes []string) oauth2.TokenSource {
+	if h.tokenStore == nil {
+		return cfg.TokenSource(ctx)
+	}
+	return oauth2.ReuseTokenSource(nil, &persistedTokenSource{
+		store:     h.tokenStore,
+		clientKey: h.Config.ClientKey,
+		accountID: userAccountID,
+		scopes:    ScopesFromStrings(scopes),
+		source:    cfg.TokenSource(ctx),
+	})
+}
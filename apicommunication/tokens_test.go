@@ -0,0 +1,55 @@
+package apicommunication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestWithTokenStore(t *testing.T) {
+	negotiated := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			negotiated++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token": "user-token", "token_type": "Bearer", "expires_in": 900}`)
+		case myselfPath:
+			if r.Header.Get("Authorization") != "Bearer user-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"accountId": "someone"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	tenant.OauthClientID = "oauth-client"
+	tokens := storage.NewMemoryStore(0)
+	// each client stands for a different replica, only the first one negotiates a token.
+	for i := 0; i < 2; i++ {
+		hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "someone", []string{"READ"},
+			srv.Client().Transport, WithAuthorizationServer(srv.URL, ""), WithTokenStore(tokens))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := hc.Myself(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if negotiated != 1 {
+		t.Fatalf("negotiated %d tokens, expected 1", negotiated)
+	}
+	token, _ := tokens.AccessToken(tenant.ClientKey, "someone", "READ")
+	if token == nil || token.AccessToken != "user-token" || time.Until(token.Expiry) < 10*time.Minute {
+		t.Fatalf("saved token is %+v", token)
+	}
+}
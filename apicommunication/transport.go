@@ -15,6 +15,7 @@ package apicommunication
 //    limitations under the License.
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -27,9 +28,9 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	gojira "github.com/andygrunwald/go-jira"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/jira"
@@ -53,6 +54,39 @@ type HostClient struct {
 	baseURL       string
 	client        *http.Client
 	localCache    map[string]*HostClient // more than enough for 60 sec tokens
+
+	roundtripper http.RoundTripper
+	opts         []HostClientOption
+	// allowedHostSuffixes restricts the hosts this client talks to, see WithHostGuard.
+	allowedHostSuffixes []string
+	// tokenLifetime, tokenClaims and tokenAudience customize the JWTs we sign, see WithTokenLifetime.
+	tokenLifetime time.Duration
+	tokenClaims   map[string]interface{}
+	tokenAudience []string
+	// authorizationServerBaseURL and authorizationPath override atlassian's oauth2 server.
+	authorizationServerBaseURL string
+	authorizationPath          string
+	// proxyFunc returns the egress proxy for the tenant, see WithProxy.
+	proxyFunc func(*storage.JiraInstallInformation) (*url.URL, error)
+	profile   TimeoutProfile
+	stats     *UsageStats
+	// attachmentInterceptors inspect attachment contents, see WithAttachmentInterceptors.
+	attachmentInterceptors []AttachmentInterceptor
+	// apiVersion and methodAPIVersions select the platform API version, see WithAPIVersion.
+	apiVersion        int
+	methodAPIVersions map[string]int
+	// dataCenter is set for jira server and data center instances, see WithDataCenter.
+	dataCenter bool
+	// tokenStore persists the access tokens of impersonated users, see WithTokenStore.
+	tokenStore storage.TokenStore
+	// maintenance pauses calls to tenants in maintenance windows, see WithMaintenanceTracker.
+	maintenance *MaintenanceTracker
+	// scheduler caps the calls to the tenant running at once, see WithRequestScheduler.
+	scheduler *RequestScheduler
+	// rateLimitPolicy says how rate limited calls are retried, see WithRateLimitPolicy.
+	rateLimitPolicy RateLimitPolicy
+	// rateLimits keeps the rate limit state of the tenant, see WithRateLimitTracker.
+	rateLimits *RateLimitTracker
 }
 
 // theoretically this combines DialContext and TLSHandshakeTimeout for TLS conns, we can look
@@ -73,45 +107,84 @@ var defaultJiraTransport http.RoundTripper = &http.Transport{
 }
 
 // NewHostClient returns a new host client for JIRA interaction based on the passed config and user account ID
-func NewHostClient(ctx context.Context, config *storage.JiraInstallInformation, userAccountID string, scopes []string) (*HostClient, error) {
-	return NewHostClientWithRoundtripper(ctx, config, userAccountID, scopes, defaultJiraTransport)
+func NewHostClient(ctx context.Context, config *storage.JiraInstallInformation, userAccountID string, scopes []string,
+	opts ...HostClientOption) (*HostClient, error) {
+	return NewHostClientWithRoundtripper(ctx, config, userAccountID, scopes, defaultJiraTransport, opts...)
 }
 
 // NewHostClientWithRoundtripper is the same as NewHostClient but allows the caller to specify a custom transport
 func NewHostClientWithRoundtripper(ctx context.Context, config *storage.JiraInstallInformation,
-	userAccountID string, scopes []string, roundtripper http.RoundTripper) (*HostClient, error) {
+	userAccountID string, scopes []string, roundtripper http.RoundTripper, opts ...HostClientOption) (*HostClient, error) {
 	hostClient := &HostClient{
 		ctx:           ctx,
 		scopes:        scopes,
 		Config:        config,
 		UserAccountID: userAccountID,
 		baseURL:       config.BaseURL,
+		roundtripper:  roundtripper,
+		opts:          opts,
+		localCache:    map[string]*HostClient{},
+	}
+	for _, opt := range opts {
+		opt(hostClient)
+	}
+	if config.BaseURL == "" {
+		return nil, fmt.Errorf("jira install information is incomplete, base URL is empty")
+	}
+	if err := hostClient.checkBaseURL(); err != nil {
+		return nil, err
+	}
+	roundtripper, err := hostClient.proxiedRoundtripper(roundtripper)
+	if err != nil {
+		return nil, err
 	}
 	if userAccountID != "" {
+		// make the oauth2 package use our transport for both token negotiation and requests.
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: roundtripper})
 		cfg, err := getOauth2Config(ctx,
-			config.BaseURL, config.OauthClientID, config.SharedSecret, userAccountID, "", scopes, "", "")
+			config.BaseURL, config.OauthClientID, config.SharedSecret, userAccountID, "", scopes,
+			hostClient.authorizationServerBaseURL, hostClient.authorizationPath)
 		if err != nil {
 			return nil, fmt.Errorf("creating jwt config: %w", err)
 		}
-		hostClient.client = cfg.Client(ctx)
-		return hostClient, nil
-	}
-	transport := gojira.JWTAuthTransport{
-		Secret:    []byte(config.SharedSecret),
-		Issuer:    config.Key,
-		Transport: roundtripper,
-	}
-	hostClient.client = transport.Client()
-
-	if config.BaseURL == "" {
-		return nil, fmt.Errorf("jira install information is incomplete, base URL is empty")
+		hostClient.client = oauth2.NewClient(ctx, hostClient.tokenSource(ctx, cfg, userAccountID, scopes))
+	} else {
+		transport, err := hostClient.newJWTTransport(roundtripper)
+		if err != nil {
+			return nil, err
+		}
+		hostClient.client = &http.Client{Transport: transport}
 	}
-	hostClient.localCache = map[string]*HostClient{}
+	hostClient.client.CheckRedirect = hostClient.checkRedirect
+	hostClient.client.Timeout = hostClient.profile.Timeout
 	return hostClient, nil
 }
 
-// Do performs an http action in JIRA using this client's configuration and the passed info.
+// Do performs an http action in JIRA using this client's configuration and the passed info. path
+// may carry a query, for arguments that are repeated and can not be passed in queryArgs.
+// Requests are not bound to any context, see DoCtx.
 func (h *HostClient) Do(method, path string, queryArgs map[string]string, body io.Reader) (*http.Response, error) {
+	return h.DoWithHeaders(method, path, queryArgs, body, nil)
+}
+
+// DoCtx behaves like Do but the request, retries included, is canceled when ctx is done, so callers
+// can propagate their deadlines. The request id of ctx, if any, is sent instead of the one of the
+// context the client was created with.
+func (h *HostClient) DoCtx(ctx context.Context, method, path string, queryArgs map[string]string,
+	body io.Reader) (*http.Response, error) {
+	return h.DoWithHeadersCtx(ctx, method, path, queryArgs, body, nil)
+}
+
+// DoWithHeaders behaves like Do but sets the passed headers in the request, they replace the JSON
+// Accept and Content-Type headers Do sets, ie to request CSV exports or send binary bodies.
+func (h *HostClient) DoWithHeaders(method, path string, queryArgs map[string]string, body io.Reader,
+	header http.Header) (*http.Response, error) {
+	return h.DoWithHeadersCtx(context.Background(), method, path, queryArgs, body, header)
+}
+
+// DoWithHeadersCtx behaves like DoWithHeaders bound to ctx, see DoCtx.
+func (h *HostClient) DoWithHeadersCtx(ctx context.Context, method, path string, queryArgs map[string]string,
+	body io.Reader, header http.Header) (*http.Response, error) {
 	if h.client == nil {
 		return nil, errors.Errorf("we are missing an http client")
 	}
@@ -121,27 +194,133 @@ func (h *HostClient) Do(method, path string, queryArgs map[string]string, body i
 		return nil, errors.Wrap(err, "parsing jira information base URL")
 	}
 
-	u.Path = path
+	var pathQuery string
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, pathQuery = path[:i], path[i+1:]
+	}
+	// confluence is served under a context path (/wiki) that api paths are relative to.
+	if basePath := strings.TrimRight(u.Path, "/"); !strings.HasPrefix(path, basePath+"/") {
+		u.Path = basePath + path
+	} else {
+		u.Path = path
+	}
 	q := u.Query()
+	extra, err := url.ParseQuery(pathQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing query of path")
+	}
+	for k, vs := range extra {
+		q[k] = append(q[k], vs...)
+	}
 	for k, v := range queryArgs {
 		q.Add(k, v)
 	}
 	u.RawQuery = q.Encode()
-	r, err := http.NewRequest(method, u.String(), body)
-	if err != nil {
-		return nil, errors.Wrap(err, "building request to JIRA")
+
+	// bodies are buffered when retrying so they can be sent again.
+	var bodyBytes []byte
+	if body != nil && h.profile.Retries > 0 && idempotent(method) {
+		if bodyBytes, err = ioutil.ReadAll(body); err != nil {
+			return nil, errors.Wrap(err, "reading request body")
+		}
 	}
-	r.Header.Add("Accept", "application/json")
-	r.Header.Add("Content-Type", "application/json")
-	response, err := h.client.Do(r)
-	if err != nil {
-		return nil, errors.Wrapf(err, "querying for %s", u.String())
+	// other bodies are only sent again for rate limits if they can be rewound, they are not read
+	// ahead since they can be large or streamed.
+	var rewind func() error
+	if seeker, ok := body.(io.Seeker); ok && bodyBytes == nil && h.rateLimitPolicy.Retries > 0 {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			rewind = func() error {
+				_, err := seeker.Seek(start, io.SeekStart)
+				return err
+			}
+			// the client closes bodies once sent, which would prevent rewinding files.
+			if _, ok := body.(io.Closer); ok {
+				body = ioutil.NopCloser(body)
+			}
+		}
+	}
+	var waited time.Duration
+	for attempt, limited := 0, 0; ; {
+		if h.maintenance != nil {
+			if err := h.maintenance.check(h.Config.ClientKey); err != nil {
+				return nil, err
+			}
+		}
+		// calls to a tenant known to be rate limited wait for it to lift, if the policy allows.
+		if h.rateLimits != nil && h.rateLimitPolicy.Retries > 0 {
+			pause := h.rateLimits.pause(h.Config.ClientKey)
+			if pause > 0 && (h.rateLimitPolicy.MaxWait <= 0 || waited+pause <= h.rateLimitPolicy.MaxWait) {
+				waited += pause
+				if err := sleepCtx(ctx, pause); err != nil {
+					return nil, errors.Wrapf(err, "querying for %s", u.String())
+				}
+			}
+		}
+		if bodyBytes != nil {
+			body = bytes.NewReader(bodyBytes)
+		} else if rewind != nil && attempt+limited > 0 {
+			if err := rewind(); err != nil {
+				return nil, errors.Wrap(err, "rewinding request body")
+			}
+		}
+		r, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+		if err != nil {
+			return nil, errors.Wrap(err, "building request to JIRA")
+		}
+		r.Header.Add("Accept", "application/json")
+		r.Header.Add("Content-Type", "application/json")
+		for k, v := range header {
+			r.Header[http.CanonicalHeaderKey(k)] = v
+		}
+		requestID := RequestIDFromContext(ctx)
+		if requestID == "" {
+			requestID = RequestIDFromContext(h.ctx)
+		}
+		if requestID != "" {
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		release := func() {}
+		if h.scheduler != nil {
+			if release, err = h.scheduler.acquire(ctx, h.Config.ClientKey, h.priority(ctx)); err != nil {
+				return nil, errors.Wrapf(err, "querying for %s", u.String())
+			}
+		}
+		response, err := h.client.Do(r)
+		holdUntilClosed(response, release)
+		if h.stats != nil {
+			h.stats.record(h.Config.ClientKey, response, err)
+		}
+		if h.rateLimits != nil {
+			h.rateLimits.observe(h.Config.ClientKey, response)
+		}
+		// retrying within a maintenance window is pointless.
+		inMaintenance := h.maintenance != nil && h.maintenance.observe(h.Config.ClientKey, response)
+		var wait time.Duration
+		if limitWait, ok := h.rateLimitWait(limited, waited, response, body == nil || bodyBytes != nil || rewind != nil); ok {
+			limited++
+			waited += limitWait
+			wait = limitWait
+		} else if inMaintenance || !h.shouldRetry(ctx, attempt, method, response, err) {
+			if err != nil {
+				return nil, errors.Wrapf(err, "querying for %s", u.String())
+			}
+			return response, nil
+		} else {
+			attempt++
+			wait = h.retryWait(attempt)
+		}
+		if response != nil {
+			response.Body.Close()
+		}
+		if err := sleepCtx(ctx, wait); err != nil {
+			return nil, errors.Wrapf(err, "querying for %s", u.String())
+		}
 	}
-	return response, nil
 }
 
 // TypeFromResponse deserializes an http.Response body into an arbitrary type
 // beware, this will accept anything but fail if it's not a pointer to.
+// Bodies that are not JSON, such as CSV exports, are read with RawFromResponse instead.
 func TypeFromResponse(r *http.Response, target interface{}) error {
 	err := json.NewDecoder(r.Body).Decode(target)
 	if err != nil {
@@ -150,6 +329,15 @@ func TypeFromResponse(r *http.Response, target interface{}) error {
 	return nil
 }
 
+// RawFromResponse copies an http.Response body into w as is, for bodies that are not JSON such as
+// CSV exports or attachment contents.
+func RawFromResponse(r *http.Response, w io.Writer) error {
+	if _, err := io.Copy(w, r.Body); err != nil {
+		return errors.Wrap(err, "copying body")
+	}
+	return nil
+}
+
 // UnexpectedResponse should be returned when DoWithTarget encounters an HTTP status code that was
 // not expected on a response from JIRA.
 type UnexpectedResponse struct {
@@ -167,25 +355,38 @@ func (err *UnexpectedResponse) Error() string {
 
 // IsUnexpectedResponse returns true if the passed error is of type UnexpectedResponse
 func IsUnexpectedResponse(err error) bool {
-	_, ok := err.(*UnexpectedResponse)
-	return ok
+	var ur *UnexpectedResponse
+	return errors.As(err, &ur)
 }
 
 // DoWithTarget performs a request much like do but can check for expected response codes and deserialize
 // the response body into a passed target.
+// Responses with one of expectedCodes are deserialized into target, unless it is nil or the status is
+// 204 No Content, any other status fails with an UnexpectedResponse.
 func (h *HostClient) DoWithTarget(method, path string, queryArgs map[string]string,
 	body io.Reader, target interface{}, expectedCodes []int) (int, error) {
-	resp, err := h.Do(method, path, queryArgs, body)
+	return h.DoWithTargetCtx(context.Background(), method, path, queryArgs, body, target, expectedCodes)
+}
+
+// DoWithTargetCtx behaves like DoWithTarget bound to ctx, see DoCtx.
+func (h *HostClient) DoWithTargetCtx(ctx context.Context, method, path string, queryArgs map[string]string,
+	body io.Reader, target interface{}, expectedCodes []int) (int, error) {
+	resp, err := h.DoCtx(ctx, method, path, queryArgs, body)
 	if err != nil {
 		return -1, fmt.Errorf("performing HTTP request: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if len(expectedCodes) > 0 {
 		for _, c := range expectedCodes {
 			if resp.StatusCode == c {
+				if target == nil || resp.StatusCode == http.StatusNoContent {
+					return resp.StatusCode, nil
+				}
 				if err := TypeFromResponse(resp, target); err != nil {
 					return resp.StatusCode, fmt.Errorf("deserializing result: %w", err)
 				}
+				return resp.StatusCode, nil
 			}
 		}
 		return resp.StatusCode, &UnexpectedResponse{
@@ -199,6 +400,29 @@ func (h *HostClient) DoWithTarget(method, path string, queryArgs map[string]stri
 	return resp.StatusCode, nil
 }
 
+// DoStream performs a request accepting the passed media type (ie text/csv) and, if the response
+// status is one of expectedCodes, streams the response body into w without buffering it.
+func (h *HostClient) DoStream(method, path string, queryArgs map[string]string, body io.Reader,
+	accept string, w io.Writer, expectedCodes []int) (int, error) {
+	resp, err := h.DoWithHeaders(method, path, queryArgs, body, http.Header{"Accept": {accept}})
+	if err != nil {
+		return -1, fmt.Errorf("performing HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	for _, c := range expectedCodes {
+		if resp.StatusCode == c {
+			if err := RawFromResponse(resp, w); err != nil {
+				return resp.StatusCode, fmt.Errorf("streaming response: %w", err)
+			}
+			return resp.StatusCode, nil
+		}
+	}
+	return resp.StatusCode, &UnexpectedResponse{
+		obtained: resp.StatusCode,
+		expected: expectedCodes,
+	}
+}
+
 const (
 	// ProductTypeJira represents a jira server
 	ProductTypeJira = "jira"
@@ -209,10 +433,20 @@ const (
 // AsUserByAccountID returns a HostClient whose calls impersoante another user, who is
 // defined by the passed account ID
 func (h *HostClient) AsUserByAccountID(userAccountID string) (*HostClient, error) {
+	return h.asUser(userAccountID, h.scopes)
+}
+
+// asUser returns a HostClient impersonating the user with the passed account ID whose tokens are
+// requested for scopes, clients are cached per user and scope set.
+func (h *HostClient) asUser(userAccountID string, scopes []string) (*HostClient, error) {
 	if userAccountID == "" {
 		return nil, fmt.Errorf("user account ID must not be blank")
 	}
-	if chc, cached := h.localCache[userAccountID]; cached {
+	if h.dataCenter {
+		return nil, fmt.Errorf("impersonating users is not available in jira data center")
+	}
+	cacheKey := userAccountID + "|" + ScopesFromStrings(scopes)
+	if chc, cached := h.localCache[cacheKey]; cached {
 		// TODO: does this know how to renegotiate itself?
 		return chc, nil
 	}
@@ -222,11 +456,11 @@ func (h *HostClient) AsUserByAccountID(userAccountID string) (*HostClient, error
 		}
 		return nil, fmt.Errorf("the asUserByAccountID method is not available for %s add-ons", h.Config.ProductType)
 	}
-	hc, err := NewHostClient(h.ctx, h.Config, userAccountID, h.scopes)
+	hc, err := NewHostClientWithRoundtripper(h.ctx, h.Config, userAccountID, scopes, h.roundtripper, h.opts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating impersonating host client: %w", err)
 	}
-	h.localCache[userAccountID] = hc
+	h.localCache[cacheKey] = hc
 	return hc, nil
 }
 
@@ -284,7 +518,7 @@ func getOauth2Config(ctx context.Context,
 			ClientID:     oauthClientID,
 			ClientSecret: sharedSecret,
 			Endpoint: oauth2.Endpoint{
-				AuthURL:  authorizationServerURL,
+				AuthURL:  authorizationServerBaseURL,
 				TokenURL: tokenURL,
 			},
 			// Scopes are joined as a string because this is how jira acepts them
@@ -342,75 +576,247 @@ func toClaims(jcs *jira.ClaimSet) jwt.Claims {
 	return validClaims
 }
 
+// Claims holds the claims of a JWT sent to us by atlassian, it is a jira.ClaimSet plus the
+// few atlassian connect specifics that the oauth2 package does not care about.
+type Claims struct {
+	jira.ClaimSet
+	ID              string `json:"jti,omitempty"`
+	QueryStringHash string `json:"qsh,omitempty"`
+	// Context holds the user jira signed the request for, it is nil for requests not made on behalf
+	// of one, such as webhooks.
+	Context *ClaimsContext `json:"context,omitempty"`
+}
+
+// ClaimsContext is the context claim of the JWTs jira signs.
+type ClaimsContext struct {
+	User *ClaimsUser `json:"user,omitempty"`
+}
+
+// ClaimsUser identifies the user in the context claim, UserKey and Username are only sent by jira
+// server and data center.
+type ClaimsUser struct {
+	AccountID string `json:"accountId,omitempty"`
+	UserKey   string `json:"userKey,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+// AccountID returns the accountId of the user the token was signed for, taken from the context
+// claim or else the subject, "" if it was not signed for a user.
+func (c *Claims) AccountID() string {
+	if c == nil {
+		return ""
+	}
+	if c.Context != nil && c.Context.User != nil && c.Context.User.AccountID != "" {
+		return c.Context.User.AccountID
+	}
+	// tokens not signed for a user may carry the client key as subject.
+	if c.Subject == c.Issuer {
+		return ""
+	}
+	return c.Subject
+}
+
+// Valid implements jwt.Claims
+func (c *Claims) Valid() error {
+	return toClaims(&c.ClaimSet).Valid()
+}
+
 // ValidateRequest returns jira install information for the request author if valid or error if not.
 // This validation will not work in lifecycle installed event
 func ValidateRequest(r *http.Request, st storage.Store) (*storage.JiraInstallInformation, error) {
-	q := r.URL.Query()
-	queryJWT := q.Get("jwt")
-	if queryJWT == "" {
-		authHeader := r.Header.Get("Authorization")
-		queryJWT = strings.TrimPrefix(authHeader, "JWT ")
-		if queryJWT == "" {
-			return nil, fmt.Errorf("jwt was expected in the query string or header")
-		}
+	jii, _, err := ValidateRequestClaims(r, st)
+	return jii, err
+}
+
+// ValidateRequestClaims behaves like ValidateRequest but also returns the claims from the validated token.
+func ValidateRequestClaims(r *http.Request, st storage.Store) (*storage.JiraInstallInformation, *Claims, error) {
+	return ValidateRequestFrom(r, st, DefaultTokenSources)
+}
+
+// ValidateRequestFrom behaves like ValidateRequestClaims but only looks for the JWT in the passed sources.
+func ValidateRequestFrom(r *http.Request, st storage.Store,
+	sources TokenSource) (*storage.JiraInstallInformation, *Claims, error) {
+	queryJWT, err := ExtractToken(r, sources)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	p := &jwt.Parser{}
-	// massage a bit oauth2 claimset to be jwt.Claims friendly
-	jcs := &jira.ClaimSet{}
-	claims := toClaims(jcs)
-	// Decode jwt to obtain info from claims
-	_, _, err := p.ParseUnverified(queryJWT, claims)
+	return ValidateToken(queryJWT, st)
+}
+
+// ValidateToken verifies a JWT sent by atlassian with the shared secret of its issuer, it returns the
+// issuer install information and the token claims. The token is parsed a single time unless its
+// signature does not match, then the previous shared secret of the issuer is tried if still valid
+// (see storage.JiraInstallInformation.PreviousSharedSecret) and, if st caches install information
+// (see storage.Invalidator), the issuer is read again in case the secret was rotated in another replica,
+// at most once every 10 seconds per issuer.
+func ValidateToken(token string, st storage.Store) (*storage.JiraInstallInformation, *Claims, error) {
+	claims := &Claims{}
+	var jii *storage.JiraInstallInformation
+	// the token is parsed once, the key func is invoked with the claims already decoded so the
+	// issuer secret can be looked up.
+	_, err := (&jwt.Parser{}).ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		var err error
+		if jii, err = LoadInstallInformation(st, claims.Issuer); err != nil {
+			return nil, err
+		}
+		return []byte(jii.SharedSecret), nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("malformed token: %w", err)
+		if jii == nil {
+			if loadErr := keyFuncError(err); loadErr != nil {
+				return nil, nil, loadErr
+			}
+			return nil, nil, tokenError(err, "malformed token")
+		}
+		if !isSignatureError(err) {
+			return nil, nil, tokenError(err, "parsing token")
+		}
+		return validateRotatedToken(token, st, jii)
+	}
+	return jii, claims, nil
+}
+
+// validateRotatedToken verifies a token whose signature did not match the shared secret of its
+// issuer jii, with the previous secret of the issuer or the one stored after invalidating its cache,
+// at most once per rotationRefreshInterval.
+func validateRotatedToken(token string, st storage.Store,
+	jii *storage.JiraInstallInformation) (*storage.JiraInstallInformation, *Claims, error) {
+	invalid := tokenError(jwt.NewValidationError("signature is invalid", jwt.ValidationErrorSignatureInvalid),
+		"parsing token")
+	if jii.PreviousSharedSecretValid(time.Now()) {
+		if claims, err := parseWithSecret(token, jii.PreviousSharedSecret); err == nil {
+			return jii, claims, nil
+		}
 	}
-	jii, err := st.JiraInstallInformation(jcs.Issuer)
+	cache, ok := st.(storage.Invalidator)
+	if !ok {
+		return nil, nil, invalid
+	}
+	fresh, err := rotationRefreshes.refresh(st, cache, jii.ClientKey)
 	if err != nil {
-		return nil, fmt.Errorf("reading jira install information from storage: %w", err)
+		return nil, nil, err
 	}
-	if jii == nil {
-		return nil, fmt.Errorf("no jira install information for client key: %s", jcs.Issuer)
+	if fresh == nil || fresh.SharedSecret == jii.SharedSecret {
+		return nil, nil, invalid
 	}
-	// now validate the thing
-	_, err = p.ParseWithClaims(queryJWT, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jii.SharedSecret), nil
-	})
+	claims, err := parseWithSecret(token, fresh.SharedSecret)
 	if err != nil {
-		if _, ok := err.(*jwt.ValidationError); ok {
-			return nil, fmt.Errorf("malformed token: %w", err)
+		return nil, nil, tokenError(err, "parsing token")
+	}
+	return fresh, claims, nil
+}
+
+// rotationRefreshInterval is the least time between two reads of the install information of a
+// tenant caused by tokens not matching its cached secret, so a stream of forged tokens does not
+// turn into a stream of reads of the backing store. A secret rotated elsewhere right after a read
+// is only accepted once it elapsed.
+const rotationRefreshInterval = 10 * time.Second
+
+// rotationRefreshes debounces the reads of validateRotatedToken.
+var rotationRefreshes = newRefreshDebouncer(rotationRefreshInterval)
+
+// refreshDebouncer reads the install information of tenants again at most once per interval,
+// concurrent refreshes of a tenant share the same read.
+type refreshDebouncer struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	last     map[string]time.Time
+	inflight map[string]*tenantRefresh
+}
+
+// tenantRefresh is a refresh in progress.
+type tenantRefresh struct {
+	done chan struct{}
+	jii  *storage.JiraInstallInformation
+	err  error
+}
+
+func newRefreshDebouncer(interval time.Duration) *refreshDebouncer {
+	return &refreshDebouncer{
+		interval: interval,
+		now:      time.Now,
+		last:     map[string]time.Time{},
+		inflight: map[string]*tenantRefresh{},
+	}
+}
+
+// refresh invalidates the cached install information of the tenant and reads it again from st, it
+// returns nil if the tenant was already refreshed less than the interval ago.
+func (d *refreshDebouncer) refresh(st storage.Store, cache storage.Invalidator,
+	clientKey string) (*storage.JiraInstallInformation, error) {
+	d.mu.Lock()
+	if refresh, ok := d.inflight[clientKey]; ok {
+		d.mu.Unlock()
+		<-refresh.done
+		return refresh.jii, refresh.err
+	}
+	now := d.now()
+	if last, ok := d.last[clientKey]; ok && now.Sub(last) < d.interval {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	for k, last := range d.last {
+		if now.Sub(last) >= d.interval {
+			delete(d.last, k)
 		}
-		return nil, fmt.Errorf("parsing token: %w", err)
 	}
-	return jii, nil
+	d.last[clientKey] = now
+	refresh := &tenantRefresh{done: make(chan struct{})}
+	d.inflight[clientKey] = refresh
+	d.mu.Unlock()
+
+	cache.Invalidate(clientKey)
+	refresh.jii, refresh.err = LoadInstallInformation(st, clientKey)
+
+	d.mu.Lock()
+	delete(d.inflight, clientKey)
+	d.mu.Unlock()
+	close(refresh.done)
+	return refresh.jii, refresh.err
+}
+
+func parseWithSecret(token, secret string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := (&jwt.Parser{}).ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	return claims, err
+}
+
+// isSignatureError returns true if err is only caused by the token signature not matching.
+func isSignatureError(err error) bool {
+	var vErr *jwt.ValidationError
+	return errors.As(err, &vErr) && vErr.Errors == jwt.ValidationErrorSignatureInvalid
+}
+
+// keyFuncError returns the error returned by the key func passed to jwt.Parser if that is what
+// caused err, so store failures are not reported as invalid tokens.
+func keyFuncError(err error) error {
+	var vErr *jwt.ValidationError
+	if errors.As(err, &vErr) && vErr.Errors&jwt.ValidationErrorUnverifiable != 0 && vErr.Inner != nil {
+		return vErr.Inner
+	}
+	return nil
 }
 
 const kidValidationURL = "https://connect-install-keys.atlassian.com/"
 
 // ValidateInstallRequest attempts to validate new install method for jira
 func ValidateInstallRequest(r *http.Request, st storage.Store) error {
-	q := r.URL.Query()
-	queryJWT := q.Get("jwt")
-	if queryJWT == "" {
-		authHeader := r.Header.Get("Authorization")
-		queryJWT = strings.TrimPrefix(authHeader, "JWT ")
-		if queryJWT == "" {
-			return fmt.Errorf("jwt was expected in the query string or header")
-		}
+	queryJWT, err := ExtractToken(r, DefaultTokenSources)
+	if err != nil {
+		return err
 	}
 
-	p := &jwt.Parser{}
 	// massage a bit oauth2 claimset to be jwt.Claims friendly
 	jcs := &jira.ClaimSet{}
 	claims := toClaims(jcs)
-	// Decode jwt to obtain info from claims
-	t, _, err := p.ParseUnverified(queryJWT, claims)
-	if err != nil {
-		return fmt.Errorf("malformed token: %w", err)
-	}
-
-	// now validate the thing
-	_, err = p.ParseWithClaims(queryJWT, claims, func(token *jwt.Token) (interface{}, error) {
-		kidRaw := t.Header["kid"]
+	// the header is available to the key func so the token is parsed once.
+	_, err = (&jwt.Parser{}).ParseWithClaims(queryJWT, claims, func(token *jwt.Token) (interface{}, error) {
+		kidRaw := token.Header["kid"]
 		kid, ok := kidRaw.(string)
 		if !ok {
 			return nil, fmt.Errorf("kid is not a string but %T", kidRaw)
@@ -421,6 +827,7 @@ func ValidateInstallRequest(r *http.Request, st storage.Store) error {
 			if err != nil {
 				return nil, fmt.Errorf("obtaining public key from atlassian: %w", err)
 			}
+			defer kidResp.Body.Close()
 			kidPKey, err := ioutil.ReadAll(kidResp.Body)
 			if err != nil {
 				return nil, fmt.Errorf("reading public key from atlassian: %w", err)
@@ -430,10 +837,7 @@ func ValidateInstallRequest(r *http.Request, st storage.Store) error {
 		return []byte{}, nil
 	})
 	if err != nil {
-		if _, ok := err.(*jwt.ValidationError); ok {
-			return fmt.Errorf("malformed token: %w", err)
-		}
-		return fmt.Errorf("parsing token: %w", err)
+		return tokenError(err, "parsing token")
 	}
 	return nil
 }
@@ -0,0 +1,357 @@
+package apicommunication
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+// readCountingStore counts the install information reads of a singleTenantStore.
+type readCountingStore struct {
+	singleTenantStore
+	reads int
+}
+
+func (s *readCountingStore) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	s.reads++
+	return s.singleTenantStore.JiraInstallInformation(clientKey)
+}
+
+func TestValidateToken(t *testing.T) {
+	st := &readCountingStore{singleTenantStore: singleTenantStore{jii: benchTenant}}
+	sign := func(issuer string, expires time.Time) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": issuer,
+			"sub": "someaccountid",
+			"exp": expires.Unix(),
+		}).SignedString([]byte(benchTenant.SharedSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	jii, claims, err := ValidateToken(sign(benchTenant.ClientKey, time.Now().Add(time.Minute)), st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jii.ClientKey != benchTenant.ClientKey || claims.Subject != "someaccountid" {
+		t.Fatalf("validated %s for %s", jii.ClientKey, claims.Subject)
+	}
+	if st.reads != 1 {
+		t.Fatalf("read the issuer %d times", st.reads)
+	}
+	if _, _, err := ValidateToken(sign("unknown", time.Now().Add(time.Minute)), st); !errors.Is(err, ErrNoInstallInfo) {
+		t.Fatalf("token of an unknown issuer returned %v", err)
+	}
+	if _, _, err := ValidateToken(sign(benchTenant.ClientKey, time.Now().Add(-time.Minute)), st); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("expired token returned %v", err)
+	}
+	if _, _, err := ValidateToken("not.a.token", st); !errors.Is(err, ErrInvalidJWT) {
+		t.Fatalf("malformed token returned %v", err)
+	}
+}
+
+func TestHostClient_DoCtx(t *testing.T) {
+	requestIDs := make(chan string, 10)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIDs <- r.Header.Get(RequestIDHeader)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(ContextWithRequestID(context.Background(), "client"), &tenant, "", nil,
+		srv.Client().Transport, WithTimeoutProfile(ProfileBatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ContextWithRequestID(context.Background(), "call"), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = hc.DoWithTargetCtx(ctx, http.MethodGet, myselfPath, nil, nil, nil, []int{http.StatusOK})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expired context returned %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("retries went on for %v after the deadline", elapsed)
+	}
+	if id := <-requestIDs; id != "call" {
+		t.Fatalf("sent request id %q", id)
+	}
+}
+
+func TestRequestScheduler(t *testing.T) {
+	unblock := make(chan struct{})
+	arrived := make(chan string, 10)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- r.URL.Query().Get("call")
+		if r.URL.Query().Get("call") == "first" {
+			<-unblock
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	scheduler := NewRequestScheduler(1)
+	hc, err := NewHostClientWithRoundtripper(ContextWithPriority(context.Background(), PriorityBackground), &tenant,
+		"", nil, srv.Client().Transport, WithRequestScheduler(scheduler))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 3)
+	call := func(ctx context.Context, name string) {
+		_, err := hc.DoWithTargetCtx(ctx, http.MethodGet, myselfPath, map[string]string{"call": name}, nil, nil,
+			[]int{http.StatusOK})
+		done <- err
+	}
+	go call(context.Background(), "first")
+	if got := <-arrived; got != "first" {
+		t.Fatalf("%s arrived first", got)
+	}
+	go call(context.Background(), "sync")
+	for scheduler.Waiting(tenant.ClientKey) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	go call(canceled, "abandoned")
+	go call(ContextWithPriority(context.Background(), PriorityInteractive), "panel")
+	for scheduler.Waiting(tenant.ClientKey) != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("abandoned call returned %v", err)
+	}
+	close(unblock)
+	for i := 0; i < 3; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := []string{<-arrived, <-arrived}; got[0] != "panel" || got[1] != "sync" {
+		t.Fatalf("calls arrived in order %v", got)
+	}
+	if n := scheduler.InFlight(tenant.ClientKey); n != 0 {
+		t.Fatalf("%d calls still hold a slot", n)
+	}
+}
+
+func TestHostClient_rateLimits(t *testing.T) {
+	var calls int
+	var bodies []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Reset", "2030-01-02T03:04:05Z")
+		switch r.URL.Query().Get("wait") {
+		case "long":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			if calls < 3 {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("X-RateLimit-Remaining", "15")
+			w.Header().Set("X-RateLimit-NearLimit", "true")
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport,
+		WithRateLimitPolicy(RateLimitPolicy{Retries: 3, MaxWait: time.Second}), WithRateLimitTracker(NewRateLimitTracker()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := hc.DoWithTarget(http.MethodPost, "/rest/api/3/issue", nil, strings.NewReader(`{"fields":{}}`), nil,
+		[]int{http.StatusCreated})
+	if err != nil {
+		t.Fatalf("rate limited call returned %d, %v", status, err)
+	}
+	if calls != 3 || bodies[2] != `{"fields":{}}` {
+		t.Fatalf("made %d calls, last with body %q", calls, bodies[len(bodies)-1])
+	}
+	state, ok := hc.RateLimit()
+	if !ok || state.Limit != 100 || state.Remaining != 15 || !state.NearLimit || state.Reset.Year() != 2030 {
+		t.Fatalf("rate limit state is %+v", state)
+	}
+
+	start := time.Now()
+	status, _ = hc.DoWithTarget(http.MethodGet, myselfPath, map[string]string{"wait": "long"}, nil, nil, nil)
+	if status != http.StatusTooManyRequests || time.Since(start) > time.Second {
+		t.Fatalf("call that would exceed the wait budget returned %d after %v", status, time.Since(start))
+	}
+	if state, _ := hc.RateLimit(); !state.Limited(time.Now()) {
+		t.Fatalf("tenant is not limited after a Retry-After: %+v", state)
+	}
+}
+
+func TestHostClient_rateLimitsBodies(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies)%2 == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport,
+		WithRateLimitPolicy(RateLimitPolicy{Retries: 3, MaxWait: time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files are rewound rather than read ahead, and not closed by the client between attempts.
+	f, err := ioutil.TempFile(t.TempDir(), "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(`skipped{"fields":{}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(int64(len("skipped")), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	status, err := hc.DoWithTarget(http.MethodPost, "/rest/api/3/issue", nil, f, nil, []int{http.StatusCreated})
+	if err != nil {
+		t.Fatalf("rate limited call returned %d, %v", status, err)
+	}
+	if len(bodies) != 2 || bodies[0] != `{"fields":{}}` || bodies[1] != bodies[0] {
+		t.Fatalf("sent bodies %q", bodies)
+	}
+
+	// streamed bodies can not be sent again, the rate limited response is returned.
+	bodies = nil
+	streamed := struct{ io.Reader }{strings.NewReader(`{"fields":{}}`)}
+	status, _ = hc.DoWithTarget(http.MethodPost, "/rest/api/3/issue", nil, streamed, nil, nil)
+	if status != http.StatusTooManyRequests || len(bodies) != 1 {
+		t.Fatalf("streamed body returned %d after %d calls", status, len(bodies))
+	}
+}
+
+func TestHostClient_DoWithTarget(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"key":"KEY-1"}`))
+		case "/deleted":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorMessages":["not found"]}`))
+		}
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	status, err := hc.DoWithTarget(http.MethodPost, "/created", nil, nil, &created, []int{http.StatusOK, http.StatusCreated})
+	if err != nil || status != http.StatusCreated || created.Key != "KEY-1" {
+		t.Fatalf("expected status returned %d, %v and decoded %+v", status, err, created)
+	}
+	if status, err := hc.DoWithTarget(http.MethodPost, "/created", nil, nil, nil, []int{http.StatusCreated}); err != nil {
+		t.Fatalf("expected status without target returned %d, %v", status, err)
+	}
+	if status, err := hc.DoWithTarget(http.MethodDelete, "/deleted", nil, nil, &created, []int{http.StatusNoContent}); err != nil {
+		t.Fatalf("expected empty status returned %d, %v", status, err)
+	}
+	status, err = hc.DoWithTarget(http.MethodGet, "/missing", nil, nil, &created, []int{http.StatusOK})
+	if status != http.StatusNotFound || !IsUnexpectedResponse(err) {
+		t.Fatalf("unexpected status returned %d, %v", status, err)
+	}
+}
+
+func TestTypeFromResponse_raw(t *testing.T) {
+	response := func(body string) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+	var s string
+	if err := TypeFromResponse(response(`"a string"`), &s); err != nil || s != "a string" {
+		t.Fatalf("decoded a JSON string into %q, %v", s, err)
+	}
+	var raw strings.Builder
+	if err := RawFromResponse(response("key,summary\nPRJ-1,it broke\n"), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.String() != "key,summary\nPRJ-1,it broke\n" {
+		t.Fatalf("copied %q", raw.String())
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); accept != "text/csv" {
+			t.Errorf("requested %s", accept)
+		}
+		w.Write([]byte("key\nPRJ-1\n"))
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var csv strings.Builder
+	if _, err := hc.DoStream(http.MethodGet, "/rest/api/3/export", nil, nil, "text/csv", &csv, []int{http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	if csv.String() != "key\nPRJ-1\n" {
+		t.Fatalf("streamed %q", csv.String())
+	}
+}
+
+func TestHostClient_contextPath(t *testing.T) {
+	var paths []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL + "/wiki/"
+	tenant.ProductType = ProductTypeConfluence
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/rest/api/content", "/wiki/rest/api/space"} {
+		if _, err := hc.DoWithTarget(http.MethodGet, path, nil, nil, nil, []int{http.StatusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(paths) != 2 || paths[0] != "/wiki/rest/api/content" || paths[1] != "/wiki/rest/api/space" {
+		t.Fatalf("requested %q", paths)
+	}
+}
@@ -0,0 +1,120 @@
+package apicommunication
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+const userMigrationPath = "/rest/api/3/user/bulk/migration"
+
+// userMigrationBatch is the number of user keys or usernames resolved per request, jira caps the
+// page size of the bulk migration API.
+const userMigrationBatch = 50
+
+// MigrateUsers returns the accountId of the users with the passed legacy user keys and usernames,
+// from the bulk migration API of jira. Users jira does not know are missing from the result.
+func (h *HostClient) MigrateUsers(keys, usernames []string) ([]UserMigrationBean, error) {
+	return h.MigrateUsersCtx(context.Background(), keys, usernames)
+}
+
+// MigrateUsersCtx behaves like MigrateUsers bound to ctx, see DoCtx.
+func (h *HostClient) MigrateUsersCtx(ctx context.Context, keys, usernames []string) ([]UserMigrationBean, error) {
+	var users []UserMigrationBean
+	for _, ids := range []struct {
+		param string
+		ids   []string
+	}{{"key", keys}, {"username", usernames}} {
+		for start := 0; start < len(ids.ids); start += userMigrationBatch {
+			end := start + userMigrationBatch
+			if end > len(ids.ids) {
+				end = len(ids.ids)
+			}
+			// the ids are repeated query arguments, which Do can only take as part of the path.
+			query := url.Values{ids.param: ids.ids[start:end]}
+			var page []UserMigrationBean
+			_, err := h.DoWithTargetCtx(ctx, http.MethodGet, h.api("MigrateUsers", userMigrationPath)+"?"+query.Encode(),
+				map[string]string{"maxResults": fmt.Sprint(end - start)}, nil, &page, []int{http.StatusOK})
+			if err != nil {
+				return nil, fmt.Errorf("migrating user %ss: %w", ids.param, err)
+			}
+			users = append(users, page...)
+		}
+	}
+	return users, nil
+}
+
+// ResolveAccountIDs returns the accountId of each of the passed legacy user keys and usernames,
+// read from store and, for the ones it does not know yet, asked to jira with MigrateUsers and saved
+// in store. Both the key and the username of users jira returns are saved, since they share the
+// namespace of store. Users jira does not know are missing from the result.
+func ResolveAccountIDs(h *HostClient, store storage.UserMappingStore, keys, usernames []string) (map[string]string, error) {
+	return ResolveAccountIDsCtx(context.Background(), h, store, keys, usernames)
+}
+
+// ResolveAccountIDsCtx behaves like ResolveAccountIDs asking jira bound to ctx, see DoCtx.
+func ResolveAccountIDsCtx(ctx context.Context, h *HostClient, store storage.UserMappingStore,
+	keys, usernames []string) (map[string]string, error) {
+	clientKey := h.Config.ClientKey
+	known, err := store.AccountIDs(clientKey, append(append([]string{}, keys...), usernames...))
+	if err != nil {
+		return nil, fmt.Errorf("reading known account ids: %w", err)
+	}
+	unknown := func(ids []string) []string {
+		var missing []string
+		for _, id := range ids {
+			if _, ok := known[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		return missing
+	}
+	missingKeys, missingUsernames := unknown(keys), unknown(usernames)
+	if len(missingKeys) == 0 && len(missingUsernames) == 0 {
+		return known, nil
+	}
+	users, err := h.MigrateUsersCtx(ctx, missingKeys, missingUsernames)
+	if err != nil {
+		return nil, err
+	}
+	migrated := map[string]string{}
+	for _, u := range users {
+		if u.AccountID == "" {
+			continue
+		}
+		if u.Key != "" {
+			migrated[u.Key] = u.AccountID
+		}
+		if u.Username != "" {
+			migrated[u.Username] = u.AccountID
+		}
+	}
+	if len(migrated) > 0 {
+		if err := store.SaveAccountIDs(clientKey, migrated); err != nil {
+			return nil, fmt.Errorf("saving migrated account ids: %w", err)
+		}
+	}
+	for _, id := range append(missingKeys, missingUsernames...) {
+		if accountID, ok := migrated[id]; ok {
+			known[id] = accountID
+		}
+	}
+	return known, nil
+}
@@ -0,0 +1,67 @@
+package apicommunication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestResolveAccountIDs(t *testing.T) {
+	var queries []url.Values
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != userMigrationPath {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		queries = append(queries, q)
+		var users []UserMigrationBean
+		for _, key := range q["key"] {
+			if key != "ghost" {
+				users = append(users, UserMigrationBean{AccountID: "id-" + key, Key: key, Username: key + "-name"})
+			}
+		}
+		for _, username := range q["username"] {
+			users = append(users, UserMigrationBean{AccountID: "id-" + username, Username: username})
+		}
+		json.NewEncoder(w).Encode(users)
+	}))
+	defer srv.Close()
+	tenant := *benchTenant
+	tenant.BaseURL = srv.URL
+	hc, err := NewHostClientWithRoundtripper(context.Background(), &tenant, "", nil, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStore(0)
+	if err := store.SaveAccountIDs(tenant.ClientKey, map[string]string{"known": "id-known"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ResolveAccountIDs(hc, store, []string{"known", "alice", "ghost"}, []string{"bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"known": "id-known", "alice": "id-alice", "bob": "id-bob"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved %v, want %v", got, want)
+	}
+	if len(queries) != 2 || !reflect.DeepEqual(queries[0]["key"], []string{"alice", "ghost"}) ||
+		queries[0].Get("maxResults") != "2" || !reflect.DeepEqual(queries[1]["username"], []string{"bob"}) {
+		t.Fatalf("queried %v", queries)
+	}
+
+	// the username of alice was saved along with her key, so nothing is asked to jira.
+	got, err = ResolveAccountIDs(hc, store, []string{"alice"}, []string{"alice-name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || got["alice-name"] != "id-alice" {
+		t.Fatalf("resolved %v after %d queries", got, len(queries))
+	}
+}
@@ -40,6 +40,12 @@ type Authentication struct {
 // ConditionParams is auto generated by github.com/perrito666/LAC from a json file
 type ConditionParams struct {
 	Expression string `json:"expression,omitempty"`
+	// Entity, PropertyKey, ObjectName and Value are the params of entity property conditions, see
+	// EntityPropertyEqualTo and EntityPropertyContainsAny.
+	Entity      string `json:"entity,omitempty"`
+	PropertyKey string `json:"propertyKey,omitempty"`
+	ObjectName  string `json:"objectName,omitempty"`
+	Value       string `json:"value,omitempty"`
 }
 
 // Conditions is auto generated by github.com/perrito666/LAC from a json file
@@ -0,0 +1,100 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/gorilla/mux"
+)
+
+// BackfillHeader is set on the requests passed to webhook handlers by Backfill so they can tell
+// replayed events from the ones sent by jira.
+const BackfillHeader = "X-Atlassian-Connect-Go-Backfill"
+
+// backfillPayload mimics the body of jira issue webhooks.
+type backfillPayload struct {
+	Timestamp    int64                       `json:"timestamp"`
+	WebhookEvent string                      `json:"webhookEvent"`
+	Issue        *apicommunication.IssueBean `json:"issue"`
+}
+
+// Backfill fetches the issues of the passed tenant updated between since and until and feeds each
+// of them to the handler registered for event with AddWebhook, through the webhook middleware, as if
+// jira had sent the webhook.
+// It is meant to recover from downtime in which webhooks were missed, handlers should be idempotent.
+// Bear in mind that JQL dates have minute precision and are interpreted in the timezone of the app
+// user, so it is advisable to pass a generous window.
+// It returns the number of issues replayed and stops at the first handler failure.
+func (p *Plugin) Backfill(ctx context.Context, jii *storage.JiraInstallInformation, event string,
+	since, until time.Time) (int, error) {
+	handler, ok := p.webhookHandler(event)
+	if !ok {
+		return 0, fmt.Errorf("no webhook registered for event %s", event)
+	}
+	route := p.webhookRoutes[event]
+	client, err := apicommunication.NewHostClient(ctx, jii, "", p.ac.Scopes)
+	if err != nil {
+		return 0, fmt.Errorf("creating host client for backfill: %w", err)
+	}
+	jql := fmt.Sprintf(`updated >= "%s" AND updated <= "%s" ORDER BY updated ASC`,
+		apicommunication.JQLTime(since), apicommunication.JQLTime(until))
+
+	var replayed int
+	err = client.ForEachIssueCtx(ctx, jql, nil, func(issue *apicommunication.IssueBean) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		body, err := json.Marshal(backfillPayload{
+			Timestamp:    time.Now().UnixNano() / int64(time.Millisecond),
+			WebhookEvent: event,
+			Issue:        issue,
+		})
+		if err != nil {
+			return fmt.Errorf("marshaling payload for issue %s: %w", issue.Key, err)
+		}
+		routePath, vars, err := route.expand(map[string]string{"issue.id": issue.ID, "issue.key": issue.Key})
+		if err != nil {
+			return fmt.Errorf("building request for issue %s: %w", issue.Key, err)
+		}
+		req, err := http.NewRequestWithContext(ContextWithTenant(ctx, jii, nil), http.MethodPost,
+			path.Join(p.baseRoute, routePath), bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("building request for issue %s: %w", issue.Key, err)
+		}
+		req = mux.SetURLVars(req, vars)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(BackfillHeader, "true")
+		rec := newResponseRecorder()
+		handler(jii, p.store, rec, req)
+		if rec.code >= http.StatusBadRequest {
+			return fmt.Errorf("handler for %s failed for issue %s with status %d", event, issue.Key, rec.code)
+		}
+		replayed++
+		return nil
+	})
+	if err != nil {
+		return replayed, fmt.Errorf("backfilling %s for %s: %w", event, jii.ClientKey, err)
+	}
+	return replayed, nil
+}
@@ -0,0 +1,83 @@
+package handling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/gorilla/mux"
+)
+
+// fakeSearch serves the issue search of a jira site holding keys, two per page.
+func fakeSearch(t *testing.T, keys ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/3/search" {
+			http.NotFound(w, r)
+			return
+		}
+		var search struct {
+			Jql     string `json:"jql"`
+			StartAt int    `json:"startAt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+			t.Errorf("decoding search: %v", err)
+		}
+		if !strings.HasPrefix(search.Jql, "updated >= ") {
+			t.Errorf("searched %q", search.Jql)
+		}
+		var issues []string
+		for i := search.StartAt; i < len(keys) && i < search.StartAt+2; i++ {
+			issues = append(issues, fmt.Sprintf(`{"id":"%d","key":%q}`, 10000+i, keys[i]))
+		}
+		fmt.Fprintf(w, `{"startAt":%d,"total":%d,"issues":[%s]}`, search.StartAt, len(keys), strings.Join(issues, ","))
+	}))
+}
+
+func TestPlugin_Backfill(t *testing.T) {
+	srv := fakeSearch(t, "KEY-1", "KEY-2", "KEY-3")
+	defer srv.Close()
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret", BaseURL: srv.URL}
+
+	p := newPlugin(t, fakeHandleFunc)
+	var replayed []string
+	status := http.StatusOK
+	err := p.AddWebhook(JiraIssueCreated, NewRoutePath("/issue/{issueKey}/created", nil).WithVars(map[string]string{"issueKey": "issue.key"}),
+		func(got *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, r *http.Request) {
+			var payload backfillPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("decoding payload: %v", err)
+			}
+			if got != jii || r.Header.Get(BackfillHeader) != "true" || payload.WebhookEvent != JiraIssueCreated {
+				t.Errorf("replayed %s with %+v, %v", payload.WebhookEvent, got, r.Header)
+			}
+			if key := mux.Vars(r)["issueKey"]; key != payload.Issue.Key {
+				t.Errorf("route variable is %q for issue %s", key, payload.Issue.Key)
+			}
+			replayed = append(replayed, payload.Issue.Key)
+			w.WriteHeader(status)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := p.Backfill(context.Background(), jii, JiraIssueCreated, time.Now().Add(-time.Hour), time.Now())
+	if err != nil || n != 3 || strings.Join(replayed, ",") != "KEY-1,KEY-2,KEY-3" {
+		t.Fatalf("replayed %d issues %v, %v", n, replayed, err)
+	}
+
+	replayed, status = nil, http.StatusInternalServerError
+	n, err = p.Backfill(context.Background(), jii, JiraIssueCreated, time.Now().Add(-time.Hour), time.Now())
+	if err == nil || n != 0 || len(replayed) != 1 {
+		t.Fatalf("failing handler replayed %d issues after %d calls, %v", n, len(replayed), err)
+	}
+
+	if _, err := p.Backfill(context.Background(), jii, JiraIssueDeleted, time.Now().Add(-time.Hour), time.Now()); err == nil {
+		t.Fatal("backfilling an event without webhook succeeded")
+	}
+}
@@ -0,0 +1,17 @@
+package handling
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func BenchmarkRenderAtlassianConnectJSON(b *testing.B) {
+	p := newPlugin(b, fakeHandleFunc)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.renderAtlassianConnectJSONFor(ioutil.Discard, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
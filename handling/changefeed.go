@@ -0,0 +1,245 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+const (
+	// changeFeedDedupWindow is how long a ChangeFeed remembers the changes it emitted.
+	changeFeedDedupWindow = 7 * 24 * time.Hour
+	// changeFeedOrderWindow is how long a ChangeFeed remembers the last change of each issue to
+	// drop older ones, jira delivers webhooks out of order within seconds, not hours.
+	changeFeedOrderWindow = time.Hour
+)
+
+// IssueChange is a change of an issue emitted by a ChangeFeed.
+type IssueChange struct {
+	ClientKey string
+	// Event is JiraIssueCreated, JiraIssueUpdated or JiraIssueDeleted, backfilled changes are
+	// always JiraIssueUpdated.
+	Event string
+	Issue *apicommunication.IssueBean
+	// Updated is the time of the change, taken from the updated field of the issue.
+	Updated    time.Time
+	Backfilled bool
+}
+
+// ChangeFeed emits the changes of the issues of every tenant to a channel, whether they arrive as
+// webhooks or are backfilled with JQL. Changes are deduplicated and emitted in order for each
+// issue: a change older than the last one emitted for its issue is dropped, as jira does not
+// deliver webhooks in order. Changes are not reordered past changeFeedOrderWindow.
+type ChangeFeed struct {
+	p       *Plugin
+	dedup   apicommunication.ReplayCache
+	changes chan IssueChange
+
+	mu   sync.Mutex
+	last map[string]time.Time
+	// emitting holds a channel closed once the change of the issue being emitted is done, so the
+	// order checks and sends of an issue don't interleave.
+	emitting  map[string]chan struct{}
+	lastPurge time.Time
+}
+
+// changeFeedPayload is the body of jira issue webhooks.
+type changeFeedPayload struct {
+	Timestamp    int64                       `json:"timestamp"`
+	WebhookEvent string                      `json:"webhookEvent"`
+	Issue        *apicommunication.IssueBean `json:"issue"`
+}
+
+// NewChangeFeed registers the issue created, updated and deleted webhooks at route followed by
+// "/created", "/updated" and "/deleted" and returns a ChangeFeed of the issues they carry, emitted
+// to a channel with room for buffer changes. Events already registered with AddWebhook keep their
+// route and handler, the feed is added with AddWebhookHandler. dedup remembers emitted changes, use
+// a shared one such as a redis backed ReplayCache when running more than one replica, or
+// apicommunication.NewMemoryReplayCache otherwise. Changes that could not be emitted are only
+// forgotten, and so emitted when jira redelivers their webhook, if dedup implements
+// apicommunication.ReplayForgetter.
+// Webhooks are answered once their change fits in the channel, or with http.StatusServiceUnavailable
+// if jira gives up on the request first, so consumers should keep up.
+func (p *Plugin) NewChangeFeed(route string, dedup apicommunication.ReplayCache, buffer int) (*ChangeFeed, error) {
+	f := &ChangeFeed{
+		p:        p,
+		dedup:    dedup,
+		changes:  make(chan IssueChange, buffer),
+		last:     map[string]time.Time{},
+		emitting: map[string]chan struct{}{},
+	}
+	routes := map[string]string{
+		JiraIssueCreated: route + "/created",
+		JiraIssueUpdated: route + "/updated",
+		JiraIssueDeleted: route + "/deleted",
+	}
+	for _, event := range []string{JiraIssueCreated, JiraIssueUpdated, JiraIssueDeleted} {
+		var err error
+		if _, exists := p.webhooks[event]; exists {
+			err = p.AddWebhookHandler(event, f.handle)
+		} else {
+			err = p.AddWebhook(event, NewRoutePath(routes[event], nil), f.handle)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("registering change feed for %s: %w", event, err)
+		}
+	}
+	return f, nil
+}
+
+// Changes returns the channel the changes are emitted to.
+func (f *ChangeFeed) Changes() <-chan IssueChange {
+	return f.changes
+}
+
+// Backfill emits the changes of the issues of the tenant updated between since and until, see
+// Plugin.Backfill, changes already emitted are skipped.
+func (f *ChangeFeed) Backfill(ctx context.Context, jii *storage.JiraInstallInformation, since, until time.Time) (int, error) {
+	return f.p.Backfill(ctx, jii, JiraIssueUpdated, since, until)
+}
+
+func (f *ChangeFeed) handle(jii *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, r *http.Request) {
+	payload := &changeFeedPayload{}
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil || payload.Issue == nil {
+		f.p.logger.Printf("ERROR: decoding issue webhook of %s for the change feed: %v", jii.ClientKey, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	change := IssueChange{
+		ClientKey:  jii.ClientKey,
+		Event:      payload.WebhookEvent,
+		Issue:      payload.Issue,
+		Updated:    issueUpdated(payload),
+		Backfilled: r.Header.Get(BackfillHeader) != "",
+	}
+	if err := f.emit(r.Context(), change); err != nil {
+		f.p.logger.Printf("ERROR: emitting change of issue %s of %s: %v", payload.Issue.Key, jii.ClientKey, err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// issueUpdated returns the updated field of the issue or, lacking it, the time of the webhook.
+func issueUpdated(payload *changeFeedPayload) time.Time {
+	if raw, ok := payload.Issue.Fields["updated"].(string); ok {
+		var updated apicommunication.Time
+		if err := updated.UnmarshalJSON([]byte(`"` + raw + `"`)); err == nil {
+			return updated.Time
+		}
+	}
+	return time.Unix(0, payload.Timestamp*int64(time.Millisecond))
+}
+
+// emit sends change unless it was already emitted or a newer change of the issue was. Changes of
+// an issue are emitted one at a time, changes of different issues don't wait for each other.
+func (f *ChangeFeed) emit(ctx context.Context, change IssueChange) error {
+	issue := change.ClientKey + ":" + change.Issue.ID
+	id := "changefeed:" + issue + ":" + change.Updated.UTC().Format(time.RFC3339Nano)
+	if change.Event == JiraIssueDeleted {
+		id = "changefeed:" + issue + ":deleted"
+	}
+	release, err := f.acquire(ctx, issue)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	f.mu.Lock()
+	f.purge()
+	last, ok := f.last[issue]
+	f.mu.Unlock()
+	if ok && change.Event != JiraIssueDeleted && change.Updated.Before(last) {
+		apicommunication.Debugf(f.p.logger, "dropping change of issue %s older than the last one emitted", issue)
+		return nil
+	}
+	seen, err := f.dedup.Seen(id, time.Now().Add(changeFeedDedupWindow))
+	if err != nil {
+		return fmt.Errorf("deduplicating change: %w", err)
+	}
+	if seen {
+		return nil
+	}
+	select {
+	case f.changes <- change:
+	case <-ctx.Done():
+		// the change was not emitted, forget it so the redelivery of the webhook is not dropped.
+		if forgetter, ok := f.dedup.(apicommunication.ReplayForgetter); ok {
+			if err := forgetter.Forget(id); err != nil {
+				f.p.logger.Printf("ERROR: forgetting change %s that was not emitted: %v", id, err)
+			}
+		}
+		return ctx.Err()
+	}
+	f.mu.Lock()
+	if change.Event == JiraIssueDeleted {
+		delete(f.last, issue)
+	} else {
+		f.last[issue] = change.Updated
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+// acquire waits until no other change of issue is being emitted and returns the function
+// releasing it.
+func (f *ChangeFeed) acquire(ctx context.Context, issue string) (func(), error) {
+	f.mu.Lock()
+	for {
+		busy, ok := f.emitting[issue]
+		if !ok {
+			break
+		}
+		f.mu.Unlock()
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		f.mu.Lock()
+	}
+	done := make(chan struct{})
+	f.emitting[issue] = done
+	f.mu.Unlock()
+	return func() {
+		f.mu.Lock()
+		delete(f.emitting, issue)
+		f.mu.Unlock()
+		close(done)
+	}, nil
+}
+
+// purge forgets the last change of issues not changed within changeFeedOrderWindow, it must be
+// called with mu held.
+func (f *ChangeFeed) purge() {
+	now := time.Now()
+	if now.Sub(f.lastPurge) < changeFeedOrderWindow {
+		return
+	}
+	for issue, last := range f.last {
+		if now.Sub(last) > changeFeedOrderWindow {
+			delete(f.last, issue)
+		}
+	}
+	f.lastPurge = now
+}
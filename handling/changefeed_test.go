@@ -0,0 +1,95 @@
+package handling
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_NewChangeFeed(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	feed, err := p.NewChangeFeed("/changes", apicommunication.NewMemoryReplayCache(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route := p.webhookRoutes[JiraIssueCreated]; route.path != "/changes/created" {
+		t.Fatalf("created webhook registered at %q", route.path)
+	}
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey"}
+	send := func(event, updated string) {
+		handler, _ := p.webhookHandler(event)
+		body := `{"timestamp": 1591012800000, "webhookEvent": "` + event +
+			`", "issue": {"id": "10001", "key": "PRJ-1", "fields": {"updated": "` + updated + `"}}}`
+		w := httptest.NewRecorder()
+		handler(jii, p.store, w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code >= http.StatusBadRequest {
+			t.Fatalf("%s webhook answered %d", event, w.Code)
+		}
+	}
+	send(JiraIssueCreated, "2020-06-01T12:00:00.000+0000")
+	send(JiraIssueUpdated, "2020-06-01T12:05:00.000+0000")
+	send(JiraIssueUpdated, "2020-06-01T12:05:00.000+0000")
+	send(JiraIssueUpdated, "2020-06-01T12:03:00.000+0000")
+	send(JiraIssueDeleted, "2020-06-01T12:05:00.000+0000")
+
+	var events []string
+	for len(feed.Changes()) > 0 {
+		c := <-feed.Changes()
+		if c.ClientKey != "ckey" || c.Issue.Key != "PRJ-1" || c.Backfilled {
+			t.Fatalf("unexpected change %+v", c)
+		}
+		events = append(events, c.Event+"@"+c.Updated.Format("15:04"))
+	}
+	want := []string{JiraIssueCreated + "@12:00", JiraIssueUpdated + "@12:05", JiraIssueDeleted + "@12:05"}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("emitted %v, want %v", events, want)
+	}
+}
+
+func TestChangeFeed_emitCancelled(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	feed, err := p.NewChangeFeed("/changes", apicommunication.NewMemoryReplayCache(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := func(id string) IssueChange {
+		return IssueChange{
+			ClientKey: "ckey",
+			Event:     JiraIssueUpdated,
+			Issue:     &apicommunication.IssueBean{ID: id},
+			Updated:   time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+		}
+	}
+	if err := feed.emit(context.Background(), change("10001")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	blocked := make(chan error)
+	go func() { blocked <- feed.emit(ctx, change("10002")) }()
+	// duplicates are dropped while another issue waits for room in the channel.
+	if err := feed.emit(context.Background(), change("10001")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := <-blocked; err != context.Canceled {
+		t.Fatalf("cancelled emit returned %v", err)
+	}
+	if c := <-feed.Changes(); c.Issue.ID != "10001" {
+		t.Fatalf("emitted %+v", c)
+	}
+
+	// the redelivery of the change that was not emitted is not deduplicated away.
+	if err := feed.emit(context.Background(), change("10002")); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-feed.Changes(); c.Issue.ID != "10002" {
+		t.Fatalf("emitted %+v", c)
+	}
+}
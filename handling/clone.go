@@ -0,0 +1,121 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Clone returns a copy of the plugin that can be configured independently, handlers, store, logger
+// and other collaborators are shared. The message catalog is copied, messages added to the catalog
+// passed to SetMessageCatalog after cloning are only seen by the original.
+func (p *Plugin) Clone() *Plugin {
+	c := *p
+	ac := *p.ac
+	ac.Scopes = append([]string(nil), p.ac.Scopes...)
+	ac.Modules = make(map[string]interface{}, len(p.ac.Modules))
+	// module slices are rebuilt on every update so they can be shared.
+	for k, v := range p.ac.Modules {
+		ac.Modules[k] = v
+	}
+	c.ac = &ac
+
+	c.handleStatuses = make(map[int]http.HandlerFunc, len(p.handleStatuses))
+	for k, v := range p.handleStatuses {
+		c.handleStatuses[k] = v
+	}
+	c.jiraIssueFields = make(map[string]JiraIssueFields, len(p.jiraIssueFields))
+	for k, v := range p.jiraIssueFields {
+		c.jiraIssueFields[k] = v
+	}
+	c.lifecycle = make(map[LifeCycleEvents]JiraHandleFunc, len(p.lifecycle))
+	for k, v := range p.lifecycle {
+		c.lifecycle[k] = v
+	}
+	c.lifecycleRoutes = make(map[LifeCycleEvents]string, len(p.lifecycleRoutes))
+	for k, v := range p.lifecycleRoutes {
+		c.lifecycleRoutes[k] = v
+	}
+	c.webhooks = make(map[string]JiraHandleFunc, len(p.webhooks))
+	for k, v := range p.webhooks {
+		c.webhooks[k] = v
+	}
+	c.webhookRoutes = make(map[string]RoutePath, len(p.webhookRoutes))
+	for k, v := range p.webhookRoutes {
+		c.webhookRoutes[k] = v
+	}
+	c.arbitraryWebPanels = make(map[string][]WebPanel, len(p.arbitraryWebPanels))
+	for k, v := range p.arbitraryWebPanels {
+		c.arbitraryWebPanels[k] = v
+	}
+	c.extraWebhookEvents = make(map[string]bool, len(p.extraWebhookEvents))
+	for k, v := range p.extraWebhookEvents {
+		c.extraWebhookEvents[k] = v
+	}
+	c.webhookHandlers = make(map[string][]JiraHandleFunc, len(p.webhookHandlers))
+	for k, v := range p.webhookHandlers {
+		c.webhookHandlers[k] = append([]JiraHandleFunc(nil), v...)
+	}
+	c.webhookMiddleware = append([]WebhookMiddleware(nil), p.webhookMiddleware...)
+	c.apiUsage = append([]APIUsage(nil), p.apiUsage...)
+	c.installAllowedHosts = append([]string(nil), p.installAllowedHosts...)
+	c.unauthenticatedRoutes = append([]unauthenticatedRoute(nil), p.unauthenticatedRoutes...)
+	c.sessionKey = append([]byte(nil), p.sessionKey...)
+	if p.moduleToggles != nil {
+		toggles := *p.moduleToggles
+		c.moduleToggles = &toggles
+	}
+	if p.messages != nil {
+		c.messages = p.messages.clone()
+	}
+	return &c
+}
+
+// DescriptorVariant parameterizes the descriptor of a white labeled variant of a plugin.
+type DescriptorVariant struct {
+	// KeySuffix is appended to the plugin key, ie "-acme", atlassian requires keys to be unique.
+	KeySuffix string
+	// NamePrefix is prepended to the plugin name, ie "ACME ".
+	NamePrefix string
+	// BaseURL replaces the plugin base URL if not empty.
+	BaseURL string
+	// Description replaces the plugin description if not empty.
+	Description string
+	// Vendor replaces the plugin vendor if its name is not empty.
+	Vendor Vendor
+}
+
+// Variant returns a clone of the plugin (see Clone) whose descriptor is altered as v describes,
+// so white labeled variants of an app can be generated from a single definition.
+func (p *Plugin) Variant(v DescriptorVariant) (*Plugin, error) {
+	if v.KeySuffix == "" && v.BaseURL == "" {
+		return nil, fmt.Errorf("a variant needs a key suffix or a base URL to be told apart from the original")
+	}
+	c := p.Clone()
+	c.ac.Key += v.KeySuffix
+	c.ac.Name = v.NamePrefix + c.ac.Name
+	if v.BaseURL != "" {
+		c.ac.BaseURL = strings.TrimRight(v.BaseURL, "/")
+	}
+	if v.Description != "" {
+		c.ac.Description = v.Description
+	}
+	if v.Vendor.Name != "" {
+		c.ac.Vendor = v.Vendor
+	}
+	return c, nil
+}
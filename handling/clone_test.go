@@ -0,0 +1,48 @@
+package handling
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_Clone(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	if err := p.EnableModuleToggles("/toggles", nil); err != nil {
+		t.Fatal(err)
+	}
+	catalog := NewMessageCatalog()
+	p.SetMessageCatalog(catalog)
+
+	c := p.Clone()
+	c.moduleToggles.route = "/clone/toggles"
+	c.messages.AddStatus(DefaultLocale, http.StatusNotFound, "Gone fishing.")
+	if err := c.AddWebPanel("", WebPanel{Key: "clone-panel", URL: "/clone"}); err != nil {
+		t.Fatal(err)
+	}
+	c.ac.Scopes = append(c.ac.Scopes, "ADMIN")
+
+	if p.moduleToggles.route != "/toggles" {
+		t.Fatalf("changing the toggles of the clone moved those of the original to %s", p.moduleToggles.route)
+	}
+	if got := catalog.Message(DefaultLocale, http.StatusNotFound); got == "Gone fishing." {
+		t.Fatal("messages added to the clone are shown by the original")
+	}
+	for _, wp := range p.ac.Modules["webPanels"].([]WebPanel) {
+		if wp.Key == "clone-panel" {
+			t.Fatal("panels added to the clone are in the descriptor of the original")
+		}
+	}
+	for _, scope := range p.ac.Scopes {
+		if scope == "ADMIN" {
+			t.Fatal("scopes added to the clone are requested by the original")
+		}
+	}
+
+	catalog.AddStatus(DefaultLocale, http.StatusForbidden, "Nope.")
+	if got := c.messages.Message(DefaultLocale, http.StatusForbidden); got == "Nope." {
+		t.Fatal("messages added to the original after cloning are shown by the clone")
+	}
+}
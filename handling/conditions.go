@@ -0,0 +1,77 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Conditions on entity properties, see
+// https://developer.atlassian.com/cloud/jira/platform/conditions/#entity-property-conditions
+const (
+	ConditionEntityPropertyEqualTo     = "entity_property_equal_to"
+	ConditionEntityPropertyContainsAny = "entity_property_contains_any"
+)
+
+// Entities whose properties can be used in entity property conditions.
+const (
+	EntityAddon     = "addon"
+	EntityIssue     = "issue"
+	EntityIssueType = "issuetype"
+	EntityProject   = "project"
+	EntityComment   = "comment"
+	EntityUser      = "user"
+)
+
+// EntityPropertyEqualTo returns a condition that holds when the value at objectName (a dot
+// separated path inside the property, empty for the whole property) of the property propertyKey
+// of the entity equals value, which is JSON encoded as atlassian requires.
+func EntityPropertyEqualTo(entity, propertyKey, objectName string, value interface{}) (Conditions, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return Conditions{}, fmt.Errorf("encoding value of %s condition: %w", ConditionEntityPropertyEqualTo, err)
+	}
+	return Conditions{
+		Condition: ConditionEntityPropertyEqualTo,
+		Params: ConditionParams{
+			Entity:      entity,
+			PropertyKey: propertyKey,
+			ObjectName:  objectName,
+			Value:       string(encoded),
+		},
+	}, nil
+}
+
+// EntityPropertyContainsAny returns a condition that holds when the array at objectName of the
+// property propertyKey of the entity contains any of values, see EntityPropertyEqualTo.
+func EntityPropertyContainsAny(entity, propertyKey, objectName string, values ...interface{}) (Conditions, error) {
+	if len(values) == 0 {
+		return Conditions{}, fmt.Errorf("%s needs at least a value", ConditionEntityPropertyContainsAny)
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return Conditions{}, fmt.Errorf("encoding values of %s condition: %w", ConditionEntityPropertyContainsAny, err)
+	}
+	return Conditions{
+		Condition: ConditionEntityPropertyContainsAny,
+		Params: ConditionParams{
+			Entity:      entity,
+			PropertyKey: propertyKey,
+			ObjectName:  objectName,
+			Value:       string(encoded),
+		},
+	}, nil
+}
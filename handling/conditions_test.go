@@ -0,0 +1,34 @@
+package handling
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEntityPropertyConditions(t *testing.T) {
+	equal, err := EntityPropertyEqualTo(EntityProject, "settings", "features.export", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contains, err := EntityPropertyContainsAny(EntityIssue, "labels", "", "security", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(Conditions{Or: []Conditions{equal, contains}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"params":{},"or":[` +
+		`{"condition":"entity_property_equal_to","params":{"entity":"project","propertyKey":"settings","objectName":"features.export","value":"true"}},` +
+		`{"condition":"entity_property_contains_any","params":{"entity":"issue","propertyKey":"labels","value":"[\"security\",42]"}}]}`
+	if string(b) != want {
+		t.Fatalf("marshaled to\n%s\nwant\n%s", b, want)
+	}
+
+	if _, err := EntityPropertyContainsAny(EntityIssue, "labels", ""); err == nil {
+		t.Fatal("built a contains any condition without values")
+	}
+	if _, err := EntityPropertyEqualTo(EntityIssue, "labels", "", make(chan int)); err == nil {
+		t.Fatal("built a condition with a value that can not be encoded")
+	}
+}
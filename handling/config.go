@@ -0,0 +1,101 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// configEnvPrefix prefixes the environment variables read by ConfigFromEnv.
+const configEnvPrefix = "ATLASSIAN_CONNECT_"
+
+// Config holds what is needed to construct a Plugin and its store, see ConfigFromEnv.
+type Config struct {
+	Name        string
+	Description string
+	Key         string
+	BaseURL     string
+	BaseRoute   string
+	Scopes      []string
+	Vendor      Vendor
+	// SignedInstall opts in to signed install lifecycle callbacks, see APIMigration.
+	SignedInstall bool
+	// StoreDSN is where install information is kept, see the storage/open package.
+	StoreDSN string
+}
+
+// ConfigFromEnv reads a Config from the environment, so apps can be deployed the 12-factor way:
+//
+//	ATLASSIAN_CONNECT_NAME            required
+//	ATLASSIAN_CONNECT_KEY             required
+//	ATLASSIAN_CONNECT_BASE_URL        required
+//	ATLASSIAN_CONNECT_STORE_DSN       required, see the storage/open package
+//	ATLASSIAN_CONNECT_DESCRIPTION
+//	ATLASSIAN_CONNECT_BASE_ROUTE
+//	ATLASSIAN_CONNECT_SCOPES          comma separated, ie "READ,WRITE"
+//	ATLASSIAN_CONNECT_VENDOR_NAME
+//	ATLASSIAN_CONNECT_VENDOR_URL
+//	ATLASSIAN_CONNECT_SIGNED_INSTALL  true unless set to a false value, such as "false" or "0"
+func ConfigFromEnv() (*Config, error) {
+	env := func(name string) string {
+		return strings.TrimSpace(os.Getenv(configEnvPrefix + name))
+	}
+	c := &Config{
+		Name:          env("NAME"),
+		Description:   env("DESCRIPTION"),
+		Key:           env("KEY"),
+		BaseURL:       env("BASE_URL"),
+		BaseRoute:     env("BASE_ROUTE"),
+		Vendor:        Vendor{Name: env("VENDOR_NAME"), URL: env("VENDOR_URL")},
+		SignedInstall: true,
+		StoreDSN:      env("STORE_DSN"),
+	}
+	var missing []string
+	required := map[string]string{"NAME": c.Name, "KEY": c.Key, "BASE_URL": c.BaseURL, "STORE_DSN": c.StoreDSN}
+	for name, v := range required {
+		if v == "" {
+			missing = append(missing, configEnvPrefix+name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing environment variables %s", strings.Join(missing, ", "))
+	}
+	for _, scope := range strings.Split(env("SCOPES"), ",") {
+		if scope = strings.ToUpper(strings.TrimSpace(scope)); scope != "" {
+			c.Scopes = append(c.Scopes, scope)
+		}
+	}
+	if signed := env("SIGNED_INSTALL"); signed != "" {
+		var err error
+		if c.SignedInstall, err = strconv.ParseBool(signed); err != nil {
+			return nil, fmt.Errorf("parsing %sSIGNED_INSTALL: %w", configEnvPrefix, err)
+		}
+	}
+	return c, nil
+}
+
+// NewPlugin returns a Plugin configured by c keeping install information in store, which can be
+// opened from StoreDSN with the storage/open package.
+func (c *Config) NewPlugin(store storage.Store, logger Logger) *Plugin {
+	return NewPlugin(c.Name, c.Description, c.Key, c.BaseURL, c.BaseRoute, store, logger,
+		c.Scopes, c.Vendor, c.SignedInstall)
+}
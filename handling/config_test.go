@@ -0,0 +1,43 @@
+package handling
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("ATLASSIAN_CONNECT_NAME", "Test")
+	t.Setenv("ATLASSIAN_CONNECT_KEY", "")
+	t.Setenv("ATLASSIAN_CONNECT_STORE_DSN", "")
+	_, err := ConfigFromEnv()
+	if err == nil || !strings.Contains(err.Error(), "ATLASSIAN_CONNECT_BASE_URL, ATLASSIAN_CONNECT_KEY, ATLASSIAN_CONNECT_STORE_DSN") {
+		t.Fatalf("missing variables returned %v", err)
+	}
+	t.Setenv("ATLASSIAN_CONNECT_KEY", "io.shiftleft.test")
+	t.Setenv("ATLASSIAN_CONNECT_BASE_URL", "https://example.com")
+	t.Setenv("ATLASSIAN_CONNECT_SCOPES", "read, write,")
+	t.Setenv("ATLASSIAN_CONNECT_VENDOR_NAME", "ShiftLeft")
+	t.Setenv("ATLASSIAN_CONNECT_STORE_DSN", "memory://")
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Scopes, []string{ScopeRead, ScopeWrite}) || !c.SignedInstall ||
+		c.Vendor.Name != "ShiftLeft" || c.StoreDSN != "memory://" {
+		t.Fatalf("read %+v", c)
+	}
+	store := storage.NewMemoryStore(0)
+	if p := c.NewPlugin(store, log.New(ioutil.Discard, "", 0)); p.store != store || p.ac.Key != c.Key {
+		t.Fatalf("plugin has key %s and store %T", p.ac.Key, p.store)
+	}
+
+	t.Setenv("ATLASSIAN_CONNECT_SIGNED_INSTALL", "nope")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("invalid ATLASSIAN_CONNECT_SIGNED_INSTALL was accepted")
+	}
+}
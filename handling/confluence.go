@@ -0,0 +1,163 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+// Confluence webhook events, a more exhaustive list is available in confluence documentation at
+// https://developer.atlassian.com/cloud/confluence/modules/webhook/
+const (
+	ConfluenceAttachmentCreated         = "attachment_created"
+	ConfluenceAttachmentRemoved         = "attachment_removed"
+	ConfluenceAttachmentRestored        = "attachment_restored"
+	ConfluenceAttachmentTrashed         = "attachment_trashed"
+	ConfluenceAttachmentUpdated         = "attachment_updated"
+	ConfluenceBlogCreated               = "blog_created"
+	ConfluenceBlogRemoved               = "blog_removed"
+	ConfluenceBlogRestored              = "blog_restored"
+	ConfluenceBlogTrashed               = "blog_trashed"
+	ConfluenceBlogUpdated               = "blog_updated"
+	ConfluenceCommentCreated            = "comment_created"
+	ConfluenceCommentRemoved            = "comment_removed"
+	ConfluenceCommentUpdated            = "comment_updated"
+	ConfluenceContentCreated            = "content_created"
+	ConfluenceContentRestored           = "content_restored"
+	ConfluenceContentTrashed            = "content_trashed"
+	ConfluenceContentUpdated            = "content_updated"
+	ConfluenceContentPermissionsUpdated = "content_permissions_updated"
+	ConfluenceLabelAdded                = "label_added"
+	ConfluenceLabelCreated              = "label_created"
+	ConfluenceLabelDeleted              = "label_deleted"
+	ConfluenceLabelRemoved              = "label_removed"
+	ConfluencePageChildrenReordered     = "page_children_reordered"
+	ConfluencePageCreated               = "page_created"
+	ConfluencePageMoved                 = "page_moved"
+	ConfluencePageRemoved               = "page_removed"
+	ConfluencePageRestored              = "page_restored"
+	ConfluencePageTrashed               = "page_trashed"
+	ConfluencePageUpdated               = "page_updated"
+	ConfluenceRelationCreated           = "relation_created"
+	ConfluenceRelationDeleted           = "relation_deleted"
+	ConfluenceSpaceCreated              = "space_created"
+	ConfluenceSpacePermissionsUpdated   = "space_permissions_updated"
+	ConfluenceSpaceRemoved              = "space_removed"
+	ConfluenceSpaceUpdated              = "space_updated"
+	ConfluenceUserCreated               = "user_created"
+	ConfluenceUserDeactivated           = "user_deactivated"
+	ConfluenceUserFollowed              = "user_followed"
+	ConfluenceUserReactivated           = "user_reactivated"
+	ConfluenceUserRemoved               = "user_removed"
+	ConfluenceGroupCreated              = "group_created"
+	ConfluenceGroupRemoved              = "group_removed"
+	ConfluenceConnectAddonEnabled       = "connect_addon_enabled"
+	ConfluenceConnectAddonDisabled      = "connect_addon_disabled"
+	ConfluenceSearchPerformed           = "search_performed"
+	ConfluenceThemeEnabled              = "theme_enabled"
+)
+
+var confluenceWebhookEvents = map[string]bool{}
+
+func init() {
+	for _, e := range []string{
+		ConfluenceAttachmentCreated, ConfluenceAttachmentRemoved, ConfluenceAttachmentRestored,
+		ConfluenceAttachmentTrashed, ConfluenceAttachmentUpdated,
+		ConfluenceBlogCreated, ConfluenceBlogRemoved, ConfluenceBlogRestored, ConfluenceBlogTrashed,
+		ConfluenceBlogUpdated,
+		ConfluenceCommentCreated, ConfluenceCommentRemoved, ConfluenceCommentUpdated,
+		ConfluenceContentCreated, ConfluenceContentRestored, ConfluenceContentTrashed,
+		ConfluenceContentUpdated, ConfluenceContentPermissionsUpdated,
+		ConfluenceLabelAdded, ConfluenceLabelCreated, ConfluenceLabelDeleted, ConfluenceLabelRemoved,
+		ConfluencePageChildrenReordered, ConfluencePageCreated, ConfluencePageMoved, ConfluencePageRemoved,
+		ConfluencePageRestored, ConfluencePageTrashed, ConfluencePageUpdated,
+		ConfluenceRelationCreated, ConfluenceRelationDeleted,
+		ConfluenceSpaceCreated, ConfluenceSpacePermissionsUpdated, ConfluenceSpaceRemoved, ConfluenceSpaceUpdated,
+		ConfluenceUserCreated, ConfluenceUserDeactivated, ConfluenceUserFollowed, ConfluenceUserReactivated,
+		ConfluenceUserRemoved, ConfluenceGroupCreated, ConfluenceGroupRemoved,
+		ConfluenceConnectAddonEnabled, ConfluenceConnectAddonDisabled, ConfluenceSearchPerformed,
+		ConfluenceThemeEnabled,
+	} {
+		confluenceWebhookEvents[e] = true
+	}
+}
+
+// SetProductType sets the atlassian product (apicommunication.ProductTypeJira, the default, or
+// apicommunication.ProductTypeConfluence) the plugin is built for, webhooks are validated against it.
+// It must be called before registering webhooks.
+func (p *Plugin) SetProductType(productType string) error {
+	productType = strings.ToLower(productType)
+	switch productType {
+	case apicommunication.ProductTypeJira, apicommunication.ProductTypeConfluence:
+	default:
+		return fmt.Errorf("unknown product type %q", productType)
+	}
+	if len(p.webhooks) > 0 {
+		return fmt.Errorf("product type must be set before registering webhooks")
+	}
+	p.productType = productType
+	return nil
+}
+
+// ConfluenceContext holds the context parameters confluence adds to the URL of modules, they are only
+// present if the module URL declares them, ie "/view?contentId={content.id}&spaceKey={space.key}" is
+// read with the content.id and space.key query arguments.
+type ConfluenceContext struct {
+	ContentID      string
+	ContentType    string
+	ContentVersion string
+	ContentPlugin  string
+	SpaceID        string
+	SpaceKey       string
+	PageID         string
+	PageType       string
+	PageVersion    string
+	MacroID        string
+	MacroHash      string
+	OutputType     string
+	// ContextPath is the cp argument atlassian adds to iframes, "/wiki" for confluence cloud.
+	ContextPath string
+}
+
+// ConfluenceContextFromRequest reads the confluence context parameters from the query of r, each
+// parameter is looked up by its dotted name (content.id) and its camel cased name (contentId).
+func ConfluenceContextFromRequest(r *http.Request) *ConfluenceContext {
+	q := r.URL.Query()
+	get := func(object, field string) string {
+		if v := q.Get(object + "." + field); v != "" {
+			return v
+		}
+		return q.Get(object + strings.ToUpper(field[:1]) + field[1:])
+	}
+	return &ConfluenceContext{
+		ContentID:      get("content", "id"),
+		ContentType:    get("content", "type"),
+		ContentVersion: get("content", "version"),
+		ContentPlugin:  get("content", "plugin"),
+		SpaceID:        get("space", "id"),
+		SpaceKey:       get("space", "key"),
+		PageID:         get("page", "id"),
+		PageType:       get("page", "type"),
+		PageVersion:    get("page", "version"),
+		MacroID:        get("macro", "id"),
+		MacroHash:      get("macro", "hash"),
+		OutputType:     get("output", "type"),
+		ContextPath:    q.Get("cp"),
+	}
+}
@@ -0,0 +1,79 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// newConfluencePlugin returns a plugin for confluence without any webhook.
+func newConfluencePlugin(t *testing.T) *Plugin {
+	p := NewPlugin("test_confluence", "a test confluence plugin", "io.something.confluence",
+		"https://invalidurl.shiftleft.io", "/path/to/api", storage.NewMemoryStore(0), adaptLogger(t),
+		[]string{"READ"}, Vendor{Name: "ShiftLeft", URL: "https://www.shiftleft.io"}, false)
+	if err := p.SetProductType("Confluence"); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPlugin_SetProductType(t *testing.T) {
+	if err := newPlugin(t, fakeHandleFunc).SetProductType(apicommunication.ProductTypeConfluence); err == nil {
+		t.Fatal("changed the product type after registering webhooks")
+	}
+	p := newConfluencePlugin(t)
+	if err := p.SetProductType("bitbucket"); err == nil {
+		t.Fatal("set an unknown product type")
+	}
+	route := NewRoutePath("/hook", nil)
+	if err := p.AddWebhook(ConfluencePageCreated, route, fakeHandleFunc); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddWebhook(JiraIssueCreated, NewRoutePath("/issue", nil), fakeHandleFunc); err == nil {
+		t.Fatal("registered a jira event in a confluence plugin")
+	}
+	err := p.AddWebhook("page_udpated", NewRoutePath("/typo", nil), fakeHandleFunc)
+	if err == nil || !strings.Contains(err.Error(), "did you mean page_updated?") {
+		t.Fatalf("registering a misspelled event returned %v", err)
+	}
+	if err := newPlugin(t, fakeHandleFunc).AddWebhook(ConfluenceBlogCreated, route, fakeHandleFunc); err == nil {
+		t.Fatal("registered a confluence event in a jira plugin")
+	}
+}
+
+func TestConfluenceContextFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/view?content.id=123&spaceKey=DOCS&page.version=4&cp=%2Fwiki", nil)
+	got := ConfluenceContextFromRequest(r)
+	want := &ConfluenceContext{ContentID: "123", SpaceKey: "DOCS", PageVersion: "4", ContextPath: "/wiki"}
+	if *got != *want {
+		t.Fatalf("read %+v, want %+v", got, want)
+	}
+}
+
+func TestPlugin_HandleInstallProductType(t *testing.T) {
+	p := newConfluencePlugin(t)
+	install := func(productType string) int {
+		payload := `{"key": "io.something.confluence", "clientKey": "` + productType + `", "sharedSecret": "secret",
+			"baseUrl": "https://acme.atlassian.net/wiki", "productType": "` + productType + `", "eventType": "installed"}`
+		w := httptest.NewRecorder()
+		p.HandleInstall(nil, p.store, w, httptest.NewRequest(http.MethodPost, "/installed", strings.NewReader(payload)))
+		return w.Code
+	}
+	if code := install("jira"); code != http.StatusBadRequest {
+		t.Fatalf("jira install of a confluence plugin answered %d", code)
+	}
+	if code := install("confluence"); code != http.StatusNoContent {
+		t.Fatalf("confluence install answered %d", code)
+	}
+	jii, err := p.store.JiraInstallInformation("confluence")
+	if err != nil || jii == nil {
+		t.Fatalf("install was not stored: %v", err)
+	}
+	if jii.ContextPath() != "/wiki" {
+		t.Fatalf("context path is %q", jii.ContextPath())
+	}
+}
@@ -0,0 +1,68 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// ContextWithTenant returns a copy of ctx carrying the passed install information and claims,
+// claims can be nil if the tenant was not obtained from a JWT.
+func ContextWithTenant(ctx context.Context, jii *storage.JiraInstallInformation,
+	claims *apicommunication.Claims) context.Context {
+	return apicommunication.ContextWithTenant(ctx, jii, claims)
+}
+
+// TenantFromContext returns the validated install information stored in the context, if any.
+func TenantFromContext(ctx context.Context) (*storage.JiraInstallInformation, bool) {
+	return apicommunication.TenantFromContext(ctx)
+}
+
+// ClaimsFromContext returns the claims of the validated JWT stored in the context, if any.
+func ClaimsFromContext(ctx context.Context) (*apicommunication.Claims, bool) {
+	return apicommunication.ClaimsFromContext(ctx)
+}
+
+// AccountIDFromContext returns the accountId of the user the validated JWT stored in the context
+// was signed for, if any, use it to authorize users in handlers wrapped by VerifiedHandleFunc.
+func AccountIDFromContext(ctx context.Context) (string, bool) {
+	return apicommunication.AccountIDFromContext(ctx)
+}
+
+// TenantMiddleware validates the request JWT and stores the tenant and claims in the request
+// context before invoking next, use TenantFromContext to retrieve them.
+// This is useful for handlers that are not JiraHandleFunc, such as the ones for panels, outside of
+// the plugin apicommunication.Middleware does the same.
+func (p *Plugin) TenantMiddleware(next http.Handler) http.Handler {
+	return p.TenantMiddlewareFrom(apicommunication.DefaultTokenSources)(next)
+}
+
+// TenantMiddlewareFrom returns a TenantMiddleware that only accepts the JWT from the passed sources.
+func (p *Plugin) TenantMiddlewareFrom(sources apicommunication.TokenSource) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return p.tenantMiddleware(sources, next)
+	}
+}
+
+func (p *Plugin) tenantMiddleware(sources apicommunication.TokenSource, next http.Handler) http.Handler {
+	return p.VerifiedHandleFuncFrom(sources, func(_ *storage.JiraInstallInformation, _ storage.Store,
+		w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+	})
+}
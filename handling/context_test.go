@@ -0,0 +1,184 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+func signedRequest(t *testing.T, method, url string, jii *storage.JiraInstallInformation) *http.Request {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": jii.ClientKey,
+		"sub": "someaccountid",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	signed, err := token.SignedString([]byte(jii.SharedSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "JWT "+signed)
+	return req
+}
+
+func TestPlugin_TenantMiddleware(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey", SharedSecret: "kiasjhdkajhdkajshd"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotTenant *storage.JiraInstallInformation
+	var gotSubject string
+	h := p.TenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant, _ = TenantFromContext(r.Context())
+		if claims, ok := ClaimsFromContext(r.Context()); ok {
+			gotSubject = claims.Subject
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, signedRequest(t, http.MethodGet, "/panel", jii))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	if gotTenant == nil || gotTenant.ClientKey != "ckey" {
+		t.Errorf("expected tenant ckey in context, got %#v", gotTenant)
+	}
+	if gotSubject != "someaccountid" {
+		t.Errorf("expected subject someaccountid, got %q", gotSubject)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panel", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unsigned request to be rejected with 401, got %d", w.Code)
+	}
+}
+
+func TestPlugin_TenantMiddlewareFrom(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey", SharedSecret: "kiasjhdkajhdkajshd"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	h := p.TenantMiddlewareFrom(apicommunication.TokenSourceBearerHeader)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := signedRequest(t, http.MethodGet, "/panel", jii)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("expected JWT header to be rejected when only Bearer is accepted")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+req.Header.Get("Authorization")[len("JWT "):])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 got %d", w.Code)
+	}
+}
+
+func TestPlugin_ReplayCache(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.SetReplayCache(apicommunication.NewMemoryReplayCache())
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey", SharedSecret: "kiasjhdkajhdkajshd"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	h := p.TenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := signedRequest(t, http.MethodGet, "/panel", jii)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected replayed token to be rejected with 401, got %d", w.Code)
+	}
+}
+
+func TestAccountIDFromContext(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey", SharedSecret: "kiasjhdkajhdkajshd"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	var gotAccountID string
+	var gotUser bool
+	h := p.VerifiedHandleFunc(func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter,
+		r *http.Request) {
+		gotAccountID, gotUser = AccountIDFromContext(r.Context())
+	})
+	request := func(claims jwt.MapClaims) *http.Request {
+		claims["iss"] = jii.ClientKey
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jii.SharedSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/panel", nil)
+		req.Header.Set("Authorization", "JWT "+signed)
+		return req
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), request(jwt.MapClaims{
+		"sub":     "subject",
+		"context": map[string]interface{}{"user": map[string]interface{}{"accountId": "contextaccountid"}},
+	}))
+	if !gotUser || gotAccountID != "contextaccountid" {
+		t.Errorf("expected the account id of the context claim, got %q, %v", gotAccountID, gotUser)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), signedRequest(t, http.MethodGet, "/panel", jii))
+	if !gotUser || gotAccountID != "someaccountid" {
+		t.Errorf("expected the subject as account id, got %q, %v", gotAccountID, gotUser)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), request(jwt.MapClaims{"sub": jii.ClientKey}))
+	if gotUser {
+		t.Errorf("token not signed for a user has account id %q", gotAccountID)
+	}
+}
+
+func TestPlugin_TemplateFuncsHostURL(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey", BaseURL: "https://example.atlassian.net/wiki"}
+	hostURL := func(query string) string {
+		r := httptest.NewRequest(http.MethodGet, "/panel?"+query, nil)
+		r = r.WithContext(ContextWithTenant(r.Context(), jii, nil))
+		return p.TemplateFuncs(r)["apHostURL"].(func() string)()
+	}
+	for query, want := range map[string]string{
+		"xdm_e=https://example.atlassian.net&cp=/wiki":           "https://example.atlassian.net/wiki",
+		"xdm_e=https://example.atlassian.net":                    "https://example.atlassian.net",
+		"xdm_e=https://EXAMPLE.atlassian.net&cp=/wiki/":          "https://EXAMPLE.atlassian.net/wiki",
+		"xdm_e=https://other.atlassian.net&cp=/wiki":             "",
+		"xdm_e=http://example.atlassian.net&cp=/wiki":            "",
+		"xdm_e=javascript://example.atlassian.net&cp=/wiki":      "",
+		"xdm_e=https://example.atlassian.net&cp=@evil.com":       "",
+		"xdm_e=https://example.atlassian.net&cp=/x@evil.com":     "",
+		"xdm_e=https://example.atlassian.net&cp=//evil.com":      "",
+		"xdm_e=https://example.atlassian.net&cp=/%5C%5Cevil.com": "",
+		"xdm_e=https://example.atlassian.net&cp=.evil.com":       "",
+	} {
+		if got := hostURL(query); got != want {
+			t.Errorf("host url of %s is %q, want %q", query, got, want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/panel?xdm_e=https://example.atlassian.net", nil)
+	if got := p.TemplateFuncs(r)["apHostURL"].(func() string)(); got != "" {
+		t.Errorf("host url without a tenant in the context is %q", got)
+	}
+}
@@ -0,0 +1,272 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/gorilla/mux"
+)
+
+// DeadLetterReplayHeader is set on the requests passed to webhook handlers by ReplayDeadLetter so
+// they can tell replayed events from the ones sent by jira.
+const DeadLetterReplayHeader = "X-Atlassian-Connect-Go-Replay"
+
+// maxWebhookRetryInterval caps the wait between attempts of AsyncWebhooks.
+const maxWebhookRetryInterval = 10 * time.Minute
+
+// asyncWebhooks tracks the webhooks AsyncWebhooks processes in the background.
+type asyncWebhooks struct {
+	mu      sync.Mutex
+	closed  bool
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newAsyncWebhooks() *asyncWebhooks {
+	return &asyncWebhooks{closing: make(chan struct{})}
+}
+
+// start registers a webhook processed in the background, it returns false once the plugin is closed.
+func (a *asyncWebhooks) start() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return false
+	}
+	a.wg.Add(1)
+	return true
+}
+
+// Close stops the background processing of AsyncWebhooks: webhooks received afterwards are handled
+// synchronously, and the ones waiting for a retry are saved as dead letters right away. It waits for
+// the webhooks being processed to be done, or for ctx to be, in which case ctx.Err() is returned.
+func (p *Plugin) Close(ctx context.Context) error {
+	a := p.async
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.closing)
+	}
+	a.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AsyncWebhooks returns a WebhookMiddleware that answers jira right away with http.StatusAccepted
+// and processes webhooks in the background, so slow handlers don't make jira give up on the app.
+// Handlers failing (status >= 400 or panic) are retried after retryAfter, doubling each time, until
+// maxAttempts is reached, then the webhook is saved as a dead letter if the store implements
+// storage.DeadLetterStore, see DeadLetters and ReplayDeadLetter, or logged and dropped otherwise.
+// Of the handlers added with AddWebhookHandler only the failing ones are retried and kept in the
+// dead letter. Requests from Backfill and ReplayDeadLetter are processed synchronously so they can
+// report failures. Close must be invoked on shutdown so webhooks being processed are not lost.
+func (p *Plugin) AsyncWebhooks(maxAttempts int, retryAfter time.Duration) WebhookMiddleware {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return func(event string, next JiraHandleFunc) JiraHandleFunc {
+		return func(jii *storage.JiraInstallInformation, store storage.Store, w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(BackfillHeader) != "" || r.Header.Get(DeadLetterReplayHeader) != "" {
+				next(jii, store, w, r)
+				return
+			}
+			var body []byte
+			if r.Body != nil {
+				var err error
+				if body, err = ioutil.ReadAll(r.Body); err != nil {
+					p.logger.Printf("ERROR: reading %s webhook body: %v", event, err)
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+			claims, _ := ClaimsFromContext(r.Context())
+			// the request outlives the one of jira, so it can not share its context.
+			req := r.Clone(ContextWithTenant(context.Background(), jii, claims))
+			req = mux.SetURLVars(req, mux.Vars(r))
+			if !p.async.start() {
+				// closing, jira retries the webhook if it fails.
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+				next(jii, store, w, r)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			go func() {
+				defer p.async.wg.Done()
+				p.processWebhook(event, next, jii, store, req, body, maxAttempts, retryAfter)
+			}()
+		}
+	}
+}
+
+func (p *Plugin) processWebhook(event string, next JiraHandleFunc, jii *storage.JiraInstallInformation,
+	store storage.Store, r *http.Request, body []byte, maxAttempts int, retryAfter time.Duration) {
+	handle := p.recoverHandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		next(jii, store, w, r)
+	})
+	var cause string
+	var failed []int
+	attempts := 0
+retries:
+	for attempts < maxAttempts {
+		if attempts > 0 {
+			wait := retryAfter << uint(attempts-1)
+			if wait < 0 || wait > maxWebhookRetryInterval {
+				wait = maxWebhookRetryInterval
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-p.async.closing:
+				timer.Stop()
+				break retries
+			}
+		}
+		attempts++
+		ctx, run := withFanOutRun(r.Context(), failed)
+		req := r.Clone(ctx)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		rec := newResponseRecorder()
+		handle(rec, req)
+		if rec.code < http.StatusBadRequest {
+			return
+		}
+		if len(run.failed) > 0 {
+			failed = run.failed
+		}
+		cause = fmt.Sprintf("handler failed with status %d", rec.code)
+		if detail := strings.TrimSpace(rec.body.String()); detail != "" {
+			cause += ": " + detail
+		}
+		p.logger.Printf("WARNING: attempt %d of %s webhook for %s: %s", attempts, event, jii.ClientKey, cause)
+	}
+
+	if !storage.Supports(store, (*storage.DeadLetterStore)(nil)) {
+		p.logger.Printf("ERROR: %T can not keep dead letters, dropping %s webhook for %s after %d attempts",
+			store, event, jii.ClientKey, attempts)
+		return
+	}
+	letters := store.(storage.DeadLetterStore)
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		p.logger.Printf("ERROR: generating dead letter id, dropping %s webhook for %s: %v", event, jii.ClientKey, err)
+		return
+	}
+	letter := &storage.DeadLetter{
+		ID:        hex.EncodeToString(id),
+		ClientKey: jii.ClientKey,
+		Event:     event,
+		Path:      r.URL.RequestURI(),
+		Vars:      mux.Vars(r),
+		Body:      body,
+		Handlers:  failed,
+		Attempts:  attempts,
+		Error:     cause,
+		FailedAt:  time.Now().UTC(),
+	}
+	if err := letters.SaveDeadLetter(letter); err != nil {
+		p.logger.Printf("ERROR: saving dead letter for %s webhook of %s: %v", event, jii.ClientKey, err)
+		return
+	}
+	p.logger.Printf("ERROR: %s webhook for %s failed %d times, saved as dead letter %s",
+		event, jii.ClientKey, attempts, letter.ID)
+}
+
+func (p *Plugin) deadLetterStore() (storage.DeadLetterStore, error) {
+	if !storage.Supports(p.store, (*storage.DeadLetterStore)(nil)) {
+		return nil, fmt.Errorf("%T can not keep dead letters", p.store)
+	}
+	return p.store.(storage.DeadLetterStore), nil
+}
+
+// DeadLetters returns the webhooks AsyncWebhooks gave up on for the tenant, or for every tenant if
+// clientKey is "", oldest first.
+func (p *Plugin) DeadLetters(clientKey string) ([]*storage.DeadLetter, error) {
+	letters, err := p.deadLetterStore()
+	if err != nil {
+		return nil, err
+	}
+	return letters.DeadLetters(clientKey)
+}
+
+// ReplayDeadLetter feeds the dead letter with the passed id to the handler of its event, through the
+// webhook middleware, and deletes it if the handler succeeds. The request carries DeadLetterReplayHeader.
+// Only the handlers that failed run, the dead letter is updated to the ones still failing otherwise.
+func (p *Plugin) ReplayDeadLetter(ctx context.Context, id string) error {
+	letters, err := p.deadLetterStore()
+	if err != nil {
+		return err
+	}
+	letter, err := letters.DeadLetter(id)
+	if err != nil {
+		return fmt.Errorf("reading dead letter %s: %w", id, err)
+	}
+	if letter == nil {
+		return fmt.Errorf("there is no dead letter %s", id)
+	}
+	handler, ok := p.webhookHandler(letter.Event)
+	if !ok {
+		return fmt.Errorf("no webhook registered for event %s", letter.Event)
+	}
+	jii, err := p.store.JiraInstallInformation(letter.ClientKey)
+	if err != nil {
+		return fmt.Errorf("reading jira install information for %s: %w", letter.ClientKey, err)
+	}
+	if jii == nil {
+		return fmt.Errorf("tenant %s of dead letter %s is not installed", letter.ClientKey, id)
+	}
+	ctx, run := withFanOutRun(ContextWithTenant(ctx, jii, nil), letter.Handlers)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, letter.Path, bytes.NewReader(letter.Body))
+	if err != nil {
+		return fmt.Errorf("building request for dead letter %s: %w", id, err)
+	}
+	req = mux.SetURLVars(req, letter.Vars)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeadLetterReplayHeader, "true")
+	rec := newResponseRecorder()
+	handler(jii, p.store, rec, req)
+	if rec.code >= http.StatusBadRequest {
+		if len(run.failed) > 0 && len(run.failed) != len(letter.Handlers) {
+			letter.Handlers = run.failed
+			if err := letters.SaveDeadLetter(letter); err != nil {
+				return fmt.Errorf("saving the handlers still failing dead letter %s: %w", id, err)
+			}
+		}
+		return fmt.Errorf("handler for %s failed replaying dead letter %s with status %d", letter.Event, id, rec.code)
+	}
+	if err := letters.DeleteDeadLetter(id); err != nil {
+		return fmt.Errorf("deleting replayed dead letter %s: %w", id, err)
+	}
+	return nil
+}
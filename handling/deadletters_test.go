@@ -0,0 +1,182 @@
+package handling
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_AsyncWebhooksDeadLetters(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	store := storage.NewMemoryStore(0)
+	p.store = store
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	if err := store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	down, calls := true, 0
+	err := p.AddWebhook(JiraIssueCreated, NewRoutePath("/issue_created", nil),
+		func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			if b, _ := ioutil.ReadAll(r.Body); string(b) != "payload" {
+				t.Errorf("handler read %q", b)
+			}
+			if down {
+				http.Error(w, "downstream is down", http.StatusBadGateway)
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.UseWebhookMiddleware(p.AsyncWebhooks(3, 0))
+
+	handler, _ := p.webhookHandler(JiraIssueCreated)
+	w := httptest.NewRecorder()
+	handler(jii, p.store, w, httptest.NewRequest(http.MethodPost, "/path/to/api/issue_created", strings.NewReader("payload")))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("webhook answered %d", w.Code)
+	}
+	var letters []*storage.DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(letters) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		if letters, err = p.DeadLetters("ck"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(letters) != 1 {
+		t.Fatalf("expected a dead letter, got %v", letters)
+	}
+	l := letters[0]
+	if l.Event != JiraIssueCreated || l.Attempts != 3 || !strings.Contains(l.Error, "downstream is down") {
+		t.Fatalf("unexpected dead letter %+v", l)
+	}
+
+	if err := p.ReplayDeadLetter(context.Background(), l.ID); err == nil {
+		t.Fatal("replaying while the handler fails succeeded")
+	}
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	if err := p.ReplayDeadLetter(context.Background(), l.ID); err != nil {
+		t.Fatal(err)
+	}
+	if letters, _ := p.DeadLetters(""); len(letters) != 0 {
+		t.Fatalf("replayed dead letter was kept: %v", letters)
+	}
+	if calls != 5 {
+		t.Fatalf("handler was called %d times", calls)
+	}
+}
+
+func TestPlugin_AsyncWebhooksFailedHandlers(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	down := true
+	calls := make([]int, 3)
+	counting := func(i int, fails bool) JiraHandleFunc {
+		return func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, _ *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[i]++
+			if fails && down {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}
+	}
+	if err := p.AddWebhook(JiraIssueCreated, NewRoutePath("/issue_created", nil), counting(0, false)); err != nil {
+		t.Fatal(err)
+	}
+	for i, fails := range []bool{true, false} {
+		if err := p.AddWebhookHandler(JiraIssueCreated, counting(i+1, fails)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.UseWebhookMiddleware(p.AsyncWebhooks(3, 0))
+
+	handler, _ := p.webhookHandler(JiraIssueCreated)
+	handler(jii, p.store, httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/issue_created", strings.NewReader("{}")))
+	var letters []*storage.DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(letters) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		if letters, err = p.DeadLetters("ck"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(letters) != 1 {
+		t.Fatalf("expected a dead letter, got %v", letters)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(letters[0].Handlers, []int{1}) || !reflect.DeepEqual(calls, []int{1, 3, 1}) {
+		t.Fatalf("dead letter of handlers %v after calls %v", letters[0].Handlers, calls)
+	}
+
+	down = false
+	mu.Unlock()
+	if err := p.ReplayDeadLetter(context.Background(), letters[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(calls, []int{1, 4, 1}) {
+		t.Fatalf("replay called handlers %v times", calls)
+	}
+}
+
+func TestPlugin_Close(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	called := make(chan struct{}, 2)
+	err := p.AddWebhook(JiraIssueCreated, NewRoutePath("/issue_created", nil),
+		func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, _ *http.Request) {
+			called <- struct{}{}
+			w.WriteHeader(http.StatusBadGateway)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.UseWebhookMiddleware(p.AsyncWebhooks(3, time.Hour))
+	handler, _ := p.webhookHandler(JiraIssueCreated)
+	call := func() int {
+		w := httptest.NewRecorder()
+		handler(jii, p.store, w, httptest.NewRequest(http.MethodPost, "/issue_created", strings.NewReader("{}")))
+		return w.Code
+	}
+
+	if code := call(); code != http.StatusAccepted {
+		t.Fatalf("webhook answered %d", code)
+	}
+	<-called
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatalf("closing while waiting for a retry: %v", err)
+	}
+	letters, err := p.DeadLetters("ck")
+	if err != nil || len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Fatalf("expected a dead letter after one attempt, got %v, %v", letters, err)
+	}
+	if code := call(); code != http.StatusBadGateway {
+		t.Fatalf("webhook received after closing answered %d", code)
+	}
+}
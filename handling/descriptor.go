@@ -0,0 +1,203 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// ModuleFilter decides if the module of the passed type (ie webPanels) and key is included in the
+// descriptor served to a tenant, jii is nil when the requesting tenant can not be identified.
+type ModuleFilter func(jii *storage.JiraInstallInformation, moduleType, key string) bool
+
+// SetModuleFilter sets a filter applied to modules when serving atlassian-connect.json, this allows
+// rolling out modules to some tenants only. Modules without a key (such as webhooks) are always included.
+func (p *Plugin) SetModuleFilter(f ModuleFilter) {
+	p.moduleFilter = f
+}
+
+var keyNamespaceRegexp = regexp.MustCompile(`^[a-zA-Z0-9\-._]*$`)
+
+// SetKeyNamespace namespaces the plugin key and the key of every module in the served descriptor
+// with the passed environment namespace, ie "-staging", which is appended to them. This prevents
+// key collisions when the apps of more than one environment are installed in the same tenant.
+// Handlers, module filters and toggles keep using the keys the modules were added with.
+func (p *Plugin) SetKeyNamespace(namespace string) error {
+	if !keyNamespaceRegexp.MatchString(namespace) {
+		return fmt.Errorf("key namespace %q must only have alphanumerics, dots, dashes or underscores", namespace)
+	}
+	p.keyNamespace = namespace
+	return nil
+}
+
+// descriptorFilter returns the filter the descriptor modules of jii go through, which combines the
+// one set with SetModuleFilter and the module toggles of jii, or nil if there is none. The toggles
+// are read once, when the filter is built.
+func (p *Plugin) descriptorFilter(jii *storage.JiraInstallInformation) ModuleFilter {
+	if p.moduleToggles == nil {
+		return p.moduleFilter
+	}
+	disabled := p.disabledModules(jii)
+	return func(jii *storage.JiraInstallInformation, moduleType, key string) bool {
+		if disabled[moduleToggleID(moduleType, key)] {
+			return false
+		}
+		return p.moduleFilter == nil || p.moduleFilter(jii, moduleType, key)
+	}
+}
+
+// descriptorTenant returns the tenant requesting the descriptor if the request carries a valid JWT.
+func (p *Plugin) descriptorTenant(r *http.Request) *storage.JiraInstallInformation {
+	if _, err := apicommunication.ExtractToken(r, apicommunication.DefaultTokenSources); err != nil {
+		return nil
+	}
+	jii, err := apicommunication.ValidateRequest(r, p.store)
+	if err != nil {
+		p.logger.Printf("INFO: descriptor requested with invalid JWT: %v", err)
+		return nil
+	}
+	return jii
+}
+
+// descriptorFor returns the descriptor to be served to the passed tenant.
+func (p *Plugin) descriptorFor(jii *storage.JiraInstallInformation) *AtlassianConnect {
+	filter := p.descriptorFilter(jii)
+	if filter == nil && p.keyNamespace == "" {
+		return p.ac
+	}
+	ac := *p.ac
+	ac.Key += p.keyNamespace
+	ac.Modules = make(map[string]interface{}, len(p.ac.Modules))
+	for moduleType, modules := range p.ac.Modules {
+		if filter != nil {
+			modules = filterModules(modules, func(key string) bool {
+				return filter(jii, moduleType, key)
+			})
+		}
+		if p.keyNamespace != "" {
+			modules = namespaceModules(modules, p.keyNamespace)
+		}
+		ac.Modules[moduleType] = modules
+	}
+	return &ac
+}
+
+// namespaceModules returns a copy of the modules slice whose module keys have namespace appended.
+func namespaceModules(modules interface{}, namespace string) interface{} {
+	v := reflect.ValueOf(modules)
+	if v.Kind() != reflect.Slice {
+		return modules
+	}
+	namespaced := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	for i := 0; i < v.Len(); i++ {
+		namespaced.Index(i).Set(namespaceModule(v.Index(i), namespace))
+	}
+	return namespaced.Interface()
+}
+
+// namespaceModule returns a copy of the typed or untyped module in v with namespace appended to
+// its key, modules are copied rather than modified since they are shared with the plugin.
+func namespaceModule(v reflect.Value, namespace string) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return namespaceModule(v.Elem(), namespace)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(namespaceModule(v.Elem(), namespace))
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		if f := cp.FieldByName("Key"); f.IsValid() && f.Kind() == reflect.String && f.CanSet() && f.String() != "" {
+			f.SetString(f.String() + namespace)
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), iter.Value())
+		}
+		keyName := reflect.ValueOf("key").Convert(v.Type().Key())
+		if key, ok := moduleKey(v); ok && key != "" {
+			namespaced := reflect.ValueOf(key + namespace)
+			if namespaced.Type().AssignableTo(v.Type().Elem()) {
+				cp.SetMapIndex(keyName, namespaced)
+			}
+		}
+		return cp
+	}
+	return v
+}
+
+// filterModules returns a copy of the modules slice holding only the ones whose key passes keep.
+func filterModules(modules interface{}, keep func(key string) bool) interface{} {
+	v := reflect.ValueOf(modules)
+	if v.Kind() != reflect.Slice {
+		return modules
+	}
+	filtered := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		key, hasKey := moduleKey(elem)
+		if !hasKey || keep(key) {
+			filtered = reflect.Append(filtered, elem)
+		}
+	}
+	return filtered.Interface()
+}
+
+// moduleKey returns the Key field of a typed module or the "key" entry of an untyped one.
+func moduleKey(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		f := v.FieldByName("Key")
+		if f.IsValid() && f.Kind() == reflect.String {
+			return f.String(), true
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return "", false
+		}
+		k := v.MapIndex(reflect.ValueOf("key"))
+		if k.IsValid() {
+			if s, ok := k.Interface().(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,126 @@
+package handling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// descriptorModules returns the type/key of the modules in the descriptor served for req, keyless
+// modules are listed by type alone.
+func descriptorModules(t *testing.T, router http.Handler, req *http.Request) []string {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var ac struct {
+		Modules map[string][]map[string]interface{} `json:"modules"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil {
+		t.Fatalf("decoding descriptor: %v", err)
+	}
+	var modules []string
+	for moduleType, ms := range ac.Modules {
+		for _, m := range ms {
+			if key, ok := m["key"].(string); ok {
+				modules = append(modules, moduleType+"/"+key)
+			} else {
+				modules = append(modules, moduleType)
+			}
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+func TestPlugin_SetModuleFilter(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	beta := &storage.JiraInstallInformation{ClientKey: "beta", SharedSecret: "secret"}
+	if err := p.store.SaveJiraInstallInformation(beta); err != nil {
+		t.Fatal(err)
+	}
+	p.ac.Modules["generalPages"] = []map[string]interface{}{
+		{"key": "beta-page", "url": "/beta"},
+		{"key": "page", "url": "/page"},
+	}
+	p.ac.Modules["postInstallPage"] = []map[string]interface{}{{"url": "/welcome"}}
+	var seen []string
+	p.SetModuleFilter(func(jii *storage.JiraInstallInformation, moduleType, key string) bool {
+		tenant := ""
+		if jii != nil {
+			tenant = jii.ClientKey
+		}
+		seen = append(seen, tenant+":"+moduleType+"/"+key)
+		return key != "beta-page" || tenant == "beta"
+	})
+	router := p.Router(nil)
+
+	all := []string{"generalPages/beta-page", "generalPages/page", "postInstallPage"}
+	anonymous := descriptorModules(t, router, httptest.NewRequest(http.MethodGet, "/path/to/api/atlassian-connect.json", nil))
+	if got := modulesOf(anonymous, "generalPages", "postInstallPage"); !reflect.DeepEqual(got, all[1:]) {
+		t.Fatalf("anonymous descriptor has %v", got)
+	}
+	tenant := descriptorModules(t, router, signedRequest(t, http.MethodGet, "/path/to/api/atlassian-connect.json", beta))
+	if got := modulesOf(tenant, "generalPages", "postInstallPage"); !reflect.DeepEqual(got, all) {
+		t.Fatalf("beta tenant descriptor has %v", got)
+	}
+	for _, s := range seen {
+		if s == ":postInstallPage/" || s == "beta:postInstallPage/" {
+			t.Fatal("keyless module went through the filter")
+		}
+	}
+	if len(tenant) != len(anonymous)+1 {
+		t.Fatalf("filter dropped more than the beta page: %v vs %v", tenant, anonymous)
+	}
+}
+
+// modulesOf returns the modules of the passed types.
+func modulesOf(modules []string, moduleTypes ...string) []string {
+	var filtered []string
+	for _, m := range modules {
+		for _, moduleType := range moduleTypes {
+			if m == moduleType || strings.HasPrefix(m, moduleType+"/") {
+				filtered = append(filtered, m)
+			}
+		}
+	}
+	return filtered
+}
+
+func TestPlugin_SetKeyNamespace(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	if err := p.AddWebPanel("", WebPanel{Key: "a-panel", URL: "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ImportModules([]byte(`{"generalPages": [{"key": "a-page", "url": "/page"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetKeyNamespace("/staging"); err == nil {
+		t.Fatal("invalid namespace was accepted")
+	}
+	if err := p.SetKeyNamespace("-staging"); err != nil {
+		t.Fatal(err)
+	}
+	ac := p.descriptorFor(nil)
+	if ac.Key != p.ac.Key+"-staging" {
+		t.Fatalf("plugin key is %q", ac.Key)
+	}
+	for _, wp := range ac.Modules["webPanels"].([]WebPanel) {
+		if !strings.HasSuffix(wp.Key, "-staging") {
+			t.Fatalf("web panel key %q was not namespaced", wp.Key)
+		}
+	}
+	if pages := ac.Modules["generalPages"].([]interface{}); pages[0].(map[string]interface{})["key"] != "a-page-staging" {
+		t.Fatalf("general pages are %+v", pages)
+	}
+	for _, wp := range p.ac.Modules["webPanels"].([]WebPanel) {
+		if strings.HasSuffix(wp.Key, "-staging") {
+			t.Fatal("namespacing modified the plugin modules")
+		}
+	}
+}
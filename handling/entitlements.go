@@ -0,0 +1,210 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// FreeTier lists the features of Entitlements available to every tenant, licensed or not.
+const FreeTier = ""
+
+// DefaultLicenseCacheTTL is how long Entitlements trusts a license read from jira.
+const DefaultLicenseCacheTTL = time.Hour
+
+const (
+	// entitlementTierSetting is the tenant setting holding the tier the tenant paid for.
+	entitlementTierSetting = "entitlement.tier"
+	// entitlementGranted and entitlementRevoked are the values of feature override settings.
+	entitlementGranted = "granted"
+	entitlementRevoked = "revoked"
+)
+
+func entitlementFeatureSetting(feature string) string {
+	return "entitlement.feature." + feature
+}
+
+// cachedLicense is a license read for the entitlement the tenant had at the time.
+type cachedLicense struct {
+	entitlementID string
+	license       *apicommunication.AppLicense
+	read          time.Time
+}
+
+// Entitlements decides which features each tenant can use, for apps with tiered pricing. A tenant is
+// entitled to the features of FreeTier and, while the marketplace license of the app is active,
+// evaluations included, to the ones of its tier. The tier of a tenant is kept in its settings (see SetTier)
+// and defaults to the one passed to NewEntitlements, features can be granted to or revoked from a
+// single tenant with Override. Licenses are read from jira and cached for DefaultLicenseCacheTTL,
+// or until the entitlement of the tenant changes, which jira reports by installing the app again.
+type Entitlements struct {
+	appKey      string
+	store       storage.Store
+	scopes      []string
+	tiers       map[string]map[string]bool
+	defaultTier string
+	ttl         time.Duration
+	now         func() time.Time
+	license     func(ctx context.Context, jii *storage.JiraInstallInformation) (*apicommunication.AppLicense, error)
+
+	mu       sync.Mutex
+	licenses map[string]cachedLicense
+}
+
+// NewEntitlements returns Entitlements for the tenants of the plugin, tiers maps each tier to the
+// features it includes, the FreeTier ones need not be repeated.
+func (p *Plugin) NewEntitlements(tiers map[string][]string, defaultTier string) *Entitlements {
+	e := &Entitlements{
+		appKey:      p.ac.Key + p.keyNamespace,
+		store:       p.store,
+		scopes:      p.ac.Scopes,
+		tiers:       map[string]map[string]bool{},
+		defaultTier: defaultTier,
+		ttl:         DefaultLicenseCacheTTL,
+		now:         time.Now,
+		licenses:    map[string]cachedLicense{},
+	}
+	for tier, features := range tiers {
+		e.tiers[tier] = map[string]bool{}
+		for _, f := range features {
+			e.tiers[tier][f] = true
+		}
+	}
+	e.license = e.readLicense
+	return e
+}
+
+// SetLicenseCacheTTL sets how long licenses read from jira are trusted.
+func (e *Entitlements) SetLicenseCacheTTL(ttl time.Duration) {
+	e.ttl = ttl
+}
+
+func (e *Entitlements) readLicense(ctx context.Context, jii *storage.JiraInstallInformation) (*apicommunication.AppLicense, error) {
+	client, err := apicommunication.NewHostClient(ctx, jii, "", e.scopes)
+	if err != nil {
+		return nil, fmt.Errorf("creating client for %s: %w", jii.ClientKey, err)
+	}
+	return client.AppLicenseCtx(ctx, e.appKey)
+}
+
+// License returns the marketplace license of the app in the tenant, nil if it has none.
+func (e *Entitlements) License(ctx context.Context, tenant *storage.JiraInstallInformation) (*apicommunication.AppLicense, error) {
+	e.mu.Lock()
+	cached, ok := e.licenses[tenant.ClientKey]
+	e.mu.Unlock()
+	if ok && cached.entitlementID == tenant.EntitlementID && e.now().Sub(cached.read) < e.ttl {
+		return cached.license, nil
+	}
+	license, err := e.license(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.licenses[tenant.ClientKey] = cachedLicense{entitlementID: tenant.EntitlementID, license: license, read: e.now()}
+	e.mu.Unlock()
+	return license, nil
+}
+
+func (e *Entitlements) settings() (storage.TenantSettings, error) {
+	settings, ok := e.store.(storage.TenantSettings)
+	if !ok {
+		return nil, fmt.Errorf("%T can not store tenant settings", e.store)
+	}
+	return settings, nil
+}
+
+// Tier returns the tier of the tenant, the default one unless SetTier was invoked for it.
+func (e *Entitlements) Tier(clientKey string) (string, error) {
+	settings, ok := e.store.(storage.TenantSettings)
+	if !ok {
+		return e.defaultTier, nil
+	}
+	tier, err := settings.GetSetting(clientKey, entitlementTierSetting)
+	if errors.Is(err, storage.ErrUnsupported) {
+		return e.defaultTier, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading tier of %s: %w", clientKey, err)
+	}
+	if tier == "" {
+		return e.defaultTier, nil
+	}
+	return tier, nil
+}
+
+// SetTier records the tier the tenant paid for, ie from the marketplace reporting API, the store
+// must implement storage.TenantSettings.
+func (e *Entitlements) SetTier(clientKey, tier string) error {
+	if _, ok := e.tiers[tier]; !ok {
+		return fmt.Errorf("unknown tier %q", tier)
+	}
+	settings, err := e.settings()
+	if err != nil {
+		return err
+	}
+	return settings.SetSetting(clientKey, entitlementTierSetting, tier)
+}
+
+// Override grants or revokes a feature for the tenant regardless of its tier and license, ie for
+// trials or support cases, the store must implement storage.TenantSettings.
+func (e *Entitlements) Override(clientKey, feature string, granted bool) error {
+	settings, err := e.settings()
+	if err != nil {
+		return err
+	}
+	value := entitlementRevoked
+	if granted {
+		value = entitlementGranted
+	}
+	return settings.SetSetting(clientKey, entitlementFeatureSetting(feature), value)
+}
+
+// HasFeature returns true if the tenant is entitled to feature.
+func (e *Entitlements) HasFeature(ctx context.Context, tenant *storage.JiraInstallInformation, feature string) (bool, error) {
+	if settings, ok := e.store.(storage.TenantSettings); ok {
+		override, err := settings.GetSetting(tenant.ClientKey, entitlementFeatureSetting(feature))
+		if err != nil && !errors.Is(err, storage.ErrUnsupported) {
+			return false, fmt.Errorf("reading %s override of %s: %w", feature, tenant.ClientKey, err)
+		}
+		switch override {
+		case entitlementGranted:
+			return true, nil
+		case entitlementRevoked:
+			return false, nil
+		}
+	}
+	if e.tiers[FreeTier][feature] {
+		return true, nil
+	}
+	license, err := e.License(ctx, tenant)
+	if err != nil {
+		return false, err
+	}
+	if license == nil || !license.Active {
+		return false, nil
+	}
+	tier, err := e.Tier(tenant.ClientKey)
+	if err != nil {
+		return false, err
+	}
+	return e.tiers[tier][feature], nil
+}
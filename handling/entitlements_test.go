@@ -0,0 +1,77 @@
+package handling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_NewEntitlements(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	e := p.NewEntitlements(map[string][]string{
+		FreeTier:   {"basic"},
+		"standard": {"reports"},
+		"premium":  {"reports", "automation", "export"},
+	}, "standard")
+	now := time.Now()
+	e.now = func() time.Time { return now }
+	reads := 0
+	license := &apicommunication.AppLicense{Active: true}
+	e.license = func(ctx context.Context, jii *storage.JiraInstallInformation) (*apicommunication.AppLicense, error) {
+		reads++
+		return license, nil
+	}
+	tenant := &storage.JiraInstallInformation{ClientKey: "a", EntitlementID: "e1"}
+	has := func(feature string) bool {
+		t.Helper()
+		ok, err := e.HasFeature(context.Background(), tenant, feature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !has("basic") || !has("reports") || has("automation") {
+		t.Fatal("default tier features are wrong")
+	}
+	if err := e.SetTier("a", "premium"); err != nil {
+		t.Fatal(err)
+	}
+	if !has("automation") {
+		t.Fatal("premium tier does not include automation")
+	}
+	if err := e.SetTier("a", "gold"); err == nil {
+		t.Fatal("unknown tier was accepted")
+	}
+	if err := e.Override("a", "automation", false); err != nil {
+		t.Fatal(err)
+	}
+	if has("automation") {
+		t.Fatal("revoked feature is still available")
+	}
+
+	// the license is cached until the entitlement changes or it expires.
+	license = &apicommunication.AppLicense{Active: false}
+	if !has("reports") || reads != 1 {
+		t.Fatalf("license was read %d times", reads)
+	}
+	tenant.EntitlementID = "e2"
+	if has("reports") || !has("basic") || reads != 2 {
+		t.Fatalf("inactive license gives access, read %d times", reads)
+	}
+	if err := e.Override("a", "reports", true); err != nil {
+		t.Fatal(err)
+	}
+	if !has("reports") {
+		t.Fatal("granted feature is not available")
+	}
+	license = &apicommunication.AppLicense{Active: true}
+	now = now.Add(DefaultLicenseCacheTTL)
+	if !has("export") || reads != 3 {
+		t.Fatalf("license was not read again after expiring, read %d times", reads)
+	}
+}
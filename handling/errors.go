@@ -0,0 +1,64 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+// ErrorResponse is the body HandleErrorCode writes to clients accepting JSON, such as the front end
+// of panels, so failures can be correlated with the plugin logs.
+type ErrorResponse struct {
+	Code int `json:"code"`
+	// Message can be shown to users, it is localized if the plugin has a MessageCatalog.
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	// ClientKey is the tenant the request was made for, if it was verified before failing.
+	ClientKey string `json:"clientKey,omitempty"`
+}
+
+// acceptsJSON returns true if the Accept header of r lists a JSON media type.
+func acceptsJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeErrorResponse writes an ErrorResponse for st with the passed message.
+func writeErrorResponse(st int, message string, w http.ResponseWriter, r *http.Request) error {
+	body := ErrorResponse{
+		Code:      st,
+		Message:   message,
+		RequestID: apicommunication.RequestIDFromContext(r.Context()),
+	}
+	if jii, ok := TenantFromContext(r.Context()); ok {
+		body.ClientKey = jii.ClientKey
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(st)
+	return json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,149 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// AddWebhookHandler adds another handler for an event registered with AddWebhook, so separate
+// features can handle the same event independently. Every handler receives the webhook, see
+// SetConcurrentWebhookHandlers, and is served by the route of the event.
+func (p *Plugin) AddWebhookHandler(event string, f JiraHandleFunc) error {
+	if _, exists := p.webhooks[event]; !exists {
+		return fmt.Errorf("%s event must be registered with AddWebhook first", event)
+	}
+	p.webhookHandlers[event] = append(p.webhookHandlers[event], f)
+	return nil
+}
+
+// SetConcurrentWebhookHandlers makes the handlers of events with more than one (see AddWebhookHandler)
+// run concurrently instead of one after the other in registration order.
+func (p *Plugin) SetConcurrentWebhookHandlers(concurrent bool) {
+	p.concurrentWebhookHandlers = concurrent
+}
+
+// fanOutContextKey carries a *fanOutRun in the context of webhook requests.
+type fanOutContextKey struct{}
+
+// fanOutRun restricts the handlers fanOut invokes for a request to only, unless empty, and collects
+// the indexes of the ones that failed, so AsyncWebhooks and ReplayDeadLetter run only those again.
+type fanOutRun struct {
+	only   []int
+	failed []int
+}
+
+func withFanOutRun(ctx context.Context, only []int) (context.Context, *fanOutRun) {
+	run := &fanOutRun{only: only}
+	return context.WithValue(ctx, fanOutContextKey{}, run), run
+}
+
+// fanOut returns a handler invoking every one of handlers with its own copy of the request and
+// buffered response. All of them run even if some fail or panic, panics are recovered like in the
+// plugin Router, failures (status >= 400) are logged and the response of the first one that failed
+// is sent, or the response of the first handler if none did.
+// If the request context carries a fanOutRun only the handlers it lists run, indexes that are no
+// longer registered are ignored and every handler runs if none is left.
+func (p *Plugin) fanOut(event string, handlers []JiraHandleFunc) JiraHandleFunc {
+	concurrent := p.concurrentWebhookHandlers
+	return func(jii *storage.JiraInstallInformation, store storage.Store, w http.ResponseWriter, r *http.Request) {
+		fr, _ := r.Context().Value(fanOutContextKey{}).(*fanOutRun)
+		var selected []int
+		if fr != nil {
+			for _, i := range fr.only {
+				if i >= 0 && i < len(handlers) {
+					selected = append(selected, i)
+				}
+			}
+		}
+		if len(selected) == 0 {
+			selected = make([]int, len(handlers))
+			for i := range handlers {
+				selected[i] = i
+			}
+		}
+		var body []byte
+		if r.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(r.Body); err != nil {
+				p.logger.Printf("ERROR: reading %s webhook body: %v", event, err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		recorders := make([]*responseRecorder, len(selected))
+		run := func(i int) {
+			req := r.Clone(r.Context())
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			recorders[i] = newResponseRecorder()
+			// a panicking handler fails on its own instead of taking the others down with it.
+			p.recoverHandleFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlers[selected[i]](jii, store, w, r)
+			})(recorders[i], req)
+		}
+		if concurrent {
+			var wg sync.WaitGroup
+			aborted := make([]bool, len(selected))
+			for i := range selected {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					// only http.ErrAbortHandler makes it past recoverHandleFunc, it is raised again
+					// below from the goroutine serving the request.
+					defer func() { aborted[i] = recover() != nil }()
+					run(i)
+				}(i)
+			}
+			wg.Wait()
+			for _, abort := range aborted {
+				if abort {
+					panic(http.ErrAbortHandler)
+				}
+			}
+		} else {
+			for i := range selected {
+				run(i)
+			}
+		}
+
+		chosen := recorders[0]
+		failed := false
+		for i, rec := range recorders {
+			if rec.code < http.StatusBadRequest {
+				continue
+			}
+			p.logger.Printf("ERROR: handler %d of %s webhook failed with status %d: %s",
+				selected[i], event, rec.code, rec.body.String())
+			if fr != nil {
+				fr.failed = append(fr.failed, selected[i])
+			}
+			if !failed {
+				chosen, failed = rec, true
+			}
+		}
+		for k, v := range chosen.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(chosen.code)
+		w.Write(chosen.body.Bytes())
+	}
+}
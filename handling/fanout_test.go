@@ -0,0 +1,86 @@
+package handling
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_AddWebhookHandler(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		p := newPlugin(t, fakeHandleFunc)
+		p.SetConcurrentWebhookHandlers(concurrent)
+		if err := p.AddWebhookHandler(JiraIssueDeleted, fakeHandleFunc); err == nil {
+			t.Fatal("handler for an unregistered event was accepted")
+		}
+		var mu sync.Mutex
+		var bodies []string
+		reading := func(status int) JiraHandleFunc {
+			return func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				mu.Lock()
+				bodies = append(bodies, string(b))
+				mu.Unlock()
+				w.WriteHeader(status)
+			}
+		}
+		for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+			if err := p.AddWebhookHandler(JiraIssueUpdated, reading(status)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		handler, _ := p.webhookHandler(JiraIssueUpdated)
+		w := httptest.NewRecorder()
+		handler(nil, p.store, w, httptest.NewRequest(http.MethodPost, "/issue_updated", strings.NewReader("payload")))
+		if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+			t.Fatalf("handlers read %q", bodies)
+		}
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected the failure to be reported, got %d", w.Code)
+		}
+	}
+}
+
+func TestPlugin_AddWebhookHandler_panic(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		p := newPlugin(t, fakeHandleFunc)
+		p.SetConcurrentWebhookHandlers(concurrent)
+		var mu sync.Mutex
+		var panics []interface{}
+		p.OnPanic(func(_ *http.Request, _ string, recovered interface{}, _ []byte) {
+			mu.Lock()
+			panics = append(panics, recovered)
+			mu.Unlock()
+		})
+		ran := false
+		err := p.AddWebhookHandler(JiraIssueUpdated,
+			func(_ *storage.JiraInstallInformation, _ storage.Store, _ http.ResponseWriter, _ *http.Request) {
+				panic("boom")
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.AddWebhookHandler(JiraIssueUpdated,
+			func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, _ *http.Request) {
+				ran = true
+				w.WriteHeader(http.StatusNoContent)
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler, _ := p.webhookHandler(JiraIssueUpdated)
+		w := httptest.NewRecorder()
+		handler(nil, p.store, w, httptest.NewRequest(http.MethodPost, "/issue_updated", strings.NewReader("payload")))
+		if w.Code != http.StatusInternalServerError || !ran {
+			t.Fatalf("answered %d, other handler ran: %v", w.Code, ran)
+		}
+		if len(panics) != 1 || panics[0] != "boom" {
+			t.Fatalf("reported panics %v", panics)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package handlingtest provides helpers to exercise a handling.Plugin in tests the way atlassian
+// would, with signed lifecycle and webhook requests.
+package handlingtest
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/handling"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+// NewTenant returns the install information of a jira cloud tenant with a random shared secret.
+func NewTenant(t testing.TB, key, clientKey string) *storage.JiraInstallInformation {
+	return &storage.JiraInstallInformation{
+		Key:          key,
+		ClientKey:    clientKey,
+		SharedSecret: randomHex(t, 32),
+		BaseURL:      "https://" + clientKey + ".atlassian.net",
+		ProductType:  apicommunication.ProductTypeJira,
+		Description:  "Atlassian JIRA at https://" + clientKey + ".atlassian.net",
+	}
+}
+
+// Flow drives the lifecycle of a tenant against a plugin: install, enable, webhooks, disable and
+// uninstall. Requests are signed with the tenant shared secret, so signed installs
+// (APIMigrations.SignedInstall) can not be simulated.
+type Flow struct {
+	t       testing.TB
+	plugin  *handling.Plugin
+	handler http.Handler
+	// Tenant is the install information sent on install, requests are signed with its shared secret.
+	Tenant *storage.JiraInstallInformation
+}
+
+// NewFlow returns a Flow for tenant against the Router of p, p must be fully configured.
+func NewFlow(t testing.TB, p *handling.Plugin, tenant *storage.JiraInstallInformation) *Flow {
+	return &Flow{
+		t:       t,
+		plugin:  p,
+		handler: p.Router(nil),
+		Tenant:  tenant,
+	}
+}
+
+// Install sends the installed lifecycle event with the tenant install information.
+func (f *Flow) Install() *httptest.ResponseRecorder {
+	return f.lifecycle(handling.LCInstalled, "installed")
+}
+
+// Enable sends the enabled lifecycle event.
+func (f *Flow) Enable() *httptest.ResponseRecorder {
+	return f.lifecycle(handling.LCEnabled, "enabled")
+}
+
+// Disable sends the disabled lifecycle event.
+func (f *Flow) Disable() *httptest.ResponseRecorder {
+	return f.lifecycle(handling.LCDisabled, "disabled")
+}
+
+// Uninstall sends the uninstalled lifecycle event.
+func (f *Flow) Uninstall() *httptest.ResponseRecorder {
+	return f.lifecycle(handling.LCUnInstalled, "uninstalled")
+}
+
+func (f *Flow) lifecycle(lce handling.LifeCycleEvents, eventType string) *httptest.ResponseRecorder {
+	route, ok := f.plugin.LifecycleRoute(lce)
+	if !ok {
+		f.t.Fatalf("the plugin does not handle the %s lifecycle event", eventType)
+	}
+	payload := *f.Tenant
+	payload.EventType = eventType
+	body, err := storage.MarshalWithSecrets(&payload)
+	if err != nil {
+		f.t.Fatalf("marshaling install information: %v", err)
+	}
+	return f.Do(http.MethodPost, route, bytes.NewReader(body))
+}
+
+// Webhook sends payload, marshaled to JSON, to the handler of the webhook event.
+func (f *Flow) Webhook(event string, payload interface{}) *httptest.ResponseRecorder {
+	route, ok := f.plugin.WebhookRoute(event)
+	if !ok {
+		f.t.Fatalf("the plugin does not handle the %s webhook", event)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		f.t.Fatalf("marshaling %s webhook payload: %v", event, err)
+	}
+	return f.Do(http.MethodPost, route, bytes.NewReader(body))
+}
+
+// Do sends a request signed by the tenant to the plugin and returns the recorded response.
+func (f *Flow) Do(method, target string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	Sign(f.t, req, f.Tenant, "")
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// Sign adds to req the JWT atlassian would send on behalf of the tenant, impersonating the user
+// with the passed account ID if not empty.
+func Sign(t testing.TB, req *http.Request, tenant *storage.JiraInstallInformation, accountID string) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": tenant.ClientKey,
+		"iat": now.Unix(),
+		"exp": now.Add(3 * time.Minute).Unix(),
+		"qsh": apicommunication.QueryStringHash(req.Method, req.URL, ""),
+		"jti": randomHex(t, 16),
+	}
+	if accountID != "" {
+		claims["sub"] = accountID
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(tenant.SharedSecret))
+	if err != nil {
+		t.Fatalf("signing request: %v", err)
+	}
+	req.Header.Set("Authorization", "JWT "+signed)
+}
+
+func randomHex(t testing.TB, n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("reading random bytes: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package handlingtest
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/handling"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+type mapStore struct {
+	mu      sync.Mutex
+	tenants map[string]*storage.JiraInstallInformation
+}
+
+func (s *mapStore) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[jii.ClientKey] = jii
+	return nil
+}
+
+func (s *mapStore) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tenants[clientKey], nil
+}
+
+func TestFlow(t *testing.T) {
+	store := &mapStore{tenants: map[string]*storage.JiraInstallInformation{}}
+	p := handling.NewPlugin("test", "a test plugin", "io.shiftleft.test", "https://invalidurl.shiftleft.io",
+		"/api", store, log.New(ioutil.Discard, "", 0), []string{"READ"}, handling.Vendor{}, false)
+	p.SetInstallAllowedHosts()
+	if err := p.AddLifecycleEvent(handling.LCInstalled, "/installed", p.HandleInstall); err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	record := func(jii *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, r *http.Request) {
+		events = append(events, jii.ClientKey+" "+r.URL.Path)
+	}
+	if err := p.AddLifecycleEvent(handling.LCUnInstalled, "/uninstalled", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddWebhook("jira:issue_created", handling.NewRoutePath("/issue_created", nil), record); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFlow(t, p, NewTenant(t, "io.shiftleft.test", "tenant"))
+	if rec := f.Install(); rec.Code != http.StatusNoContent {
+		t.Fatalf("install answered %d", rec.Code)
+	}
+	// re-installs must be signed with the stored secret
+	if rec := f.Install(); rec.Code != http.StatusNoContent {
+		t.Fatalf("re-install answered %d", rec.Code)
+	}
+	if rec := f.Webhook("jira:issue_created", map[string]string{"webhookEvent": "jira:issue_created"}); rec.Code != http.StatusOK {
+		t.Fatalf("webhook answered %d", rec.Code)
+	}
+	if rec := f.Uninstall(); rec.Code != http.StatusOK {
+		t.Fatalf("uninstall answered %d", rec.Code)
+	}
+	want := []string{"tenant /api/issue_created", "tenant /api/uninstalled"}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Fatalf("handled %v, want %v", events, want)
+	}
+}
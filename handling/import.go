@@ -0,0 +1,115 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ImportModules merges module definitions maintained outside of the code, ie by a front end team,
+// into the registered modules. modulesJSON has the shape of the modules section of the descriptor,
+// module keys must be unique across the plugin and webhooks can not be imported since they need a
+// handler. Nothing is imported if any module is rejected.
+func (p *Plugin) ImportModules(modulesJSON []byte) error {
+	var imported map[string][]json.RawMessage
+	if err := json.Unmarshal(modulesJSON, &imported); err != nil {
+		return fmt.Errorf("decoding modules: %w", err)
+	}
+	keys := map[string]string{}
+	for _, s := range p.moduleStates(nil) {
+		keys[s.Key] = s.Type
+	}
+	moduleTypes := make([]string, 0, len(imported))
+	for moduleType := range imported {
+		moduleTypes = append(moduleTypes, moduleType)
+	}
+	sort.Strings(moduleTypes)
+
+	var apply []func() error
+	for _, moduleType := range moduleTypes {
+		moduleType, modules := moduleType, imported[moduleType]
+		if moduleType == webhooksKey {
+			return fmt.Errorf("webhooks can not be imported, register them with AddWebhook")
+		}
+		for i, raw := range modules {
+			var keyed struct {
+				Key string `json:"key"`
+			}
+			if err := json.Unmarshal(raw, &keyed); err != nil || keyed.Key == "" {
+				return fmt.Errorf("module %d of %s has no key", i, moduleType)
+			}
+			if other, exists := keys[keyed.Key]; exists {
+				return fmt.Errorf("module key %s of %s is already used in %s", keyed.Key, moduleType, other)
+			}
+			keys[keyed.Key] = moduleType
+		}
+		switch existing := p.ac.Modules[moduleType].(type) {
+		case []JiraIssueFields:
+			fields := make([]JiraIssueFields, len(modules))
+			for i, raw := range modules {
+				if err := json.Unmarshal(raw, &fields[i]); err != nil {
+					return fmt.Errorf("decoding %s module: %w", moduleType, err)
+				}
+			}
+			apply = append(apply, func() error {
+				for _, f := range fields {
+					if err := p.AddJiraIssueField(f); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		case []WebPanel:
+			panels := make([]WebPanel, len(modules))
+			for i, raw := range modules {
+				if err := json.Unmarshal(raw, &panels[i]); err != nil {
+					return fmt.Errorf("decoding %s module: %w", moduleType, err)
+				}
+			}
+			apply = append(apply, func() error {
+				for _, wp := range panels {
+					if err := p.AddWebPanel(moduleType, wp); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		case nil, []interface{}:
+			merged, _ := existing.([]interface{})
+			merged = append([]interface{}(nil), merged...)
+			for _, raw := range modules {
+				var m map[string]interface{}
+				if err := json.Unmarshal(raw, &m); err != nil {
+					return fmt.Errorf("decoding %s module: %w", moduleType, err)
+				}
+				merged = append(merged, m)
+			}
+			apply = append(apply, func() error {
+				p.ac.Modules[moduleType] = merged
+				return nil
+			})
+		default:
+			return fmt.Errorf("modules of type %s can not be imported into %T", moduleType, existing)
+		}
+	}
+	for _, f := range apply {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
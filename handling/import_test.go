@@ -0,0 +1,28 @@
+package handling
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlugin_ImportModules(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	err := p.ImportModules([]byte(`{"generalPages": [{"key": "A_Field", "url": "/page"}]}`))
+	if err == nil || !strings.Contains(err.Error(), "already used in jiraIssueFields") {
+		t.Fatalf("key conflict was not detected: %v", err)
+	}
+	if _, ok := p.ac.Modules["generalPages"]; ok {
+		t.Fatal("modules were partially imported")
+	}
+	err = p.ImportModules([]byte(`{"generalPages": [{"key": "a-page", "url": "/page"}],
+		"webPanels": [{"key": "imported-panel", "location": "atl.jira.view.issue.right.context"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := p.ac.Modules["generalPages"].([]interface{}); len(pages) != 1 {
+		t.Fatalf("imported pages are %v", pages)
+	}
+	if len(p.arbitraryWebPanels["webPanels"]) != 2 {
+		t.Fatalf("web panels are %v", p.arbitraryWebPanels["webPanels"])
+	}
+}
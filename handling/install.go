@@ -0,0 +1,306 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// DecodeInstallInformation reads the install payload sent by jira to the installed lifecycle
+// event from the request body, normalizes and validates it so it is safe to store.
+func DecodeInstallInformation(r *http.Request) (*storage.JiraInstallInformation, error) {
+	jii := &storage.JiraInstallInformation{}
+	if err := json.NewDecoder(r.Body).Decode(jii); err != nil {
+		return nil, fmt.Errorf("decoding install information: %w", err)
+	}
+	jii.Normalize()
+	// the previous secret is ours to keep, it must not be set by whoever sends the payload.
+	jii.PreviousSharedSecret, jii.PreviousSharedSecretExpiry = "", 0
+	if err := jii.Validate(); err != nil {
+		return nil, fmt.Errorf("validating install information: %w", err)
+	}
+	return jii, nil
+}
+
+// SetInstallAllowedHosts sets the domains (see apicommunication.HostAllowed) the base URL of unsigned
+// installs handled by HandleInstall must belong to, it defaults to apicommunication.AtlassianHostSuffixes.
+// Passing none disables the check, which is only advisable for development.
+func (p *Plugin) SetInstallAllowedHosts(suffixes ...string) {
+	p.installAllowedHosts = suffixes
+}
+
+func verifyInstallOrigin(jii *storage.JiraInstallInformation, allowed []string) error {
+	u, err := url.Parse(jii.BaseURL)
+	if err != nil {
+		return fmt.Errorf("parsing base URL: %w", err)
+	}
+	if u.Scheme != "https" || !apicommunication.HostAllowed(u.Host, allowed) {
+		return fmt.Errorf("base URL %q is not an allowed https host", jii.BaseURL)
+	}
+	return nil
+}
+
+// InstallCallback is invoked with the install information of a tenant after it was stored.
+type InstallCallback func(ctx context.Context, jii *storage.JiraInstallInformation) error
+
+// OnFirstInstall sets a callback invoked by HandleInstall the first time a tenant installs the plugin,
+// which is the place to create webhooks, app properties, custom fields and such.
+// It runs asynchronously once jira was answered, since the plugin is not considered installed by
+// jira until then and calls to its API would fail.
+func (p *Plugin) OnFirstInstall(f InstallCallback) {
+	p.onFirstInstall = f
+}
+
+// DefaultSecretRotationGrace is how long HandleInstall keeps accepting the previous shared secret
+// of a tenant that rotated it, unless changed with SetSecretRotationGrace.
+const DefaultSecretRotationGrace = 10 * time.Minute
+
+// SecretRotationCallback is invoked with the install information of a tenant before and after it
+// rotated its shared secret.
+type SecretRotationCallback func(ctx context.Context, previous, current *storage.JiraInstallInformation) error
+
+// SetSecretRotationGrace sets how long the previous shared secret of a tenant is accepted once it
+// re-installs with a new one, so requests signed by atlassian before the rotation, or validated by
+// replicas that did not see it yet, are not refused. Passing 0 stops accepting it right away.
+func (p *Plugin) SetSecretRotationGrace(grace time.Duration) {
+	p.secretRotationGrace = grace
+}
+
+// OnSecretRotation sets a callback invoked by HandleInstall when a tenant re-installs with a new shared
+// secret, ie to refresh secrets cached outside the store. It runs asynchronously once jira was answered.
+func (p *Plugin) OnSecretRotation(f SecretRotationCallback) {
+	p.onSecretRotation = f
+}
+
+// rotateSecret keeps the shared secret of existing as the previous one of jii if it changed, or
+// carries over the previous secret of existing if it is still valid, and returns whether it rotated.
+func (p *Plugin) rotateSecret(existing, jii *storage.JiraInstallInformation) bool {
+	now := time.Now()
+	if existing.SharedSecret == jii.SharedSecret {
+		if existing.PreviousSharedSecretValid(now) {
+			jii.PreviousSharedSecret = existing.PreviousSharedSecret
+			jii.PreviousSharedSecretExpiry = existing.PreviousSharedSecretExpiry
+		}
+		return false
+	}
+	if p.secretRotationGrace > 0 {
+		jii.PreviousSharedSecret = existing.SharedSecret
+		jii.PreviousSharedSecretExpiry = now.Add(p.secretRotationGrace).Unix()
+	}
+	return true
+}
+
+// SetInvalidation makes HandleInstall invalidate the state cached for installing tenants in every
+// replica through inv, which should watch the plugin store and the ClientManagers in use.
+func (p *Plugin) SetInvalidation(inv *apicommunication.Invalidation) {
+	p.invalidation = inv
+}
+
+// HandleInstall is a JiraHandleFunc for the LCInstalled lifecycle event that decodes and stores
+// the install information, recording it if the store implements storage.InstallHistory, invoking the
+// OnFirstInstall callback if the tenant is new, the OnSecretRotation one if it changed its shared
+// secret (see SetSecretRotationGrace) and capturing a snapshot of the tenant if EnableInstallSnapshots
+// was called.
+// Re-installs must be signed with the previously stored shared secret when the plugin does not use
+// signed installs, to prevent anyone from overwriting a tenant's secret.
+// Installs from a product other than the one of the plugin (see SetProductType) are refused.
+// The install information is read and saved holding the lock of the tenant if the store implements
+// storage.Locker, so concurrent installed events are handled one after the other.
+func (p *Plugin) HandleInstall(_ *storage.JiraInstallInformation, store storage.Store,
+	w http.ResponseWriter, r *http.Request) {
+	jii, err := DecodeInstallInformation(r)
+	if err != nil {
+		p.logger.Printf("ERROR: %v", err)
+		p.HandleErrorCode(http.StatusBadRequest, w, r)
+		return
+	}
+	if jii.ProductType != p.productType {
+		p.logger.Printf("ERROR: refusing install of %s: this is a %s plugin and the host is %s",
+			jii.ClientKey, p.productType, jii.ProductType)
+		p.HandleErrorCode(http.StatusBadRequest, w, r)
+		return
+	}
+	if !p.ac.APIMigrations.SignedInstall && len(p.installAllowedHosts) > 0 {
+		if err := verifyInstallOrigin(jii, p.installAllowedHosts); err != nil {
+			p.logger.Printf("ERROR: refusing install of %s: %v", jii.ClientKey, err)
+			p.HandleErrorCode(http.StatusForbidden, w, r)
+			return
+		}
+	}
+	var existing *storage.JiraInstallInformation
+	var rotated bool
+	// replicas receiving the installed event at once must not interleave their reads and writes.
+	status := http.StatusInternalServerError
+	err = storage.WithLock(store, jii.ClientKey, func() error {
+		var failed int
+		var err error
+		if existing, rotated, failed, err = p.saveInstall(store, jii, r); err != nil {
+			status = failed
+		}
+		return err
+	})
+	if err != nil {
+		p.logger.Printf("ERROR: %v", err)
+		p.HandleErrorCode(status, w, r)
+		return
+	}
+	firstInstall := existing == nil
+	if p.invalidation != nil {
+		if err := p.invalidation.Invalidate(r.Context(), jii.ClientKey); err != nil {
+			p.logger.Printf("ERROR: %v", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	if p.installSnapshots {
+		go func() {
+			if err := p.captureInstallSnapshot(context.Background(), jii); err != nil {
+				p.logger.Printf("ERROR: capturing install snapshot of %s: %v", jii.ClientKey, err)
+			}
+		}()
+	}
+	if rotated {
+		p.logger.Printf("INFO: %s rotated its shared secret from %s to %s", jii.ClientKey,
+			storage.Fingerprint(existing.SharedSecret), storage.Fingerprint(jii.SharedSecret))
+		if p.onSecretRotation != nil {
+			go func() {
+				if err := p.onSecretRotation(context.Background(), existing, jii); err != nil {
+					p.logger.Printf("ERROR: secret rotation callback for %s: %v", jii.ClientKey, err)
+				}
+			}()
+		}
+	}
+	if firstInstall && p.onFirstInstall != nil {
+		go func() {
+			if err := p.onFirstInstall(context.Background(), jii); err != nil {
+				p.logger.Printf("ERROR: first install callback for %s: %v", jii.ClientKey, err)
+			}
+		}()
+	}
+}
+
+// saveInstall saves jii, and records it in the install history, if the tenant may install. It
+// returns the install information it replaced, whether the shared secret was rotated and, if it
+// fails, the status to answer with.
+func (p *Plugin) saveInstall(store storage.Store, jii *storage.JiraInstallInformation,
+	r *http.Request) (*storage.JiraInstallInformation, bool, int, error) {
+	existing, err := store.JiraInstallInformation(jii.ClientKey)
+	if err != nil {
+		return nil, false, http.StatusInternalServerError,
+			fmt.Errorf("reading jira install information for %s: %w", jii.ClientKey, err)
+	}
+	if existing != nil && !p.ac.APIMigrations.SignedInstall {
+		_, claims, err := apicommunication.ValidateRequestClaims(r, store)
+		if err != nil {
+			return nil, false, http.StatusUnauthorized,
+				fmt.Errorf("re-install of %s is not signed with its shared secret: %w", jii.ClientKey, err)
+		}
+		// a token of another tenant must not replace the secret of this one.
+		if claims.Issuer != jii.ClientKey {
+			return nil, false, http.StatusUnauthorized,
+				fmt.Errorf("re-install of %s is signed by %s", jii.ClientKey, claims.Issuer)
+		}
+	}
+	rotated := existing != nil && p.rotateSecret(existing, jii)
+	if err := store.SaveJiraInstallInformation(jii); err != nil {
+		return nil, false, http.StatusInternalServerError,
+			fmt.Errorf("saving jira install information for %s: %w", jii.ClientKey, err)
+	}
+	p.recordInstall(store, jii, storage.HistoryEventInstalled)
+	return existing, rotated, 0, nil
+}
+
+// PrefetchInstallations warms the cache of the plugin store with every installation, it is meant
+// to be invoked at boot and requires the store to implement both storage.Lister and storage.Preloader,
+// as caching stores wrapping a listable one do.
+func (p *Plugin) PrefetchInstallations(ctx context.Context) (int, error) {
+	if !storage.Supports(p.store, (*storage.Lister)(nil)) {
+		return 0, fmt.Errorf("%T can not list installations", p.store)
+	}
+	preloader, ok := p.store.(storage.Preloader)
+	if !ok {
+		return 0, fmt.Errorf("%T does not cache installations", p.store)
+	}
+	lister := p.store.(storage.Lister)
+	count, err := storage.Prefetch(ctx, lister, preloader, storage.DefaultPrefetchPageSize)
+	if err != nil {
+		return count, err
+	}
+	p.logger.Printf("INFO: prefetched %d installations", count)
+	return count, nil
+}
+
+// HandleUninstall is a JiraHandleFunc for the LCUnInstalled lifecycle event that deletes the install
+// information of the tenant, so its tokens are no longer accepted, if the store implements
+// storage.Deleter. Otherwise the tenant lingers in the store and a warning is logged.
+func (p *Plugin) HandleUninstall(jii *storage.JiraInstallInformation, store storage.Store,
+	w http.ResponseWriter, r *http.Request) {
+	deleter, ok := store.(storage.Deleter)
+	var err error
+	if ok {
+		err = deleter.DeleteJiraInstallInformation(jii.ClientKey)
+	}
+	if !ok || errors.Is(err, storage.ErrUnsupported) {
+		p.logger.Printf("WARNING: %T can not delete install information, %s is uninstalled but kept",
+			store, jii.ClientKey)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		p.logger.Printf("ERROR: deleting jira install information for %s: %v", jii.ClientKey, err)
+		p.HandleErrorCode(http.StatusInternalServerError, w, r)
+		return
+	}
+	p.recordInstall(store, jii, storage.HistoryEventUninstalled)
+	if p.invalidation != nil {
+		if err := p.invalidation.Invalidate(r.Context(), jii.ClientKey); err != nil {
+			p.logger.Printf("ERROR: %v", err)
+		}
+	}
+	p.logger.Printf("INFO: deleted install information of uninstalled tenant %s", jii.ClientKey)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordInstall appends jii to the install history of the tenant if store keeps one, failures are
+// logged since the history is informative.
+func (p *Plugin) recordInstall(store storage.Store, jii *storage.JiraInstallInformation, eventType string) {
+	history, ok := store.(storage.InstallHistory)
+	if !ok {
+		return
+	}
+	err := history.RecordInstall(storage.NewInstallRecord(jii, eventType, time.Now()))
+	if err != nil && !errors.Is(err, storage.ErrUnsupported) {
+		p.logger.Printf("ERROR: recording %s of %s in the install history: %v", eventType, jii.ClientKey, err)
+	}
+}
+
+// InstallHistory returns every recorded version of the install information of the tenant, oldest
+// first, which requires the store to implement storage.InstallHistory.
+func (p *Plugin) InstallHistory(clientKey string) ([]*storage.InstallRecord, error) {
+	if !storage.Supports(p.store, (*storage.InstallHistory)(nil)) {
+		return nil, fmt.Errorf("%T does not keep install history", p.store)
+	}
+	history := p.store.(storage.InstallHistory)
+	return history.InstallHistory(clientKey)
+}
@@ -0,0 +1,354 @@
+package handling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestDecodeInstallInformation(t *testing.T) {
+	r := httptest.NewRequest("POST", "/installed", strings.NewReader(`{
+		"key": "io.shiftleft.app",
+		"clientKey": " a-client ",
+		"sharedSecret": "secret",
+		"baseUrl": "https://acme.atlassian.net/",
+		"productType": "Jira",
+		"eventType": "installed",
+		"previousSharedSecret": "planted",
+		"previousSharedSecretExpiry": 4102444800
+	}`))
+	jii, err := DecodeInstallInformation(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jii.ClientKey != "a-client" || jii.BaseURL != "https://acme.atlassian.net" || jii.ProductType != "jira" {
+		t.Fatalf("install information was not normalized: %+v", jii)
+	}
+	if jii.PreviousSharedSecret != "" || jii.PreviousSharedSecretExpiry != 0 {
+		t.Fatal("the previous shared secret was taken from the payload")
+	}
+
+	for name, body := range map[string]string{
+		"not json":       `{"key":`,
+		"missing secret": `{"key":"k","clientKey":"c","baseUrl":"https://acme.atlassian.net","productType":"jira"}`,
+		"bad url":        `{"key":"k","clientKey":"c","sharedSecret":"s","baseUrl":"acme","productType":"jira"}`,
+	} {
+		if _, err := DecodeInstallInformation(httptest.NewRequest("POST", "/installed", strings.NewReader(body))); err == nil {
+			t.Errorf("%s: payload was accepted", name)
+		}
+	}
+}
+
+func TestPlugin_HandleInstallAllowedHosts(t *testing.T) {
+	p := newPlugin(t, nil)
+	p.store = storage.NewMemoryStore(0)
+	install := func(clientKey, baseURL string) int {
+		payload := `{"key": "io.something.very.uniqye", "clientKey": "` + clientKey + `", "sharedSecret": "secret",
+			"baseUrl": "` + baseURL + `", "productType": "jira", "eventType": "installed"}`
+		rec := httptest.NewRecorder()
+		p.HandleInstall(nil, p.store, rec, httptest.NewRequest(http.MethodPost, "/installed", strings.NewReader(payload)))
+		return rec.Code
+	}
+
+	for clientKey, baseURL := range map[string]string{
+		"evil":   "https://atlassian.net.evil.example.com",
+		"plain":  "http://acme.atlassian.net",
+		"suffix": "https://evilatlassian.net",
+	} {
+		if code := install(clientKey, baseURL); code != http.StatusForbidden {
+			t.Fatalf("install from %s answered %d", baseURL, code)
+		}
+		if stored, _ := p.store.JiraInstallInformation(clientKey); stored != nil {
+			t.Fatalf("install from %s was stored", baseURL)
+		}
+	}
+	if code := install("acme", "https://acme.atlassian.net"); code != http.StatusNoContent {
+		t.Fatalf("install from an atlassian host answered %d", code)
+	}
+
+	p.SetInstallAllowedHosts()
+	if code := install("local", "http://localhost:2990/jira"); code != http.StatusNoContent {
+		t.Fatalf("install with the check disabled answered %d", code)
+	}
+}
+
+func TestPlugin_servesInstall(t *testing.T) {
+	var sentJII storage.JiraInstallInformation
+	hf := func(jii *storage.JiraInstallInformation, store storage.Store, w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-type", "application/json")
+		// jii is nil here
+		err := json.NewDecoder(r.Body).Decode(&sentJII)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	initialJii := &storage.JiraInstallInformation{
+		UserAccount:    "uaccount",
+		Key:            "ukey",
+		ClientKey:      "ckey",
+		OauthClientID:  "sdadsadsadas",
+		PublicKey:      "kasdhaskdjhaksjhdka",
+		SharedSecret:   "kiasjhdkajhdkajshd",
+		ServerVersion:  "1",
+		PluginsVersion: "2",
+		BaseURL:        "http://www.atlassian.net",
+		ProductType:    "jira",
+		Description:    "a jira plugin",
+		EventType:      "installed",
+	}
+
+	t.Run("serves install", func(t *testing.T) {
+		p := newPlugin(t, hf)
+		w := &bytes.Buffer{}
+		if err := p.renderAtlassianConnectJSON(w); err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(p.Router(nil))
+		defer ts.Close()
+		bodyBytes, err := json.MarshalIndent(initialJii, "", "    ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/path/to/api/installed", bytes.NewReader(bodyBytes))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%#v", err)
+		}
+		if res.StatusCode != 200 {
+			t.Logf("server responded %d", res.StatusCode)
+			t.FailNow()
+		}
+
+		marshalledSentJii, err := json.MarshalIndent(sentJII, "", "    ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(marshalledSentJii) != string(bodyBytes) {
+			t.Logf("%s\nis different from\n%s", marshalledSentJii, bodyBytes)
+			t.FailNow()
+		}
+
+	})
+
+}
+
+func TestPlugin_HandleInstall(t *testing.T) {
+	installPayload := []byte(`{"key": "io.something.very.uniqye", "clientKey": "ckey",
+		"sharedSecret": "kiasjhdkajhdkajshd", "baseUrl": "https://example.atlassian.net/",
+		"productType": "JIRA", "eventType": "installed"}`)
+	firstInstalls := make(chan *storage.JiraInstallInformation, 1)
+
+	p := newPlugin(t, nil)
+	if err := p.UpdateLifecycleEvent(LCInstalled, "/installed", p.HandleInstall); err != nil {
+		t.Fatal(err)
+	}
+	p.OnFirstInstall(func(ctx context.Context, jii *storage.JiraInstallInformation) error {
+		firstInstalls <- jii
+		return nil
+	})
+	ts := httptest.NewServer(p.Router(nil))
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"/path/to/api/installed", "application/json", bytes.NewReader(installPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 on first install, got %d", res.StatusCode)
+	}
+	select {
+	case jii := <-firstInstalls:
+		if jii.BaseURL != "https://example.atlassian.net" || jii.ProductType != "jira" {
+			t.Errorf("install information was not normalized: %#v", jii)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("first install callback was not invoked")
+	}
+
+	res, err = http.Post(ts.URL+"/path/to/api/installed", "application/json", bytes.NewReader(installPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unsigned re-install to be rejected with 401, got %d", res.StatusCode)
+	}
+}
+
+func TestPlugin_HandleInstallCrossTenant(t *testing.T) {
+	p := newPlugin(t, nil)
+	p.store = storage.NewMemoryStore(0)
+	tenantA := &storage.JiraInstallInformation{ClientKey: "tenant-a", SharedSecret: "secret-of-a",
+		BaseURL: "https://a.atlassian.net", ProductType: "jira"}
+	tenantB := &storage.JiraInstallInformation{ClientKey: "tenant-b", SharedSecret: "secret-of-b",
+		BaseURL: "https://b.atlassian.net", ProductType: "jira"}
+	for _, jii := range []*storage.JiraInstallInformation{tenantA, tenantB} {
+		if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reinstall := func(signer *storage.JiraInstallInformation) int {
+		payload := `{"key": "io.something.very.uniqye", "clientKey": "tenant-b", "sharedSecret": "new-secret",
+			"baseUrl": "https://b.atlassian.net", "productType": "jira", "eventType": "installed"}`
+		req := signedRequest(t, http.MethodPost, "/installed", signer)
+		req.Body = ioutil.NopCloser(strings.NewReader(payload))
+		rec := httptest.NewRecorder()
+		p.HandleInstall(nil, p.store, rec, req)
+		return rec.Code
+	}
+
+	if code := reinstall(tenantA); code != http.StatusUnauthorized {
+		t.Fatalf("re-install of tenant-b signed by tenant-a got %d", code)
+	}
+	stored, err := p.store.JiraInstallInformation("tenant-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SharedSecret != "secret-of-b" {
+		t.Fatalf("tenant-b secret was replaced by %q", stored.SharedSecret)
+	}
+	if code := reinstall(tenantB); code != http.StatusNoContent {
+		t.Fatalf("re-install of tenant-b signed by itself got %d", code)
+	}
+}
+
+func TestPlugin_HandleInstallRotatesSecret(t *testing.T) {
+	p := newPlugin(t, nil)
+	store := storage.NewMemoryStore(0)
+	p.store = store
+	existing := &storage.JiraInstallInformation{Key: "io.something.very.uniqye", ClientKey: "ckey",
+		SharedSecret: "old-secret", BaseURL: "https://example.atlassian.net", ProductType: "jira"}
+	if err := store.SaveJiraInstallInformation(existing); err != nil {
+		t.Fatal(err)
+	}
+	rotations := make(chan [2]string, 1)
+	p.OnSecretRotation(func(_ context.Context, previous, current *storage.JiraInstallInformation) error {
+		rotations <- [2]string{previous.SharedSecret, current.SharedSecret}
+		return nil
+	})
+	req := signedRequest(t, http.MethodPost, "/installed", existing)
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"key": "io.something.very.uniqye", "clientKey": "ckey",
+		"sharedSecret": "new-secret", "baseUrl": "https://example.atlassian.net", "productType": "jira",
+		"previousSharedSecret": "attacker-secret", "previousSharedSecretExpiry": 99999999999}`))
+	w := httptest.NewRecorder()
+	p.HandleInstall(nil, store, w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("re-install answered %d", w.Code)
+	}
+	select {
+	case secrets := <-rotations:
+		if secrets != [2]string{"old-secret", "new-secret"} {
+			t.Fatalf("rotation callback got %v", secrets)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("secret rotation callback was not invoked")
+	}
+	jii, _ := store.JiraInstallInformation("ckey")
+	if jii.SharedSecret != "new-secret" || jii.PreviousSharedSecret != "old-secret" ||
+		!jii.PreviousSharedSecretValid(time.Now()) ||
+		jii.PreviousSharedSecretValid(time.Now().Add(DefaultSecretRotationGrace+time.Second)) {
+		t.Fatalf("stored %+v", jii)
+	}
+	// requests signed before the rotation are still accepted.
+	if _, err := apicommunication.ValidateRequest(signedRequest(t, http.MethodGet, "/", existing), store); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lockingStore records whether install information is saved holding the lock of the tenant.
+type lockingStore struct {
+	*storage.MemoryStore
+	locked      string
+	savedLocked []bool
+}
+
+func (s *lockingStore) WithLock(clientKey string, f func() error) error {
+	s.locked = clientKey
+	defer func() { s.locked = "" }()
+	return s.MemoryStore.WithLock(clientKey, f)
+}
+
+func (s *lockingStore) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	s.savedLocked = append(s.savedLocked, s.locked == jii.ClientKey)
+	return s.MemoryStore.SaveJiraInstallInformation(jii)
+}
+
+func TestPlugin_HandleInstallLocksTenant(t *testing.T) {
+	p := newPlugin(t, nil)
+	store := &lockingStore{MemoryStore: storage.NewMemoryStore(0)}
+	p.store = store
+	req := httptest.NewRequest(http.MethodPost, "/installed", strings.NewReader(`{"key": "io.something.very.uniqye",
+		"clientKey": "ckey", "sharedSecret": "secret", "baseUrl": "https://example.atlassian.net", "productType": "jira"}`))
+	w := httptest.NewRecorder()
+	p.HandleInstall(nil, store, w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("install answered %d", w.Code)
+	}
+	if !reflect.DeepEqual(store.savedLocked, []bool{true}) {
+		t.Fatalf("saves holding the lock: %v", store.savedLocked)
+	}
+}
+
+func TestPlugin_HandleUninstall(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	store := storage.NewMemoryStore(0)
+	jii := &storage.JiraInstallInformation{ClientKey: "a"}
+	store.Preload(jii)
+	rec := httptest.NewRecorder()
+	p.HandleUninstall(jii, store, rec, httptest.NewRequest(http.MethodPost, "/uninstalled", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("uninstall answered %d", rec.Code)
+	}
+	if got, _ := store.JiraInstallInformation("a"); got != nil {
+		t.Fatal("uninstalled tenant was kept")
+	}
+	p.store = store
+	history, err := p.InstallHistory("a")
+	if err != nil || len(history) != 1 || history[0].Install.EventType != storage.HistoryEventUninstalled {
+		t.Fatalf("install history is %v, %v", history, err)
+	}
+}
+
+func TestPlugin_PrefetchInstallations(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	if _, err := p.PrefetchInstallations(context.Background()); err == nil {
+		t.Fatal("prefetched from a store that can not list installations")
+	}
+	backing := storage.NewMemoryStore(0)
+	for _, clientKey := range []string{"a", "b"} {
+		jii := &storage.JiraInstallInformation{ClientKey: clientKey, SharedSecret: "secret-" + clientKey,
+			BaseURL: "https://" + clientKey + ".atlassian.net"}
+		if err := backing.SaveJiraInstallInformation(jii); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.store = storage.NewCachedStore(backing, time.Hour)
+
+	count, err := p.PrefetchInstallations(context.Background())
+	if err != nil || count != 2 {
+		t.Fatalf("prefetched %d installations: %v", count, err)
+	}
+	// only the cache knows the tenant once the backing store forgets it.
+	backing.Delete("a")
+	if jii, err := p.store.JiraInstallInformation("a"); err != nil || jii == nil || jii.SharedSecret != "secret-a" {
+		t.Fatalf("prefetched tenant read back as %+v, %v", jii, err)
+	}
+}
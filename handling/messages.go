@@ -0,0 +1,173 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+// DefaultLocale is the locale MessageCatalog falls back to when it has no message for the locale of
+// a request.
+const DefaultLocale = "en"
+
+// localeQueryParameter is the standard query parameter jira adds to iframe URLs with the locale of
+// the user, ie "en-US".
+const localeQueryParameter = "loc"
+
+// errorMessage is the message for errors matching target, see errors.Is.
+type errorMessage struct {
+	target  error
+	message string
+}
+
+// MessageCatalog holds the user presentable messages shown instead of raw errors, such as in the
+// ErrorResponse of panels, per locale. Messages for errors take precedence over the ones for status
+// codes and are matched in the order they were added. It is safe for concurrent use.
+type MessageCatalog struct {
+	mu       sync.RWMutex
+	statuses map[string]map[int]string
+	errors   map[string][]errorMessage
+}
+
+// NewMessageCatalog returns a MessageCatalog with DefaultLocale messages for the errors of the
+// library, more locales and messages are added with AddStatus and AddError.
+func NewMessageCatalog() *MessageCatalog {
+	c := &MessageCatalog{
+		statuses: map[string]map[int]string{},
+		errors:   map[string][]errorMessage{},
+	}
+	c.AddStatus(DefaultLocale, http.StatusUnauthorized, "Your session could not be verified, please reload the page.")
+	c.AddStatus(DefaultLocale, http.StatusForbidden, "You are not allowed to do this.")
+	c.AddStatus(DefaultLocale, http.StatusNotFound, "What you are looking for could not be found.")
+	c.AddStatus(DefaultLocale, http.StatusInternalServerError, "Something went wrong, please try again later.")
+	c.AddStatus(DefaultLocale, http.StatusServiceUnavailable, "The app is temporarily unavailable, please try again later.")
+	c.AddError(DefaultLocale, apicommunication.ErrExpiredToken, "Your session expired, please reload the page.")
+	c.AddError(DefaultLocale, apicommunication.ErrNoInstallInfo, "The app is not installed in this site, please ask an administrator to install it again.")
+	return c
+}
+
+// clone returns a copy of the catalog, messages added to either are not seen by the other.
+func (c *MessageCatalog) clone() *MessageCatalog {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cc := &MessageCatalog{
+		statuses: make(map[string]map[int]string, len(c.statuses)),
+		errors:   make(map[string][]errorMessage, len(c.errors)),
+	}
+	for locale, messages := range c.statuses {
+		cc.statuses[locale] = make(map[int]string, len(messages))
+		for st, message := range messages {
+			cc.statuses[locale][st] = message
+		}
+	}
+	for locale, messages := range c.errors {
+		cc.errors[locale] = append([]errorMessage(nil), messages...)
+	}
+	return cc
+}
+
+// normalizeLocale lowercases locale and uses dashes as separator, so "en_US" and "en-us" match.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// fallbacks returns the locales whose messages are used for locale, most specific first.
+func fallbacks(locale string) []string {
+	locale = normalizeLocale(locale)
+	var locales []string
+	if locale != "" {
+		locales = append(locales, locale)
+		if i := strings.IndexByte(locale, '-'); i > 0 {
+			locales = append(locales, locale[:i])
+		}
+	}
+	return append(locales, DefaultLocale)
+}
+
+// AddStatus sets the message shown for st to users of locale, which can be a language ("de") or a
+// language and region ("de-AT").
+func (c *MessageCatalog) AddStatus(locale string, st int, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	locale = normalizeLocale(locale)
+	if c.statuses[locale] == nil {
+		c.statuses[locale] = map[int]string{}
+	}
+	c.statuses[locale][st] = message
+}
+
+// AddError sets the message shown to users of locale for errors matching target, see AddStatus.
+func (c *MessageCatalog) AddError(locale string, target error, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	locale = normalizeLocale(locale)
+	c.errors[locale] = append(c.errors[locale], errorMessage{target: target, message: message})
+}
+
+// Message returns the message for st in locale, falling back to its language, DefaultLocale and
+// finally http.StatusText.
+func (c *MessageCatalog) Message(locale string, st int) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, l := range fallbacks(locale) {
+		if message, ok := c.statuses[l][st]; ok {
+			return message
+		}
+	}
+	return http.StatusText(st)
+}
+
+// ErrorMessage returns the message for err in locale, or the one for st if no message matches err.
+// The locale fallbacks are the ones of Message.
+func (c *MessageCatalog) ErrorMessage(locale string, err error, st int) string {
+	c.mu.RLock()
+	for _, l := range fallbacks(locale) {
+		for _, m := range c.errors[l] {
+			if errors.Is(err, m.target) {
+				c.mu.RUnlock()
+				return m.message
+			}
+		}
+	}
+	c.mu.RUnlock()
+	return c.Message(locale, st)
+}
+
+// LocaleFromRequest returns the locale of the user making r, from the loc context parameter jira
+// adds to iframe URLs or else the first language in the Accept-Language header, "" if neither is set.
+func LocaleFromRequest(r *http.Request) string {
+	if loc := r.URL.Query().Get(localeQueryParameter); loc != "" {
+		return normalizeLocale(loc)
+	}
+	accepted := strings.Split(r.Header.Get("Accept-Language"), ",")[0]
+	if i := strings.IndexByte(accepted, ';'); i >= 0 {
+		accepted = accepted[:i]
+	}
+	if accepted == "*" {
+		return ""
+	}
+	return normalizeLocale(accepted)
+}
+
+// SetMessageCatalog makes the ErrorResponse written by HandleErrorCode and HandleError carry the
+// message of c for the locale of the request (see LocaleFromRequest) rather than the status text.
+func (p *Plugin) SetMessageCatalog(c *MessageCatalog) {
+	p.messages = c
+}
@@ -0,0 +1,48 @@
+package handling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+func TestPlugin_SetMessageCatalog(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	c := NewMessageCatalog()
+	c.AddStatus("de", http.StatusUnauthorized, "Sitzung ungültig")
+	c.AddError("de", apicommunication.ErrExpiredToken, "Sitzung abgelaufen")
+	p.SetMessageCatalog(c)
+	for _, tc := range []struct {
+		name, target, acceptLanguage string
+		err                          error
+		want                         string
+	}{
+		{name: "status in region locale", target: "/panel?loc=de_AT", err: apicommunication.ErrInvalidJWT, want: "Sitzung ungültig"},
+		{name: "error in region locale", target: "/panel?loc=de-AT", err: fmt.Errorf("validating: %w", apicommunication.ErrExpiredToken), want: "Sitzung abgelaufen"},
+		{name: "accept language", target: "/panel", acceptLanguage: "de;q=0.9, en", err: apicommunication.ErrInvalidJWT, want: "Sitzung ungültig"},
+		{name: "default locale", target: "/panel?loc=fr-FR", err: apicommunication.ErrExpiredToken, want: "Your session expired, please reload the page."},
+		{name: "default status", target: "/panel?loc=fr-FR", err: errors.New("boom"), want: "Something went wrong, please try again later."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			req.Header.Set("Accept", "application/json")
+			if tc.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tc.acceptLanguage)
+			}
+			rec := httptest.NewRecorder()
+			p.HandleError(tc.err, rec, req)
+			var got ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Code != rec.Code || got.Message != tc.want {
+				t.Fatalf("answered %d %+v, want message %q", rec.Code, got, tc.want)
+			}
+		})
+	}
+}
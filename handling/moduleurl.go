@@ -0,0 +1,162 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// contextParameters are the context parameters atlassian documents for module URLs, see
+// https://developer.atlassian.com/cloud/jira/platform/context-parameters/ and
+// https://developer.atlassian.com/cloud/confluence/context-parameters/
+var contextParameters = map[string]bool{}
+
+func init() {
+	for _, p := range []string{
+		// jira
+		"issue.id", "issue.key", "issuetype.id",
+		"project.id", "project.key", "project.type",
+		"version.id", "component.id",
+		"profileUser.accountId",
+		"dashboardItem.id", "dashboardItem.key", "dashboardItem.viewType", "dashboard.id",
+		"board.id", "board.type", "board.screen", "board.mode",
+		"sprint.id", "sprint.state",
+		"postFunction.id", "postFunction.config",
+		"option.id", "option.key", "option.properties",
+		"servicedesk.requestId", "servicedesk.requestKey", "servicedesk.requestTypeId",
+		"servicedesk.serviceDeskId", "servicedesk.projectId", "servicedesk.projectKey",
+		// confluence
+		"content.id", "content.version", "content.type", "content.plugin",
+		"space.id", "space.key",
+		"page.id", "page.version", "page.type",
+		"macro.id", "macro.hash", "macro.body", "output.type",
+		"target.user.accountId",
+		// both
+		"user.accountId", "user.id", "user.key", "user.isSystemAdmin",
+	} {
+		contextParameters[p] = true
+	}
+}
+
+// customContextParameterPrefix prefixes the context parameters apps define, ie {ac.myParameter}.
+const customContextParameterPrefix = "ac."
+
+// validateContextParameter returns an error if parameter is not a documented context parameter
+// nor an app defined one.
+func validateContextParameter(parameter string) error {
+	if contextParameters[parameter] {
+		return nil
+	}
+	if strings.HasPrefix(parameter, customContextParameterPrefix) && len(parameter) > len(customContextParameterPrefix) {
+		return nil
+	}
+	if suggestion := closestEvent(parameter, contextParameters); suggestion != "" {
+		return fmt.Errorf("%s is not a known context parameter, did you mean %s?", parameter, suggestion)
+	}
+	return fmt.Errorf("%s is not a known context parameter", parameter)
+}
+
+// ModuleURL builds the URL of a module, ie WebPanel.URL, escaping its static parts and checking
+// the context parameters atlassian interpolates are documented ones:
+//
+//	u, err := NewModuleURL("/panels/issue").
+//		Context("issueId", "issue.id").
+//		Query("mode", "compact & dense").
+//		Build()
+//	// u is "/panels/issue?issueId={issue.id}&mode=compact+%26+dense"
+//
+// Errors are reported once the URL is built.
+type ModuleURL struct {
+	path  []string
+	query map[string]string
+	err   error
+}
+
+// NewModuleURL returns a builder for a module URL under the passed path, whose segments are
+// escaped unless they are a context parameter between braces, ie "/issue/{issue.key}".
+func NewModuleURL(path string) *ModuleURL {
+	u := &ModuleURL{query: map[string]string{}}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			u.fail(validateContextParameter(strings.Trim(segment, "{}")))
+			u.path = append(u.path, segment)
+			continue
+		}
+		u.path = append(u.path, url.PathEscape(segment))
+	}
+	return u
+}
+
+func (u *ModuleURL) fail(err error) {
+	if u.err == nil && err != nil {
+		u.err = err
+	}
+}
+
+func (u *ModuleURL) set(arg, value string) {
+	if arg == "" {
+		u.fail(fmt.Errorf("query arguments must have a name"))
+		return
+	}
+	if _, ok := u.query[arg]; ok {
+		u.fail(fmt.Errorf("query argument %s is set more than once", arg))
+		return
+	}
+	u.query[arg] = value
+}
+
+// Context adds the query argument arg holding the value of the passed context parameter, ie
+// Context("issueId", "issue.id") adds issueId={issue.id}.
+func (u *ModuleURL) Context(arg, parameter string) *ModuleURL {
+	u.fail(validateContextParameter(parameter))
+	u.set(url.QueryEscape(arg), "{"+parameter+"}")
+	return u
+}
+
+// Query adds the query argument arg holding value, which is escaped.
+func (u *ModuleURL) Query(arg, value string) *ModuleURL {
+	u.set(url.QueryEscape(arg), url.QueryEscape(value))
+	return u
+}
+
+// Build returns the module URL or the first problem found while building it, query arguments
+// are sorted so the descriptor does not change across renders.
+func (u *ModuleURL) Build() (string, error) {
+	if u.err != nil {
+		return "", u.err
+	}
+	path := strings.Join(u.path, "/")
+	if len(u.query) == 0 {
+		return path, nil
+	}
+	kvs := make([]string, 0, len(u.query))
+	for k, v := range u.query {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return path + "?" + strings.Join(kvs, "&"), nil
+}
+
+// MustBuild is like Build but panics on errors, it is meant for URLs known at compile time.
+func (u *ModuleURL) MustBuild() string {
+	s, err := u.Build()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
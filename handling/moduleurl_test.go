@@ -0,0 +1,27 @@
+package handling
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModuleURL(t *testing.T) {
+	got, err := NewModuleURL("/panels/my panel/{issue.key}").
+		Context("issueId", "issue.id").
+		Context("custom", "ac.severity").
+		Query("mode", "compact & dense").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/panels/my%20panel/{issue.key}?custom={ac.severity}&issueId={issue.id}&mode=compact+%26+dense"; got != want {
+		t.Fatalf("built %s, want %s", got, want)
+	}
+	_, err = NewModuleURL("/panel").Context("issueId", "isue.id").Build()
+	if err == nil || !strings.Contains(err.Error(), "did you mean issue.id?") {
+		t.Fatalf("typo was not caught: %v", err)
+	}
+	if _, err := NewModuleURL("/panel").Query("a", "1").Query("a", "2").Build(); err == nil {
+		t.Fatal("repeated query argument was accepted")
+	}
+}
@@ -0,0 +1,79 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+// PanicCallback is invoked when a handler served by the plugin Router panics, clientKey is the
+// tenant the request claims to come from (not verified, it can be empty) and stack the goroutine
+// stack trace at the time of the panic. Use it to report to services such as sentry.
+type PanicCallback func(r *http.Request, clientKey string, recovered interface{}, stack []byte)
+
+// OnPanic sets a callback invoked when a handler served by the plugin Router panics, the panic is
+// logged and answered with http.StatusInternalServerError regardless of it being set.
+func (p *Plugin) OnPanic(f PanicCallback) {
+	p.onPanic = f
+}
+
+// RecoverMiddleware recovers from panics in next the same way the plugin Router does, use it for the
+// handlers added to the router by hand.
+func (p *Plugin) RecoverMiddleware(next http.Handler) http.Handler {
+	return p.recoverHandleFunc(next.ServeHTTP)
+}
+
+func (p *Plugin) recoverHandleFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			stack := debug.Stack()
+			clientKey := requestClientKey(r)
+			p.logger.Printf("ERROR: [%s] panic serving %s %s for tenant %q: %v\n%s",
+				apicommunication.RequestIDFromContext(r.Context()), r.Method, r.URL.Path, clientKey, recovered, stack)
+			if p.onPanic != nil {
+				p.onPanic(r, clientKey, recovered, stack)
+			}
+			p.HandleErrorCode(http.StatusInternalServerError, w, r)
+		}()
+		next(w, r)
+	}
+}
+
+// requestClientKey returns the issuer of the request JWT, without verifying it.
+func requestClientKey(r *http.Request) string {
+	if jii, ok := TenantFromContext(r.Context()); ok {
+		return jii.ClientKey
+	}
+	token, err := apicommunication.ExtractToken(r, apicommunication.TokenSourceQuery|
+		apicommunication.TokenSourceJWTHeader|apicommunication.TokenSourceBearerHeader)
+	if err != nil {
+		return ""
+	}
+	claims, err := apicommunication.ParseUnverifiedClaims(token)
+	if err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
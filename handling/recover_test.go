@@ -0,0 +1,45 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_OnPanic(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	var gotClientKey string
+	var gotRecovered interface{}
+	var gotStack []byte
+	p.OnPanic(func(r *http.Request, clientKey string, recovered interface{}, stack []byte) {
+		gotClientKey, gotRecovered, gotStack = clientKey, recovered, stack
+	})
+	if err := p.AddUnauthenticatedHandler("/boom", false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	p.Router(nil).ServeHTTP(w, signedRequest(t, http.MethodGet, "/path/to/api/boom", jii))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic was answered %d", w.Code)
+	}
+	if gotClientKey != "ck" || gotRecovered != "boom" || len(gotStack) == 0 {
+		t.Fatalf("callback got tenant %q, recovered %v and %d bytes of stack", gotClientKey, gotRecovered, len(gotStack))
+	}
+
+	aborted := p.RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Fatalf("aborting the handler recovered %v", recovered)
+		}
+	}()
+	aborted.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Fatal("aborting the handler was recovered from")
+}
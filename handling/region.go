@@ -0,0 +1,129 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// ForwardedRegionHeader is set to the forwarding region on requests proxied by region routing,
+// requests carrying it are never routed again.
+const ForwardedRegionHeader = "X-Connect-Forwarded-Region"
+
+type regionRouting struct {
+	current string
+	regions map[string]*url.URL
+	store   storage.RegionStore
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// SetRegionRouting makes verified routes send requests for tenants owned by another region to that
+// region's deployment, regionURLs maps each region to the base URL where it is served.
+// Requests are redirected with http.StatusTemporaryRedirect unless proxy is true, in which case they
+// are proxied, use it when the caller (ie jira webhooks) does not follow redirects.
+// Proxied requests carry ForwardedRegionHeader and are validated and handled by the receiving
+// region, whatever region it believes owns the tenant, so misconfigured regions can not loop.
+// Tenants not pinned to any region in rs are handled locally.
+func (p *Plugin) SetRegionRouting(current string, regionURLs map[string]string, rs storage.RegionStore,
+	proxy bool) error {
+	if rs == nil {
+		return fmt.Errorf("a region store is required for region routing")
+	}
+	rr := &regionRouting{
+		current: current,
+		regions: make(map[string]*url.URL, len(regionURLs)),
+		store:   rs,
+	}
+	for region, rawURL := range regionURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("parsing URL for region %s: %w", region, err)
+		}
+		rr.regions[region] = u
+	}
+	if proxy {
+		rr.proxies = make(map[string]*httputil.ReverseProxy, len(rr.regions))
+		for region, u := range rr.regions {
+			proxy := httputil.NewSingleHostReverseProxy(u)
+			director := proxy.Director
+			proxy.Director = func(r *http.Request) {
+				director(r)
+				r.Header.Set(ForwardedRegionHeader, current)
+			}
+			rr.proxies[region] = proxy
+		}
+	}
+	p.regionRouting = rr
+	return nil
+}
+
+// routeToRegion sends the request to the region owning its tenant and returns true if said
+// region is not the current one, the request must not be handled further in that case.
+// The tenant is read from the unverified token, so requests already forwarded by another region
+// are left to validation instead of being routed again.
+func (p *Plugin) routeToRegion(sources apicommunication.TokenSource, w http.ResponseWriter, r *http.Request) bool {
+	rr := p.regionRouting
+	if rr == nil || r.Header.Get(ForwardedRegionHeader) != "" {
+		return false
+	}
+	token, err := apicommunication.ExtractToken(r, sources)
+	if err != nil {
+		return false // validation will take care of it
+	}
+	claims, err := apicommunication.ParseUnverifiedClaims(token)
+	if err != nil {
+		return false
+	}
+	region, err := rr.store.TenantRegion(claims.Issuer)
+	if err != nil {
+		p.logger.Printf("ERROR: reading region for tenant %s: %v", claims.Issuer, err)
+		p.HandleErrorCode(http.StatusServiceUnavailable, w, r)
+		return true
+	}
+	if region == "" || region == rr.current {
+		return false
+	}
+	target, ok := rr.regions[region]
+	if !ok {
+		p.logger.Printf("ERROR: tenant %s is pinned to unknown region %s", claims.Issuer, region)
+		p.HandleErrorCode(http.StatusMisdirectedRequest, w, r)
+		return true
+	}
+	if proxy, ok := rr.proxies[region]; ok {
+		proxy.ServeHTTP(w, r)
+		return true
+	}
+	redirectTo := *target
+	redirectTo.Path = singleJoiningSlash(target.Path, r.URL.Path)
+	redirectTo.RawQuery = r.URL.RawQuery
+	http.Redirect(w, r, redirectTo.String(), http.StatusTemporaryRedirect)
+	return true
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case len(a) > 0 && a[len(a)-1] == '/' && len(b) > 0 && b[0] == '/':
+		return a + b[1:]
+	case (len(a) == 0 || a[len(a)-1] != '/') && (len(b) == 0 || b[0] != '/'):
+		return a + "/" + b
+	}
+	return a + b
+}
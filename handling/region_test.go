@@ -0,0 +1,109 @@
+package handling
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// fakeRegions pins tenants to regions, tenants mapped to "" fail to be read.
+type fakeRegions map[string]string
+
+func (f fakeRegions) SaveTenantRegion(clientKey, region string) error {
+	f[clientKey] = region
+	return nil
+}
+
+func (f fakeRegions) TenantRegion(clientKey string) (string, error) {
+	if region, ok := f[clientKey]; ok && region == "" {
+		return "", errors.New("region store is down")
+	}
+	return f[clientKey], nil
+}
+
+func TestPlugin_RegionRouting(t *testing.T) {
+	var proxied []string
+	eu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.RequestURI()+" from "+r.Header.Get(ForwardedRegionHeader))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer eu.Close()
+	regions := fakeRegions{"eu-tenant": "eu", "us-tenant": "us", "lost-tenant": "apac", "broken-tenant": ""}
+	urls := map[string]string{"us": "https://us.example.com", "eu": eu.URL + "/base"}
+
+	for _, proxy := range []bool{false, true} {
+		p := newPlugin(t, fakeHandleFunc)
+		p.store = storage.NewMemoryStore(0)
+		if err := p.SetRegionRouting("us", urls, regions, proxy); err != nil {
+			t.Fatal(err)
+		}
+		handled := false
+		h := p.VerifiedHandleFunc(func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, _ *http.Request) {
+			handled = true
+		})
+		call := func(clientKey string) *httptest.ResponseRecorder {
+			jii := &storage.JiraInstallInformation{ClientKey: clientKey, SharedSecret: "secret"}
+			if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+				t.Fatal(err)
+			}
+			handled = false
+			w := httptest.NewRecorder()
+			h(w, signedRequest(t, http.MethodGet, "/panel?issueKey=PRJ-1", jii))
+			return w
+		}
+
+		for _, clientKey := range []string{"us-tenant", "unpinned-tenant"} {
+			if w := call(clientKey); !handled || w.Code != http.StatusOK {
+				t.Fatalf("proxy %v: %s was answered %d instead of being handled locally", proxy, clientKey, w.Code)
+			}
+		}
+		if w := call("lost-tenant"); handled || w.Code != http.StatusMisdirectedRequest {
+			t.Fatalf("proxy %v: tenant of an unknown region was answered %d", proxy, w.Code)
+		}
+		if w := call("broken-tenant"); handled || w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("proxy %v: failing to read the region was answered %d", proxy, w.Code)
+		}
+
+		w := call("eu-tenant")
+		if handled {
+			t.Fatalf("proxy %v: tenant of another region was handled locally", proxy)
+		}
+		if !proxy {
+			if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != eu.URL+"/base/panel?issueKey=PRJ-1" {
+				t.Fatalf("redirected with %d to %s", w.Code, w.Header().Get("Location"))
+			}
+			continue
+		}
+		if w.Code != http.StatusAccepted || len(proxied) != 1 || proxied[0] != "/base/panel?issueKey=PRJ-1 from us" {
+			t.Fatalf("proxied %v and answered %d", proxied, w.Code)
+		}
+	}
+}
+
+func TestPlugin_RegionRoutingForwarded(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	// each region believes the other owns the tenant
+	if err := p.SetRegionRouting("us", map[string]string{"eu": "https://eu.example.com"},
+		fakeRegions{"eu-tenant": "eu"}, true); err != nil {
+		t.Fatal(err)
+	}
+	jii := &storage.JiraInstallInformation{ClientKey: "eu-tenant", SharedSecret: "secret"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	handled := false
+	h := p.VerifiedHandleFunc(func(_ *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, _ *http.Request) {
+		handled = true
+	})
+	r := signedRequest(t, http.MethodGet, "/panel?issueKey=PRJ-1", jii)
+	r.Header.Set(ForwardedRegionHeader, "eu")
+	w := httptest.NewRecorder()
+	h(w, r)
+	if !handled || w.Code != http.StatusOK {
+		t.Fatalf("forwarded request was answered %d instead of being handled locally", w.Code)
+	}
+}
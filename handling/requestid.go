@@ -0,0 +1,48 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/http"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+// RequestIDMiddleware takes the request id from the apicommunication.RequestIDHeader or generates one,
+// stores it in the request context and echoes it in the response. HostClients created with the
+// request context send it along to jira. The plugin Router applies it to all its routes.
+func (p *Plugin) RequestIDMiddleware(next http.Handler) http.Handler {
+	return requestIDHandleFunc(next.ServeHTTP)
+}
+
+func requestIDHandleFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apicommunication.RequestIDFromContext(r.Context()) != "" {
+			next(w, r)
+			return
+		}
+		id := r.Header.Get(apicommunication.RequestIDHeader)
+		if !apicommunication.ValidRequestID(id) {
+			id = apicommunication.NewRequestID()
+		}
+		w.Header().Set(apicommunication.RequestIDHeader, id)
+		next(w, r.WithContext(apicommunication.ContextWithRequestID(r.Context(), id)))
+	}
+}
+
+// routeHandleFunc wraps the handlers served by the plugin Router.
+func (p *Plugin) routeHandleFunc(next http.HandlerFunc) http.HandlerFunc {
+	return requestIDHandleFunc(p.recoverHandleFunc(next))
+}
@@ -0,0 +1,46 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+func TestPlugin_RequestIDMiddleware(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	var got string
+	h := p.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = apicommunication.RequestIDFromContext(r.Context())
+	}))
+	serve := func(r *http.Request, id string) string {
+		if id != "" {
+			r.Header.Set(apicommunication.RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if echoed := w.Header().Get(apicommunication.RequestIDHeader); echoed != got {
+			t.Fatalf("echoed request id %q, handler got %q", echoed, got)
+		}
+		return got
+	}
+
+	if id := serve(httptest.NewRequest(http.MethodGet, "/", nil), "from-the-caller"); id != "from-the-caller" {
+		t.Fatalf("request id of the caller was replaced with %q", id)
+	}
+	for _, invalid := range []string{"", "has spaces", strings.Repeat("x", 129)} {
+		if id := serve(httptest.NewRequest(http.MethodGet, "/", nil), invalid); id == "" || id == invalid {
+			t.Fatalf("request id %q was used as %q", invalid, id)
+		}
+	}
+	// an id already in the context, ie set by an outer router, is kept.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(apicommunication.ContextWithRequestID(r.Context(), "outer"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got != "outer" {
+		t.Fatalf("request id in the context was replaced with %q", got)
+	}
+}
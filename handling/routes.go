@@ -18,11 +18,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"path"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
 	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
@@ -39,23 +39,36 @@ func NewRoutePath(path string, args map[string]string) RoutePath {
 type RoutePath struct {
 	path string
 	keys map[string]string
+	// vars binds the mux variables in path to context parameters, see WithVars.
+	vars map[string]string
 }
 
 func (r *RoutePath) url() string {
+	return r.withQuery(r.descriptorPath())
+}
+
+// withQuery returns path followed by the query arguments of the route.
+func (r *RoutePath) withQuery(path string) string {
 	if len(r.keys) == 0 {
-		return r.path
+		return path
 	}
 	kvs := make([]string, 0, len(r.keys))
 	for k, v := range r.keys {
 		kvs = append(kvs, k+"="+v)
 	}
-	return r.path + "?" + strings.Join(kvs, "&")
+	// sorted so the descriptor does not change across renders.
+	sort.Strings(kvs)
+	return path + "?" + strings.Join(kvs, "&")
 }
 
+// Logger is what the plugin uses to log, *log.Logger satisfies it and apicommunication.LeveledLogger
+// can be used to filter and sample messages.
+type Logger = apicommunication.Logger
+
 // Plugin represents an atlassian connect plugin instance
 type Plugin struct {
 	ac        *AtlassianConnect
-	logger    *log.Logger
+	logger    Logger
 	baseRoute string
 	store     storage.Store
 
@@ -66,10 +79,43 @@ type Plugin struct {
 	lifecycle       map[LifeCycleEvents]JiraHandleFunc
 	lifecycleRoutes map[LifeCycleEvents]string
 
-	webhooks      map[string]JiraHandleFunc
-	webhookRoutes map[string]RoutePath
+	webhooks          map[string]JiraHandleFunc
+	webhookRoutes     map[string]RoutePath
+	webhookMiddleware []WebhookMiddleware
+	// webhookHandlers are the handlers of each event besides the one passed to AddWebhook.
+	webhookHandlers           map[string][]JiraHandleFunc
+	concurrentWebhookHandlers bool
+	// async tracks the webhooks processed in the background by AsyncWebhooks, it is shared by clones.
+	async *asyncWebhooks
+
+	productType        string
+	extraWebhookEvents map[string]bool
+	apiUsage           []APIUsage
+
+	invalidation *apicommunication.Invalidation
 
 	arbitraryWebPanels map[string][]WebPanel
+
+	replayCache   apicommunication.ReplayCache
+	regionRouting *regionRouting
+
+	onFirstInstall      InstallCallback
+	onSecretRotation    SecretRotationCallback
+	secretRotationGrace time.Duration
+	installSnapshots    bool
+	installAllowedHosts []string
+	moduleFilter        ModuleFilter
+	moduleToggles       *moduleToggles
+	keyNamespace        string
+
+	unauthenticatedRoutes []unauthenticatedRoute
+
+	onPanic  PanicCallback
+	messages *MessageCatalog
+
+	sessionRoute    string
+	sessionKey      []byte
+	sessionLifetime time.Duration
 }
 
 // AddErrorCodeHandler adds a handler for a given error code, if this status is raised we will pass on
@@ -79,34 +125,89 @@ func (p *Plugin) AddErrorCodeHandler(st int, handler http.HandlerFunc) {
 	p.handleStatuses[st] = handler
 }
 
-// HandleErrorCode uses the handler for the given error or plain sends the code.
+// HandleErrorCode uses the handler for the given error or plain sends the code, along with an
+// ErrorResponse body if the client accepts JSON.
 func (p *Plugin) HandleErrorCode(st int, w http.ResponseWriter, r *http.Request) {
+	p.handleError(st, nil, w, r)
+}
+
+// HandleError is like HandleErrorCode for the status err maps to, the message of the ErrorResponse
+// is the one of the MessageCatalog for err, if any, but never the text of err.
+func (p *Plugin) HandleError(err error, w http.ResponseWriter, r *http.Request) {
+	p.handleError(statusForError(err), err, w, r)
+}
+
+func (p *Plugin) handleError(st int, cause error, w http.ResponseWriter, r *http.Request) {
 	h, hasHandlerForError := p.handleStatuses[st]
 	if hasHandlerForError {
 		h(w, r)
 		return
 	}
+	if acceptsJSON(r) {
+		message := http.StatusText(st)
+		if p.messages != nil {
+			message = p.messages.ErrorMessage(LocaleFromRequest(r), cause, st)
+		}
+		if err := writeErrorResponse(st, message, w, r); err != nil {
+			p.logger.Printf("ERROR: writing error response: %v", err)
+		}
+		return
+	}
 	w.WriteHeader(st)
 }
 
+// SetReplayCache enables replay protection for verified routes, tokens will be recorded in rc
+// for their validity window and rejected with http.StatusUnauthorized if presented again.
+func (p *Plugin) SetReplayCache(rc apicommunication.ReplayCache) {
+	p.replayCache = rc
+}
+
+// statusForError returns the status code to answer with when handling a request failed with err.
+func statusForError(err error) int {
+	return apicommunication.StatusForError(err)
+}
+
 // JiraHandleFunc represents an http handler func that also receives jira install information
 // and access to storage.
 type JiraHandleFunc func(jii *storage.JiraInstallInformation, store storage.Store,
 	w http.ResponseWriter, r *http.Request)
 
-// VerifiedHandleFunc returns the passed JiraHandleFunc wrapped into a verification check.
+// VerifiedHandleFunc returns the passed JiraHandleFunc wrapped into a verification check, the
+// request passed to the handler carries the tenant in its context (see TenantFromContext).
+// Requests failing validation are answered through HandleError with the status of
+// apicommunication.StatusForError: http.StatusUnauthorized for invalid or expired tokens and
+// unknown tenants, http.StatusServiceUnavailable if the store is unavailable and
+// http.StatusInternalServerError otherwise.
 func (p *Plugin) VerifiedHandleFunc(handler JiraHandleFunc) http.HandlerFunc {
+	return p.VerifiedHandleFuncFrom(apicommunication.DefaultTokenSources, handler)
+}
+
+// VerifiedHandleFuncFrom is like VerifiedHandleFunc but only accepts the JWT from the passed sources,
+// use it for routes called by front ends which send the context token in a different place than jira.
+func (p *Plugin) VerifiedHandleFuncFrom(sources apicommunication.TokenSource, handler JiraHandleFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		jii, err := apicommunication.ValidateRequest(r, p.store)
+		if p.routeToRegion(sources, w, r) {
+			return
+		}
+		jii, claims, err := apicommunication.ValidateRequestFrom(r, p.store, sources)
 		if err != nil {
-			p.logger.Printf("ERROR: Validating jira JWT: %v", err)
-			p.HandleErrorCode(http.StatusInternalServerError, w, r)
+			p.logger.Printf("ERROR: [%s] Validating jira JWT: %v", apicommunication.RequestIDFromContext(r.Context()), err)
+			p.HandleError(err, w, r)
 			return
 		}
 		if jii == nil {
 			p.HandleErrorCode(http.StatusUnauthorized, w, r)
 			return
 		}
+		if p.replayCache != nil {
+			if err := apicommunication.CheckReplay(p.replayCache, claims); err != nil {
+				p.logger.Printf("ERROR: Validating jira JWT: %v", err)
+				p.HandleErrorCode(http.StatusUnauthorized, w, r)
+				return
+			}
+		}
+		apicommunication.Debugf(p.logger, "Validated jira JWT from %s for %s", jii.ClientKey, r.URL.Path)
+		r = r.WithContext(ContextWithTenant(r.Context(), jii, claims))
 		handler(jii, p.store, w, r)
 	}
 }
@@ -118,7 +219,7 @@ func (p *Plugin) InstallHandleFunc(handler JiraHandleFunc) http.HandlerFunc {
 
 		if err := apicommunication.ValidateInstallRequest(r, p.store); err != nil {
 			p.logger.Printf("ERROR: Validating jira install JWT: %v", err)
-			p.HandleErrorCode(http.StatusInternalServerError, w, r)
+			p.HandleError(err, w, r)
 			return
 		}
 		handler(nil, p.store, w, r)
@@ -134,9 +235,13 @@ func (p *Plugin) UnverifiedHandleFunc(handler JiraHandleFunc) http.HandlerFunc {
 }
 
 func (p *Plugin) renderAtlassianConnectJSON(w io.Writer) error {
+	return p.renderAtlassianConnectJSONFor(w, nil)
+}
+
+func (p *Plugin) renderAtlassianConnectJSONFor(w io.Writer, jii *storage.JiraInstallInformation) error {
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "    ")
-	if err := enc.Encode(p.ac); err != nil {
+	if err := enc.Encode(p.descriptorFor(jii)); err != nil {
 		return fmt.Errorf("marshaling atlassian-connect.json")
 	}
 	return nil
@@ -146,6 +251,7 @@ func (p *Plugin) renderAtlassianConnectJSON(w io.Writer) error {
 // panel handlers are not covered here so if you want them you can add them to the returned router.
 // The returned router is based on the passed one if provided.
 func (p *Plugin) Router(r *mux.Router) *mux.Router {
+	p.warnExcessScopes()
 	var newRouter *mux.Router
 	if r == nil {
 		r = mux.NewRouter()
@@ -156,15 +262,19 @@ func (p *Plugin) Router(r *mux.Router) *mux.Router {
 		newRouter = r
 	}
 	newRouter.Methods(http.MethodGet).Path("/atlassian-connect.json").
-		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandlerFunc(p.routeHandleFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add("content-type", "application/json")
-			if err := p.renderAtlassianConnectJSON(w); err != nil {
+			var jii *storage.JiraInstallInformation
+			if p.moduleFilter != nil || p.moduleToggles != nil {
+				jii = p.descriptorTenant(r)
+			}
+			if err := p.renderAtlassianConnectJSONFor(w, jii); err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				if p.logger != nil {
 					p.logger.Printf("ERROR: %v", err)
 				}
 			}
-		})
+		}))
 
 	for event, handler := range p.lifecycle {
 		var verifiedHandler http.HandlerFunc
@@ -175,10 +285,22 @@ func (p *Plugin) Router(r *mux.Router) *mux.Router {
 		} else {
 			verifiedHandler = p.UnverifiedHandleFunc(handler)
 		}
-		newRouter.Methods(http.MethodGet, http.MethodPost).Path(p.lifecycleRoutes[event]).HandlerFunc(verifiedHandler)
+		newRouter.Methods(http.MethodGet, http.MethodPost).Path(p.lifecycleRoutes[event]).
+			HandlerFunc(p.routeHandleFunc(verifiedHandler))
 	}
-	for hook, handler := range p.webhooks {
-		newRouter.Methods(http.MethodGet, http.MethodPost).Path(p.webhookRoutes[hook].path).HandlerFunc(p.VerifiedHandleFunc(handler))
+	for hook := range p.webhooks {
+		handler, _ := p.webhookHandler(hook)
+		newRouter.Methods(http.MethodGet, http.MethodPost).Path(p.webhookRoutes[hook].path).
+			HandlerFunc(p.routeHandleFunc(p.VerifiedHandleFunc(handler)))
+	}
+	p.registerUnauthenticatedRoutes(newRouter)
+	if p.moduleToggles != nil {
+		newRouter.Methods(http.MethodGet, http.MethodPut).Path(p.moduleToggles.route).
+			HandlerFunc(p.routeHandleFunc(p.VerifiedHandleFuncFrom(sessionTokenSources, p.handleModuleToggles)))
+	}
+	if p.sessionRoute != "" {
+		newRouter.Methods(http.MethodGet, http.MethodPost).Path(p.sessionRoute).
+			HandlerFunc(p.routeHandleFunc(p.VerifiedHandleFuncFrom(sessionTokenSources, p.issueSessionToken)))
 	}
 	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		pathTmpl, _ := route.GetPathTemplate()
@@ -233,11 +355,20 @@ func (p *Plugin) UpdateWebPanel(panelContainer string, wp WebPanel) error {
 	if panelContainer == "" {
 		panelContainer = "webPanels"
 	}
-	ewp, exists := p.arbitraryWebPanels[panelContainer]
-	if !exists {
-		ewp = []WebPanel{}
+	// panels keep the order they were added in, a replaced one keeps its place.
+	ewp := append(make([]WebPanel, 0, len(p.arbitraryWebPanels[panelContainer])+1),
+		p.arbitraryWebPanels[panelContainer]...)
+	replaced := false
+	for i, v := range ewp {
+		if v.Key == wp.Key {
+			ewp[i] = wp
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		ewp = append(ewp, wp)
 	}
-	ewp = append(ewp, wp)
 	p.arbitraryWebPanels[panelContainer] = ewp
 	keys := make([]string, 0, len(p.arbitraryWebPanels))
 	for k := range p.arbitraryWebPanels {
@@ -281,6 +412,7 @@ func (p *Plugin) UpdateJiraIssueField(f JiraIssueFields) error {
 // AddWebhook will add a webhook to a given jira event (of the form jira:issue_updated) or fail if
 // already present, a more exhaustive list is available in jira documentation at
 // https://developer.atlassian.com/cloud/jira/platform/webhooks/
+// Events are validated against the Jira* (or Confluence*) event constants, see AllowWebhookEvents.
 func (p *Plugin) AddWebhook(event string, route RoutePath, f JiraHandleFunc) error {
 	if _, exists := p.webhooks[event]; exists {
 		return fmt.Errorf("%s event is already being handled", event)
@@ -290,8 +422,15 @@ func (p *Plugin) AddWebhook(event string, route RoutePath, f JiraHandleFunc) err
 
 const webhooksKey = "webhooks"
 
-// UpdateWebhook will add a webhook to a given jira event, if already present it will be replaced.
+// UpdateWebhook will add a webhook to a given jira event, if already present it will be replaced,
+// handlers added with AddWebhookHandler are kept. The event is validated like in AddWebhook.
 func (p *Plugin) UpdateWebhook(event string, route RoutePath, f JiraHandleFunc) error {
+	if err := p.validateWebhookEvent(event); err != nil {
+		return err
+	}
+	if err := route.validate(); err != nil {
+		return err
+	}
 	p.webhooks[event] = f
 	p.webhookRoutes[event] = route
 	var webhooks []Webhooks
@@ -340,11 +479,29 @@ func (p *Plugin) UpdateLifecycleEvent(lce LifeCycleEvents, route string, f JiraH
 	return nil
 }
 
+// LifecycleRoute returns the path, base route included, the handler of the lifecycle event is served at.
+func (p *Plugin) LifecycleRoute(lce LifeCycleEvents) (string, bool) {
+	route, ok := p.lifecycleRoutes[lce]
+	if !ok {
+		return "", false
+	}
+	return path.Join(p.baseRoute, route), true
+}
+
+// WebhookRoute returns the path, base route included, the handler of the webhook event is served at.
+func (p *Plugin) WebhookRoute(event string) (string, bool) {
+	route, ok := p.webhookRoutes[event]
+	if !ok {
+		return "", false
+	}
+	return path.Join(p.baseRoute, route.path), true
+}
+
 // NewPlugin will create a new Plugin instance, as it is it will not be enough, you should add the
 // necesary lifecycle events, webhooks, etc using the provided methods then obtain the Router handling
 // all the events by invoking Router().
 func NewPlugin(name, description, key, baseURL, baseRoute string,
-	store storage.Store, logger *log.Logger,
+	store storage.Store, logger Logger,
 	scopes []string, vendor Vendor, signedInstall bool) *Plugin {
 	ac := &AtlassianConnect{
 		Authentication: defaultPluginAuthentication,
@@ -364,13 +521,19 @@ func NewPlugin(name, description, key, baseURL, baseRoute string,
 		ac:                 ac,
 		baseRoute:          baseRoute,
 		store:              store,
-		logger:             logger,
+		logger:             apicommunication.NewRedactingLogger(logger),
 		jiraIssueFields:    map[string]JiraIssueFields{},
 		lifecycle:          map[LifeCycleEvents]JiraHandleFunc{},
 		lifecycleRoutes:    map[LifeCycleEvents]string{},
 		webhooks:           map[string]JiraHandleFunc{},
 		webhookRoutes:      map[string]RoutePath{},
+		webhookHandlers:    map[string][]JiraHandleFunc{},
 		arbitraryWebPanels: map[string][]WebPanel{},
 		handleStatuses:     map[int]http.HandlerFunc{},
+		async:              newAsyncWebhooks(),
+
+		installAllowedHosts: apicommunication.AtlassianHostSuffixes,
+		secretRotationGrace: DefaultSecretRotationGrace,
+		productType:         apicommunication.ProductTypeJira,
 	}
 }
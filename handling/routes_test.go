@@ -7,8 +7,10 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
 	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
 	"github.com/beme/abide"
 )
@@ -32,12 +34,12 @@ func (f *fakeStore) JiraInstallInformation(clientKey string) (*storage.JiraInsta
 	return f.j, nil
 }
 
-func adaptLogger(t *testing.T) *log.Logger {
+func adaptLogger(t testing.TB) *log.Logger {
 	return log.New(&tlog{t: t}, "TEST:", log.LstdFlags)
 }
 
 type tlog struct {
-	t *testing.T
+	t testing.TB
 }
 
 func (t *tlog) Write(p []byte) (int, error) {
@@ -47,7 +49,7 @@ func (t *tlog) Write(p []byte) (int, error) {
 
 var fakeHandleFunc = func(jii *storage.JiraInstallInformation, s storage.Store, w http.ResponseWriter, r *http.Request) {}
 
-func newPlugin(t *testing.T, handleFunc JiraHandleFunc) *Plugin {
+func newPlugin(t testing.TB, handleFunc JiraHandleFunc) *Plugin {
 	l := adaptLogger(t)
 	p := NewPlugin("test_atlassian_connect_01",
 		"a test of generating atlassian connect",
@@ -59,7 +61,7 @@ func newPlugin(t *testing.T, handleFunc JiraHandleFunc) *Plugin {
 			Name: "ShiftLeft",
 			URL:  "https://www.shiftleft.io",
 		},
-		false)// can't test this in true without significant changes
+		false) // can't test this in true without significant changes
 	err := p.AddLifecycleEvent(LCInstalled, "/installed", handleFunc)
 	if err != nil {
 		t.Error(err)
@@ -210,71 +212,84 @@ func TestPlugin_servesAtlasianJSON(t *testing.T) {
 	}
 }
 
-func TestPlugin_servesInstall(t *testing.T) {
-	var sentJII storage.JiraInstallInformation
-	hf := func(jii *storage.JiraInstallInformation, store storage.Store, w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Content-type", "application/json")
-		// jii is nil here
-		err := json.NewDecoder(r.Body).Decode(&sentJII)
-		if err != nil {
-			t.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
+func TestPlugin_HandleErrorCodeJSON(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	req := httptest.NewRequest(http.MethodGet, "/panel", nil)
+	req.Header.Set("Accept", "text/html;q=0.9, application/json")
+	req = req.WithContext(apicommunication.ContextWithRequestID(req.Context(), "reqid"))
+	rec := httptest.NewRecorder()
+	p.HandleErrorCode(http.StatusUnauthorized, rec, req)
+	var got ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
 	}
-
-	initialJii := &storage.JiraInstallInformation{
-		UserAccount:    "uaccount",
-		Key:            "ukey",
-		ClientKey:      "ckey",
-		OauthClientID:  "sdadsadsadas",
-		PublicKey:      "kasdhaskdjhaksjhdka",
-		SharedSecret:   "kiasjhdkajhdkajshd",
-		ServerVersion:  "1",
-		PluginsVersion: "2",
-		BaseURL:        "http://www.atlassian.net",
-		ProductType:    "jira",
-		Description:    "a jira plugin",
-		EventType:      "installed",
+	want := ErrorResponse{Code: http.StatusUnauthorized, Message: "Unauthorized", RequestID: "reqid"}
+	if rec.Code != http.StatusUnauthorized || got != want {
+		t.Fatalf("answered %d %+v, want %+v", rec.Code, got, want)
 	}
+}
 
-	t.Run("serves install", func(t *testing.T) {
-		p := newPlugin(t, hf)
-		w := &bytes.Buffer{}
-		if err := p.renderAtlassianConnectJSON(w); err != nil {
-			t.Fatal(err)
-		}
-		ts := httptest.NewServer(p.Router(nil))
-		defer ts.Close()
-		bodyBytes, err := json.MarshalIndent(initialJii, "", "    ")
-		if err != nil {
-			t.Fatal(err)
-		}
-		req, err := http.NewRequest(http.MethodPost, ts.URL+"/path/to/api/installed", bytes.NewReader(bodyBytes))
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		client := &http.Client{}
-		res, err := client.Do(req)
-		if err != nil {
-			t.Fatalf("%#v", err)
-		}
-		if res.StatusCode != 200 {
-			t.Logf("server responded %d", res.StatusCode)
-			t.FailNow()
+func TestPlugin_descriptorIsStable(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	route := NewRoutePath("/issue_created", map[string]string{"b": "{issue.id}", "a": "{project.id}", "c": "x"})
+	if got := route.url(); got != "/issue_created?a={project.id}&b={issue.id}&c=x" {
+		t.Fatalf("route url is %s", got)
+	}
+	panel := WebPanel{Key: "a-panel", URL: "/a"}
+	if err := p.AddWebPanel("", panel); err != nil {
+		t.Fatal(err)
+	}
+	panel.URL = "/b"
+	if err := p.UpdateWebPanel("", panel); err != nil {
+		t.Fatal(err)
+	}
+	var first, second bytes.Buffer
+	if err := p.renderAtlassianConnectJSON(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.renderAtlassianConnectJSON(&second); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Fatal("descriptor changed across renders")
+	}
+	panels := p.ac.Modules["webPanels"].([]WebPanel)
+	for _, wp := range panels {
+		if wp.Key == panel.Key && wp.URL != "/b" {
+			t.Fatalf("panel was not replaced: %+v", panels)
 		}
+	}
+}
 
-		marshalledSentJii, err := json.MarshalIndent(sentJII, "", "    ")
-		if err != nil {
+func TestPlugin_UpdateWebPanel(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	for _, key := range []string{"z-panel", "a-panel"} {
+		if err := p.AddWebPanel("webPanels", WebPanel{Key: key, URL: "/" + key}); err != nil {
 			t.Fatal(err)
 		}
-		if string(marshalledSentJii) != string(bodyBytes) {
-			t.Logf("%s\nis different from\n%s", marshalledSentJii, bodyBytes)
-			t.FailNow()
+	}
+	keys := func() []string {
+		var keys []string
+		for _, wp := range p.ac.Modules["webPanels"].([]WebPanel) {
+			keys = append(keys, wp.Key)
 		}
-
-	})
-
+		return keys
+	}
+	if err := p.UpdateWebPanel("", WebPanel{Key: "z-panel", URL: "/replaced"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"some-key", "z-panel", "a-panel"}
+	if got := keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("panels after replacing are %v, want %v", got, want)
+	}
+	if wp := p.ac.Modules["webPanels"].([]WebPanel)[1]; wp.URL != "/replaced" {
+		t.Fatalf("panel was not replaced: %+v", wp)
+	}
+	if err := p.UpdateWebPanel("", WebPanel{Key: "m-panel", URL: "/m-panel"}); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "m-panel")
+	if got := keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("panels after appending are %v, want %v", got, want)
+	}
 }
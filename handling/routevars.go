@@ -0,0 +1,140 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// routeVarRegexp matches the variables of mux path templates, ie {issueKey} or {id:[0-9]+}.
+var routeVarRegexp = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// WithVars returns a copy of the route whose path declares the passed mux variables, each bound
+// to the context parameter atlassian puts in its place, ie:
+//
+//	NewRoutePath("/issues/{issueKey}/updated", nil).WithVars(map[string]string{"issueKey": "issue.key"})
+//
+// is registered in the descriptor as /issues/{issue.key}/updated and routed as /issues/{issueKey}/updated,
+// handlers read the variables with Vars.
+func (r RoutePath) WithVars(vars map[string]string) RoutePath {
+	r.vars = make(map[string]string, len(vars))
+	for name, parameter := range vars {
+		r.vars[name] = parameter
+	}
+	return r
+}
+
+// validate returns an error if the variables in the path and the declared ones differ or are bound
+// to unknown context parameters.
+func (r *RoutePath) validate() error {
+	var problems []string
+	inPath := map[string]bool{}
+	for _, m := range routeVarRegexp.FindAllStringSubmatch(r.path, -1) {
+		name := m[1]
+		inPath[name] = true
+		parameter, declared := r.vars[name]
+		if !declared {
+			problems = append(problems, fmt.Sprintf("path variable %s is not declared", name))
+			continue
+		}
+		if err := validateContextParameter(parameter); err != nil {
+			problems = append(problems, fmt.Sprintf("path variable %s: %v", name, err))
+		}
+	}
+	for name := range r.vars {
+		if !inPath[name] {
+			problems = append(problems, fmt.Sprintf("declared variable %s is not in the path", name))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("route %s: %s", r.path, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// descriptorPath returns the path of the route with its variables replaced by the context
+// parameters they are bound to.
+func (r *RoutePath) descriptorPath() string {
+	if len(r.vars) == 0 {
+		return r.path
+	}
+	return routeVarRegexp.ReplaceAllStringFunc(r.path, func(v string) string {
+		name := routeVarRegexp.FindStringSubmatch(v)[1]
+		if parameter, ok := r.vars[name]; ok {
+			return "{" + parameter + "}"
+		}
+		return v
+	})
+}
+
+// expand returns the URL of the route with its path variables replaced by the value of the context
+// parameters they are bound to, and those values keyed by variable name. It fails if a value is
+// missing.
+func (r *RoutePath) expand(values map[string]string) (string, map[string]string, error) {
+	vars := make(map[string]string, len(r.vars))
+	var missing []string
+	expanded := routeVarRegexp.ReplaceAllStringFunc(r.path, func(v string) string {
+		name := routeVarRegexp.FindStringSubmatch(v)[1]
+		value, ok := values[r.vars[name]]
+		if !ok {
+			missing = append(missing, r.vars[name])
+			return v
+		}
+		vars[name] = value
+		return value
+	})
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("no value for context parameters %s", strings.Join(missing, ", "))
+	}
+	return r.withQuery(expanded), vars, nil
+}
+
+// RouteVars are the path variables of the route serving a request.
+type RouteVars map[string]string
+
+// Vars returns the path variables of the route serving r, see RoutePath.WithVars.
+func Vars(r *http.Request) RouteVars {
+	return mux.Vars(r)
+}
+
+// Get returns the variable called name, it fails if it is missing or empty.
+func (v RouteVars) Get(name string) (string, error) {
+	value := v[name]
+	if value == "" {
+		return "", fmt.Errorf("path variable %s is missing", name)
+	}
+	return value, nil
+}
+
+// Int64 returns the variable called name as an int64, ie for issue or project ids.
+func (v RouteVars) Int64(name string) (int64, error) {
+	value, err := v.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("path variable %s is not an integer: %w", name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,46 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestRoutePath_WithVars(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	route := NewRoutePath("/issues/{issueKey}/created/{projectId:[0-9]+}", map[string]string{"a": "b"}).
+		WithVars(map[string]string{"issueKey": "issue.key", "projectId": "project.id"})
+	if got := route.url(); got != "/issues/{issue.key}/created/{project.id}?a=b" {
+		t.Fatalf("route url is %s", got)
+	}
+	undeclared := NewRoutePath("/issues/{issueKey}", nil)
+	if err := p.AddWebhook(JiraIssueCreated, undeclared, fakeHandleFunc); err == nil {
+		t.Fatal("route with undeclared variables was accepted")
+	}
+	var got RouteVars
+	err := p.AddWebhook(JiraIssueCreated, route, func(_ *storage.JiraInstallInformation, _ storage.Store,
+		w http.ResponseWriter, r *http.Request) {
+		got = Vars(r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jii := &storage.JiraInstallInformation{ClientKey: "ckey", SharedSecret: "kiasjhdkajhdkajshd"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	handler := p.Router(nil)
+	handler.ServeHTTP(httptest.NewRecorder(),
+		signedRequest(t, http.MethodPost, "/path/to/api/issues/KEY-1/created/10000?a=b", jii))
+	if key, err := got.Get("issueKey"); err != nil || key != "KEY-1" {
+		t.Fatalf("issue key is %q, %v", key, err)
+	}
+	if id, err := got.Int64("projectId"); err != nil || id != 10000 {
+		t.Fatalf("project id is %d, %v", id, err)
+	}
+	if _, err := got.Get("missing"); err == nil {
+		t.Fatal("missing variable was found")
+	}
+}
@@ -0,0 +1,170 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Scopes an app can declare in its descriptor, see
+// https://developer.atlassian.com/cloud/jira/platform/scopes-for-connect-apps/
+// Each of READ, WRITE, DELETE, PROJECT_ADMIN and ADMIN implies the ones before it.
+const (
+	ScopeRead         = "READ"
+	ScopeWrite        = "WRITE"
+	ScopeDelete       = "DELETE"
+	ScopeProjectAdmin = "PROJECT_ADMIN"
+	ScopeAdmin        = "ADMIN"
+	ScopeActAsUser    = "ACT_AS_USER"
+)
+
+// scopeRank orders the scopes that imply each other.
+var scopeRank = map[string]int{
+	ScopeRead:         1,
+	ScopeWrite:        2,
+	ScopeDelete:       3,
+	ScopeProjectAdmin: 4,
+	ScopeAdmin:        5,
+}
+
+// adminPathPrefixes are API paths that require ADMIN for anything but reading.
+var adminPathPrefixes = []string{
+	"/rest/api/3/field",
+	"/rest/api/3/issuetype",
+	"/rest/api/3/notificationscheme",
+	"/rest/api/3/permissionscheme",
+	"/rest/api/3/priority",
+	"/rest/api/3/resolution",
+	"/rest/api/3/screens",
+	"/rest/api/3/status",
+	"/rest/api/3/workflow",
+	"/rest/api/3/workflowscheme",
+}
+
+// projectAdminPathPrefixes are API paths that require PROJECT_ADMIN for anything but reading.
+var projectAdminPathPrefixes = []string{
+	"/rest/api/3/project/",
+	"/rest/api/3/component",
+	"/rest/api/3/version",
+}
+
+// APIUsage declares a call the plugin makes to the product REST API, it is used to infer the
+// scopes the plugin needs (see InferScopes).
+type APIUsage struct {
+	Method string
+	Path   string
+	// AsUser must be true if the call is made impersonating a user (see AsUserByAccountID).
+	AsUser bool
+}
+
+// scope returns the scope required by the usage, ACT_AS_USER aside.
+func (u APIUsage) scope() string {
+	switch strings.ToUpper(u.Method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	}
+	if strings.ToUpper(u.Method) == http.MethodPost && strings.TrimRight(u.Path, "/") == "/rest/api/3/project" {
+		return ScopeAdmin
+	}
+	for _, prefix := range adminPathPrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			return ScopeAdmin
+		}
+	}
+	for _, prefix := range projectAdminPathPrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			return ScopeProjectAdmin
+		}
+	}
+	if strings.ToUpper(u.Method) == http.MethodDelete {
+		return ScopeDelete
+	}
+	return ScopeWrite
+}
+
+// DeclareAPIUsage records calls the plugin makes to the product API so InferScopes can compute
+// the scopes it needs.
+func (p *Plugin) DeclareAPIUsage(usages ...APIUsage) {
+	p.apiUsage = append(p.apiUsage, usages...)
+}
+
+// InferScopes returns the minimal scopes required by the registered modules and the API usage
+// declared with DeclareAPIUsage, since scopes imply the lesser ones at most one of READ, WRITE,
+// DELETE, PROJECT_ADMIN and ADMIN is returned, along with ACT_AS_USER if needed.
+func (p *Plugin) InferScopes() []string {
+	needed := ""
+	need := func(scope string) {
+		if scopeRank[scope] > scopeRank[needed] {
+			needed = scope
+		}
+	}
+	if len(p.webhooks) > 0 || len(p.jiraIssueFields) > 0 {
+		need(ScopeRead)
+	}
+	actAsUser := false
+	for _, u := range p.apiUsage {
+		need(u.scope())
+		actAsUser = actAsUser || u.AsUser
+	}
+	var scopes []string
+	if needed != "" {
+		scopes = append(scopes, needed)
+	}
+	if actAsUser {
+		scopes = append(scopes, ScopeActAsUser)
+	}
+	return scopes
+}
+
+// UseInferredScopes replaces the scopes passed to NewPlugin with the ones returned by InferScopes,
+// it must be called once all modules are registered and API usage declared.
+func (p *Plugin) UseInferredScopes() {
+	p.ac.Scopes = p.InferScopes()
+}
+
+// ExcessScopes returns the declared scopes that exceed the ones returned by InferScopes, apps
+// requesting more scopes than they need fail the marketplace security review.
+func (p *Plugin) ExcessScopes() []string {
+	inferred := p.InferScopes()
+	maxRank, actAsUser := 0, false
+	for _, s := range inferred {
+		if s == ScopeActAsUser {
+			actAsUser = true
+		} else if scopeRank[s] > maxRank {
+			maxRank = scopeRank[s]
+		}
+	}
+	var excess []string
+	for _, s := range p.ac.Scopes {
+		s = strings.ToUpper(s)
+		if s == ScopeActAsUser && !actAsUser || scopeRank[s] > maxRank {
+			excess = append(excess, s)
+		}
+	}
+	return excess
+}
+
+// warnExcessScopes logs the declared scopes that exceed the inferred ones, only if API usage was
+// declared since otherwise the plugin needs can not be known.
+func (p *Plugin) warnExcessScopes() {
+	if len(p.apiUsage) == 0 {
+		return
+	}
+	if excess := p.ExcessScopes(); len(excess) > 0 {
+		p.logger.Printf("WARNING: declared scopes %s exceed the inferred ones %s",
+			strings.Join(excess, ", "), strings.Join(p.InferScopes(), ", "))
+	}
+}
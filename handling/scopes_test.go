@@ -0,0 +1,29 @@
+package handling
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPlugin_InferScopes(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.DeclareAPIUsage(
+		APIUsage{Method: http.MethodGet, Path: "/rest/api/3/issue/KEY-1"},
+		APIUsage{Method: http.MethodPut, Path: "/rest/api/3/issue/KEY-1"},
+	)
+	if got := p.InferScopes(); !reflect.DeepEqual(got, []string{ScopeWrite}) {
+		t.Fatalf("inferred scopes are %v", got)
+	}
+	// newPlugin declares READ, WRITE and ACT_AS_USER
+	if got := p.ExcessScopes(); !reflect.DeepEqual(got, []string{ScopeActAsUser}) {
+		t.Fatalf("excess scopes are %v", got)
+	}
+	p.DeclareAPIUsage(APIUsage{Method: http.MethodPost, Path: "/rest/api/3/workflow", AsUser: true})
+	if got := p.InferScopes(); !reflect.DeepEqual(got, []string{ScopeAdmin, ScopeActAsUser}) {
+		t.Fatalf("inferred scopes are %v", got)
+	}
+	if got := p.ExcessScopes(); len(got) != 0 {
+		t.Fatalf("excess scopes are %v", got)
+	}
+}
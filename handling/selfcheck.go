@@ -0,0 +1,196 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// SelfCheckStatus is the outcome of a single self check.
+type SelfCheckStatus string
+
+const (
+	// SelfCheckOK means the check passed.
+	SelfCheckOK SelfCheckStatus = "ok"
+	// SelfCheckFailed means the check found a problem, described in the result detail.
+	SelfCheckFailed SelfCheckStatus = "failed"
+	// SelfCheckSkipped means the check could not be performed, ie the store can not be pinged.
+	SelfCheckSkipped SelfCheckStatus = "skipped"
+)
+
+// SelfCheckResult is the result of a single self check.
+type SelfCheckResult struct {
+	Name   string          `json:"name"`
+	Status SelfCheckStatus `json:"status"`
+	Detail string          `json:"detail,omitempty"`
+}
+
+// SelfCheckReport holds the results of SelfCheck, it marshals to JSON for deploy tooling.
+type SelfCheckReport struct {
+	Checks []SelfCheckResult `json:"checks"`
+}
+
+// OK returns true if no check failed.
+func (r *SelfCheckReport) OK() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the failed checks.
+func (r *SelfCheckReport) Failed() []SelfCheckResult {
+	var failed []SelfCheckResult
+	for _, c := range r.Checks {
+		if c.Status == SelfCheckFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+func (r *SelfCheckReport) add(name string, err error) {
+	if err != nil {
+		r.Checks = append(r.Checks, SelfCheckResult{Name: name, Status: SelfCheckFailed, Detail: err.Error()})
+		return
+	}
+	r.Checks = append(r.Checks, SelfCheckResult{Name: name, Status: SelfCheckOK})
+}
+
+// selfCheckTimeout bounds the base URL reachability check.
+const selfCheckTimeout = 10 * time.Second
+
+// SelfCheck verifies the plugin is fit to be deployed, it is meant to be run by deploy gates once
+// the plugin is fully configured. It checks that:
+//
+//	descriptor: the descriptor has the fields atlassian requires.
+//	store: the store is reachable, if it implements storage.Pinger.
+//	baseURL: the base URL is served over https with a valid certificate.
+//	routes: no two routes of the plugin share a path and none is shadowed by an unauthenticated prefix.
+func (p *Plugin) SelfCheck(ctx context.Context) *SelfCheckReport {
+	report := &SelfCheckReport{}
+	report.add("descriptor", p.checkDescriptor())
+	pinger, ok := p.store.(storage.Pinger)
+	var pingErr error
+	if ok {
+		pingErr = pinger.Ping(ctx)
+	}
+	if ok && !errors.Is(pingErr, storage.ErrUnsupported) {
+		report.add("store", pingErr)
+	} else {
+		report.Checks = append(report.Checks, SelfCheckResult{Name: "store", Status: SelfCheckSkipped,
+			Detail: fmt.Sprintf("%T does not implement storage.Pinger", p.store)})
+	}
+	report.add("baseURL", p.checkBaseURLReachable(ctx))
+	report.add("routes", p.checkRouteConflicts())
+	return report
+}
+
+var descriptorKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9\-._]{1,64}$`)
+
+func (p *Plugin) checkDescriptor() error {
+	var problems []string
+	if key := p.ac.Key + p.keyNamespace; !descriptorKeyRegexp.MatchString(key) {
+		problems = append(problems, fmt.Sprintf("key %q must be 1 to 64 alphanumerics, dots, dashes or underscores", key))
+	}
+	if p.ac.Name == "" {
+		problems = append(problems, "name is empty")
+	}
+	if u, err := url.Parse(p.ac.BaseURL); err != nil || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("base URL %q is not an absolute URL", p.ac.BaseURL))
+	}
+	if p.ac.Authentication.Type != defaultPluginAuthentication.Type {
+		problems = append(problems, fmt.Sprintf("authentication type is %q", p.ac.Authentication.Type))
+	}
+	if p.ac.Lifecycle.Installed == "" {
+		problems = append(problems, "there is no installed lifecycle event")
+	}
+	for event := range p.webhooks {
+		if err := p.validateWebhookEvent(event); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (p *Plugin) checkBaseURLReachable(ctx context.Context) error {
+	u, err := url.Parse(p.ac.BaseURL)
+	if err != nil {
+		return fmt.Errorf("parsing base URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("base URL %q is not https, atlassian only talks to apps over TLS", p.ac.BaseURL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("building request to base URL: %w", err)
+	}
+	// any answer will do, the point is the TLS handshake succeeding.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("reaching base URL: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *Plugin) checkRouteConflicts() error {
+	owners := map[string][]string{"/atlassian-connect.json": {"descriptor"}}
+	for event, route := range p.lifecycleRoutes {
+		owners[route] = append(owners[route], "lifecycle "+string(event))
+	}
+	for event, route := range p.webhookRoutes {
+		owners[route.path] = append(owners[route.path], "webhook "+event)
+	}
+	for _, u := range p.unauthenticatedRoutes {
+		owners[u.route] = append(owners[u.route], "unauthenticated handler")
+	}
+	if p.sessionRoute != "" {
+		owners[p.sessionRoute] = append(owners[p.sessionRoute], "session tokens")
+	}
+	if p.moduleToggles != nil {
+		owners[p.moduleToggles.route] = append(owners[p.moduleToggles.route], "module toggles")
+	}
+	var problems []string
+	for route, names := range owners {
+		if len(names) > 1 {
+			problems = append(problems, fmt.Sprintf("%s is served by %s", route, strings.Join(names, ", ")))
+		}
+		for _, u := range p.unauthenticatedRoutes {
+			if u.prefix && u.route != route && strings.HasPrefix(route, u.route) {
+				problems = append(problems, fmt.Sprintf("%s (%s) is under unauthenticated prefix %s",
+					route, strings.Join(names, ", "), u.route))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
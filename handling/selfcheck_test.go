@@ -0,0 +1,89 @@
+package handling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// pingStore is a store whose backend answers pings with err.
+type pingStore struct {
+	*storage.MemoryStore
+	err error
+}
+
+func (s pingStore) Ping(context.Context) error {
+	return s.err
+}
+
+func TestPlugin_SelfCheck(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	results := func(p *Plugin) map[string]SelfCheckResult {
+		report := p.SelfCheck(context.Background())
+		byName := map[string]SelfCheckResult{}
+		for _, c := range report.Checks {
+			byName[c.Name] = c
+		}
+		if len(byName) != 4 {
+			t.Fatalf("ran checks %+v", report.Checks)
+		}
+		return byName
+	}
+
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = pingStore{MemoryStore: storage.NewMemoryStore(0)}
+	got := results(p)
+	for _, name := range []string{"descriptor", "store", "routes"} {
+		if got[name].Status != SelfCheckOK {
+			t.Fatalf("%s check of a healthy plugin: %+v", name, got[name])
+		}
+	}
+
+	// the certificate of the test server is not trusted.
+	p.ac.BaseURL = srv.URL
+	if got := results(p)["baseURL"]; got.Status != SelfCheckFailed || !strings.Contains(got.Detail, "certificate") {
+		t.Fatalf("base URL with an untrusted certificate: %+v", got)
+	}
+	p.ac.BaseURL = "http://plugin.example.com"
+	if got := results(p)["baseURL"]; got.Status != SelfCheckFailed || !strings.Contains(got.Detail, "not https") {
+		t.Fatalf("plain http base URL: %+v", got)
+	}
+
+	p.ac.Key = "has spaces"
+	p.store = pingStore{MemoryStore: storage.NewMemoryStore(0), err: errors.New("connection refused")}
+	if err := p.AddUnauthenticatedHandler("/issue", true, http.NotFoundHandler()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddUnauthenticatedHandler("/installed", false, http.NotFoundHandler()); err != nil {
+		t.Fatal(err)
+	}
+	got = results(p)
+	if got["descriptor"].Status != SelfCheckFailed || !strings.Contains(got["descriptor"].Detail, `key "has spaces"`) {
+		t.Fatalf("descriptor with an invalid key: %+v", got["descriptor"])
+	}
+	if got["store"].Status != SelfCheckFailed || got["store"].Detail != "connection refused" {
+		t.Fatalf("unreachable store: %+v", got["store"])
+	}
+	routes := got["routes"].Detail
+	if got["routes"].Status != SelfCheckFailed || !strings.Contains(routes, "/installed is served by") ||
+		!strings.Contains(routes, "/issue_updated (webhook jira:issue_updated) is under unauthenticated prefix /issue") {
+		t.Fatalf("conflicting routes: %+v", got["routes"])
+	}
+
+	p.store = storage.NewMemoryStore(0)
+	report := p.SelfCheck(context.Background())
+	if report.OK() || len(report.Failed()) != 3 {
+		t.Fatalf("report is ok %v with failures %+v", report.OK(), report.Failed())
+	}
+	for _, c := range report.Checks {
+		if c.Name == "store" && c.Status != SelfCheckSkipped {
+			t.Fatalf("store that can not be pinged: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2/jira"
+)
+
+// sessionTokenSources are the places where front ends usually put the context token.
+const sessionTokenSources = apicommunication.TokenSourceQuery |
+	apicommunication.TokenSourceJWTHeader | apicommunication.TokenSourceBearerHeader
+
+// SessionClaims are the claims of the session tokens issued by the plugin.
+type SessionClaims struct {
+	jwt.StandardClaims
+	ClientKey string `json:"clientKey"`
+}
+
+// SessionToken is the body returned by the session token route.
+type SessionToken struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// EnableSessionTokens makes the plugin Router serve route, which exchanges a valid connect context JWT
+// for a session token signed with key and valid for lifetime. Said token can then be used by the app's
+// front end to call routes protected by SessionMiddleware without carrying atlassian JWTs around.
+func (p *Plugin) EnableSessionTokens(route string, key []byte, lifetime time.Duration) error {
+	if len(key) == 0 {
+		return fmt.Errorf("a key is required to sign session tokens")
+	}
+	if lifetime <= 0 {
+		return fmt.Errorf("session token lifetime must be positive")
+	}
+	p.sessionRoute = route
+	p.sessionKey = key
+	p.sessionLifetime = lifetime
+	return nil
+}
+
+func (p *Plugin) issueSessionToken(jii *storage.JiraInstallInformation, _ storage.Store,
+	w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	claims := &SessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    p.ac.Key,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(p.sessionLifetime).Unix(),
+		},
+		ClientKey: jii.ClientKey,
+	}
+	if contextClaims, ok := ClaimsFromContext(r.Context()); ok {
+		claims.Subject = contextClaims.AccountID()
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(p.sessionKey)
+	if err != nil {
+		p.logger.Printf("ERROR: signing session token: %v", err)
+		p.HandleErrorCode(http.StatusInternalServerError, w, r)
+		return
+	}
+	w.Header().Add("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(SessionToken{Token: signed, ExpiresAt: claims.ExpiresAt}); err != nil {
+		p.logger.Printf("ERROR: writing session token: %v", err)
+	}
+}
+
+// SessionMiddleware validates a session token issued by the route set with EnableSessionTokens, passed as
+// an `Authorization: Bearer` header, and stores the tenant in the request context before invoking next.
+func (p *Plugin) SessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(p.sessionKey) == 0 {
+			p.logger.Printf("ERROR: session middleware used without enabling session tokens")
+			p.HandleErrorCode(http.StatusInternalServerError, w, r)
+			return
+		}
+		token, err := apicommunication.ExtractToken(r, apicommunication.TokenSourceBearerHeader)
+		if err != nil {
+			p.HandleErrorCode(http.StatusUnauthorized, w, r)
+			return
+		}
+		claims := &SessionClaims{}
+		_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+			}
+			return p.sessionKey, nil
+		})
+		if err != nil || claims.Issuer != p.ac.Key {
+			p.HandleErrorCode(http.StatusUnauthorized, w, r)
+			return
+		}
+		jii, err := apicommunication.LoadInstallInformation(p.store, claims.ClientKey)
+		if err != nil {
+			p.logger.Printf("ERROR: loading session tenant: %v", err)
+			p.HandleError(err, w, r)
+			return
+		}
+		ctxClaims := &apicommunication.Claims{
+			ClaimSet: jira.ClaimSet{
+				Issuer:    claims.ClientKey,
+				Subject:   claims.Subject,
+				ExpiresIn: claims.ExpiresAt,
+				IssuedAt:  claims.IssuedAt,
+			},
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithTenant(r.Context(), jii, ctxClaims)))
+	})
+}
@@ -0,0 +1,91 @@
+package handling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestPlugin_SessionTokens(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("session-key")
+	if err := p.EnableSessionTokens("/session", key, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var tenant, account string
+	protected := p.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := TenantFromContext(r.Context())
+		claims, _ := ClaimsFromContext(r.Context())
+		tenant, account = got.ClientKey, claims.AccountID()
+	}))
+	call := func(token string) int {
+		tenant, account = "", ""
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		return w.Code
+	}
+	sign := func(claims *SessionClaims, key []byte) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// a connect context JWT is exchanged for a session token accepted by the middleware.
+	w := httptest.NewRecorder()
+	p.Router(nil).ServeHTTP(w, signedRequest(t, http.MethodGet, "/path/to/api/session", jii))
+	if w.Code != http.StatusOK {
+		t.Fatalf("session route answered %d", w.Code)
+	}
+	var session SessionToken
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(time.Unix(session.ExpiresAt, 0)) > time.Minute {
+		t.Fatalf("session token expires at %d", session.ExpiresAt)
+	}
+	if code := call(session.Token); code != http.StatusOK || tenant != "ck" || account != "someaccountid" {
+		t.Fatalf("session token got %d for tenant %q and account %q", code, tenant, account)
+	}
+
+	valid := func() *SessionClaims {
+		return &SessionClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    p.ac.Key,
+				IssuedAt:  time.Now().Unix(),
+				ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			},
+			ClientKey: "ck",
+		}
+	}
+	expired := valid()
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	otherApp := valid()
+	otherApp.Issuer = "io.other.app"
+	otherTenant := valid()
+	otherTenant.ClientKey = "uninstalled"
+	for name, token := range map[string]string{
+		"expired":      sign(expired, key),
+		"wrong key":    sign(valid(), []byte("another-key")),
+		"other app":    sign(otherApp, key),
+		"other tenant": sign(otherTenant, key),
+		"no token":     "",
+	} {
+		if code := call(token); code < http.StatusBadRequest || tenant != "" {
+			t.Errorf("%s session token got %d for tenant %q", name, code, tenant)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// snapshotSetting is the tenant setting install snapshots are saved to.
+const snapshotSetting = "snapshot"
+
+// EnableInstallSnapshots makes HandleInstall capture a apicommunication.TenantSnapshot of every
+// installing tenant and save it in the tenant settings, it fails if the store does not implement
+// storage.TenantSettings.
+// Snapshots are captured asynchronously once jira was answered, as OnFirstInstall callbacks are,
+// and on re-installs too since those follow upgrades.
+func (p *Plugin) EnableInstallSnapshots() error {
+	if !storage.Supports(p.store, (*storage.TenantSettings)(nil)) {
+		return fmt.Errorf("%T can not store tenant settings", p.store)
+	}
+	p.installSnapshots = true
+	return nil
+}
+
+// captureInstallSnapshot captures and saves the snapshot of the tenant.
+func (p *Plugin) captureInstallSnapshot(ctx context.Context, jii *storage.JiraInstallInformation) error {
+	client, err := apicommunication.NewHostClient(ctx, jii, "", p.ac.Scopes)
+	if err != nil {
+		return fmt.Errorf("creating host client: %w", err)
+	}
+	snapshot, err := client.CaptureSnapshotCtx(ctx)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshaling snapshot: %w", err)
+	}
+	if err := p.store.(storage.TenantSettings).SetSetting(jii.ClientKey, snapshotSetting, string(raw)); err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	return nil
+}
+
+// InstallSnapshot returns the snapshot captured on the last install of the tenant, or nil if there
+// is none, see EnableInstallSnapshots.
+func (p *Plugin) InstallSnapshot(clientKey string) (*apicommunication.TenantSnapshot, error) {
+	if !storage.Supports(p.store, (*storage.TenantSettings)(nil)) {
+		return nil, fmt.Errorf("%T can not store tenant settings", p.store)
+	}
+	settings := p.store.(storage.TenantSettings)
+	raw, err := settings.GetSetting(clientKey, snapshotSetting)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot of %s: %w", clientKey, err)
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	snapshot := &apicommunication.TenantSnapshot{}
+	if err := json.Unmarshal([]byte(raw), snapshot); err != nil {
+		return nil, fmt.Errorf("decoding snapshot of %s: %w", clientKey, err)
+	}
+	return snapshot, nil
+}
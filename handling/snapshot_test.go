@@ -0,0 +1,56 @@
+package handling
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_InstallSnapshots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/3/serverInfo":
+			w.Write([]byte(`{"serverTitle":"ACME","deploymentType":"Cloud","version":"1001.0.0"}`))
+		case "/rest/api/3/applicationrole":
+			w.Write([]byte(`[{"key":"jira-software"},{"key":"jira-core"}]`))
+		case "/rest/api/3/myself":
+			w.Write([]byte(`{"accountId":"app","locale":"de_DE","timeZone":"Europe/Berlin"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := newPlugin(t, fakeHandleFunc)
+	if err := p.EnableInstallSnapshots(); err == nil {
+		t.Fatal("enabled snapshots with a store that can not keep them")
+	}
+	if p.store = storage.NewCachedStore(p.store, time.Minute); p.EnableInstallSnapshots() == nil {
+		t.Fatal("enabled snapshots with a decorated store that can not keep them")
+	}
+	p.store = storage.NewMemoryStore(0)
+	if err := p.EnableInstallSnapshots(); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, err := p.InstallSnapshot("ck"); err != nil || snapshot != nil {
+		t.Fatalf("tenant without a snapshot returned %+v, %v", snapshot, err)
+	}
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret", BaseURL: srv.URL}
+	if err := p.captureInstallSnapshot(context.Background(), jii); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := p.InstallSnapshot("ck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.ServerTitle != "ACME" || snapshot.DeploymentType != "Cloud" || snapshot.Locale != "de_DE" ||
+		snapshot.TimeZone != "Europe/Berlin" || snapshot.CapturedAt.IsZero() ||
+		!reflect.DeepEqual(snapshot.Applications, []string{"jira-core", "jira-software"}) {
+		t.Fatalf("captured %+v", snapshot)
+	}
+}
@@ -0,0 +1,56 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// FrameAncestorsCSP is the Content-Security-Policy that allows resources to be loaded in iframes
+// inside atlassian cloud products only.
+const FrameAncestorsCSP = "frame-ancestors 'self' https://*.atlassian.net https://*.jira.com"
+
+// AddStaticAssets serves the files in fs under route, relative to the base route, without
+// authentication. Responses are cacheable for maxAge (no-cache if zero) and carry FrameAncestorsCSP so
+// html files can be loaded in jira iframes. Directory listings are not served.
+func (p *Plugin) AddStaticAssets(route string, fs http.FileSystem, maxAge time.Duration) error {
+	if fs == nil {
+		return fmt.Errorf("a file system is required to serve static assets")
+	}
+	route = "/" + strings.Trim(route, "/")
+	cacheControl := "no-cache"
+	if maxAge > 0 {
+		cacheControl = fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+	}
+	fileServer := http.StripPrefix(path.Join(p.baseRoute, route), http.FileServer(fs))
+	return p.AddUnauthenticatedHandler(route+"/", true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/") {
+			p.HandleErrorCode(http.StatusNotFound, w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Content-Security-Policy", FrameAncestorsCSP)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,54 @@
+package handling
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlugin_AddStaticAssets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "js"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "js", "app.js"), []byte("console.log(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newPlugin(t, fakeHandleFunc)
+	if err := p.AddStaticAssets("/static/", nil, time.Hour); err == nil {
+		t.Fatal("served assets without a file system")
+	}
+	if err := p.AddStaticAssets("/static/", http.Dir(dir), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	router := p.Router(nil)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/path/to/api/static/js/app.js")
+	if w.Code != http.StatusOK || w.Body.String() != "console.log(1)" {
+		t.Fatalf("asset answered %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Fatalf("asset is cached with %q", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy"); got != FrameAncestorsCSP {
+		t.Fatalf("asset is served with policy %q", got)
+	}
+	if w := serve(http.MethodGet, "/path/to/api/static/js/"); w.Code != http.StatusNotFound {
+		t.Fatalf("directory listing answered %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/path/to/api/static/js/missing.js"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing asset answered %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/path/to/api/static/js/app.js"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST answered %d", w.Code)
+	}
+}
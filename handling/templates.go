@@ -0,0 +1,87 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllJSURL is the location of the AP.js library served by atlassian's CDN.
+const AllJSURL = "https://connect-cdn.atl-paas.net/all.js"
+
+// TemplateFuncs returns functions to bootstrap AP.js in html/template pages loaded in jira iframes,
+// the request must be the one for the iframe so its xdm_e and cp arguments can be read:
+//
+//	apScript: the script tag loading all.js.
+//	apMetaTags: the meta tags AP.js and the app front end need (local base url and context token).
+//	apHostURL: the base url of the host product (xdm_e + cp), only if it matches the tenant
+//	  stored in the request context (see TenantMiddleware), empty otherwise.
+func (p *Plugin) TemplateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"apScript": func() template.HTML {
+			return template.HTML(`<script src="` + template.HTMLEscapeString(AllJSURL) +
+				`" type="text/javascript" data-options="sizeToParent:true"></script>`)
+		},
+		"apMetaTags": func() template.HTML {
+			var b strings.Builder
+			b.WriteString(`<meta name="ap-local-base-url" content="`)
+			b.WriteString(template.HTMLEscapeString(p.ac.BaseURL))
+			b.WriteString(`">`)
+			if token := r.URL.Query().Get("jwt"); token != "" {
+				b.WriteString(`<meta name="token" content="`)
+				b.WriteString(template.HTMLEscapeString(token))
+				b.WriteString(`">`)
+			}
+			return template.HTML(b.String())
+		},
+		"apHostURL": func() string {
+			return hostURL(r)
+		},
+	}
+}
+
+// hostURL returns xdm_e + cp from the request if it is an https url of the tenant in the context.
+func hostURL(r *http.Request) string {
+	jii, ok := TenantFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	q := r.URL.Query()
+	xdmE, err := url.Parse(q.Get("xdm_e"))
+	if err != nil || xdmE.Scheme != "https" || xdmE.Host == "" {
+		return ""
+	}
+	tenantURL, err := url.Parse(jii.BaseURL)
+	if err != nil || !strings.EqualFold(tenantURL.Host, xdmE.Host) {
+		return ""
+	}
+	cp := q.Get("cp")
+	if !cleanContextPath(cp) {
+		return ""
+	}
+	return strings.TrimRight("https://"+xdmE.Host+cp, "/")
+}
+
+// cleanContextPath returns true if cp, the context path of the host product, can only be appended
+// to its host as a path, ie it can not turn the host into userinfo or start a new authority.
+func cleanContextPath(cp string) bool {
+	if cp == "" {
+		return true
+	}
+	return strings.HasPrefix(cp, "/") && !strings.ContainsAny(cp, `@\`) && !strings.Contains(cp, "//")
+}
@@ -0,0 +1,73 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// TenantFunc is invoked by ForEachTenant for each installed tenant.
+type TenantFunc func(ctx context.Context, jii *storage.JiraInstallInformation) error
+
+// TenantErrors is returned by ForEachTenant when f failed for some tenants, keyed by client key.
+type TenantErrors map[string]error
+
+func (e TenantErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", k, e[k]))
+	}
+	return fmt.Sprintf("failed for %d tenants: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ForEachTenant invokes f for every tenant in the plugin store, ie for backfills, migrations or
+// broadcast notifications, which requires the store to implement storage.Lister. A failure for a
+// tenant does not stop the iteration, they are logged and returned together as TenantErrors.
+// It returns how many tenants f succeeded for.
+func (p *Plugin) ForEachTenant(ctx context.Context, f TenantFunc) (int, error) {
+	if !storage.Supports(p.store, (*storage.Lister)(nil)) {
+		return 0, fmt.Errorf("%T can not list installations", p.store)
+	}
+	lister := p.store.(storage.Lister)
+	var succeeded int
+	failed := TenantErrors{}
+	err := storage.ForEachInstallation(ctx, lister, storage.DefaultPrefetchPageSize,
+		func(jii *storage.JiraInstallInformation) error {
+			if err := f(ContextWithTenant(ctx, jii, nil), jii); err != nil {
+				p.logger.Printf("ERROR: processing tenant %s: %v", jii.ClientKey, err)
+				failed[jii.ClientKey] = err
+				return nil
+			}
+			succeeded++
+			return nil
+		})
+	if err != nil {
+		return succeeded, err
+	}
+	if len(failed) > 0 {
+		return succeeded, failed
+	}
+	return succeeded, nil
+}
@@ -0,0 +1,40 @@
+package handling
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_ForEachTenant(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	if _, err := p.ForEachTenant(context.Background(), nil); err == nil {
+		t.Fatal("iterated a store that can not list installations")
+	}
+	store := storage.NewMemoryStore(0)
+	for _, ck := range []string{"a", "b", "c"} {
+		store.Preload(&storage.JiraInstallInformation{ClientKey: ck})
+	}
+	p.store = store
+	var visited []string
+	n, err := p.ForEachTenant(context.Background(), func(ctx context.Context, jii *storage.JiraInstallInformation) error {
+		if inCtx, ok := TenantFromContext(ctx); !ok || inCtx.ClientKey != jii.ClientKey {
+			t.Errorf("tenant %s is not in the context", jii.ClientKey)
+		}
+		visited = append(visited, jii.ClientKey)
+		if jii.ClientKey == "b" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	failed, ok := err.(TenantErrors)
+	if !ok || len(failed) != 1 || failed["b"] == nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n != 2 || !reflect.DeepEqual(visited, []string{"a", "b", "c"}) {
+		t.Fatalf("succeeded for %d, visited %v", n, visited)
+	}
+}
@@ -0,0 +1,226 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// AdminCheck returns true if the user with the passed account ID administers the tenant.
+type AdminCheck func(r *http.Request, jii *storage.JiraInstallInformation, accountID string) (bool, error)
+
+// JiraAdminCheck is an AdminCheck asking jira whether the user has the Administer Jira global
+// permission, the plugin needs the ADMIN scope for it.
+func JiraAdminCheck(r *http.Request, jii *storage.JiraInstallInformation, accountID string) (bool, error) {
+	client, err := apicommunication.NewHostClient(r.Context(), jii, "", nil)
+	if err != nil {
+		return false, err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"accountId":         accountID,
+		"globalPermissions": []string{"ADMINISTER"},
+	})
+	if err != nil {
+		return false, fmt.Errorf("marshaling permissions check: %w", err)
+	}
+	var granted struct {
+		GlobalPermissions []string `json:"globalPermissions"`
+	}
+	_, err = client.DoWithTargetCtx(r.Context(), http.MethodPost, "/rest/api/3/permissions/check", nil, bytes.NewReader(body),
+		&granted, []int{http.StatusOK})
+	if err != nil {
+		return false, fmt.Errorf("checking permissions of %s: %w", accountID, err)
+	}
+	for _, p := range granted.GlobalPermissions {
+		if p == "ADMINISTER" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type moduleToggles struct {
+	route    string
+	settings storage.TenantSettings
+	isAdmin  AdminCheck
+}
+
+// ModuleState is a module of the plugin and whether it is enabled for a tenant, it is what the
+// module toggle route lists and accepts.
+type ModuleState struct {
+	Type    string `json:"type"`
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+}
+
+// moduleTogglesSetting is the tenant setting holding the modules disabled for the tenant, as a
+// JSON list of moduleToggleID, so rendering the descriptor reads it a single time.
+const moduleTogglesSetting = "modules.disabled"
+
+func moduleToggleID(moduleType, key string) string {
+	return moduleType + "/" + key
+}
+
+// EnableModuleToggles makes the plugin Router serve route, which lets tenant admins list the plugin
+// modules (GET) and enable or disable them (PUT a ModuleState), disabled modules are left out of
+// the descriptor served to the tenant. Toggles are persisted in the plugin store, which must
+// implement storage.TenantSettings. isAdmin decides who is an admin, JiraAdminCheck if nil.
+func (p *Plugin) EnableModuleToggles(route string, isAdmin AdminCheck) error {
+	if !storage.Supports(p.store, (*storage.TenantSettings)(nil)) {
+		return fmt.Errorf("%T does not implement storage.TenantSettings", p.store)
+	}
+	settings := p.store.(storage.TenantSettings)
+	if isAdmin == nil {
+		isAdmin = JiraAdminCheck
+	}
+	p.moduleToggles = &moduleToggles{route: route, settings: settings, isAdmin: isAdmin}
+	return nil
+}
+
+// readDisabledModules returns the moduleToggleID of the modules disabled for the tenant.
+func (p *Plugin) readDisabledModules(clientKey string) (map[string]bool, error) {
+	raw, err := p.moduleToggles.settings.GetSetting(clientKey, moduleTogglesSetting)
+	if err != nil || raw == "" {
+		return map[string]bool{}, err
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(raw), &ids); err != nil {
+		return nil, fmt.Errorf("decoding disabled modules: %w", err)
+	}
+	disabled := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		disabled[id] = true
+	}
+	return disabled, nil
+}
+
+// disabledModules behaves like readDisabledModules but logs failures, every module is enabled then
+// as it is if jii is nil or toggles are not enabled.
+func (p *Plugin) disabledModules(jii *storage.JiraInstallInformation) map[string]bool {
+	if jii == nil || p.moduleToggles == nil {
+		return nil
+	}
+	disabled, err := p.readDisabledModules(jii.ClientKey)
+	if err != nil {
+		p.logger.Printf("ERROR: reading module toggles of %s: %v", jii.ClientKey, err)
+		return nil
+	}
+	return disabled
+}
+
+// setModuleEnabled enables or disables the module for the tenant.
+func (p *Plugin) setModuleEnabled(clientKey string, state ModuleState) error {
+	// the toggles of a tenant are a single setting, concurrent changes must not overwrite each other.
+	return storage.WithLock(p.store, clientKey, func() error {
+		disabled, err := p.readDisabledModules(clientKey)
+		if err != nil {
+			return err
+		}
+		disabled[moduleToggleID(state.Type, state.Key)] = !state.Enabled
+		ids := make([]string, 0, len(disabled))
+		for id, off := range disabled {
+			if off {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		raw, err := json.Marshal(ids)
+		if err != nil {
+			return fmt.Errorf("encoding disabled modules: %w", err)
+		}
+		return p.moduleToggles.settings.SetSetting(clientKey, moduleTogglesSetting, string(raw))
+	})
+}
+
+// moduleStates returns every module with a key and whether it is enabled for the tenant.
+func (p *Plugin) moduleStates(jii *storage.JiraInstallInformation) []ModuleState {
+	disabled := p.disabledModules(jii)
+	var states []ModuleState
+	for moduleType, modules := range p.ac.Modules {
+		v := reflect.ValueOf(modules)
+		if v.Kind() != reflect.Slice {
+			continue
+		}
+		for i := 0; i < v.Len(); i++ {
+			if key, ok := moduleKey(v.Index(i)); ok {
+				states = append(states, ModuleState{
+					Type:    moduleType,
+					Key:     key,
+					Enabled: !disabled[moduleToggleID(moduleType, key)],
+				})
+			}
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Type != states[j].Type {
+			return states[i].Type < states[j].Type
+		}
+		return states[i].Key < states[j].Key
+	})
+	return states
+}
+
+func (p *Plugin) handleModuleToggles(jii *storage.JiraInstallInformation, _ storage.Store,
+	w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+	if claims == nil || claims.Subject == "" {
+		p.HandleErrorCode(http.StatusForbidden, w, r)
+		return
+	}
+	admin, err := p.moduleToggles.isAdmin(r, jii, claims.Subject)
+	if err != nil {
+		p.logger.Printf("ERROR: checking if %s administers %s: %v", claims.Subject, jii.ClientKey, err)
+		p.HandleErrorCode(http.StatusInternalServerError, w, r)
+		return
+	}
+	if !admin {
+		p.HandleErrorCode(http.StatusForbidden, w, r)
+		return
+	}
+	if r.Method == http.MethodPut {
+		var state ModuleState
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			p.HandleErrorCode(http.StatusBadRequest, w, r)
+			return
+		}
+		known := false
+		for _, s := range p.moduleStates(nil) {
+			known = known || s.Type == state.Type && s.Key == state.Key
+		}
+		if !known {
+			p.HandleErrorCode(http.StatusNotFound, w, r)
+			return
+		}
+		if err := p.setModuleEnabled(jii.ClientKey, state); err != nil {
+			p.logger.Printf("ERROR: saving module toggle of %s: %v", jii.ClientKey, err)
+			p.HandleErrorCode(http.StatusServiceUnavailable, w, r)
+			return
+		}
+		p.logger.Printf("INFO: %s set module %s/%s of %s enabled=%t", claims.Subject, state.Type, state.Key,
+			jii.ClientKey, state.Enabled)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.moduleStates(jii)); err != nil {
+		p.logger.Printf("ERROR: writing module states: %v", err)
+	}
+}
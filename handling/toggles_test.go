@@ -0,0 +1,118 @@
+package handling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// countingSettings counts the settings read from the wrapped store.
+type countingSettings struct {
+	*storage.MemoryStore
+	gets int
+}
+
+func (c *countingSettings) GetSetting(clientKey, key string) (string, error) {
+	c.gets++
+	return c.MemoryStore.GetSetting(clientKey, key)
+}
+
+func TestPlugin_ModuleToggles(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	st := &countingSettings{MemoryStore: storage.NewMemoryStore(0)}
+	p.store = st
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	if err := st.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	admin := "someone-else"
+	err := p.EnableModuleToggles("/toggles", func(_ *http.Request, _ *storage.JiraInstallInformation, accountID string) (bool, error) {
+		return accountID == admin, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := p.Router(nil)
+	toggle := func(body string) *httptest.ResponseRecorder {
+		req := signedRequest(t, http.MethodPut, "/path/to/api/toggles", jii)
+		req.Body = ioutil.NopCloser(strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	descriptorKeys := func() []string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, signedRequest(t, http.MethodGet, "/path/to/api/atlassian-connect.json", jii))
+		var ac struct {
+			Modules map[string][]struct {
+				Key string `json:"key"`
+			} `json:"modules"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &ac); err != nil {
+			t.Fatalf("decoding descriptor: %v", err)
+		}
+		var keys []string
+		for moduleType, modules := range ac.Modules {
+			for _, m := range modules {
+				if m.Key != "" {
+					keys = append(keys, moduleType+"/"+m.Key)
+				}
+			}
+		}
+		return keys
+	}
+	allKeys := len(descriptorKeys())
+
+	// only admins toggle modules.
+	if w := toggle(`{"type":"webPanels","key":"some-key","enabled":false}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non admin toggle answered %d", w.Code)
+	}
+	if got := len(descriptorKeys()); got != allKeys {
+		t.Fatalf("descriptor has %d modules after a rejected toggle, expected %d", got, allKeys)
+	}
+
+	admin = "someaccountid"
+	w := toggle(`{"type":"webPanels","key":"some-key","enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("toggle answered %d", w.Code)
+	}
+	var states []ModuleState
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if want := !(s.Type == "webPanels" && s.Key == "some-key"); s.Enabled != want {
+			t.Fatalf("module states are %+v", states)
+		}
+	}
+	if w := toggle(`{"type":"webPanels","key":"unknown","enabled":false}`); w.Code != http.StatusNotFound {
+		t.Fatalf("toggling an unknown module answered %d", w.Code)
+	}
+
+	// the toggles are read once per descriptor.
+	st.gets = 0
+	keys := descriptorKeys()
+	if len(keys) != allKeys-1 {
+		t.Fatalf("descriptor of the tenant has modules %v", keys)
+	}
+	for _, k := range keys {
+		if k == "webPanels/some-key" {
+			t.Fatal("disabled module is in the descriptor")
+		}
+	}
+	if st.gets != 1 {
+		t.Fatalf("rendering the descriptor read %d settings", st.gets)
+	}
+
+	if w := toggle(`{"type":"webPanels","key":"some-key","enabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("toggle answered %d", w.Code)
+	}
+	if got := len(descriptorKeys()); got != allKeys {
+		t.Fatalf("descriptor has %d modules once enabled again, expected %d", got, allKeys)
+	}
+}
@@ -0,0 +1,64 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type unauthenticatedRoute struct {
+	route   string
+	prefix  bool
+	handler http.Handler
+}
+
+// AddUnauthenticatedHandler makes the plugin Router serve handler at route, relative to the base route,
+// without any JWT verification. It is meant for health checks, metrics and static assets.
+// If prefix is true every path under route is served by handler.
+func (p *Plugin) AddUnauthenticatedHandler(route string, prefix bool, handler http.Handler) error {
+	for _, u := range p.unauthenticatedRoutes {
+		if u.route == route {
+			return fmt.Errorf("%s is already served without authentication", route)
+		}
+	}
+	p.unauthenticatedRoutes = append(p.unauthenticatedRoutes, unauthenticatedRoute{
+		route:   route,
+		prefix:  prefix,
+		handler: handler,
+	})
+	return nil
+}
+
+// AddHealthCheck serves a plain 200 OK at route without authentication.
+func (p *Plugin) AddHealthCheck(route string) error {
+	return p.AddUnauthenticatedHandler(route, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "OK")
+	}))
+}
+
+func (p *Plugin) registerUnauthenticatedRoutes(r *mux.Router) {
+	for _, u := range p.unauthenticatedRoutes {
+		if u.prefix {
+			r.PathPrefix(u.route).Handler(p.routeHandleFunc(u.handler.ServeHTTP))
+			continue
+		}
+		r.Path(u.route).Handler(p.routeHandleFunc(u.handler.ServeHTTP))
+	}
+}
@@ -0,0 +1,45 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlugin_AddUnauthenticatedHandler(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	if err := p.AddHealthCheck("/healthz"); err != nil {
+		t.Fatal(err)
+	}
+	var served []string
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, r.URL.Path)
+	})
+	if err := p.AddUnauthenticatedHandler("/metrics/", true, metrics); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddUnauthenticatedHandler("/metrics/", false, metrics); err == nil {
+		t.Fatal("served a route twice")
+	}
+	router := p.Router(nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/path/to/api/healthz"); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Fatalf("health check answered %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/path/to/api/healthz/deep"); w.Code != http.StatusNotFound {
+		t.Fatalf("path under a route that is not a prefix answered %d", w.Code)
+	}
+	for _, path := range []string{"/path/to/api/metrics/", "/path/to/api/metrics/tenants/ck"} {
+		if w := get(path); w.Code != http.StatusOK {
+			t.Fatalf("%s answered %d", path, w.Code)
+		}
+	}
+	if len(served) != 2 || served[1] != "/path/to/api/metrics/tenants/ck" {
+		t.Fatalf("prefix handler served %v", served)
+	}
+}
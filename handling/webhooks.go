@@ -0,0 +1,230 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/apicommunication"
+)
+
+// Jira webhook events, see https://developer.atlassian.com/cloud/jira/platform/webhooks/
+const (
+	JiraIssueCreated                 = "jira:issue_created"
+	JiraIssueUpdated                 = "jira:issue_updated"
+	JiraIssueDeleted                 = "jira:issue_deleted"
+	JiraIssueWorklogUpdated          = "jira:worklog_updated"
+	JiraVersionCreated               = "jira:version_created"
+	JiraVersionUpdated               = "jira:version_updated"
+	JiraVersionDeleted               = "jira:version_deleted"
+	JiraVersionMerged                = "jira:version_merged"
+	JiraVersionMoved                 = "jira:version_moved"
+	JiraVersionReleased              = "jira:version_released"
+	JiraVersionUnreleased            = "jira:version_unreleased"
+	JiraIssueLinkCreated             = "issuelink_created"
+	JiraIssueLinkDeleted             = "issuelink_deleted"
+	JiraWorklogCreated               = "worklog_created"
+	JiraWorklogUpdated               = "worklog_updated"
+	JiraWorklogDeleted               = "worklog_deleted"
+	JiraCommentCreated               = "comment_created"
+	JiraCommentUpdated               = "comment_updated"
+	JiraCommentDeleted               = "comment_deleted"
+	JiraAttachmentCreated            = "attachment_created"
+	JiraAttachmentDeleted            = "attachment_deleted"
+	JiraIssuePropertySet             = "issue_property_set"
+	JiraIssuePropertyDeleted         = "issue_property_deleted"
+	JiraIssueTypeCreated             = "issuetype_created"
+	JiraIssueTypeUpdated             = "issuetype_updated"
+	JiraIssueTypeDeleted             = "issuetype_deleted"
+	JiraProjectCreated               = "project_created"
+	JiraProjectUpdated               = "project_updated"
+	JiraProjectDeleted               = "project_deleted"
+	JiraProjectSoftDeleted           = "project_soft_deleted"
+	JiraProjectRestoredDeleted       = "project_restored_deleted"
+	JiraProjectArchived              = "project_archived"
+	JiraProjectRestoredArchived      = "project_restored_archived"
+	JiraComponentCreated             = "component_created"
+	JiraComponentUpdated             = "component_updated"
+	JiraComponentDeleted             = "component_deleted"
+	JiraUserCreated                  = "user_created"
+	JiraUserUpdated                  = "user_updated"
+	JiraUserDeleted                  = "user_deleted"
+	JiraFilterCreated                = "filter_created"
+	JiraFilterUpdated                = "filter_updated"
+	JiraFilterDeleted                = "filter_deleted"
+	JiraSprintCreated                = "sprint_created"
+	JiraSprintUpdated                = "sprint_updated"
+	JiraSprintDeleted                = "sprint_deleted"
+	JiraSprintStarted                = "sprint_started"
+	JiraSprintClosed                 = "sprint_closed"
+	JiraBoardCreated                 = "board_created"
+	JiraBoardUpdated                 = "board_updated"
+	JiraBoardDeleted                 = "board_deleted"
+	JiraBoardConfigurationChanged    = "board_configuration_changed"
+	JiraOptionVotingChanged          = "option_voting_changed"
+	JiraOptionWatchingChanged        = "option_watching_changed"
+	JiraOptionUnassignedIssues       = "option_unassigned_issues_changed"
+	JiraOptionSubtasksChanged        = "option_subtasks_changed"
+	JiraOptionAttachmentsChanged     = "option_attachments_changed"
+	JiraOptionIssueLinksChanged      = "option_issuelinks_changed"
+	JiraOptionTimeTrackingChanged    = "option_timetracking_changed"
+	JiraConnectAddonEnabled          = "connect_addon_enabled"
+	JiraConnectAddonDisabled         = "connect_addon_disabled"
+	JiraExpressionEvaluationFailed   = "jira_expression_evaluation_failed"
+	JiraIssueFieldValueChanged       = "issue_field_value_changed"
+	JiraServiceDeskRequestCreated    = "jira:servicedesk_request_created"
+	JiraServiceDeskRequestUpdated    = "jira:servicedesk_request_updated"
+	JiraServiceDeskRequestDeleted    = "jira:servicedesk_request_deleted"
+	JiraServiceDeskRequestCommented  = "jira:servicedesk_request_commented"
+	JiraServiceDeskCustomerInvited   = "jira:servicedesk_customer_invited"
+	JiraServiceDeskParticipantsAdded = "jira:servicedesk_participants_added"
+)
+
+var jiraWebhookEvents = map[string]bool{}
+
+func init() {
+	for _, e := range []string{
+		JiraIssueCreated, JiraIssueUpdated, JiraIssueDeleted, JiraIssueWorklogUpdated,
+		JiraVersionCreated, JiraVersionUpdated, JiraVersionDeleted, JiraVersionMerged, JiraVersionMoved,
+		JiraVersionReleased, JiraVersionUnreleased,
+		JiraIssueLinkCreated, JiraIssueLinkDeleted,
+		JiraWorklogCreated, JiraWorklogUpdated, JiraWorklogDeleted,
+		JiraCommentCreated, JiraCommentUpdated, JiraCommentDeleted,
+		JiraAttachmentCreated, JiraAttachmentDeleted,
+		JiraIssuePropertySet, JiraIssuePropertyDeleted,
+		JiraIssueTypeCreated, JiraIssueTypeUpdated, JiraIssueTypeDeleted,
+		JiraProjectCreated, JiraProjectUpdated, JiraProjectDeleted, JiraProjectSoftDeleted,
+		JiraProjectRestoredDeleted, JiraProjectArchived, JiraProjectRestoredArchived,
+		JiraComponentCreated, JiraComponentUpdated, JiraComponentDeleted,
+		JiraUserCreated, JiraUserUpdated, JiraUserDeleted,
+		JiraFilterCreated, JiraFilterUpdated, JiraFilterDeleted,
+		JiraSprintCreated, JiraSprintUpdated, JiraSprintDeleted, JiraSprintStarted, JiraSprintClosed,
+		JiraBoardCreated, JiraBoardUpdated, JiraBoardDeleted, JiraBoardConfigurationChanged,
+		JiraOptionVotingChanged, JiraOptionWatchingChanged, JiraOptionUnassignedIssues,
+		JiraOptionSubtasksChanged, JiraOptionAttachmentsChanged, JiraOptionIssueLinksChanged,
+		JiraOptionTimeTrackingChanged,
+		JiraConnectAddonEnabled, JiraConnectAddonDisabled, JiraExpressionEvaluationFailed,
+		JiraIssueFieldValueChanged,
+		JiraServiceDeskRequestCreated, JiraServiceDeskRequestUpdated, JiraServiceDeskRequestDeleted,
+		JiraServiceDeskRequestCommented, JiraServiceDeskCustomerInvited, JiraServiceDeskParticipantsAdded,
+	} {
+		jiraWebhookEvents[e] = true
+	}
+}
+
+// AllowWebhookEvents makes AddWebhook accept the passed events besides the ones known for the plugin
+// product, ie events introduced by atlassian after this catalog was written.
+func (p *Plugin) AllowWebhookEvents(events ...string) {
+	if p.extraWebhookEvents == nil {
+		p.extraWebhookEvents = map[string]bool{}
+	}
+	for _, e := range events {
+		p.extraWebhookEvents[e] = true
+	}
+}
+
+// validateWebhookEvent returns an error if event does not exist in the plugin product.
+func (p *Plugin) validateWebhookEvent(event string) error {
+	if p.extraWebhookEvents[event] {
+		return nil
+	}
+	known, product := jiraWebhookEvents, apicommunication.ProductTypeJira
+	if p.productType == apicommunication.ProductTypeConfluence {
+		if strings.HasPrefix(event, "jira:") {
+			return fmt.Errorf("%s is a jira event and this is a confluence plugin", event)
+		}
+		known, product = confluenceWebhookEvents, apicommunication.ProductTypeConfluence
+	}
+	if known[event] {
+		return nil
+	}
+	if suggestion := closestEvent(event, known); suggestion != "" {
+		return fmt.Errorf("%s is not a known %s webhook event, did you mean %s? (allow it with AllowWebhookEvents)",
+			event, product, suggestion)
+	}
+	return fmt.Errorf("%s is not a known %s webhook event, allow it with AllowWebhookEvents", event, product)
+}
+
+// closestEvent returns the known event at the smallest edit distance from event, if close enough
+// to be a typo.
+func closestEvent(event string, known map[string]bool) string {
+	const maxDistance = 3
+	best, bestDistance := "", maxDistance+1
+	for k := range known {
+		if d := editDistance(event, k); d < bestDistance || d == bestDistance && k < best {
+			best, bestDistance = k, d
+		}
+	}
+	if bestDistance > maxDistance {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// WebhookMiddleware wraps the handler of a webhook event, ie for dedup, queueing or logging.
+type WebhookMiddleware func(event string, next JiraHandleFunc) JiraHandleFunc
+
+// UseWebhookMiddleware appends middleware to the chain applied to every webhook handler, after
+// the request was verified. The first middleware registered is the outermost one.
+func (p *Plugin) UseWebhookMiddleware(mw ...WebhookMiddleware) {
+	p.webhookMiddleware = append(p.webhookMiddleware, mw...)
+}
+
+// webhookHandler returns the handler for event wrapped in the webhook middleware chain.
+func (p *Plugin) webhookHandler(event string) (JiraHandleFunc, bool) {
+	h, ok := p.webhooks[event]
+	if !ok {
+		return nil, false
+	}
+	if extra := p.webhookHandlers[event]; len(extra) > 0 {
+		h = p.fanOut(event, append([]JiraHandleFunc{h}, extra...))
+	}
+	for i := len(p.webhookMiddleware) - 1; i >= 0; i-- {
+		h = p.webhookMiddleware[i](event, h)
+	}
+	return h, true
+}
@@ -0,0 +1,73 @@
+package handling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestPlugin_UseWebhookMiddleware(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	p.store = storage.NewMemoryStore(0)
+	jii := &storage.JiraInstallInformation{ClientKey: "ck", SharedSecret: "secret"}
+	if err := p.store.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	err := p.AddWebhook(JiraIssueCreated, NewRoutePath("/issue_created", nil),
+		func(jii *storage.JiraInstallInformation, _ storage.Store, w http.ResponseWriter, _ *http.Request) {
+			calls = append(calls, "handler:"+jii.ClientKey)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := func(name string) WebhookMiddleware {
+		return func(event string, next JiraHandleFunc) JiraHandleFunc {
+			return func(jii *storage.JiraInstallInformation, st storage.Store, w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+":"+event)
+				if r.URL.Query().Get("drop") == name {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				next(jii, st, w, r)
+			}
+		}
+	}
+	p.UseWebhookMiddleware(layer("outer"))
+	p.UseWebhookMiddleware(layer("inner"))
+	router := p.Router(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, signedRequest(t, http.MethodPost, "/path/to/api/issue_created", jii))
+	want := []string{"outer:" + JiraIssueCreated, "inner:" + JiraIssueCreated, "handler:ck"}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(calls, want) {
+		t.Fatalf("answered %d after calling %q, want %q", w.Code, calls, want)
+	}
+
+	calls = nil
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, signedRequest(t, http.MethodPost, "/path/to/api/issue_created?drop=outer", jii))
+	if w.Code != http.StatusAccepted || !reflect.DeepEqual(calls, want[:1]) {
+		t.Fatalf("answered %d after calling %q when the outer middleware dropped the event", w.Code, calls)
+	}
+}
+
+func TestPlugin_AddWebhookValidatesEvents(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	err := p.AddWebhook("jira:issue_update", NewRoutePath("/typo", nil), fakeHandleFunc)
+	if err == nil || !strings.Contains(err.Error(), "did you mean jira:issue_updated?") {
+		t.Fatalf("typo was not caught: %v", err)
+	}
+	err = p.UpdateWebhook("jira:brand_new_event", NewRoutePath("/new", nil), fakeHandleFunc)
+	if err == nil || !strings.Contains(err.Error(), "AllowWebhookEvents") {
+		t.Fatalf("unknown event was not pointed to AllowWebhookEvents: %v", err)
+	}
+	p.AllowWebhookEvents("jira:brand_new_event")
+	if err := p.AddWebhook("jira:brand_new_event", NewRoutePath("/new", nil), fakeHandleFunc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package handling
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// WebPanelWeightStep is the gap left between the weights assigned by the web panel positioning
+// helpers, so panels can later be inserted between others without renumbering.
+const WebPanelWeightStep = 10
+
+// panelsByWeight returns the panels of the container sorted by weight, lighter (shown first) first.
+func (p *Plugin) panelsByWeight(panelContainer string) []WebPanel {
+	panels := append([]WebPanel(nil), p.arbitraryWebPanels[panelContainer]...)
+	sort.SliceStable(panels, func(i, j int) bool {
+		if panels[i].Weight == panels[j].Weight {
+			return panels[i].Key < panels[j].Key
+		}
+		return panels[i].Weight < panels[j].Weight
+	})
+	return panels
+}
+
+// AppendWebPanel adds the web panel to the container after every panel already in it, the panel
+// weight is overwritten.
+func (p *Plugin) AppendWebPanel(panelContainer string, wp WebPanel) error {
+	if panelContainer == "" {
+		panelContainer = "webPanels"
+	}
+	panels := p.panelsByWeight(panelContainer)
+	wp.Weight = WebPanelWeightStep
+	if len(panels) > 0 {
+		wp.Weight = math.Floor(panels[len(panels)-1].Weight) + WebPanelWeightStep
+	}
+	return p.AddWebPanel(panelContainer, wp)
+}
+
+// AddWebPanelBefore adds the web panel to the container right before the panel with key
+// beforeKey, the panel weight is overwritten and the container renumbered if there is no room.
+func (p *Plugin) AddWebPanelBefore(panelContainer, beforeKey string, wp WebPanel) error {
+	return p.addWebPanelAt(panelContainer, beforeKey, 0, wp)
+}
+
+// AddWebPanelAfter adds the web panel to the container right after the panel with key afterKey,
+// see AddWebPanelBefore.
+func (p *Plugin) AddWebPanelAfter(panelContainer, afterKey string, wp WebPanel) error {
+	return p.addWebPanelAt(panelContainer, afterKey, 1, wp)
+}
+
+// addWebPanelAt inserts wp at the position of the panel with the passed key plus offset.
+func (p *Plugin) addWebPanelAt(panelContainer, key string, offset int, wp WebPanel) error {
+	if panelContainer == "" {
+		panelContainer = "webPanels"
+	}
+	panels := p.panelsByWeight(panelContainer)
+	at := -1
+	for i, v := range panels {
+		if v.Key == wp.Key {
+			return fmt.Errorf("panel %s is already defined in container %s", wp.Key, panelContainer)
+		}
+		if v.Key == key {
+			at = i + offset
+		}
+	}
+	if at < 0 {
+		return fmt.Errorf("there is no panel %s in container %s", key, panelContainer)
+	}
+	// weights are integers for atlassian, if there is no integer between the neighbours the
+	// container is renumbered.
+	lower := 0.0
+	if at > 0 {
+		lower = panels[at-1].Weight
+	}
+	upper := lower + 2*WebPanelWeightStep
+	if at < len(panels) {
+		upper = panels[at].Weight
+	}
+	weight := math.Floor((lower + upper) / 2)
+	if weight <= lower || weight >= upper {
+		panels = append(panels[:at], append([]WebPanel{wp}, panels[at:]...)...)
+		for i := range panels {
+			panels[i].Weight = float64((i + 1) * WebPanelWeightStep)
+		}
+		p.arbitraryWebPanels[panelContainer] = nil
+		for _, v := range panels {
+			if err := p.UpdateWebPanel(panelContainer, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	wp.Weight = weight
+	return p.UpdateWebPanel(panelContainer, wp)
+}
+
+// RenumberWebPanels reassigns the weights of the panels in the container, keeping their order,
+// so they are WebPanelWeightStep apart.
+func (p *Plugin) RenumberWebPanels(panelContainer string) error {
+	if panelContainer == "" {
+		panelContainer = "webPanels"
+	}
+	panels := p.panelsByWeight(panelContainer)
+	for i := range panels {
+		panels[i].Weight = float64((i + 1) * WebPanelWeightStep)
+		if err := p.UpdateWebPanel(panelContainer, panels[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
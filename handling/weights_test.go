@@ -0,0 +1,36 @@
+package handling
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlugin_webPanelWeights(t *testing.T) {
+	p := newPlugin(t, fakeHandleFunc)
+	const container = "atl.jira.view.issue.right.context"
+	for _, key := range []string{"a", "c"} {
+		if err := p.AppendWebPanel(container, WebPanel{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.AddWebPanelAfter(container, "a", WebPanel{Key: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddWebPanelBefore(container, "a", WebPanel{Key: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	// there is no integer between b and c anymore, so this renumbers
+	for _, key := range []string{"b1", "b2", "b3", "b4"} {
+		if err := p.AddWebPanelAfter(container, "b", WebPanel{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, wp := range p.panelsByWeight(container) {
+		got = append(got, wp.Key)
+	}
+	want := []string{"first", "a", "b", "b4", "b3", "b2", "b1", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("panels are ordered %v, want %v", got, want)
+	}
+}
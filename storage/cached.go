@@ -0,0 +1,152 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"sync"
+	"time"
+)
+
+// CachedStore is a Store that keeps the install information read from the wrapped store in memory
+// for a ttl, so validating each incoming request does not read the backing store. Saving or
+// deleting a tenant through it drops its cached information, other replicas must be told with
+// Invalidate, ie through apicommunication.Invalidation.WatchStore.
+// Settings, history, tokens and the like are not cached, the embedded Delegate reads them through.
+type CachedStore struct {
+	Delegate
+	inner Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]cachedEntry
+	inflight map[string]*cachedRead
+}
+
+type cachedEntry struct {
+	jii     JiraInstallInformation
+	expires time.Time
+}
+
+// cachedRead is a read of the wrapped store in progress, concurrent lookups of the same tenant
+// wait for it instead of reading again.
+type cachedRead struct {
+	done chan struct{}
+	jii  *JiraInstallInformation
+	err  error
+}
+
+var (
+	_ Store       = (*CachedStore)(nil)
+	_ Invalidator = (*CachedStore)(nil)
+	_ Preloader   = (*CachedStore)(nil)
+	_ Deleter     = (*CachedStore)(nil)
+	_ Locker      = (*CachedStore)(nil)
+)
+
+// NewCachedStore returns a Store caching the install information read from inner for ttl, tenants
+// that are not installed are not cached.
+func NewCachedStore(inner Store, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		Delegate: NewDelegate(inner),
+		inner:    inner,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  map[string]cachedEntry{},
+		inflight: map[string]*cachedRead{},
+	}
+}
+
+// SaveJiraInstallInformation implements Store, the cached information of the tenant is dropped.
+func (c *CachedStore) SaveJiraInstallInformation(jii *JiraInstallInformation) error {
+	err := c.inner.SaveJiraInstallInformation(jii)
+	c.Invalidate(jii.ClientKey)
+	return err
+}
+
+// JiraInstallInformation implements Store.
+func (c *CachedStore) JiraInstallInformation(clientKey string) (*JiraInstallInformation, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[clientKey]; ok && c.now().Before(e.expires) {
+		c.mu.Unlock()
+		jii := e.jii
+		return &jii, nil
+	}
+	if read, ok := c.inflight[clientKey]; ok {
+		c.mu.Unlock()
+		<-read.done
+		return copyInstall(read.jii), read.err
+	}
+	read := &cachedRead{done: make(chan struct{})}
+	c.inflight[clientKey] = read
+	c.mu.Unlock()
+
+	read.jii, read.err = c.inner.JiraInstallInformation(clientKey)
+
+	c.mu.Lock()
+	// an invalidation while reading removes the read from inflight, what we read may be stale.
+	if c.inflight[clientKey] == read {
+		delete(c.inflight, clientKey)
+		if read.err == nil && read.jii != nil {
+			c.entries[clientKey] = cachedEntry{jii: *read.jii, expires: c.now().Add(c.ttl)}
+		}
+	}
+	c.mu.Unlock()
+	close(read.done)
+	return copyInstall(read.jii), read.err
+}
+
+// copyInstall returns a copy of jii so callers can't modify what other callers read.
+func copyInstall(jii *JiraInstallInformation) *JiraInstallInformation {
+	if jii == nil {
+		return nil
+	}
+	cp := *jii
+	return &cp
+}
+
+// Invalidate implements Invalidator.
+func (c *CachedStore) Invalidate(clientKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, clientKey)
+	delete(c.inflight, clientKey)
+}
+
+// Preload implements Preloader, it caches the passed install information for ttl.
+func (c *CachedStore) Preload(jiis ...*JiraInstallInformation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	for _, jii := range jiis {
+		c.entries[jii.ClientKey] = cachedEntry{jii: *jii, expires: expires}
+	}
+}
+
+// DeleteJiraInstallInformation implements Deleter, the cached information of the tenant is dropped.
+func (c *CachedStore) DeleteJiraInstallInformation(clientKey string) error {
+	err := c.Delegate.DeleteJiraInstallInformation(clientKey)
+	c.Invalidate(clientKey)
+	return err
+}
+
+// WithLock implements Locker, the tenant is evicted once locked so f reads what other processes
+// saved.
+func (c *CachedStore) WithLock(clientKey string, f func() error) error {
+	return c.Delegate.WithLock(clientKey, func() error {
+		c.Invalidate(clientKey)
+		return f()
+	})
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingStore counts the reads of the wrapped store.
+type countingStore struct {
+	*MemoryStore
+	reads int
+}
+
+func (c *countingStore) JiraInstallInformation(clientKey string) (*JiraInstallInformation, error) {
+	c.reads++
+	return c.MemoryStore.JiraInstallInformation(clientKey)
+}
+
+func TestCachedStore(t *testing.T) {
+	inner := &countingStore{MemoryStore: NewMemoryStore(0)}
+	c := NewCachedStore(inner, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if jii, err := c.JiraInstallInformation("a"); jii != nil || err != nil {
+		t.Fatalf("missing tenant returned %+v, %v", jii, err)
+	}
+	if err := c.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: "a", SharedSecret: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if jii, _ := c.JiraInstallInformation("a"); jii == nil || jii.SharedSecret != "first" {
+			t.Fatalf("read %+v", jii)
+		}
+	}
+	if inner.reads != 2 {
+		t.Fatalf("inner store was read %d times, expected 2", inner.reads)
+	}
+
+	if err := c.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: "a", SharedSecret: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if jii, _ := c.JiraInstallInformation("a"); jii.SharedSecret != "second" {
+		t.Fatalf("saving did not invalidate the cache, read %+v", jii)
+	}
+
+	now = now.Add(time.Minute)
+	c.JiraInstallInformation("a")
+	if inner.reads != 4 {
+		t.Fatalf("inner store was read %d times, expected the entry to expire", inner.reads)
+	}
+
+	if err := c.DeleteJiraInstallInformation("a"); err != nil {
+		t.Fatal(err)
+	}
+	if jii, _ := c.JiraInstallInformation("a"); jii != nil {
+		t.Fatalf("deleted tenant read back as %+v", jii)
+	}
+}
+
+func TestCachedStore_Prefetch(t *testing.T) {
+	inner := &countingStore{MemoryStore: NewMemoryStore(0)}
+	for i := 0; i < 5; i++ {
+		if err := inner.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: fmt.Sprintf("tenant-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCachedStore(inner, time.Hour)
+	count, err := Prefetch(context.Background(), inner, c, 2)
+	if err != nil || count != 5 {
+		t.Fatalf("prefetched %d installations, %v", count, err)
+	}
+	for i := 0; i < 5; i++ {
+		if jii, err := c.JiraInstallInformation(fmt.Sprintf("tenant-%d", i)); err != nil || jii == nil {
+			t.Fatalf("read %+v, %v", jii, err)
+		}
+	}
+	if inner.reads != 0 {
+		t.Fatalf("prefetched installations were read %d times from the inner store", inner.reads)
+	}
+}
@@ -0,0 +1,273 @@
+// Package consul implements a storage.Store on the KV store of HashiCorp Consul, for teams that
+// already run a replicated Consul cluster and would rather not add a database for install information.
+package consul
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// DefaultPrefix is the path keys are written under if Config has none.
+const DefaultPrefix = "atlassian-connect"
+
+// Config holds how to reach Consul.
+type Config struct {
+	// Address is the URL of the Consul HTTP API, ie http://127.0.0.1:8500.
+	Address string
+	// Token is sent in the X-Consul-Token header if set.
+	Token string
+	// Datacenter is the datacenter queried, the one of the agent if empty.
+	Datacenter string
+	Prefix     string
+	// HTTPClient defaults to a client with a 10 seconds timeout.
+	HTTPClient *http.Client
+}
+
+// Store is a storage.Store keeping the install information of each tenant, secrets included, as a
+// JSON document in a Consul key, and tenant settings in a key each.
+type Store struct {
+	config Config
+	client *http.Client
+}
+
+var (
+	_ storage.Store   = (*Store)(nil)
+	_ storage.Pinger  = (*Store)(nil)
+	_ storage.Lister  = (*Store)(nil)
+	_ storage.Deleter = (*Store)(nil)
+
+	_ storage.TenantSettings = (*Store)(nil)
+)
+
+// New returns a Store on the Consul described by config.
+func New(config Config) (*Store, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("consul address is required")
+	}
+	if _, err := url.Parse(config.Address); err != nil {
+		return nil, fmt.Errorf("parsing consul address: %w", err)
+	}
+	if config.Prefix = strings.Trim(config.Prefix, "/"); config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Store{config: config, client: client}, nil
+}
+
+// installationsKey is the folder installations are kept in, each in a key named after the escaped
+// client key so client keys with slashes don't create folders.
+func (s *Store) installationsKey() string {
+	return s.config.Prefix + "/installations/"
+}
+
+func (s *Store) installationKey(clientKey string) string {
+	return s.installationsKey() + url.PathEscape(clientKey)
+}
+
+func (s *Store) settingKey(clientKey, key string) string {
+	return s.config.Prefix + "/settings/" + url.PathEscape(clientKey) + "/" + url.PathEscape(key)
+}
+
+// request performs a request to the consul API, a 404 is not an error and results in a nil body.
+func (s *Store) request(ctx context.Context, method, path string, query url.Values, body io.Reader) ([]byte, error) {
+	u := strings.TrimRight(s.config.Address, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("building consul request: %w", err)
+	}
+	if s.config.Token != "" {
+		req.Header.Set("X-Consul-Token", s.config.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying consul: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading consul response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("consul answered %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	return respBody, nil
+}
+
+// kv performs a request to the KV API for key, see request.
+func (s *Store) kv(method, key, flag string, body []byte) ([]byte, error) {
+	query := url.Values{}
+	// consul only checks flags such as raw are present, "raw=" will do.
+	if flag != "" {
+		query.Set(flag, "")
+	}
+	if s.config.Datacenter != "" {
+		query.Set("dc", s.config.Datacenter)
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	// keys are escaped once more, consul unescapes the path.
+	return s.request(context.Background(), method, (&url.URL{Path: "/v1/kv/" + key}).EscapedPath(), query, reqBody)
+}
+
+// put writes value to key, consul answers false if the write did not happen.
+func (s *Store) put(key string, value []byte) error {
+	answer, err := s.kv(http.MethodPut, key, "", value)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(answer)) != "true" {
+		return fmt.Errorf("consul did not write %s", key)
+	}
+	return nil
+}
+
+// SaveJiraInstallInformation implements storage.Store
+func (s *Store) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	data, err := storage.MarshalWithSecrets(jii)
+	if err != nil {
+		return fmt.Errorf("marshaling install information: %w", err)
+	}
+	if err := s.put(s.installationKey(jii.ClientKey), data); err != nil {
+		return fmt.Errorf("saving install information of %s: %w", jii.ClientKey, err)
+	}
+	return nil
+}
+
+// JiraInstallInformation implements storage.Store
+func (s *Store) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	data, err := s.kv(http.MethodGet, s.installationKey(clientKey), "raw", nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading install information of %s: %w", clientKey, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	jii := &storage.JiraInstallInformation{}
+	if err := json.Unmarshal(data, jii); err != nil {
+		return nil, fmt.Errorf("decoding install information of %s: %w", clientKey, err)
+	}
+	return jii, nil
+}
+
+// DeleteJiraInstallInformation implements storage.Deleter, settings of the tenant are kept.
+func (s *Store) DeleteJiraInstallInformation(clientKey string) error {
+	if _, err := s.kv(http.MethodDelete, s.installationKey(clientKey), "", nil); err != nil {
+		return fmt.Errorf("deleting install information of %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// ListInstallations implements storage.Lister, cursors are client keys. Consul can only list every
+// key in a folder, so each page lists them all.
+func (s *Store) ListInstallations(cursor string, limit int) ([]*storage.JiraInstallInformation, string, error) {
+	data, err := s.kv(http.MethodGet, s.installationsKey(), "keys", nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("listing installations: %w", err)
+	}
+	var keys []string
+	if data != nil {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, "", fmt.Errorf("decoding installation keys: %w", err)
+		}
+	}
+	clientKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		clientKey, err := url.PathUnescape(strings.TrimPrefix(k, s.installationsKey()))
+		if err != nil {
+			return nil, "", fmt.Errorf("decoding installation key %s: %w", k, err)
+		}
+		if clientKey > cursor {
+			clientKeys = append(clientKeys, clientKey)
+		}
+	}
+	// consul sorts the escaped keys.
+	sort.Strings(clientKeys)
+	next := ""
+	if limit > 0 && len(clientKeys) > limit {
+		clientKeys = clientKeys[:limit]
+		next = clientKeys[limit-1]
+	}
+	jiis := make([]*storage.JiraInstallInformation, 0, len(clientKeys))
+	for _, clientKey := range clientKeys {
+		jii, err := s.JiraInstallInformation(clientKey)
+		if err != nil {
+			return nil, "", err
+		}
+		// deleted since the keys were listed
+		if jii != nil {
+			jiis = append(jiis, jii)
+		}
+	}
+	return jiis, next, nil
+}
+
+// GetSetting implements storage.TenantSettings
+func (s *Store) GetSetting(clientKey, key string) (string, error) {
+	data, err := s.kv(http.MethodGet, s.settingKey(clientKey, key), "raw", nil)
+	if err != nil {
+		return "", fmt.Errorf("reading setting %s of %s: %w", key, clientKey, err)
+	}
+	return string(data), nil
+}
+
+// SetSetting implements storage.TenantSettings
+func (s *Store) SetSetting(clientKey, key, value string) error {
+	if err := s.put(s.settingKey(clientKey, key), []byte(value)); err != nil {
+		return fmt.Errorf("saving setting %s of %s: %w", key, clientKey, err)
+	}
+	return nil
+}
+
+// Ping implements storage.Pinger checking the cluster has a leader, without which writes fail.
+func (s *Store) Ping(ctx context.Context) error {
+	data, err := s.request(ctx, http.MethodGet, "/v1/status/leader", nil, nil)
+	if err != nil {
+		return err
+	}
+	var leader string
+	if data != nil {
+		if err := json.Unmarshal(data, &leader); err != nil {
+			return fmt.Errorf("decoding consul leader: %w", err)
+		}
+	}
+	if leader == "" {
+		return fmt.Errorf("consul has no leader")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/storagetest"
+)
+
+// fakeConsul mimics the KV API.
+func fakeConsul(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	kv := map[string][]byte{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/v1/status/leader" {
+			json.NewEncoder(w).Encode("10.0.0.1:8300")
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v1/kv/atlassian-connect/") {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kv[key] = body
+			w.Write([]byte("true"))
+		case http.MethodGet:
+			if _, ok := r.URL.Query()["keys"]; ok {
+				var keys []string
+				for k := range kv {
+					if strings.HasPrefix(k, key) {
+						keys = append(keys, k)
+					}
+				}
+				if len(keys) == 0 {
+					http.NotFound(w, r)
+					return
+				}
+				sort.Strings(keys)
+				json.NewEncoder(w).Encode(keys)
+				return
+			}
+			if _, ok := r.URL.Query()["raw"]; !ok {
+				t.Errorf("reading %s without raw", key)
+			}
+			value, ok := kv[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(value)
+		case http.MethodDelete:
+			delete(kv, key)
+			w.Write([]byte("true"))
+		}
+	}))
+}
+
+func TestStore(t *testing.T) {
+	srv := fakeConsul(t)
+	defer srv.Close()
+	s, err := New(Config{Address: srv.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	jii := &storage.JiraInstallInformation{ClientKey: "jira:a/b", SharedSecret: "secret"}
+	if err := s.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	listed, next, err := s.ListInstallations("", 10)
+	if err != nil || len(listed) != 1 || listed[0].ClientKey != jii.ClientKey || listed[0].SharedSecret != "secret" || next != "" {
+		t.Fatalf("listed %v, %q, %v", listed, next, err)
+	}
+
+	s.config.Token = "wrong"
+	if _, err := s.JiraInstallInformation(jii.ClientKey); err == nil {
+		t.Fatal("reading with a wrong token succeeded")
+	}
+}
+
+func TestStoreConformance(t *testing.T) {
+	srv := fakeConsul(t)
+	defer srv.Close()
+	prefixes := 0
+	storagetest.Run(t, func() storage.Store {
+		prefixes++
+		// each store gets its own folder, the fake server is shared.
+		s, err := New(Config{Address: srv.URL, Token: "token", Prefix: fmt.Sprintf("atlassian-connect/%d", prefixes)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,323 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrUnsupported is returned by stores decorating another one, such as CachedStore, when the
+// wrapped store does not implement the optional interface called.
+var ErrUnsupported = errors.New("not supported by the wrapped store")
+
+// Delegate implements every optional interface of this package forwarding the calls to a wrapped
+// store, stores decorating another one embed it so wrapping a store keeps its capabilities and
+// only override the methods they intercept.
+// Calls to interfaces the wrapped store does not implement fail with ErrUnsupported, except for
+// Invalidate and Preload which do nothing and WithLock which invokes f right away, as the WithLock
+// function does.
+type Delegate struct {
+	inner Store
+}
+
+var (
+	_ Deleter          = Delegate{}
+	_ RegionStore      = Delegate{}
+	_ OutboxStore      = Delegate{}
+	_ LeaseStore       = Delegate{}
+	_ Invalidator      = Delegate{}
+	_ Pinger           = Delegate{}
+	_ TenantSettings   = Delegate{}
+	_ DeadLetterStore  = Delegate{}
+	_ InstallHistory   = Delegate{}
+	_ Locker           = Delegate{}
+	_ Lister           = Delegate{}
+	_ Preloader        = Delegate{}
+	_ SiteLookup       = Delegate{}
+	_ TokenStore       = Delegate{}
+	_ UserMappingStore = Delegate{}
+)
+
+// NewDelegate returns a Delegate forwarding calls to inner.
+func NewDelegate(inner Store) Delegate {
+	return Delegate{inner: inner}
+}
+
+// Unwrap returns the wrapped store.
+func (d Delegate) Unwrap() Store {
+	return d.inner
+}
+
+// Supports returns true if st implements the optional interface iface points to, ie
+// Supports(st, (*TenantSettings)(nil)), and so do all the stores it wraps, found through their
+// Unwrap method. Use it rather than a type assertion to check the capabilities of decorated stores,
+// which implement every optional interface through Delegate.
+func Supports(st Store, iface interface{}) bool {
+	t := reflect.TypeOf(iface).Elem()
+	for st != nil {
+		if !reflect.TypeOf(st).Implements(t) {
+			return false
+		}
+		u, ok := st.(interface{ Unwrap() Store })
+		if !ok {
+			return true
+		}
+		st = u.Unwrap()
+	}
+	return false
+}
+
+func (d Delegate) unsupported(what string) error {
+	return fmt.Errorf("%T can not %s: %w", d.inner, what, ErrUnsupported)
+}
+
+// DeleteJiraInstallInformation implements Deleter.
+func (d Delegate) DeleteJiraInstallInformation(clientKey string) error {
+	s, ok := d.inner.(Deleter)
+	if !ok {
+		return d.unsupported("delete install information")
+	}
+	return s.DeleteJiraInstallInformation(clientKey)
+}
+
+// SaveTenantRegion implements RegionStore.
+func (d Delegate) SaveTenantRegion(clientKey, region string) error {
+	s, ok := d.inner.(RegionStore)
+	if !ok {
+		return d.unsupported("store tenant regions")
+	}
+	return s.SaveTenantRegion(clientKey, region)
+}
+
+// TenantRegion implements RegionStore.
+func (d Delegate) TenantRegion(clientKey string) (string, error) {
+	s, ok := d.inner.(RegionStore)
+	if !ok {
+		return "", d.unsupported("store tenant regions")
+	}
+	return s.TenantRegion(clientKey)
+}
+
+// EnqueueOutboxMessage implements OutboxStore.
+func (d Delegate) EnqueueOutboxMessage(m *OutboxMessage) error {
+	s, ok := d.inner.(OutboxStore)
+	if !ok {
+		return d.unsupported("store the outbox")
+	}
+	return s.EnqueueOutboxMessage(m)
+}
+
+// PendingOutboxMessages implements OutboxStore.
+func (d Delegate) PendingOutboxMessages(now time.Time, limit int) ([]*OutboxMessage, error) {
+	s, ok := d.inner.(OutboxStore)
+	if !ok {
+		return nil, d.unsupported("store the outbox")
+	}
+	return s.PendingOutboxMessages(now, limit)
+}
+
+// UpdateOutboxMessage implements OutboxStore.
+func (d Delegate) UpdateOutboxMessage(m *OutboxMessage) error {
+	s, ok := d.inner.(OutboxStore)
+	if !ok {
+		return d.unsupported("store the outbox")
+	}
+	return s.UpdateOutboxMessage(m)
+}
+
+// DeleteOutboxMessage implements OutboxStore.
+func (d Delegate) DeleteOutboxMessage(id string) error {
+	s, ok := d.inner.(OutboxStore)
+	if !ok {
+		return d.unsupported("store the outbox")
+	}
+	return s.DeleteOutboxMessage(id)
+}
+
+// AcquireLease implements LeaseStore.
+func (d Delegate) AcquireLease(name, owner string, ttl time.Duration) (bool, error) {
+	s, ok := d.inner.(LeaseStore)
+	if !ok {
+		return false, d.unsupported("grant leases")
+	}
+	return s.AcquireLease(name, owner, ttl)
+}
+
+// ReleaseLease implements LeaseStore.
+func (d Delegate) ReleaseLease(name, owner string) error {
+	s, ok := d.inner.(LeaseStore)
+	if !ok {
+		return d.unsupported("grant leases")
+	}
+	return s.ReleaseLease(name, owner)
+}
+
+// Invalidate implements Invalidator.
+func (d Delegate) Invalidate(clientKey string) {
+	if s, ok := d.inner.(Invalidator); ok {
+		s.Invalidate(clientKey)
+	}
+}
+
+// Ping implements Pinger.
+func (d Delegate) Ping(ctx context.Context) error {
+	s, ok := d.inner.(Pinger)
+	if !ok {
+		return d.unsupported("be pinged")
+	}
+	return s.Ping(ctx)
+}
+
+// GetSetting implements TenantSettings.
+func (d Delegate) GetSetting(clientKey, key string) (string, error) {
+	s, ok := d.inner.(TenantSettings)
+	if !ok {
+		return "", d.unsupported("store tenant settings")
+	}
+	return s.GetSetting(clientKey, key)
+}
+
+// SetSetting implements TenantSettings.
+func (d Delegate) SetSetting(clientKey, key, value string) error {
+	s, ok := d.inner.(TenantSettings)
+	if !ok {
+		return d.unsupported("store tenant settings")
+	}
+	return s.SetSetting(clientKey, key, value)
+}
+
+// SaveDeadLetter implements DeadLetterStore.
+func (d Delegate) SaveDeadLetter(letter *DeadLetter) error {
+	s, ok := d.inner.(DeadLetterStore)
+	if !ok {
+		return d.unsupported("store dead letters")
+	}
+	return s.SaveDeadLetter(letter)
+}
+
+// DeadLetter implements DeadLetterStore.
+func (d Delegate) DeadLetter(id string) (*DeadLetter, error) {
+	s, ok := d.inner.(DeadLetterStore)
+	if !ok {
+		return nil, d.unsupported("store dead letters")
+	}
+	return s.DeadLetter(id)
+}
+
+// DeadLetters implements DeadLetterStore.
+func (d Delegate) DeadLetters(clientKey string) ([]*DeadLetter, error) {
+	s, ok := d.inner.(DeadLetterStore)
+	if !ok {
+		return nil, d.unsupported("store dead letters")
+	}
+	return s.DeadLetters(clientKey)
+}
+
+// DeleteDeadLetter implements DeadLetterStore.
+func (d Delegate) DeleteDeadLetter(id string) error {
+	s, ok := d.inner.(DeadLetterStore)
+	if !ok {
+		return d.unsupported("store dead letters")
+	}
+	return s.DeleteDeadLetter(id)
+}
+
+// RecordInstall implements InstallHistory.
+func (d Delegate) RecordInstall(r *InstallRecord) error {
+	s, ok := d.inner.(InstallHistory)
+	if !ok {
+		return d.unsupported("keep an install history")
+	}
+	return s.RecordInstall(r)
+}
+
+// InstallHistory implements InstallHistory.
+func (d Delegate) InstallHistory(clientKey string) ([]*InstallRecord, error) {
+	s, ok := d.inner.(InstallHistory)
+	if !ok {
+		return nil, d.unsupported("keep an install history")
+	}
+	return s.InstallHistory(clientKey)
+}
+
+// WithLock implements Locker.
+func (d Delegate) WithLock(clientKey string, f func() error) error {
+	return WithLock(d.inner, clientKey, f)
+}
+
+// ListInstallations implements Lister.
+func (d Delegate) ListInstallations(cursor string, limit int) ([]*JiraInstallInformation, string, error) {
+	s, ok := d.inner.(Lister)
+	if !ok {
+		return nil, "", d.unsupported("list installations")
+	}
+	return s.ListInstallations(cursor, limit)
+}
+
+// Preload implements Preloader.
+func (d Delegate) Preload(jiis ...*JiraInstallInformation) {
+	if s, ok := d.inner.(Preloader); ok {
+		s.Preload(jiis...)
+	}
+}
+
+// JiraInstallInformationByHost implements SiteLookup.
+func (d Delegate) JiraInstallInformationByHost(host string) ([]*JiraInstallInformation, error) {
+	s, ok := d.inner.(SiteLookup)
+	if !ok {
+		return nil, d.unsupported("look tenants up by site")
+	}
+	return s.JiraInstallInformationByHost(host)
+}
+
+// SaveAccessToken implements TokenStore.
+func (d Delegate) SaveAccessToken(clientKey, accountID, scopes string, token *AccessToken) error {
+	s, ok := d.inner.(TokenStore)
+	if !ok {
+		return d.unsupported("store access tokens")
+	}
+	return s.SaveAccessToken(clientKey, accountID, scopes, token)
+}
+
+// AccessToken implements TokenStore.
+func (d Delegate) AccessToken(clientKey, accountID, scopes string) (*AccessToken, error) {
+	s, ok := d.inner.(TokenStore)
+	if !ok {
+		return nil, d.unsupported("store access tokens")
+	}
+	return s.AccessToken(clientKey, accountID, scopes)
+}
+
+// SaveAccountIDs implements UserMappingStore.
+func (d Delegate) SaveAccountIDs(clientKey string, mapping map[string]string) error {
+	s, ok := d.inner.(UserMappingStore)
+	if !ok {
+		return d.unsupported("map legacy users to account ids")
+	}
+	return s.SaveAccountIDs(clientKey, mapping)
+}
+
+// AccountIDs implements UserMappingStore.
+func (d Delegate) AccountIDs(clientKey string, legacyIDs []string) (map[string]string, error) {
+	s, ok := d.inner.(UserMappingStore)
+	if !ok {
+		return nil, d.unsupported("map legacy users to account ids")
+	}
+	return s.AccountIDs(clientKey, legacyIDs)
+}
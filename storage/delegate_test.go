@@ -0,0 +1,62 @@
+package storage_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/storagetest"
+)
+
+func TestDecorators(t *testing.T) {
+	decorators := map[string]func(storage.Store) storage.Store{
+		"Cached": func(inner storage.Store) storage.Store {
+			return storage.NewCachedStore(inner, time.Minute)
+		},
+		"Encrypted": func(inner storage.Store) storage.Store {
+			s, err := storage.NewEncryptedStore(inner, bytes.Repeat([]byte{7}, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"Hooked": func(inner storage.Store) storage.Store {
+			return storage.NewHookedStore(inner)
+		},
+		"Instrumented": func(inner storage.Store) storage.Store {
+			return storage.NewInstrumentedStore(inner, storage.NewStoreMetrics())
+		},
+	}
+	for name, wrap := range decorators {
+		t.Run(name, func(t *testing.T) {
+			storagetest.RunDecorator(t, wrap)
+		})
+	}
+}
+
+// bareStore only implements storage.Store.
+type bareStore struct {
+	storage.Store
+}
+
+func TestSupports(t *testing.T) {
+	memory := storage.NewMemoryStore(0)
+	bare := bareStore{memory}
+	for _, tc := range []struct {
+		name string
+		st   storage.Store
+		want bool
+	}{
+		{"memory", memory, true},
+		{"bare", bare, false},
+		{"cached memory", storage.NewCachedStore(memory, time.Minute), true},
+		{"cached bare", storage.NewCachedStore(bare, time.Minute), false},
+		{"hooked cached memory", storage.NewHookedStore(storage.NewCachedStore(memory, time.Minute)), true},
+		{"hooked cached bare", storage.NewHookedStore(storage.NewCachedStore(bare, time.Minute)), false},
+	} {
+		if got := storage.Supports(tc.st, (*storage.TenantSettings)(nil)); got != tc.want {
+			t.Errorf("%s: supports tenant settings is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
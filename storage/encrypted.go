@@ -0,0 +1,187 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// encryptedPrefix marks encrypted values, values without it are read as plaintext so existing
+// stores can be wrapped without migrating them.
+const encryptedPrefix = "enc:v1:"
+
+// EncryptedStore is a Store that encrypts the secrets of the install information (SharedSecret,
+// PreviousSharedSecret, OauthClientID and PublicKey) with AES-GCM before handing it to the wrapped
+// store, and decrypts them when reading it back, listed and looked up installations included.
+type EncryptedStore struct {
+	Delegate
+	inner Store
+	aead  cipher.AEAD
+}
+
+var (
+	_ Store      = (*EncryptedStore)(nil)
+	_ Lister     = (*EncryptedStore)(nil)
+	_ SiteLookup = (*EncryptedStore)(nil)
+	_ Preloader  = (*EncryptedStore)(nil)
+)
+
+// NewEncryptedStore returns a Store encrypting secrets with key, which must be 16, 24 or 32 bytes
+// long to use AES-128, AES-192 or AES-256, before saving them in inner.
+func NewEncryptedStore(inner Store, key []byte) (*EncryptedStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return &EncryptedStore{Delegate: NewDelegate(inner), inner: inner, aead: aead}, nil
+}
+
+// encrypt seals value, the client key is authenticated so ciphertexts can't be swapped between
+// tenants.
+func (e *EncryptedStore) encrypt(clientKey, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := e.aead.Seal(nonce, nonce, []byte(value), []byte(clientKey))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *EncryptedStore) decrypt(clientKey, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decoding encrypted value: %w", err)
+	}
+	if len(sealed) < e.aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+	nonce, ciphertext := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plain, err := e.aead.Open(nil, nonce, ciphertext, []byte(clientKey))
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// secrets returns pointers to the encrypted fields of jii.
+func secrets(jii *JiraInstallInformation) []*string {
+	return []*string{&jii.SharedSecret, &jii.PreviousSharedSecret, &jii.OauthClientID, &jii.PublicKey}
+}
+
+// SaveJiraInstallInformation implements Store, jii is not modified.
+func (e *EncryptedStore) SaveJiraInstallInformation(jii *JiraInstallInformation) error {
+	encrypted, err := e.encryptInstall(jii)
+	if err != nil {
+		return err
+	}
+	return e.inner.SaveJiraInstallInformation(encrypted)
+}
+
+// JiraInstallInformation implements Store
+func (e *EncryptedStore) JiraInstallInformation(clientKey string) (*JiraInstallInformation, error) {
+	jii, err := e.inner.JiraInstallInformation(clientKey)
+	if err != nil || jii == nil {
+		return jii, err
+	}
+	return e.decryptInstall(jii)
+}
+
+// encryptInstall returns a copy of jii with its secrets encrypted.
+func (e *EncryptedStore) encryptInstall(jii *JiraInstallInformation) (*JiraInstallInformation, error) {
+	encrypted := *jii
+	for _, s := range secrets(&encrypted) {
+		var err error
+		if *s, err = e.encrypt(jii.ClientKey, *s); err != nil {
+			return nil, fmt.Errorf("encrypting install information of %s: %w", jii.ClientKey, err)
+		}
+	}
+	return &encrypted, nil
+}
+
+// decryptInstall returns a copy of jii with its secrets decrypted.
+func (e *EncryptedStore) decryptInstall(jii *JiraInstallInformation) (*JiraInstallInformation, error) {
+	decrypted := *jii
+	for _, s := range secrets(&decrypted) {
+		var err error
+		if *s, err = e.decrypt(jii.ClientKey, *s); err != nil {
+			return nil, fmt.Errorf("decrypting install information of %s: %w", jii.ClientKey, err)
+		}
+	}
+	return &decrypted, nil
+}
+
+// decryptInstalls decrypts the secrets of jiis in place.
+func (e *EncryptedStore) decryptInstalls(jiis []*JiraInstallInformation) error {
+	for i, jii := range jiis {
+		decrypted, err := e.decryptInstall(jii)
+		if err != nil {
+			return err
+		}
+		jiis[i] = decrypted
+	}
+	return nil
+}
+
+// ListInstallations implements Lister.
+func (e *EncryptedStore) ListInstallations(cursor string, limit int) ([]*JiraInstallInformation, string, error) {
+	jiis, next, err := e.Delegate.ListInstallations(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := e.decryptInstalls(jiis); err != nil {
+		return nil, "", err
+	}
+	return jiis, next, nil
+}
+
+// JiraInstallInformationByHost implements SiteLookup.
+func (e *EncryptedStore) JiraInstallInformationByHost(host string) ([]*JiraInstallInformation, error) {
+	jiis, err := e.Delegate.JiraInstallInformationByHost(host)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.decryptInstalls(jiis); err != nil {
+		return nil, err
+	}
+	return jiis, nil
+}
+
+// Preload implements Preloader, the installations are cached encrypted by the wrapped store as if
+// they had been read from it. Those that can not be encrypted are not cached.
+func (e *EncryptedStore) Preload(jiis ...*JiraInstallInformation) {
+	encrypted := make([]*JiraInstallInformation, 0, len(jiis))
+	for _, jii := range jiis {
+		if enc, err := e.encryptInstall(jii); err == nil {
+			encrypted = append(encrypted, enc)
+		}
+	}
+	e.Delegate.Preload(encrypted...)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	inner := NewMemoryStore(0)
+	key := bytes.Repeat([]byte{7}, 32)
+	s, err := NewEncryptedStore(inner, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jii := &JiraInstallInformation{ClientKey: "a", SharedSecret: "shared", PublicKey: "public", OauthClientID: "oauth"}
+	if err := s.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	if jii.SharedSecret != "shared" {
+		t.Fatal("saving modified the passed install information")
+	}
+
+	stored, _ := inner.JiraInstallInformation("a")
+	for _, v := range []string{stored.SharedSecret, stored.PublicKey, stored.OauthClientID} {
+		if !strings.HasPrefix(v, encryptedPrefix) {
+			t.Fatalf("%q was stored in plaintext", v)
+		}
+	}
+	got, err := s.JiraInstallInformation("a")
+	if err != nil || *got != *jii {
+		t.Fatalf("read %+v, %v", got, err)
+	}
+
+	// ciphertexts are bound to the tenant
+	stored.ClientKey = "b"
+	inner.Preload(stored)
+	if _, err := s.JiraInstallInformation("b"); err == nil {
+		t.Fatal("decrypted the secrets of another tenant")
+	}
+
+	// plaintext values are read as is
+	inner.Preload(&JiraInstallInformation{ClientKey: "c", SharedSecret: "legacy"})
+	if got, err := s.JiraInstallInformation("c"); err != nil || got.SharedSecret != "legacy" {
+		t.Fatalf("read %+v, %v", got, err)
+	}
+	if _, err := NewEncryptedStore(inner, []byte("short")); err == nil {
+		t.Fatal("accepted a key of invalid length")
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Export writes every installation in st to w as newline delimited JSON, one install information
+// per line with its secrets, for backups and to clone environments with Import. st must implement
+// Lister. It returns how many installations were written.
+func Export(st Store, w io.Writer) (int, error) {
+	lister, ok := st.(Lister)
+	if !ok {
+		return 0, fmt.Errorf("%T can not list installations", st)
+	}
+	bw := bufio.NewWriter(w)
+	count := 0
+	err := ForEachInstallation(context.Background(), lister, 0, func(jii *JiraInstallInformation) error {
+		line, err := MarshalWithSecrets(jii)
+		if err != nil {
+			return fmt.Errorf("marshaling install information of %s: %w", jii.ClientKey, err)
+		}
+		if _, err := bw.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("writing install information of %s: %w", jii.ClientKey, err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := bw.Flush(); err != nil {
+		return count, fmt.Errorf("writing installations: %w", err)
+	}
+	return count, nil
+}
+
+// Import saves in st every installation read from r, as written by Export, replacing the ones st
+// already holds for the same client keys. It returns how many installations were saved, which
+// were saved even if an error is returned.
+func Import(st Store, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	count := 0
+	for {
+		jii := &JiraInstallInformation{}
+		err := dec.Decode(jii)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("decoding installation %d: %w", count+1, err)
+		}
+		if jii.ClientKey == "" {
+			return count, fmt.Errorf("installation %d has no client key", count+1)
+		}
+		if err := st.SaveJiraInstallInformation(jii); err != nil {
+			return count, fmt.Errorf("saving install information of %s: %w", jii.ClientKey, err)
+		}
+		count++
+	}
+}
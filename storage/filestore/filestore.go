@@ -0,0 +1,228 @@
+// Package filestore implements storage.Store persisting to a JSON file, it is meant to run apps
+// locally without provisioning a database, not for production.
+package filestore
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// contents is the layout of the file.
+type contents struct {
+	// Installations are kept as persisted by storage.MarshalWithSecrets.
+	Installations map[string]json.RawMessage          `json:"installations"`
+	Settings      map[string]map[string]string        `json:"settings,omitempty"`
+	History       map[string][]*storage.InstallRecord `json:"history,omitempty"`
+}
+
+// Store is a storage.Store persisting to a JSON file, it is safe for concurrent use within a
+// process but the file must not be shared by more than one.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	c    contents
+}
+
+var (
+	_ storage.Store          = (*Store)(nil)
+	_ storage.Lister         = (*Store)(nil)
+	_ storage.TenantSettings = (*Store)(nil)
+	_ storage.Deleter        = (*Store)(nil)
+	_ storage.InstallHistory = (*Store)(nil)
+)
+
+// New returns a Store persisting to the file at path, which is read if it exists and created on the
+// first write otherwise.
+func New(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		c: contents{
+			Installations: map[string]json.RawMessage{},
+			Settings:      map[string]map[string]string{},
+			History:       map[string][]*storage.InstallRecord{},
+		},
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading store file: %w", err)
+	}
+	if err := json.Unmarshal(raw, &s.c); err != nil {
+		return nil, fmt.Errorf("decoding store file %s: %w", path, err)
+	}
+	if s.c.Installations == nil {
+		s.c.Installations = map[string]json.RawMessage{}
+	}
+	if s.c.Settings == nil {
+		s.c.Settings = map[string]map[string]string{}
+	}
+	if s.c.History == nil {
+		s.c.History = map[string][]*storage.InstallRecord{}
+	}
+	return s, nil
+}
+
+// flush writes the contents to a temporary file renamed over the store file, so a crash never
+// leaves it half written. It must be called with mu held.
+func (s *Store) flush() error {
+	raw, err := json.MarshalIndent(s.c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding store file: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing temporary store file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing temporary store file: %w", err)
+	}
+	// the file holds shared secrets.
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("restricting store file permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replacing store file: %w", err)
+	}
+	return nil
+}
+
+// SaveJiraInstallInformation implements storage.Store
+func (s *Store) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	raw, err := storage.MarshalWithSecrets(jii)
+	if err != nil {
+		return fmt.Errorf("marshaling install information: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c.Installations[jii.ClientKey] = raw
+	return s.flush()
+}
+
+// JiraInstallInformation implements storage.Store, it returns nil if the tenant is not installed.
+func (s *Store) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	s.mu.Lock()
+	raw, ok := s.c.Installations[clientKey]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return decode(raw)
+}
+
+// DeleteJiraInstallInformation implements storage.Deleter, the tenant settings are kept.
+func (s *Store) DeleteJiraInstallInformation(clientKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.c.Installations[clientKey]; !ok {
+		return nil
+	}
+	delete(s.c.Installations, clientKey)
+	return s.flush()
+}
+
+// ListInstallations implements storage.Lister, cursors are client keys.
+func (s *Store) ListInstallations(cursor string, limit int) ([]*storage.JiraInstallInformation, string, error) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.c.Installations))
+	for k := range s.c.Installations {
+		if k > cursor {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	next := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	raws := make([]json.RawMessage, len(keys))
+	for i, k := range keys {
+		raws[i] = s.c.Installations[k]
+	}
+	s.mu.Unlock()
+
+	jiis := make([]*storage.JiraInstallInformation, 0, len(raws))
+	for _, raw := range raws {
+		jii, err := decode(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		jiis = append(jiis, jii)
+	}
+	return jiis, next, nil
+}
+
+// GetSetting implements storage.TenantSettings
+func (s *Store) GetSetting(clientKey, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Settings[clientKey][key], nil
+}
+
+// SetSetting implements storage.TenantSettings
+func (s *Store) SetSetting(clientKey, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.c.Settings[clientKey] == nil {
+		s.c.Settings[clientKey] = map[string]string{}
+	}
+	s.c.Settings[clientKey][key] = value
+	return s.flush()
+}
+
+// RecordInstall implements storage.InstallHistory
+func (s *Store) RecordInstall(r *storage.InstallRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := *r
+	s.c.History[r.Install.ClientKey] = append(s.c.History[r.Install.ClientKey], &record)
+	return s.flush()
+}
+
+// InstallHistory implements storage.InstallHistory
+func (s *Store) InstallHistory(clientKey string) ([]*storage.InstallRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]*storage.InstallRecord, 0, len(s.c.History[clientKey]))
+	for _, r := range s.c.History[clientKey] {
+		record := *r
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+func decode(raw json.RawMessage) (*storage.JiraInstallInformation, error) {
+	jii := &storage.JiraInstallInformation{}
+	if err := json.Unmarshal(raw, jii); err != nil {
+		return nil, fmt.Errorf("decoding install information: %w", err)
+	}
+	return jii, nil
+}
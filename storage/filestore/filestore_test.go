@@ -0,0 +1,59 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/storagetest"
+)
+
+func TestStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ck := range []string{"b", "a", "c"} {
+		jii := &storage.JiraInstallInformation{ClientKey: ck, SharedSecret: "secret-" + ck}
+		if err := s.SaveJiraInstallInformation(jii); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetSetting("a", "color", "blue"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jii, err := s.JiraInstallInformation("b")
+	if err != nil || jii == nil || jii.SharedSecret != "secret-b" {
+		t.Fatalf("read %+v, %v", jii, err)
+	}
+	if jii, err := s.JiraInstallInformation("missing"); jii != nil || err != nil {
+		t.Fatalf("missing tenant returned %+v, %v", jii, err)
+	}
+	if v, _ := s.GetSetting("a", "color"); v != "blue" {
+		t.Fatalf("setting is %q", v)
+	}
+	page, next, err := s.ListInstallations("", 2)
+	if err != nil || len(page) != 2 || page[0].ClientKey != "a" || next != "b" {
+		t.Fatalf("first page %v, %q, %v", page, next, err)
+	}
+	page, next, err = s.ListInstallations(next, 2)
+	if err != nil || len(page) != 1 || page[0].ClientKey != "c" || next != "" {
+		t.Fatalf("last page %v, %q, %v", page, next, err)
+	}
+}
+
+func TestStoreConformance(t *testing.T) {
+	storagetest.Run(t, func() storage.Store {
+		s, err := New(filepath.Join(t.TempDir(), "store.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,68 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Install history event types, besides them the EventType sent by atlassian in the payload is used.
+const (
+	HistoryEventInstalled   = "installed"
+	HistoryEventUninstalled = "uninstalled"
+)
+
+// InstallRecord is a version of the install information of a tenant. Secrets are not kept, only
+// fingerprints of them, so records can be handed to support and auditors.
+type InstallRecord struct {
+	Install    JiraInstallInformation `json:"install"`
+	RecordedAt time.Time              `json:"recordedAt"`
+	// SharedSecretFingerprint identifies the shared secret the tenant had, to debug rotations.
+	SharedSecretFingerprint string `json:"sharedSecretFingerprint"`
+}
+
+// Fingerprint returns a short non reversible identifier of secret, "" for an empty one.
+func Fingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NewInstallRecord returns a record of jii as of at, without its secrets. eventType replaces the
+// EventType of jii if not empty.
+func NewInstallRecord(jii *JiraInstallInformation, eventType string, at time.Time) *InstallRecord {
+	r := &InstallRecord{
+		Install:                 *jii,
+		RecordedAt:              at.UTC(),
+		SharedSecretFingerprint: Fingerprint(jii.SharedSecret),
+	}
+	r.Install.SharedSecret, r.Install.PreviousSharedSecret, r.Install.OauthClientID = "", "", ""
+	if eventType != "" {
+		r.Install.EventType = eventType
+	}
+	return r
+}
+
+// InstallHistory can be implemented by stores to keep every version of the install information of
+// tenants rather than only the latest, the plugin records installs and uninstalls in it.
+type InstallHistory interface {
+	RecordInstall(*InstallRecord) error
+	// InstallHistory returns the records of the tenant, oldest first.
+	InstallHistory(clientKey string) ([]*InstallRecord, error)
+}
@@ -0,0 +1,98 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"sync"
+)
+
+// InstallSavedFunc is invoked with the install information of a tenant after it was saved.
+type InstallSavedFunc func(jii *JiraInstallInformation)
+
+// InstallDeletedFunc is invoked with the client key of a tenant after its install information was
+// deleted.
+type InstallDeletedFunc func(clientKey string)
+
+// HookedStore is a Store that invokes callbacks after install information is saved to or deleted
+// from the wrapped store, so other subsystems such as client caches, schedulers or metrics learn
+// about tenants appearing and leaving without polling. Callbacks run synchronously, in registration
+// order, and only after the wrapped store succeeded; they should hand slow work off.
+// Only changes made through the HookedStore are noticed, not those made by other replicas.
+// Every other call goes straight to the wrapped store through the embedded Delegate.
+type HookedStore struct {
+	Delegate
+	inner Store
+
+	mu      sync.RWMutex
+	saved   []InstallSavedFunc
+	deleted []InstallDeletedFunc
+}
+
+var (
+	_ Store   = (*HookedStore)(nil)
+	_ Deleter = (*HookedStore)(nil)
+)
+
+// NewHookedStore returns a Store invoking the registered callbacks on changes to inner.
+func NewHookedStore(inner Store) *HookedStore {
+	return &HookedStore{Delegate: NewDelegate(inner), inner: inner}
+}
+
+// OnInstallSaved registers f to be invoked after install information is saved, f must not modify it.
+func (s *HookedStore) OnInstallSaved(f InstallSavedFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, f)
+}
+
+// OnInstallDeleted registers f to be invoked after install information is deleted.
+func (s *HookedStore) OnInstallDeleted(f InstallDeletedFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, f)
+}
+
+// SaveJiraInstallInformation implements Store
+func (s *HookedStore) SaveJiraInstallInformation(jii *JiraInstallInformation) error {
+	if err := s.inner.SaveJiraInstallInformation(jii); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	hooks := s.saved
+	s.mu.RUnlock()
+	for _, f := range hooks {
+		f(jii)
+	}
+	return nil
+}
+
+// JiraInstallInformation implements Store
+func (s *HookedStore) JiraInstallInformation(clientKey string) (*JiraInstallInformation, error) {
+	return s.inner.JiraInstallInformation(clientKey)
+}
+
+// DeleteJiraInstallInformation implements Deleter, the delete hooks run once the tenant is gone.
+func (s *HookedStore) DeleteJiraInstallInformation(clientKey string) error {
+	if err := s.Delegate.DeleteJiraInstallInformation(clientKey); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	hooks := s.deleted
+	s.mu.RUnlock()
+	for _, f := range hooks {
+		f(clientKey)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHookedStore(t *testing.T) {
+	s := NewHookedStore(NewMemoryStore(0))
+	var events []string
+	s.OnInstallSaved(func(jii *JiraInstallInformation) { events = append(events, "saved "+jii.ClientKey) })
+	s.OnInstallDeleted(func(clientKey string) { events = append(events, "deleted "+clientKey) })
+	if err := s.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteJiraInstallInformation("a"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"saved a", "deleted a"}; !reflect.DeepEqual(events, want) {
+		t.Fatalf("hooks saw %v, want %v", events, want)
+	}
+
+	failing := NewHookedStore(failingStore{})
+	failing.OnInstallSaved(func(*JiraInstallInformation) { t.Fatal("hook invoked for a failed save") })
+	if err := failing.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: "a"}); err == nil {
+		t.Fatal("save to a failing store succeeded")
+	}
+	if err := failing.DeleteJiraInstallInformation("a"); err == nil {
+		t.Fatal("deleting from a store that can not delete succeeded")
+	}
+}
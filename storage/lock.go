@@ -0,0 +1,72 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import "sync"
+
+// Locker can be implemented by stores shared by several replicas of an app to serialize changes to
+// a tenant, ie so two replicas receiving the installed event at once don't interleave their reads
+// and writes and persist a mix of both.
+type Locker interface {
+	// WithLock invokes f holding an exclusive lock on clientKey, across every process using the
+	// store, and returns its error.
+	WithLock(clientKey string, f func() error) error
+}
+
+// WithLock invokes f holding the lock of clientKey if st implements Locker, or right away otherwise.
+func WithLock(st Store, clientKey string, f func() error) error {
+	if l, ok := st.(Locker); ok {
+		return l.WithLock(clientKey, f)
+	}
+	return f()
+}
+
+// keyedLocks holds a mutex per key while it is in use, the zero value is ready to use.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	// users is the number of goroutines holding or waiting for the lock.
+	users int
+}
+
+// with invokes f holding the lock of key.
+func (k *keyedLocks) with(key string, f func() error) error {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.users++
+	k.mu.Unlock()
+
+	l.Lock()
+	defer func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.users--; l.users == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}()
+	return f()
+}
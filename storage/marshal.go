@@ -0,0 +1,46 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import "encoding/json"
+
+// jiiFields has the same fields as JiraInstallInformation without its methods.
+type jiiFields JiraInstallInformation
+
+// RedactedInstall is a view of JiraInstallInformation whose SharedSecret, PreviousSharedSecret
+// and PublicKey are replaced with Redacted when marshaled to JSON, preventing leaks when install
+// information is serialized into logs or API responses, see JiraInstallInformation.Redacted.
+type RedactedInstall JiraInstallInformation
+
+// Redacted returns the view of j to marshal when its secrets must not be exposed, JiraInstallInformation
+// itself is marshaled with its secrets.
+func (j JiraInstallInformation) Redacted() RedactedInstall {
+	return RedactedInstall(j)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r RedactedInstall) MarshalJSON() ([]byte, error) {
+	f := jiiFields(r)
+	f.SharedSecret = Secret(f.SharedSecret).String()
+	f.PublicKey = Secret(f.PublicKey).String()
+	f.PreviousSharedSecret = Secret(f.PreviousSharedSecret).String()
+	return json.Marshal(f)
+}
+
+// MarshalWithSecrets marshals the install information to JSON including its secrets, it is meant
+// for stores persisting it and states so explicitly, as opposed to marshaling the Redacted view.
+func MarshalWithSecrets(j *JiraInstallInformation) ([]byte, error) {
+	return json.Marshal((*jiiFields)(j))
+}
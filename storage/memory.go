@@ -0,0 +1,385 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	jii   JiraInstallInformation
+	saved time.Time
+}
+
+type memoryLease struct {
+	owner   string
+	expires time.Time
+}
+
+// MemoryStore is a Store keeping install information in memory, meant for tests, demos and as the
+// cache of other stores. It is safe for concurrent use and hands out copies, so callers can't
+// modify what it holds.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	now      func() time.Time
+	entries  map[string]memoryEntry
+	settings map[string]map[string]string
+	history  map[string][]InstallRecord
+	tokens   map[tokenKey]AccessToken
+	letters  map[string]DeadLetter
+	accounts map[userMappingKey]string
+	outbox   map[string]OutboxMessage
+	leases   map[string]memoryLease
+	// locks are not guarded by mu, which must not be held while the function of WithLock runs.
+	locks keyedLocks
+}
+
+var (
+	_ Store            = (*MemoryStore)(nil)
+	_ Lister           = (*MemoryStore)(nil)
+	_ Preloader        = (*MemoryStore)(nil)
+	_ TenantSettings   = (*MemoryStore)(nil)
+	_ Deleter          = (*MemoryStore)(nil)
+	_ InstallHistory   = (*MemoryStore)(nil)
+	_ TokenStore       = (*MemoryStore)(nil)
+	_ DeadLetterStore  = (*MemoryStore)(nil)
+	_ UserMappingStore = (*MemoryStore)(nil)
+	_ Locker           = (*MemoryStore)(nil)
+	_ OutboxStore      = (*MemoryStore)(nil)
+	_ LeaseStore       = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore returns an empty MemoryStore, install information expires ttl after being saved
+// unless ttl is 0.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  map[string]memoryEntry{},
+		settings: map[string]map[string]string{},
+		history:  map[string][]InstallRecord{},
+		tokens:   map[tokenKey]AccessToken{},
+		letters:  map[string]DeadLetter{},
+		accounts: map[userMappingKey]string{},
+		outbox:   map[string]OutboxMessage{},
+		leases:   map[string]memoryLease{},
+	}
+}
+
+func (m *MemoryStore) expired(e memoryEntry) bool {
+	return m.ttl > 0 && m.now().Sub(e.saved) >= m.ttl
+}
+
+// SaveJiraInstallInformation implements Store
+func (m *MemoryStore) SaveJiraInstallInformation(jii *JiraInstallInformation) error {
+	m.Preload(jii)
+	return nil
+}
+
+// Preload implements Preloader
+func (m *MemoryStore) Preload(jiis ...*JiraInstallInformation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for _, jii := range jiis {
+		m.entries[jii.ClientKey] = memoryEntry{jii: *jii, saved: now}
+	}
+}
+
+// JiraInstallInformation implements Store, it returns nil if the tenant is unknown or expired.
+func (m *MemoryStore) JiraInstallInformation(clientKey string) (*JiraInstallInformation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[clientKey]
+	if !ok || m.expired(e) {
+		return nil, nil
+	}
+	jii := e.jii
+	return &jii, nil
+}
+
+// Delete forgets the install information and settings of the tenant.
+func (m *MemoryStore) Delete(clientKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, clientKey)
+	delete(m.settings, clientKey)
+}
+
+// DeleteJiraInstallInformation implements Deleter, the tenant settings are kept.
+func (m *MemoryStore) DeleteJiraInstallInformation(clientKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, clientKey)
+	return nil
+}
+
+// ListInstallations implements Lister, cursors are client keys.
+func (m *MemoryStore) ListInstallations(cursor string, limit int) ([]*JiraInstallInformation, string, error) {
+	jiis := m.Snapshot()
+	start := sort.Search(len(jiis), func(i int) bool { return jiis[i].ClientKey > cursor })
+	jiis = jiis[start:]
+	if limit > 0 && len(jiis) > limit {
+		return jiis[:limit], jiis[limit-1].ClientKey, nil
+	}
+	return jiis, "", nil
+}
+
+// Snapshot returns copies of the install information held, sorted by client key.
+func (m *MemoryStore) Snapshot() []*JiraInstallInformation {
+	m.mu.RLock()
+	jiis := make([]*JiraInstallInformation, 0, len(m.entries))
+	for _, e := range m.entries {
+		if m.expired(e) {
+			continue
+		}
+		jii := e.jii
+		jiis = append(jiis, &jii)
+	}
+	m.mu.RUnlock()
+	sort.Slice(jiis, func(i, j int) bool { return jiis[i].ClientKey < jiis[j].ClientKey })
+	return jiis
+}
+
+// Seed saves the install information read from r, a JSON array of install payloads such as those
+// atlassian sends to the installed lifecycle route, ie to load a fixture in tests.
+func (m *MemoryStore) Seed(r io.Reader) error {
+	var jiis []*JiraInstallInformation
+	if err := json.NewDecoder(r).Decode(&jiis); err != nil {
+		return fmt.Errorf("decoding install information fixture: %w", err)
+	}
+	for i, jii := range jiis {
+		if jii == nil || jii.ClientKey == "" {
+			return fmt.Errorf("install information %d of the fixture has no clientKey", i)
+		}
+	}
+	m.Preload(jiis...)
+	return nil
+}
+
+// GetSetting implements TenantSettings
+func (m *MemoryStore) GetSetting(clientKey, key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings[clientKey][key], nil
+}
+
+// SetSetting implements TenantSettings
+func (m *MemoryStore) SetSetting(clientKey, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.settings[clientKey] == nil {
+		m.settings[clientKey] = map[string]string{}
+	}
+	m.settings[clientKey][key] = value
+	return nil
+}
+
+// RecordInstall implements InstallHistory
+func (m *MemoryStore) RecordInstall(r *InstallRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history[r.Install.ClientKey] = append(m.history[r.Install.ClientKey], *r)
+	return nil
+}
+
+// InstallHistory implements InstallHistory
+func (m *MemoryStore) InstallHistory(clientKey string) ([]*InstallRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records := make([]*InstallRecord, 0, len(m.history[clientKey]))
+	for _, r := range m.history[clientKey] {
+		r := r
+		records = append(records, &r)
+	}
+	return records, nil
+}
+
+// SaveAccessToken implements TokenStore
+func (m *MemoryStore) SaveAccessToken(clientKey, accountID, scopes string, token *AccessToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[tokenKey{clientKey, accountID, scopes}] = *token
+	return nil
+}
+
+// AccessToken implements TokenStore
+func (m *MemoryStore) AccessToken(clientKey, accountID, scopes string) (*AccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	token, ok := m.tokens[tokenKey{clientKey, accountID, scopes}]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+// SaveDeadLetter implements DeadLetterStore
+func (m *MemoryStore) SaveDeadLetter(l *DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters[l.ID] = *l
+	return nil
+}
+
+// DeadLetter implements DeadLetterStore
+func (m *MemoryStore) DeadLetter(id string) (*DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	l, ok := m.letters[id]
+	if !ok {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+// DeadLetters implements DeadLetterStore
+func (m *MemoryStore) DeadLetters(clientKey string) ([]*DeadLetter, error) {
+	m.mu.RLock()
+	letters := make([]*DeadLetter, 0, len(m.letters))
+	for _, l := range m.letters {
+		if clientKey != "" && l.ClientKey != clientKey {
+			continue
+		}
+		l := l
+		letters = append(letters, &l)
+	}
+	m.mu.RUnlock()
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].FailedAt.Before(letters[j].FailedAt)
+		}
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, nil
+}
+
+// DeleteDeadLetter implements DeadLetterStore
+func (m *MemoryStore) DeleteDeadLetter(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.letters, id)
+	return nil
+}
+
+// SaveAccountIDs implements UserMappingStore
+func (m *MemoryStore) SaveAccountIDs(clientKey string, mapping map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for legacyID, accountID := range mapping {
+		m.accounts[userMappingKey{clientKey, legacyID}] = accountID
+	}
+	return nil
+}
+
+// AccountIDs implements UserMappingStore
+func (m *MemoryStore) AccountIDs(clientKey string, legacyIDs []string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found := map[string]string{}
+	for _, legacyID := range legacyIDs {
+		if accountID, ok := m.accounts[userMappingKey{clientKey, legacyID}]; ok {
+			found[legacyID] = accountID
+		}
+	}
+	return found, nil
+}
+
+// WithLock implements Locker, the lock is only held within the process.
+func (m *MemoryStore) WithLock(clientKey string, f func() error) error {
+	return m.locks.with(clientKey, f)
+}
+
+// EnqueueOutboxMessage implements OutboxStore
+func (m *MemoryStore) EnqueueOutboxMessage(msg *OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.outbox[msg.ID]; ok {
+		return fmt.Errorf("outbox message %s is already enqueued", msg.ID)
+	}
+	m.outbox[msg.ID] = *msg
+	return nil
+}
+
+// PendingOutboxMessages implements OutboxStore, messages are returned by NextAttempt, oldest first.
+func (m *MemoryStore) PendingOutboxMessages(now time.Time, limit int) ([]*OutboxMessage, error) {
+	m.mu.RLock()
+	pending := make([]*OutboxMessage, 0, len(m.outbox))
+	for _, msg := range m.outbox {
+		if msg.GaveUp || msg.NextAttempt.After(now) {
+			continue
+		}
+		msg := msg
+		pending = append(pending, &msg)
+	}
+	m.mu.RUnlock()
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].NextAttempt.Equal(pending[j].NextAttempt) {
+			return pending[i].NextAttempt.Before(pending[j].NextAttempt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+// UpdateOutboxMessage implements OutboxStore
+func (m *MemoryStore) UpdateOutboxMessage(msg *OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.outbox[msg.ID]; !ok {
+		return fmt.Errorf("outbox message %s is not enqueued", msg.ID)
+	}
+	m.outbox[msg.ID] = *msg
+	return nil
+}
+
+// DeleteOutboxMessage implements OutboxStore
+func (m *MemoryStore) DeleteOutboxMessage(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.outbox, id)
+	return nil
+}
+
+// AcquireLease implements LeaseStore, leases are only exclusive within the process.
+func (m *MemoryStore) AcquireLease(name, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if l, ok := m.leases[name]; ok && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+	m.leases[name] = memoryLease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease implements LeaseStore, releasing a lease held by somebody else does nothing.
+func (m *MemoryStore) ReleaseLease(name, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.leases[name]; ok && l.owner == owner {
+		delete(m.leases, name)
+	}
+	return nil
+}
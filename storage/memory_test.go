@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	m := NewMemoryStore(time.Hour)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	err := m.Seed(strings.NewReader(`[
+		{"key": "io.shiftleft.test", "clientKey": "b", "sharedSecret": "secret-b"},
+		{"key": "io.shiftleft.test", "clientKey": "a", "sharedSecret": "secret-a"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jii, err := m.JiraInstallInformation("a")
+	if err != nil || jii == nil || jii.SharedSecret != "secret-a" {
+		t.Fatalf("read %+v, %v", jii, err)
+	}
+	jii.SharedSecret = "modified"
+	if again, _ := m.JiraInstallInformation("a"); again.SharedSecret != "secret-a" {
+		t.Fatal("modifying a read install information changed the stored one")
+	}
+
+	page, next, err := m.ListInstallations("", 1)
+	if err != nil || len(page) != 1 || page[0].ClientKey != "a" || next != "a" {
+		t.Fatalf("first page %v, %q, %v", page, next, err)
+	}
+	page, next, _ = m.ListInstallations(next, 1)
+	if len(page) != 1 || page[0].ClientKey != "b" || next != "" {
+		t.Fatalf("last page %v, %q", page, next)
+	}
+
+	now = now.Add(time.Hour)
+	if jii, _ := m.JiraInstallInformation("a"); jii != nil {
+		t.Fatal("install information did not expire")
+	}
+	if len(m.Snapshot()) != 0 {
+		t.Fatal("snapshot includes expired install information")
+	}
+	if err := m.Seed(strings.NewReader(`[{"key": "io.shiftleft.test"}]`)); err == nil {
+		t.Fatal("seeding install information without client key succeeded")
+	}
+}
+
+func TestMemoryStore_InstallHistory(t *testing.T) {
+	m := NewMemoryStore(0)
+	for _, secret := range []string{"first", "rotated"} {
+		jii := &JiraInstallInformation{ClientKey: "a", SharedSecret: secret}
+		if err := m.RecordInstall(NewInstallRecord(jii, HistoryEventInstalled, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := m.InstallHistory("a")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("history is %v, %v", history, err)
+	}
+	if history[0].Install.SharedSecret != "" {
+		t.Fatal("the install history keeps secrets")
+	}
+	if history[0].SharedSecretFingerprint != Fingerprint("first") ||
+		history[0].SharedSecretFingerprint == history[1].SharedSecretFingerprint {
+		t.Fatalf("fingerprints do not tell secrets apart: %v", history)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	// secrets must survive the round trip.
+	source := NewMemoryStore(0)
+	for _, ck := range []string{"b", "a"} {
+		if err := source.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: ck, SharedSecret: "secret-" + ck}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if n, err := Export(source, &buf); err != nil || n != 2 {
+		t.Fatalf("exported %d, %v", n, err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Fatalf("exported %d lines: %s", lines, buf.String())
+	}
+
+	target := NewMemoryStore(0)
+	if n, err := Import(target, &buf); err != nil || n != 2 {
+		t.Fatalf("imported %d, %v", n, err)
+	}
+	if jii, _ := target.JiraInstallInformation("b"); jii == nil || jii.SharedSecret != "secret-b" {
+		t.Fatalf("imported %+v", jii)
+	}
+	if n, err := Import(target, strings.NewReader(`{"clientKey": "c"}`+"\n"+`{"sharedSecret": "x"}`)); err == nil || n != 1 {
+		t.Fatalf("importing an installation without client key returned %d, %v", n, err)
+	}
+	if _, err := Export(&struct{ Store }{target}, &buf); err == nil {
+		t.Fatal("exporting a store that can not list succeeded")
+	}
+}
+
+func TestMemoryStore_WithLock(t *testing.T) {
+	m := NewMemoryStore(0)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	holding := map[string]int{}
+	for i := 0; i < 20; i++ {
+		clientKey := []string{"a", "b"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.WithLock(clientKey, func() error {
+				mu.Lock()
+				holding[clientKey]++
+				if holding[clientKey] > 1 {
+					t.Errorf("%s is locked twice", clientKey)
+				}
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				holding[clientKey]--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(m.locks.locks) != 0 {
+		t.Fatalf("%d locks are kept after being released", len(m.locks.locks))
+	}
+}
+
+func TestJiraInstallInformation_Redacted(t *testing.T) {
+	jii := JiraInstallInformation{ClientKey: "a", SharedSecret: "shared", PreviousSharedSecret: "previous", PublicKey: "public"}
+	redacted, err := json.Marshal(jii.Redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"shared", "previous", "public"} {
+		if strings.Contains(string(redacted), `"`+secret+`"`) {
+			t.Fatalf("redacted view leaks %s: %s", secret, redacted)
+		}
+	}
+	var back JiraInstallInformation
+	if err := json.Unmarshal(redacted, &back); err != nil || back.ClientKey != "a" || back.SharedSecret != Redacted {
+		t.Fatalf("redacted view read back as %+v, %v", back, err)
+	}
+
+	// the install information itself, and pointers to it, keep their secrets.
+	for _, v := range []interface{}{jii, &jii} {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(raw, &back); err != nil || back != jii {
+			t.Fatalf("marshaled %T read back as %+v, %v", v, back, err)
+		}
+	}
+	raw, err := MarshalWithSecrets(&jii)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &back); err != nil || back != jii {
+		t.Fatalf("marshaled with secrets read back as %+v, %v", back, err)
+	}
+}
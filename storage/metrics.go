@@ -0,0 +1,173 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// MetricsSink receives a sample for every call to an InstrumentedStore, method is the name of the
+// Store method called (ie "JiraInstallInformation") so it can be used as a metric label, ie of a
+// prometheus HistogramVec observing d and a CounterVec of errors.
+type MetricsSink interface {
+	ObserveStoreCall(method string, d time.Duration, err error)
+}
+
+// MetricsSinkFunc adapts a function to MetricsSink.
+type MetricsSinkFunc func(method string, d time.Duration, err error)
+
+// ObserveStoreCall implements MetricsSink.
+func (f MetricsSinkFunc) ObserveStoreCall(method string, d time.Duration, err error) {
+	f(method, d, err)
+}
+
+// InstrumentedStore is a Store that reports the latency and outcome of every call to the wrapped
+// store to a MetricsSink, telling slow storage apart from slow jira.
+// Only the Store, Deleter and TenantSettings calls are observed, the rest is forwarded as is.
+type InstrumentedStore struct {
+	Delegate
+	inner Store
+	sink  MetricsSink
+}
+
+var (
+	_ Store   = (*InstrumentedStore)(nil)
+	_ Deleter = (*InstrumentedStore)(nil)
+
+	_ TenantSettings = (*InstrumentedStore)(nil)
+)
+
+// NewInstrumentedStore returns a Store reporting the calls to inner to sink.
+func NewInstrumentedStore(inner Store, sink MetricsSink) *InstrumentedStore {
+	return &InstrumentedStore{Delegate: NewDelegate(inner), inner: inner, sink: sink}
+}
+
+// observe reports a call to the sink, calls the wrapped store does not support were never attempted.
+func (s *InstrumentedStore) observe(method string, start time.Time, err error) {
+	if errors.Is(err, ErrUnsupported) {
+		return
+	}
+	s.sink.ObserveStoreCall(method, time.Since(start), err)
+}
+
+// SaveJiraInstallInformation implements Store.
+func (s *InstrumentedStore) SaveJiraInstallInformation(jii *JiraInstallInformation) error {
+	start := time.Now()
+	err := s.inner.SaveJiraInstallInformation(jii)
+	s.observe("SaveJiraInstallInformation", start, err)
+	return err
+}
+
+// JiraInstallInformation implements Store.
+func (s *InstrumentedStore) JiraInstallInformation(clientKey string) (*JiraInstallInformation, error) {
+	start := time.Now()
+	jii, err := s.inner.JiraInstallInformation(clientKey)
+	s.observe("JiraInstallInformation", start, err)
+	return jii, err
+}
+
+// DeleteJiraInstallInformation implements Deleter.
+func (s *InstrumentedStore) DeleteJiraInstallInformation(clientKey string) error {
+	start := time.Now()
+	err := s.Delegate.DeleteJiraInstallInformation(clientKey)
+	s.observe("DeleteJiraInstallInformation", start, err)
+	return err
+}
+
+// GetSetting implements TenantSettings.
+func (s *InstrumentedStore) GetSetting(clientKey, key string) (string, error) {
+	start := time.Now()
+	value, err := s.Delegate.GetSetting(clientKey, key)
+	s.observe("GetSetting", start, err)
+	return value, err
+}
+
+// SetSetting implements TenantSettings.
+func (s *InstrumentedStore) SetSetting(clientKey, key, value string) error {
+	start := time.Now()
+	err := s.Delegate.SetSetting(clientKey, key, value)
+	s.observe("SetSetting", start, err)
+	return err
+}
+
+// StoreMethodMetrics holds the statistics of the calls to a Store method.
+type StoreMethodMetrics struct {
+	Calls        int64         `json:"calls"`
+	Errors       int64         `json:"errors"`
+	TotalLatency time.Duration `json:"totalLatency"`
+	MaxLatency   time.Duration `json:"maxLatency"`
+}
+
+// ErrorRate returns the fraction of calls that failed.
+func (m StoreMethodMetrics) ErrorRate() float64 {
+	if m.Calls == 0 {
+		return 0
+	}
+	return float64(m.Errors) / float64(m.Calls)
+}
+
+// MeanLatency returns the average latency of the calls.
+func (m StoreMethodMetrics) MeanLatency() time.Duration {
+	if m.Calls == 0 {
+		return 0
+	}
+	return m.TotalLatency / time.Duration(m.Calls)
+}
+
+// StoreMetrics is a MetricsSink aggregating in memory the calls to each Store method, for
+// deployments that don't export metrics elsewhere. It is safe for concurrent use.
+type StoreMetrics struct {
+	mu      sync.Mutex
+	methods map[string]*StoreMethodMetrics
+}
+
+var _ MetricsSink = (*StoreMetrics)(nil)
+
+// NewStoreMetrics returns an empty StoreMetrics.
+func NewStoreMetrics() *StoreMetrics {
+	return &StoreMetrics{methods: map[string]*StoreMethodMetrics{}}
+}
+
+// ObserveStoreCall implements MetricsSink.
+func (m *StoreMetrics) ObserveStoreCall(method string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm, ok := m.methods[method]
+	if !ok {
+		mm = &StoreMethodMetrics{}
+		m.methods[method] = mm
+	}
+	mm.Calls++
+	if err != nil {
+		mm.Errors++
+	}
+	mm.TotalLatency += d
+	if d > mm.MaxLatency {
+		mm.MaxLatency = d
+	}
+}
+
+// Snapshot returns a copy of the statistics of all methods keyed by method name.
+func (m *StoreMetrics) Snapshot() map[string]StoreMethodMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]StoreMethodMetrics, len(m.methods))
+	for k, v := range m.methods {
+		snapshot[k] = *v
+	}
+	return snapshot
+}
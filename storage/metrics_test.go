@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingStore fails every call.
+type failingStore struct{}
+
+func (failingStore) SaveJiraInstallInformation(*JiraInstallInformation) error {
+	return errors.New("database is down")
+}
+
+func (failingStore) JiraInstallInformation(string) (*JiraInstallInformation, error) {
+	return nil, errors.New("database is down")
+}
+
+func TestInstrumentedStore(t *testing.T) {
+	metrics := NewStoreMetrics()
+	s := NewInstrumentedStore(NewMemoryStore(0), metrics)
+	if err := s.SaveJiraInstallInformation(&JiraInstallInformation{ClientKey: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		s.JiraInstallInformation("a")
+	}
+	failing := NewInstrumentedStore(failingStore{}, metrics)
+	failing.JiraInstallInformation("a")
+	if err := failing.DeleteJiraInstallInformation("a"); err == nil {
+		t.Fatal("deleting through a store that can't delete succeeded")
+	}
+
+	snapshot := metrics.Snapshot()
+	if save := snapshot["SaveJiraInstallInformation"]; save.Calls != 1 || save.Errors != 0 {
+		t.Fatalf("save metrics are %+v", save)
+	}
+	read := snapshot["JiraInstallInformation"]
+	if read.Calls != 4 || read.Errors != 1 || read.ErrorRate() != 0.25 {
+		t.Fatalf("read metrics are %+v", read)
+	}
+	if _, ok := snapshot["DeleteJiraInstallInformation"]; ok {
+		t.Fatal("a delete that was never attempted was recorded")
+	}
+}
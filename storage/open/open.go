@@ -0,0 +1,65 @@
+// Package open opens the stores of this module from a DSN, so apps can pick their store with
+// configuration, ie ATLASSIAN_CONNECT_STORE_DSN read by handling.ConfigFromEnv.
+package open
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/filestore"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/postgres"
+)
+
+// Store returns the store described by dsn, one of:
+//
+//	memory://                 a storage.MemoryStore, install information is lost on restart.
+//	file:///path/to/file      a filestore.Store persisting to the file.
+//	postgres://... or postgresql://...
+//	                          a postgres.Store, migrated before being returned. A database/sql
+//	                          driver must be registered as "postgres", ie by importing github.com/lib/pq.
+func Store(ctx context.Context, dsn string) (storage.Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing store DSN: %w", err)
+	}
+	switch u.Scheme {
+	case "memory":
+		return storage.NewMemoryStore(0), nil
+	case "file":
+		path := u.Path
+		if u.Host != "" {
+			// file://relative/path
+			path = u.Host + path
+		}
+		return filestore.New(path)
+	case "postgres", "postgresql":
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("opening postgres store: %w", err)
+		}
+		s := postgres.New(db)
+		if err := s.Migrate(ctx); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrating postgres store: %w", err)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported store DSN scheme %q", u.Scheme)
+}
@@ -0,0 +1,27 @@
+package open
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/filestore"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	if st, err := Store(ctx, "memory://"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := st.(*storage.MemoryStore); !ok {
+		t.Fatalf("memory DSN opened %T", st)
+	}
+	if st, err := Store(ctx, "file://"+filepath.Join(t.TempDir(), "store.json")); err != nil {
+		t.Fatal(err)
+	} else if _, ok := st.(*filestore.Store); !ok {
+		t.Fatalf("file DSN opened %T", st)
+	}
+	if _, err := Store(ctx, "mysql://localhost"); err == nil {
+		t.Fatal("unsupported DSN was accepted")
+	}
+}
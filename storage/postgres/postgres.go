@@ -0,0 +1,503 @@
+// Package postgres implements storage.Store on top of database/sql for PostgreSQL, any driver
+// can be used (ie pgx through github.com/jackc/pgx/v4/stdlib or lib/pq).
+package postgres
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// migrationLockID is the key of the advisory lock held while migrating, so replicas booting at
+// the same time don't race.
+const migrationLockID = 7318230420
+
+// tenantLockClass namespaces the advisory locks of tenants taken by WithLock, whose second key is
+// the hash of the client key.
+const tenantLockClass = 73182305
+
+// migrations are applied in order, each exactly once, never edit or reorder them, append new ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS atlassian_connect_installations (
+		client_key   TEXT PRIMARY KEY,
+		base_url     TEXT NOT NULL,
+		product_type TEXT NOT NULL,
+		data         JSONB NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS atlassian_connect_install_history (
+		id          BIGSERIAL PRIMARY KEY,
+		client_key  TEXT NOT NULL,
+		event_type  TEXT NOT NULL,
+		recorded_at TIMESTAMPTZ NOT NULL,
+		data        JSONB NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS atlassian_connect_install_history_client_key
+		ON atlassian_connect_install_history (client_key, recorded_at)`,
+	`CREATE TABLE IF NOT EXISTS atlassian_connect_settings (
+		client_key TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		value      TEXT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (client_key, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS atlassian_connect_access_tokens (
+		client_key TEXT NOT NULL,
+		account_id TEXT NOT NULL,
+		scopes     TEXT NOT NULL,
+		data       JSONB NOT NULL,
+		expiry     TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (client_key, account_id, scopes)
+	)`,
+	`CREATE TABLE IF NOT EXISTS atlassian_connect_dead_letters (
+		id         TEXT PRIMARY KEY,
+		client_key TEXT NOT NULL,
+		failed_at  TIMESTAMPTZ NOT NULL,
+		data       JSONB NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS atlassian_connect_user_mappings (
+		client_key TEXT NOT NULL,
+		legacy_id  TEXT NOT NULL,
+		account_id TEXT NOT NULL,
+		PRIMARY KEY (client_key, legacy_id)
+	)`,
+}
+
+// Store is a storage.Store backed by a PostgreSQL database, Migrate must be invoked before using it.
+type Store struct {
+	db *sql.DB
+}
+
+var (
+	_ storage.Store            = (*Store)(nil)
+	_ storage.Pinger           = (*Store)(nil)
+	_ storage.Lister           = (*Store)(nil)
+	_ storage.Deleter          = (*Store)(nil)
+	_ storage.InstallHistory   = (*Store)(nil)
+	_ storage.TenantSettings   = (*Store)(nil)
+	_ storage.TokenStore       = (*Store)(nil)
+	_ storage.DeadLetterStore  = (*Store)(nil)
+	_ storage.SiteLookup       = (*Store)(nil)
+	_ storage.UserMappingStore = (*Store)(nil)
+	_ storage.Locker           = (*Store)(nil)
+)
+
+// New returns a Store using db.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Migrate creates or updates the tables used by the store, it is safe to invoke it concurrently
+// from many replicas.
+func (s *Store) Migrate(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("locking migrations: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS atlassian_connect_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+	var applied int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM atlassian_connect_migrations`).Scan(&applied); err != nil {
+		return fmt.Errorf("reading applied migrations: %w", err)
+	}
+	for version := applied + 1; version <= len(migrations); version++ {
+		if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+			return fmt.Errorf("applying migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO atlassian_connect_migrations (version) VALUES ($1)`, version); err != nil {
+			return fmt.Errorf("recording migration %d: %w", version, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing migrations: %w", err)
+	}
+	return nil
+}
+
+// SaveJiraInstallInformation implements storage.Store, install information is upserted by client key.
+func (s *Store) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	data, err := storage.MarshalWithSecrets(jii)
+	if err != nil {
+		return fmt.Errorf("marshaling install information: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO atlassian_connect_installations (client_key, base_url, product_type, data)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (client_key) DO UPDATE SET
+			base_url = EXCLUDED.base_url,
+			product_type = EXCLUDED.product_type,
+			data = EXCLUDED.data,
+			updated_at = now()`,
+		jii.ClientKey, jii.BaseURL, jii.ProductType, string(data))
+	if err != nil {
+		return fmt.Errorf("saving install information of %s: %w", jii.ClientKey, err)
+	}
+	return nil
+}
+
+// JiraInstallInformation implements storage.Store, it returns nil if the tenant is not installed.
+func (s *Store) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM atlassian_connect_installations WHERE client_key = $1`,
+		clientKey).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading install information of %s: %w", clientKey, err)
+	}
+	return decode(data)
+}
+
+// DeleteJiraInstallInformation implements storage.Deleter
+func (s *Store) DeleteJiraInstallInformation(clientKey string) error {
+	_, err := s.db.Exec(`DELETE FROM atlassian_connect_installations WHERE client_key = $1`, clientKey)
+	if err != nil {
+		return fmt.Errorf("deleting install information of %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// ListInstallations implements storage.Lister, cursors are client keys.
+func (s *Store) ListInstallations(cursor string, limit int) ([]*storage.JiraInstallInformation, string, error) {
+	rows, err := s.db.Query(`SELECT data FROM atlassian_connect_installations
+		WHERE client_key > $1 ORDER BY client_key LIMIT $2`, cursor, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("listing installations: %w", err)
+	}
+	defer rows.Close()
+	var jiis []*storage.JiraInstallInformation
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, "", fmt.Errorf("reading installation: %w", err)
+		}
+		jii, err := decode(data)
+		if err != nil {
+			return nil, "", err
+		}
+		jiis = append(jiis, jii)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("listing installations: %w", err)
+	}
+	next := ""
+	if len(jiis) == limit && limit > 0 {
+		next = jiis[len(jiis)-1].ClientKey
+	}
+	return jiis, next, nil
+}
+
+// JiraInstallInformationByHost implements storage.SiteLookup
+func (s *Store) JiraInstallInformationByHost(host string) ([]*storage.JiraInstallInformation, error) {
+	rows, err := s.db.Query(`SELECT data FROM atlassian_connect_installations
+		WHERE LOWER(base_url) LIKE $1 ESCAPE '\' OR LOWER(base_url) LIKE $2 ESCAPE '\'
+		OR LOWER(base_url) LIKE $3 ESCAPE '\' ORDER BY client_key`,
+		"%://"+escapeLike(host), "%://"+escapeLike(host)+"/%", "%://"+escapeLike(host)+":%")
+	if err != nil {
+		return nil, fmt.Errorf("looking up installations of %s: %w", host, err)
+	}
+	defer rows.Close()
+	var jiis []*storage.JiraInstallInformation
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("reading installation: %w", err)
+		}
+		jii, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		jiis = append(jiis, jii)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("looking up installations of %s: %w", host, err)
+	}
+	return jiis, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s, so it matches literally in patterns with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// RecordInstall implements storage.InstallHistory
+func (s *Store) RecordInstall(r *storage.InstallRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshaling install record: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO atlassian_connect_install_history (client_key, event_type, recorded_at, data)
+		VALUES ($1, $2, $3, $4)`, r.Install.ClientKey, r.Install.EventType, r.RecordedAt, string(data))
+	if err != nil {
+		return fmt.Errorf("recording install of %s: %w", r.Install.ClientKey, err)
+	}
+	return nil
+}
+
+// InstallHistory implements storage.InstallHistory
+func (s *Store) InstallHistory(clientKey string) ([]*storage.InstallRecord, error) {
+	rows, err := s.db.Query(`SELECT data FROM atlassian_connect_install_history
+		WHERE client_key = $1 ORDER BY recorded_at, id`, clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading install history of %s: %w", clientKey, err)
+	}
+	defer rows.Close()
+	var records []*storage.InstallRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("reading install record: %w", err)
+		}
+		r := &storage.InstallRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return nil, fmt.Errorf("decoding install record: %w", err)
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading install history of %s: %w", clientKey, err)
+	}
+	return records, nil
+}
+
+// GetSetting implements storage.TenantSettings
+func (s *Store) GetSetting(clientKey, key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM atlassian_connect_settings WHERE client_key = $1 AND key = $2`,
+		clientKey, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading setting %s of %s: %w", key, clientKey, err)
+	}
+	return value, nil
+}
+
+// SetSetting implements storage.TenantSettings
+func (s *Store) SetSetting(clientKey, key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO atlassian_connect_settings (client_key, key, value) VALUES ($1, $2, $3)
+		ON CONFLICT (client_key, key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`,
+		clientKey, key, value)
+	if err != nil {
+		return fmt.Errorf("saving setting %s of %s: %w", key, clientKey, err)
+	}
+	return nil
+}
+
+// SaveAccessToken implements storage.TokenStore
+func (s *Store) SaveAccessToken(clientKey, accountID, scopes string, token *storage.AccessToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("marshaling access token: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO atlassian_connect_access_tokens (client_key, account_id, scopes, data, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (client_key, account_id, scopes) DO UPDATE SET data = EXCLUDED.data, expiry = EXCLUDED.expiry`,
+		clientKey, accountID, scopes, string(data), token.Expiry)
+	if err != nil {
+		return fmt.Errorf("saving access token of %s in %s: %w", accountID, clientKey, err)
+	}
+	return nil
+}
+
+// AccessToken implements storage.TokenStore
+func (s *Store) AccessToken(clientKey, accountID, scopes string) (*storage.AccessToken, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM atlassian_connect_access_tokens
+		WHERE client_key = $1 AND account_id = $2 AND scopes = $3`, clientKey, accountID, scopes).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading access token of %s in %s: %w", accountID, clientKey, err)
+	}
+	token := &storage.AccessToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("decoding access token: %w", err)
+	}
+	return token, nil
+}
+
+// SaveDeadLetter implements storage.DeadLetterStore
+func (s *Store) SaveDeadLetter(l *storage.DeadLetter) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("marshaling dead letter: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO atlassian_connect_dead_letters (id, client_key, failed_at, data)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET failed_at = EXCLUDED.failed_at, data = EXCLUDED.data`,
+		l.ID, l.ClientKey, l.FailedAt, string(data))
+	if err != nil {
+		return fmt.Errorf("saving dead letter %s: %w", l.ID, err)
+	}
+	return nil
+}
+
+// DeadLetter implements storage.DeadLetterStore
+func (s *Store) DeadLetter(id string) (*storage.DeadLetter, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM atlassian_connect_dead_letters WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading dead letter %s: %w", id, err)
+	}
+	l := &storage.DeadLetter{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("decoding dead letter: %w", err)
+	}
+	return l, nil
+}
+
+// DeadLetters implements storage.DeadLetterStore
+func (s *Store) DeadLetters(clientKey string) ([]*storage.DeadLetter, error) {
+	rows, err := s.db.Query(`SELECT data FROM atlassian_connect_dead_letters
+		WHERE $1 = '' OR client_key = $1 ORDER BY failed_at, id`, clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading dead letters: %w", err)
+	}
+	defer rows.Close()
+	var letters []*storage.DeadLetter
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("reading dead letter: %w", err)
+		}
+		l := &storage.DeadLetter{}
+		if err := json.Unmarshal(data, l); err != nil {
+			return nil, fmt.Errorf("decoding dead letter: %w", err)
+		}
+		letters = append(letters, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading dead letters: %w", err)
+	}
+	return letters, nil
+}
+
+// DeleteDeadLetter implements storage.DeadLetterStore
+func (s *Store) DeleteDeadLetter(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM atlassian_connect_dead_letters WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("deleting dead letter %s: %w", id, err)
+	}
+	return nil
+}
+
+// SaveAccountIDs implements storage.UserMappingStore
+func (s *Store) SaveAccountIDs(clientKey string, mapping map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for legacyID, accountID := range mapping {
+		if _, err := tx.Exec(`INSERT INTO atlassian_connect_user_mappings (client_key, legacy_id, account_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (client_key, legacy_id) DO UPDATE SET account_id = EXCLUDED.account_id`,
+			clientKey, legacyID, accountID); err != nil {
+			return fmt.Errorf("saving account id of %s in %s: %w", legacyID, clientKey, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing account ids of %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// AccountIDs implements storage.UserMappingStore
+func (s *Store) AccountIDs(clientKey string, legacyIDs []string) (map[string]string, error) {
+	found := map[string]string{}
+	if len(legacyIDs) == 0 {
+		return found, nil
+	}
+	args := []interface{}{clientKey}
+	placeholders := make([]string, 0, len(legacyIDs))
+	for _, legacyID := range legacyIDs {
+		args = append(args, legacyID)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+	}
+	rows, err := s.db.Query(`SELECT legacy_id, account_id FROM atlassian_connect_user_mappings
+		WHERE client_key = $1 AND legacy_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading account ids of %s: %w", clientKey, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var legacyID, accountID string
+		if err := rows.Scan(&legacyID, &accountID); err != nil {
+			return nil, fmt.Errorf("scanning account id: %w", err)
+		}
+		found[legacyID] = accountID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading account ids of %s: %w", clientKey, err)
+	}
+	return found, nil
+}
+
+// WithLock implements storage.Locker with an advisory lock held by a transaction, which postgres
+// releases if the connection is lost. Tenants whose client keys share a hash share a lock.
+func (s *Store) WithLock(clientKey string, f func() error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, tenantLockClass, clientKey); err != nil {
+		return fmt.Errorf("locking %s: %w", clientKey, err)
+	}
+	if err := f(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unlocking %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// Ping implements storage.Pinger
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func decode(data []byte) (*storage.JiraInstallInformation, error) {
+	jii := &storage.JiraInstallInformation{}
+	if err := json.Unmarshal(data, jii); err != nil {
+		return nil, fmt.Errorf("decoding install information: %w", err)
+	}
+	return jii, nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/storagetest"
+	_ "github.com/lib/pq"
+)
+
+const dropTables = `DROP TABLE IF EXISTS atlassian_connect_installations, atlassian_connect_install_history, atlassian_connect_settings, atlassian_connect_access_tokens, atlassian_connect_dead_letters, atlassian_connect_user_mappings, atlassian_connect_migrations`
+
+// testDB returns the database at POSTGRES_TEST_DSN, the test is skipped if unset.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec(dropTables)
+		db.Close()
+	})
+	return db
+}
+
+// newTestStore returns a migrated Store on the database at POSTGRES_TEST_DSN.
+func newTestStore(t *testing.T) *Store {
+	s := New(testDB(t))
+	// migrating twice must be harmless
+	for i := 0; i < 2; i++ {
+		if err := s.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestStore(t *testing.T) {
+	s := newTestStore(t)
+	jii := &storage.JiraInstallInformation{
+		Key:          "io.shiftleft.test",
+		ClientKey:    "ckey",
+		SharedSecret: "secret",
+		BaseURL:      "https://example.atlassian.net",
+		ProductType:  "jira",
+	}
+	if got, err := s.JiraInstallInformation(jii.ClientKey); err != nil || got != nil {
+		t.Fatalf("missing tenant returned %v, %v", got, err)
+	}
+	for _, secret := range []string{"secret", "rotated"} {
+		jii.SharedSecret = secret
+		if err := s.SaveJiraInstallInformation(jii); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.JiraInstallInformation(jii.ClientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *jii {
+		t.Fatalf("read %+v, saved %+v", got, jii)
+	}
+	listed, next, err := s.ListInstallations("", 10)
+	if err != nil || len(listed) != 1 || next != "" {
+		t.Fatalf("listed %v, %q, %v", listed, next, err)
+	}
+}
+
+func TestStoreConformance(t *testing.T) {
+	db := testDB(t)
+	storagetest.Run(t, func() storage.Store {
+		db.Exec(dropTables)
+		s := New(db)
+		if err := s.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`a_b%c\d.net`); got != `a\_b\%c\\d.net` {
+		t.Fatalf("escaped to %s", got)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"fmt"
+)
+
+// Lister can be implemented by stores able to enumerate the installations they hold.
+type Lister interface {
+	// ListInstallations returns up to limit installations after cursor, which is "" for the first
+	// page, and the cursor of the next page, which is "" once there are no more.
+	ListInstallations(cursor string, limit int) ([]*JiraInstallInformation, string, error)
+}
+
+// Preloader can be implemented by stores that cache install information to be handed
+// installations read elsewhere, ie at boot.
+type Preloader interface {
+	Preload(jiis ...*JiraInstallInformation)
+}
+
+// DefaultPrefetchPageSize is the page size Prefetch uses when passed none.
+const DefaultPrefetchPageSize = 100
+
+// ForEachInstallation lists every installation in source, page by page, and invokes f for each of
+// them, it stops at the first error returned by f.
+func ForEachInstallation(ctx context.Context, source Lister, pageSize int, f func(jii *JiraInstallInformation) error) error {
+	return forEachPage(ctx, source, pageSize, func(jiis []*JiraInstallInformation) error {
+		for _, jii := range jiis {
+			if err := f(jii); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// forEachPage invokes f with every page of installations in source.
+func forEachPage(ctx context.Context, source Lister, pageSize int, f func(jiis []*JiraInstallInformation) error) error {
+	if pageSize <= 0 {
+		pageSize = DefaultPrefetchPageSize
+	}
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		jiis, next, err := source.ListInstallations(cursor, pageSize)
+		if err != nil {
+			return fmt.Errorf("listing installations: %w", err)
+		}
+		if err := f(jiis); err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Prefetch lists every installation in source and hands them to cache page by page, so the first
+// request of each tenant after a deploy does not pay a cold read. It returns how many
+// installations were preloaded.
+func Prefetch(ctx context.Context, source Lister, cache Preloader, pageSize int) (int, error) {
+	count := 0
+	err := forEachPage(ctx, source, pageSize, func(jiis []*JiraInstallInformation) error {
+		cache.Preload(jiis...)
+		count += len(jiis)
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// pagedStore lists its installations in pages and records the ones preloaded into it.
+type pagedStore struct {
+	jiis      []*JiraInstallInformation
+	preloaded []string
+}
+
+func (s *pagedStore) ListInstallations(cursor string, limit int) ([]*JiraInstallInformation, string, error) {
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	end := start + limit
+	if end >= len(s.jiis) {
+		return s.jiis[start:], "", nil
+	}
+	return s.jiis[start:end], strconv.Itoa(end), nil
+}
+
+func (s *pagedStore) Preload(jiis ...*JiraInstallInformation) {
+	for _, jii := range jiis {
+		s.preloaded = append(s.preloaded, jii.ClientKey)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	st := &pagedStore{}
+	for i := 0; i < 5; i++ {
+		st.jiis = append(st.jiis, &JiraInstallInformation{ClientKey: fmt.Sprintf("tenant-%d", i)})
+	}
+	count, err := Prefetch(context.Background(), st, st, 2)
+	if err != nil || count != 5 {
+		t.Fatalf("prefetched %d installations, %v", count, err)
+	}
+	if len(st.preloaded) != 5 || st.preloaded[4] != "tenant-4" {
+		t.Fatalf("preloaded %v", st.preloaded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Prefetch(ctx, st, st, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("prefetching with a cancelled context returned %v", err)
+	}
+}
+
+func TestForEachInstallation(t *testing.T) {
+	st := &pagedStore{}
+	for i := 0; i < 5; i++ {
+		st.jiis = append(st.jiis, &JiraInstallInformation{ClientKey: fmt.Sprintf("tenant-%d", i)})
+	}
+	var seen []string
+	stop := errors.New("stop")
+	err := ForEachInstallation(context.Background(), st, 2, func(jii *JiraInstallInformation) error {
+		seen = append(seen, jii.ClientKey)
+		if len(seen) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || len(seen) != 3 || seen[2] != "tenant-2" {
+		t.Fatalf("listed %v before returning %v", seen, err)
+	}
+	seen = nil
+	if err := ForEachInstallation(context.Background(), st, 0, func(jii *JiraInstallInformation) error {
+		seen = append(seen, jii.ClientKey)
+		return nil
+	}); err != nil || len(seen) != 5 {
+		t.Fatalf("listed %v, %v", seen, err)
+	}
+}
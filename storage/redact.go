@@ -0,0 +1,76 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Redacted is what secrets are replaced with.
+const Redacted = "[REDACTED]"
+
+// Secret holds a sensitive value that must not end up in logs or API responses, it redacts itself
+// when formatted or marshaled to JSON, use string(s) to obtain the actual value.
+type Secret string
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// GoString implements fmt.GoStringer.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+var redactions = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// JWTs, wherever they are.
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`), Redacted},
+	// Authorization header values.
+	{regexp.MustCompile(`(?i)\b(JWT|Bearer|Basic)\s+[A-Za-z0-9._~+/=-]{8,}`), "$1 " + Redacted},
+	// JSON fields holding secrets.
+	{regexp.MustCompile(`(?i)("(?:sharedSecret|previousSharedSecret|publicKey|oauthClientId|access_token|refresh_token|password|token)"\s*:\s*")[^"]*(")`),
+		"${1}" + Redacted + "${2}"},
+	// Query string arguments holding secrets.
+	{regexp.MustCompile(`(?i)([?&](?:jwt|access_token|token)=)[^&\s"]+`), "${1}" + Redacted},
+}
+
+// Redact returns s with anything that looks like a secret (JWTs, authorization headers, secret
+// JSON fields and query arguments) replaced, it is used to sanitize log and error messages.
+func Redact(s string) string {
+	for _, r := range redactions {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+// String implements fmt.Stringer without exposing the secrets.
+func (j JiraInstallInformation) String() string {
+	return fmt.Sprintf("{Key:%s ClientKey:%s BaseURL:%s ProductType:%s EventType:%s SharedSecret:%s}",
+		j.Key, j.ClientKey, j.BaseURL, j.ProductType, j.EventType, Secret(j.SharedSecret))
+}
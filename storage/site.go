@@ -0,0 +1,113 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SiteLookup can be implemented by stores able to find tenants by the host of their base URL
+// without listing every installation, see FindBySite.
+type SiteLookup interface {
+	// JiraInstallInformationByHost returns the install information of every tenant whose BaseURL has
+	// the passed host, which is lowercase and has no port.
+	JiraInstallInformationByHost(host string) ([]*JiraInstallInformation, error)
+}
+
+// SiteHost returns the lowercase hostname and context path (see JiraInstallInformation.ContextPath)
+// of site, which can be a base URL such as "https://example.atlassian.net/wiki" or a bare hostname.
+func SiteHost(site string) (host, contextPath string, err error) {
+	site = strings.TrimSpace(site)
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing site %q: %w", site, err)
+	}
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("site %q has no host", site)
+	}
+	return strings.ToLower(u.Hostname()), strings.TrimRight(u.Path, "/"), nil
+}
+
+// matchesSite returns true if jii is served from host and, unless contextPath is "", from contextPath.
+func matchesSite(jii *JiraInstallInformation, host, contextPath string) bool {
+	u, err := url.Parse(jii.BaseURL)
+	if err != nil || strings.ToLower(u.Hostname()) != host {
+		return false
+	}
+	return contextPath == "" || jii.ContextPath() == contextPath
+}
+
+// FindBySite returns the install information of the tenant served from site, a base URL or bare
+// hostname as accepted by SiteHost, or nil if there is none. This is for tooling that only knows the
+// site of a tenant, such as support consoles and CLI commands, requests carry the client key.
+// Stores implementing SiteLookup are queried directly, others must implement Lister and are scanned.
+// If site is a bare hostname serving more than one tenant, ie jira and confluence, pass the base URL.
+func FindBySite(ctx context.Context, st Store, site string) (*JiraInstallInformation, error) {
+	host, contextPath, err := SiteHost(site)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*JiraInstallInformation
+	looked := false
+	if lookup, ok := st.(SiteLookup); ok {
+		candidates, err := lookup.JiraInstallInformationByHost(host)
+		// decorators of stores that can not look sites up fall back to listing.
+		if err != nil && !errors.Is(err, ErrUnsupported) {
+			return nil, fmt.Errorf("looking up tenants of %s: %w", host, err)
+		}
+		looked = err == nil
+		for _, jii := range candidates {
+			if matchesSite(jii, host, contextPath) {
+				matches = append(matches, jii)
+			}
+		}
+	}
+	if !looked {
+		lister, ok := st.(Lister)
+		if !ok {
+			return nil, fmt.Errorf("%T can not look up tenants by site", st)
+		}
+		err := ForEachInstallation(ctx, lister, DefaultPrefetchPageSize, func(jii *JiraInstallInformation) error {
+			if matchesSite(jii, host, contextPath) {
+				matches = append(matches, jii)
+			}
+			return nil
+		})
+		if errors.Is(err, ErrUnsupported) {
+			return nil, fmt.Errorf("%T can not look up tenants by site: %w", st, ErrUnsupported)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("looking up tenants of %s: %w", host, err)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	}
+	keys := make([]string, 0, len(matches))
+	for _, jii := range matches {
+		keys = append(keys, jii.ClientKey)
+	}
+	return nil, fmt.Errorf("more than one tenant is served from %s: %s", site, strings.Join(keys, ", "))
+}
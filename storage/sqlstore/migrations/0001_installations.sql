@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS atlassian_connect_installations (
+	client_key   VARCHAR(255) NOT NULL PRIMARY KEY,
+	base_url     VARCHAR(2048) NOT NULL,
+	product_type VARCHAR(64) NOT NULL,
+	data         TEXT NOT NULL,
+	created_at   BIGINT NOT NULL,
+	updated_at   BIGINT NOT NULL
+)
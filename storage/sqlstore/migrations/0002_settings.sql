@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS atlassian_connect_settings (
+	client_key    VARCHAR(255) NOT NULL,
+	setting_key   VARCHAR(255) NOT NULL,
+	setting_value TEXT NOT NULL,
+	PRIMARY KEY (client_key, setting_key)
+)
@@ -0,0 +1,319 @@
+// Package sqlstore implements storage.Store on top of database/sql with portable SQL, it works with
+// any driver whose database supports the common subset of SQL such as PostgreSQL, MySQL and SQLite.
+// Use storage/postgres instead for PostgreSQL specific features such as concurrent migrations.
+package sqlstore
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// migrationFiles hold one statement each, they are applied in file name order and exactly once,
+// never edit or rename them, add new ones.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrations returns the statements of the embedded migrations in order.
+func migrations() []string {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		panic(fmt.Sprintf("reading embedded migrations: %v", err))
+	}
+	statements := make([]string, 0, len(entries))
+	for _, e := range entries {
+		b, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			panic(fmt.Sprintf("reading embedded migration %s: %v", e.Name(), err))
+		}
+		statements = append(statements, strings.TrimRight(strings.TrimSpace(string(b)), ";"))
+	}
+	return statements
+}
+
+// Schema returns the SQL creating every table the store uses, for deployments that manage their
+// schema with their own migration tool instead of Migrate.
+func Schema() string {
+	return strings.Join(migrations(), ";\n\n") + ";\n"
+}
+
+// Placeholder returns the bind parameter for the nth (starting at 1) argument of a query.
+type Placeholder func(n int) string
+
+var (
+	// QuestionPlaceholder binds arguments with ?, as MySQL and SQLite do.
+	QuestionPlaceholder Placeholder = func(int) string { return "?" }
+	// DollarPlaceholder binds arguments with $1, $2..., as PostgreSQL (and SQLite) do.
+	DollarPlaceholder Placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+// Store is a storage.Store backed by any database/sql database, Migrate must be invoked before
+// using it unless the tables in Schema were created some other way.
+type Store struct {
+	db          *sql.DB
+	placeholder Placeholder
+}
+
+var (
+	_ storage.Store   = (*Store)(nil)
+	_ storage.Pinger  = (*Store)(nil)
+	_ storage.Lister  = (*Store)(nil)
+	_ storage.Deleter = (*Store)(nil)
+
+	_ storage.TenantSettings = (*Store)(nil)
+	_ storage.SiteLookup     = (*Store)(nil)
+)
+
+// New returns a Store using db, whose driver binds query arguments with placeholder.
+func New(db *sql.DB, placeholder Placeholder) *Store {
+	return &Store{db: db, placeholder: placeholder}
+}
+
+// bind replaces the ? in query with the placeholders of the store, queries of this package have
+// no ? anywhere else.
+func (s *Store) bind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString(s.placeholder(n))
+	}
+	return b.String()
+}
+
+// Migrate creates or updates the tables used by the store. Not every database can change its
+// schema in a transaction nor lock it, so it must not run concurrently, ie from every replica.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS atlassian_connect_sqlstore_migrations (
+		version    INTEGER NOT NULL PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+	var applied int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM atlassian_connect_sqlstore_migrations`).Scan(&applied); err != nil {
+		return fmt.Errorf("reading applied migrations: %w", err)
+	}
+	statements := migrations()
+	for version := applied + 1; version <= len(statements); version++ {
+		if _, err := s.db.ExecContext(ctx, statements[version-1]); err != nil {
+			return fmt.Errorf("applying migration %d: %w", version, err)
+		}
+		if _, err := s.db.ExecContext(ctx,
+			s.bind(`INSERT INTO atlassian_connect_sqlstore_migrations (version, applied_at) VALUES (?, ?)`),
+			version, time.Now().Unix()); err != nil {
+			return fmt.Errorf("recording migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// SaveJiraInstallInformation implements storage.Store, install information is replaced by client key.
+func (s *Store) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	data, err := storage.MarshalWithSecrets(jii)
+	if err != nil {
+		return fmt.Errorf("marshaling install information: %w", err)
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	// there is no portable upsert, updating first and inserting if there was nothing to update
+	// could race with a concurrent insert, in which case updating again settles it.
+	for attempt := 0; ; attempt++ {
+		var exists int
+		err := s.db.QueryRow(s.bind(`SELECT COUNT(*) FROM atlassian_connect_installations WHERE client_key = ?`),
+			jii.ClientKey).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("saving install information of %s: %w", jii.ClientKey, err)
+		}
+		if exists > 0 {
+			_, err = s.db.Exec(s.bind(`UPDATE atlassian_connect_installations
+				SET base_url = ?, product_type = ?, data = ?, updated_at = ? WHERE client_key = ?`),
+				jii.BaseURL, jii.ProductType, string(data), now, jii.ClientKey)
+		} else {
+			_, err = s.db.Exec(s.bind(`INSERT INTO atlassian_connect_installations
+				(client_key, base_url, product_type, data, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`),
+				jii.ClientKey, jii.BaseURL, jii.ProductType, string(data), now, now)
+		}
+		if err == nil {
+			return nil
+		}
+		if exists > 0 || attempt > 0 {
+			return fmt.Errorf("saving install information of %s: %w", jii.ClientKey, err)
+		}
+	}
+}
+
+// JiraInstallInformation implements storage.Store, it returns nil if the tenant is not installed.
+func (s *Store) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	var data string
+	err := s.db.QueryRow(s.bind(`SELECT data FROM atlassian_connect_installations WHERE client_key = ?`),
+		clientKey).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading install information of %s: %w", clientKey, err)
+	}
+	return decode(data)
+}
+
+// DeleteJiraInstallInformation implements storage.Deleter
+func (s *Store) DeleteJiraInstallInformation(clientKey string) error {
+	_, err := s.db.Exec(s.bind(`DELETE FROM atlassian_connect_installations WHERE client_key = ?`), clientKey)
+	if err != nil {
+		return fmt.Errorf("deleting install information of %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// ListInstallations implements storage.Lister, cursors are client keys.
+func (s *Store) ListInstallations(cursor string, limit int) ([]*storage.JiraInstallInformation, string, error) {
+	rows, err := s.db.Query(s.bind(`SELECT data FROM atlassian_connect_installations
+		WHERE client_key > ? ORDER BY client_key LIMIT ?`), cursor, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("listing installations: %w", err)
+	}
+	defer rows.Close()
+	var jiis []*storage.JiraInstallInformation
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, "", fmt.Errorf("reading installation: %w", err)
+		}
+		jii, err := decode(data)
+		if err != nil {
+			return nil, "", err
+		}
+		jiis = append(jiis, jii)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("listing installations: %w", err)
+	}
+	next := ""
+	if len(jiis) == limit && limit > 0 {
+		next = jiis[len(jiis)-1].ClientKey
+	}
+	return jiis, next, nil
+}
+
+// JiraInstallInformationByHost implements storage.SiteLookup
+func (s *Store) JiraInstallInformationByHost(host string) ([]*storage.JiraInstallInformation, error) {
+	rows, err := s.db.Query(s.bind(`SELECT data FROM atlassian_connect_installations
+		WHERE LOWER(base_url) LIKE ? ESCAPE '!' OR LOWER(base_url) LIKE ? ESCAPE '!'
+		OR LOWER(base_url) LIKE ? ESCAPE '!' ORDER BY client_key`),
+		"%://"+escapeLike(host), "%://"+escapeLike(host)+"/%", "%://"+escapeLike(host)+":%")
+	if err != nil {
+		return nil, fmt.Errorf("looking up installations of %s: %w", host, err)
+	}
+	defer rows.Close()
+	var jiis []*storage.JiraInstallInformation
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("reading installation: %w", err)
+		}
+		jii, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		jiis = append(jiis, jii)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("looking up installations of %s: %w", host, err)
+	}
+	return jiis, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s, so it matches literally in patterns with ESCAPE '!'.
+// The escape character is not a backslash since MySQL would read it as escaping the closing quote.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+// GetSetting implements storage.TenantSettings
+func (s *Store) GetSetting(clientKey, key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(s.bind(`SELECT setting_value FROM atlassian_connect_settings
+		WHERE client_key = ? AND setting_key = ?`), clientKey, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading setting %s of %s: %w", key, clientKey, err)
+	}
+	return value, nil
+}
+
+// SetSetting implements storage.TenantSettings
+func (s *Store) SetSetting(clientKey, key, value string) error {
+	// see SaveJiraInstallInformation for why this is not an upsert.
+	for attempt := 0; ; attempt++ {
+		res, err := s.db.Exec(s.bind(`UPDATE atlassian_connect_settings SET setting_value = ?
+			WHERE client_key = ? AND setting_key = ?`), value, clientKey, key)
+		if err != nil {
+			return fmt.Errorf("saving setting %s of %s: %w", key, clientKey, err)
+		}
+		var exists int
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			return nil
+		}
+		// MySQL reports no affected rows when the value did not change.
+		err = s.db.QueryRow(s.bind(`SELECT COUNT(*) FROM atlassian_connect_settings
+			WHERE client_key = ? AND setting_key = ?`), clientKey, key).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("saving setting %s of %s: %w", key, clientKey, err)
+		}
+		if exists > 0 {
+			return nil
+		}
+		_, err = s.db.Exec(s.bind(`INSERT INTO atlassian_connect_settings (client_key, setting_key, setting_value)
+			VALUES (?, ?, ?)`), clientKey, key, value)
+		if err == nil {
+			return nil
+		}
+		if attempt > 0 {
+			return fmt.Errorf("saving setting %s of %s: %w", key, clientKey, err)
+		}
+	}
+}
+
+// Ping implements storage.Pinger
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func decode(data string) (*storage.JiraInstallInformation, error) {
+	jii := &storage.JiraInstallInformation{}
+	if err := json.Unmarshal([]byte(data), jii); err != nil {
+		return nil, fmt.Errorf("decoding install information: %w", err)
+	}
+	return jii, nil
+}
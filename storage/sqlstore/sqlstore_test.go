@@ -0,0 +1,50 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/storagetest"
+	_ "github.com/lib/pq"
+)
+
+func TestBind(t *testing.T) {
+	s := New(nil, DollarPlaceholder)
+	if got := s.bind(`UPDATE t SET a = ?, b = ? WHERE c = ?`); got != `UPDATE t SET a = $1, b = $2 WHERE c = $3` {
+		t.Fatalf("bound %s", got)
+	}
+	if !strings.Contains(Schema(), "CREATE TABLE IF NOT EXISTS atlassian_connect_installations") {
+		t.Fatalf("schema is %s", Schema())
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike("a_b%c!d.net"); got != "a!_b!%c!!d.net" {
+		t.Fatalf("escaped to %s", got)
+	}
+}
+
+// TestStoreConformance runs against the PostgreSQL database at POSTGRES_TEST_DSN, it is skipped if unset.
+func TestStoreConformance(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	storagetest.Run(t, func() storage.Store {
+		db.Exec(`DROP TABLE IF EXISTS atlassian_connect_installations, atlassian_connect_settings, atlassian_connect_sqlstore_migrations`)
+		s := New(db, DollarPlaceholder)
+		if err := s.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
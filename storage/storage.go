@@ -14,6 +14,14 @@ package storage
 //    See the License for the specific language governing permissions and
 //    limitations under the License.
 
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
 // JiraInstallInformation is the payload sent by JIRA to the /install endpoint
 type JiraInstallInformation struct {
 	UserAccount    string `json:"-"`
@@ -28,6 +36,15 @@ type JiraInstallInformation struct {
 	ProductType    string `json:"productType"`
 	Description    string `json:"description"`
 	EventType      string `json:"eventType"`
+	// EntitlementID and EntitlementNumber identify the marketplace entitlement of paid apps, they
+	// change when the tenant buys, upgrades or renews the app.
+	EntitlementID     string `json:"entitlementId,omitempty"`
+	EntitlementNumber string `json:"entitlementNumber,omitempty"`
+	// PreviousSharedSecret is the shared secret the tenant had before the last rotation, it is
+	// accepted until PreviousSharedSecretExpiry (unix seconds) so tokens signed before the rotation
+	// are not refused. These are kept by the app and never taken from install payloads.
+	PreviousSharedSecret       string `json:"previousSharedSecret,omitempty"`
+	PreviousSharedSecretExpiry int64  `json:"previousSharedSecretExpiry,omitempty"`
 }
 
 // Store should be implemented to allow storage of the necessary jira information.
@@ -36,3 +53,169 @@ type Store interface {
 	SaveJiraInstallInformation(*JiraInstallInformation) error
 	JiraInstallInformation(clientKey string) (*JiraInstallInformation, error)
 }
+
+// knownProductTypes are the product types atlassian sends in the install payload, lowercased.
+var knownProductTypes = map[string]bool{
+	"jira":       true,
+	"confluence": true,
+}
+
+// Normalize cleans up the values sent by atlassian so they can be safely compared and used to
+// build URLs, it trims spaces, the trailing slash of BaseURL and lowercases ProductType.
+func (j *JiraInstallInformation) Normalize() {
+	j.Key = strings.TrimSpace(j.Key)
+	j.ClientKey = strings.TrimSpace(j.ClientKey)
+	j.BaseURL = strings.TrimRight(strings.TrimSpace(j.BaseURL), "/")
+	j.ProductType = strings.ToLower(strings.TrimSpace(j.ProductType))
+	j.EventType = strings.TrimSpace(j.EventType)
+}
+
+// Validate returns an error if the install information lacks any of the fields required to
+// communicate with the tenant or if they hold unexpected values.
+func (j *JiraInstallInformation) Validate() error {
+	var missing []string
+	if j.Key == "" {
+		missing = append(missing, "key")
+	}
+	if j.ClientKey == "" {
+		missing = append(missing, "clientKey")
+	}
+	if j.SharedSecret == "" {
+		missing = append(missing, "sharedSecret")
+	}
+	if j.BaseURL == "" {
+		missing = append(missing, "baseUrl")
+	}
+	if j.ProductType == "" {
+		missing = append(missing, "productType")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("install information is missing required fields: %s", strings.Join(missing, ", "))
+	}
+	u, err := url.Parse(j.BaseURL)
+	if err != nil {
+		return fmt.Errorf("parsing base URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return fmt.Errorf("base URL %q is not an absolute http(s) URL", j.BaseURL)
+	}
+	if !knownProductTypes[strings.ToLower(j.ProductType)] {
+		return fmt.Errorf("unknown product type %q", j.ProductType)
+	}
+	return nil
+}
+
+// PreviousSharedSecretValid returns true if PreviousSharedSecret is still accepted at now.
+func (j *JiraInstallInformation) PreviousSharedSecretValid(now time.Time) bool {
+	return j.PreviousSharedSecret != "" && now.Unix() < j.PreviousSharedSecretExpiry
+}
+
+// ContextPath returns the path of BaseURL, which is where the product is served from in the tenant
+// host, ie "/wiki" for confluence cloud and "" for jira cloud.
+func (j *JiraInstallInformation) ContextPath() string {
+	u, err := url.Parse(j.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
+
+// Deleter can be implemented by stores to forget uninstalled tenants, so their tokens are no longer
+// accepted. Deleting an unknown tenant must not fail.
+type Deleter interface {
+	DeleteJiraInstallInformation(clientKey string) error
+}
+
+// RegionStore can be implemented by stores of apps deployed in more than one region to record
+// which region owns each tenant, ie to honor atlassian data residency realms.
+type RegionStore interface {
+	SaveTenantRegion(clientKey, region string) error
+	// TenantRegion returns the region owning the tenant or "" if it is not pinned to any.
+	TenantRegion(clientKey string) (string, error)
+}
+
+// OutboxMessage is a write to jira enqueued by a handler to be performed later by a dispatcher.
+type OutboxMessage struct {
+	ID          string            `json:"id"`
+	ClientKey   string            `json:"clientKey"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Query       map[string]string `json:"query,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Attempts    int               `json:"attempts"`
+	NextAttempt time.Time         `json:"nextAttempt"`
+	LastError   string            `json:"lastError,omitempty"`
+	// GaveUp is set once the dispatcher exhausted its attempts, these are kept for inspection
+	// but no longer pending.
+	GaveUp bool `json:"gaveUp"`
+}
+
+// OutboxStore can be implemented by stores to persist the outbox, ideally in the same database
+// (and transaction) as the rest of the app state so enqueued writes are not lost on crashes.
+type OutboxStore interface {
+	EnqueueOutboxMessage(*OutboxMessage) error
+	// PendingOutboxMessages returns up to limit messages not given up on whose NextAttempt is not after now.
+	PendingOutboxMessages(now time.Time, limit int) ([]*OutboxMessage, error)
+	UpdateOutboxMessage(*OutboxMessage) error
+	DeleteOutboxMessage(id string) error
+}
+
+// LeaseStore can be implemented by stores shared across replicas to grant time bound exclusive
+// leases, it is used to ensure scheduled work runs in a single replica.
+type LeaseStore interface {
+	// AcquireLease takes the lease called name for owner during ttl, it returns false if it is held
+	// by somebody else. Acquiring a lease already held by owner extends it.
+	AcquireLease(name, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(name, owner string) error
+}
+
+// Invalidator can be implemented by stores that cache install information, Invalidate drops the
+// cached information of a tenant so it is read again from the backing store.
+type Invalidator interface {
+	Invalidate(clientKey string)
+}
+
+// Pinger can be implemented by stores to report whether their backend is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// TenantSettings can be implemented by stores to persist per tenant configuration alongside the
+// install information.
+type TenantSettings interface {
+	// GetSetting returns the value of the setting of the tenant or "" if it was never set.
+	GetSetting(clientKey, key string) (string, error)
+	SetSetting(clientKey, key, value string) error
+}
+
+// DeadLetter is a webhook whose processing kept failing after every attempt, it is kept so it can
+// be inspected and replayed once the cause is fixed.
+type DeadLetter struct {
+	ID        string `json:"id"`
+	ClientKey string `json:"clientKey"`
+	Event     string `json:"event"`
+	// Path is the path, with query, the webhook was received on and Vars the route variables in it.
+	Path string            `json:"path"`
+	Vars map[string]string `json:"vars,omitempty"`
+	Body []byte            `json:"body,omitempty"`
+	// Handlers are the indexes, in registration order, of the handlers of Event that failed when
+	// it has several (see handling.Plugin.AddWebhookHandler), every handler is replayed if empty.
+	Handlers []int     `json:"handlers,omitempty"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// DeadLetterStore can be implemented by stores to persist the webhooks that could not be processed,
+// so they are not lost when a downstream system is down for longer than the retries last.
+type DeadLetterStore interface {
+	SaveDeadLetter(*DeadLetter) error
+	// DeadLetter returns the dead letter with the passed id or nil if there is none.
+	DeadLetter(id string) (*DeadLetter, error)
+	// DeadLetters returns the dead letters of the tenant, or of every tenant if clientKey is "",
+	// oldest first.
+	DeadLetters(clientKey string) ([]*DeadLetter, error)
+	// DeleteDeadLetter forgets a dead letter, deleting an unknown one must not fail.
+	DeleteDeadLetter(id string) error
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJiraInstallInformation_Validate(t *testing.T) {
+	valid := func() *JiraInstallInformation {
+		return &JiraInstallInformation{
+			Key:          " io.shiftleft.app ",
+			ClientKey:    "a-client\n",
+			SharedSecret: "secret",
+			BaseURL:      " https://acme.atlassian.net/ ",
+			ProductType:  "JIRA",
+			EventType:    "installed ",
+		}
+	}
+	jii := valid()
+	jii.Normalize()
+	if jii.Key != "io.shiftleft.app" || jii.ClientKey != "a-client" || jii.BaseURL != "https://acme.atlassian.net" ||
+		jii.ProductType != "jira" || jii.EventType != "installed" {
+		t.Fatalf("normalized to %+v", jii)
+	}
+	if err := jii.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		change func(*JiraInstallInformation)
+		want   string
+	}{
+		"missing fields":  {func(j *JiraInstallInformation) { j.ClientKey, j.SharedSecret = "", "" }, "clientKey, sharedSecret"},
+		"relative url":    {func(j *JiraInstallInformation) { j.BaseURL = "acme.atlassian.net" }, "not an absolute"},
+		"other scheme":    {func(j *JiraInstallInformation) { j.BaseURL = "ftp://acme.atlassian.net" }, "not an absolute"},
+		"bad url":         {func(j *JiraInstallInformation) { j.BaseURL = "https://acme .net/%zz" }, "parsing base URL"},
+		"unknown product": {func(j *JiraInstallInformation) { j.ProductType = "bitbucket" }, "unknown product type"},
+	} {
+		jii := valid()
+		jii.Normalize()
+		tc.change(jii)
+		err := jii.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: validating returned %v, want an error mentioning %q", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,559 @@
+// Package storagetest provides a test suite checking storage.Store implementations honor the
+// contract the rest of the module relies on.
+package storagetest
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+// concurrentSaves is the number of goroutines saving at once in the concurrency test.
+const concurrentSaves = 16
+
+// Tenant returns complete install information for clientKey, every field holds a distinct value
+// so lost or swapped fields are noticed.
+func Tenant(clientKey string) *storage.JiraInstallInformation {
+	return &storage.JiraInstallInformation{
+		Key:            "io.shiftleft.storagetest",
+		ClientKey:      clientKey,
+		OauthClientID:  "oauth-" + clientKey,
+		PublicKey:      "public-key-" + clientKey,
+		SharedSecret:   "shared-secret-" + clientKey,
+		ServerVersion:  "100185",
+		PluginsVersion: "1001.0.0-SNAPSHOT",
+		BaseURL:        "https://" + clientKey + ".atlassian.net",
+		ProductType:    "jira",
+		Description:    "Atlassian JIRA at https://" + clientKey + ".atlassian.net",
+		EventType:      "installed",
+
+		EntitlementID:     "entitlement-" + clientKey,
+		EntitlementNumber: "E-" + clientKey,
+
+		PreviousSharedSecret:       "previous-shared-secret-" + clientKey,
+		PreviousSharedSecretExpiry: 1591012800,
+	}
+}
+
+// Run exercises the store returned by newStore, which is called once per subtest and must return
+// an empty store each time. It checks:
+//   - reading a tenant that was never saved returns nil and no error.
+//   - saved install information is read back unchanged, including its secrets.
+//   - saving is idempotent and saving again replaces the stored information.
+//   - concurrent saves of different tenants are all kept.
+//   - if the store implements storage.Deleter, deleted tenants are no longer returned and deleting
+//     unknown tenants does not fail.
+//   - if the store implements storage.TenantSettings, settings are kept per tenant and unset ones
+//     read as "".
+//   - if the store implements storage.SiteLookup or storage.Lister, storage.FindBySite finds tenants
+//     by base URL or hostname.
+//   - if the store implements storage.OutboxStore, enqueued messages are pending once due, oldest
+//     first, until deleted or given up on, and updates are kept.
+//   - if the store implements storage.LeaseStore, a lease is held by a single owner until it is
+//     released by it or expires, and acquiring it again extends it.
+func Run(t *testing.T, newStore func() storage.Store) {
+	t.Run("MissingTenant", func(t *testing.T) {
+		testMissingTenant(t, newStore())
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		testRoundTrip(t, newStore())
+	})
+	t.Run("Idempotent", func(t *testing.T) {
+		testIdempotent(t, newStore())
+	})
+	t.Run("ConcurrentSaves", func(t *testing.T) {
+		testConcurrentSaves(t, newStore())
+	})
+	t.Run("Delete", func(t *testing.T) {
+		testDelete(t, newStore())
+	})
+	t.Run("Settings", func(t *testing.T) {
+		testSettings(t, newStore())
+	})
+	t.Run("FindBySite", func(t *testing.T) {
+		testFindBySite(t, newStore())
+	})
+	t.Run("Outbox", func(t *testing.T) {
+		testOutbox(t, newStore())
+	})
+	t.Run("Leases", func(t *testing.T) {
+		testLeases(t, newStore())
+	})
+}
+
+// mustRead reads clientKey from st failing the test on errors.
+func mustRead(t *testing.T, st storage.Store, clientKey string) *storage.JiraInstallInformation {
+	t.Helper()
+	jii, err := st.JiraInstallInformation(clientKey)
+	if err != nil {
+		t.Fatalf("reading %s: %v", clientKey, err)
+	}
+	return jii
+}
+
+// mustSave saves jii into st failing the test on errors.
+func mustSave(t *testing.T, st storage.Store, jii *storage.JiraInstallInformation) {
+	t.Helper()
+	if err := st.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatalf("saving %s: %v", jii.ClientKey, err)
+	}
+}
+
+func testMissingTenant(t *testing.T, st storage.Store) {
+	if jii := mustRead(t, st, "never-installed"); jii != nil {
+		t.Fatalf("reading a tenant that was never saved returned %+v, expected nil", jii)
+	}
+	mustSave(t, st, Tenant("installed"))
+	if jii := mustRead(t, st, "never-installed"); jii != nil {
+		t.Fatalf("reading a tenant that was never saved returned %+v, expected nil", jii)
+	}
+}
+
+func testRoundTrip(t *testing.T, st storage.Store) {
+	want := Tenant("round-trip")
+	saved := *want
+	mustSave(t, st, &saved)
+	got := mustRead(t, st, want.ClientKey)
+	if got == nil {
+		t.Fatal("saved tenant was not found")
+	}
+	// UserAccount is not part of the install payload so stores are not required to keep it.
+	got.UserAccount = want.UserAccount
+	if *got != *want {
+		t.Fatalf("read back %+v, expected %+v", *got, *want)
+	}
+	got.SharedSecret = "modified"
+	if again := mustRead(t, st, want.ClientKey); again.SharedSecret != want.SharedSecret {
+		t.Fatal("modifying read install information changed the stored one")
+	}
+}
+
+func testIdempotent(t *testing.T, st storage.Store) {
+	jii := Tenant("idempotent")
+	mustSave(t, st, jii)
+	mustSave(t, st, jii)
+	if got := mustRead(t, st, jii.ClientKey); got == nil || got.SharedSecret != jii.SharedSecret {
+		t.Fatalf("saving twice read back %+v", got)
+	}
+
+	updated := Tenant("idempotent")
+	updated.SharedSecret = "rotated-shared-secret"
+	updated.BaseURL = "https://renamed.atlassian.net"
+	mustSave(t, st, updated)
+	got := mustRead(t, st, jii.ClientKey)
+	if got == nil || got.SharedSecret != updated.SharedSecret || got.BaseURL != updated.BaseURL {
+		t.Fatalf("saving again did not replace the stored information, read back %+v", got)
+	}
+}
+
+func testConcurrentSaves(t *testing.T, st storage.Store) {
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentSaves)
+	for i := 0; i < concurrentSaves; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := st.SaveJiraInstallInformation(Tenant(fmt.Sprintf("concurrent-%d", i))); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent save: %v", err)
+	}
+	for i := 0; i < concurrentSaves; i++ {
+		clientKey := fmt.Sprintf("concurrent-%d", i)
+		got := mustRead(t, st, clientKey)
+		if got == nil || got.SharedSecret != Tenant(clientKey).SharedSecret {
+			t.Errorf("concurrently saved %s read back as %+v", clientKey, got)
+		}
+	}
+}
+
+func testDelete(t *testing.T, st storage.Store) {
+	d, ok := st.(storage.Deleter)
+	if !ok {
+		t.Skip("store does not implement storage.Deleter")
+	}
+	if err := d.DeleteJiraInstallInformation("never-installed"); errors.Is(err, storage.ErrUnsupported) {
+		t.Skip("wrapped store does not implement storage.Deleter")
+	}
+	mustSave(t, st, Tenant("deleted"))
+	mustSave(t, st, Tenant("kept"))
+	if err := d.DeleteJiraInstallInformation("deleted"); err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+	if jii := mustRead(t, st, "deleted"); jii != nil {
+		t.Fatalf("deleted tenant read back as %+v", jii)
+	}
+	if jii := mustRead(t, st, "kept"); jii == nil {
+		t.Fatal("deleting a tenant deleted another one")
+	}
+	if err := d.DeleteJiraInstallInformation("never-installed"); err != nil {
+		t.Fatalf("deleting an unknown tenant: %v", err)
+	}
+}
+
+func testSettings(t *testing.T, st storage.Store) {
+	ts, ok := st.(storage.TenantSettings)
+	if !ok {
+		t.Skip("store does not implement storage.TenantSettings")
+	}
+	v, err := ts.GetSetting("a", "color")
+	if errors.Is(err, storage.ErrUnsupported) {
+		t.Skip("wrapped store does not implement storage.TenantSettings")
+	}
+	if err != nil || v != "" {
+		t.Fatalf("unset setting read back as %q, %v", v, err)
+	}
+	for _, v := range []string{"blue", "blue", "green"} {
+		if err := ts.SetSetting("a", "color", v); err != nil {
+			t.Fatalf("setting: %v", err)
+		}
+	}
+	if err := ts.SetSetting("b", "color", "red"); err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+	if v, err := ts.GetSetting("a", "color"); err != nil || v != "green" {
+		t.Fatalf("setting read back as %q, %v", v, err)
+	}
+	if v, err := ts.GetSetting("b", "color"); err != nil || v != "red" {
+		t.Fatalf("setting of another tenant read back as %q, %v", v, err)
+	}
+}
+
+func testFindBySite(t *testing.T, st storage.Store) {
+	_, lookup := st.(storage.SiteLookup)
+	_, lister := st.(storage.Lister)
+	if !lookup && !lister {
+		t.Skip("store implements neither storage.SiteLookup nor storage.Lister")
+	}
+	mustSave(t, st, Tenant("site"))
+	mustSave(t, st, Tenant("site-other"))
+	for _, site := range []string{"https://site.atlassian.net", "site.atlassian.net", "HTTPS://Site.Atlassian.net/"} {
+		jii, err := storage.FindBySite(context.Background(), st, site)
+		if errors.Is(err, storage.ErrUnsupported) {
+			t.Skip("wrapped store implements neither storage.SiteLookup nor storage.Lister")
+		}
+		if err != nil {
+			t.Fatalf("finding %s: %v", site, err)
+		}
+		if jii == nil || jii.ClientKey != "site" {
+			t.Fatalf("found %+v for %s", jii, site)
+		}
+	}
+	if jii, err := storage.FindBySite(context.Background(), st, "unknown.atlassian.net"); err != nil || jii != nil {
+		t.Fatalf("unknown site returned %+v, %v", jii, err)
+	}
+	if lookup, ok := st.(storage.SiteLookup); ok {
+		// hosts are matched literally, not as patterns.
+		for _, host := range []string{"s_te.atlassian.net", "%.atlassian.net"} {
+			jiis, err := lookup.JiraInstallInformationByHost(host)
+			if errors.Is(err, storage.ErrUnsupported) {
+				break
+			}
+			if err != nil || len(jiis) != 0 {
+				t.Fatalf("host %s returned %+v, %v", host, jiis, err)
+			}
+		}
+	}
+}
+
+func testOutbox(t *testing.T, st storage.Store) {
+	outbox, ok := st.(storage.OutboxStore)
+	if !ok {
+		t.Skip("store does not implement storage.OutboxStore")
+	}
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	pending := func(at time.Time, limit int) []string {
+		t.Helper()
+		msgs, err := outbox.PendingOutboxMessages(at, limit)
+		if err != nil {
+			t.Fatalf("reading pending messages: %v", err)
+		}
+		ids := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			ids = append(ids, msg.ID)
+		}
+		return ids
+	}
+	if _, err := outbox.PendingOutboxMessages(now, 10); errors.Is(err, storage.ErrUnsupported) {
+		t.Skip("wrapped store does not implement storage.OutboxStore")
+	}
+	for i, id := range []string{"second", "first", "later"} {
+		msg := &storage.OutboxMessage{
+			ID:          id,
+			ClientKey:   "a",
+			Method:      "PUT",
+			Path:        "/rest/api/3/issue/KEY-1",
+			Body:        []byte(`{"fields":{}}`),
+			CreatedAt:   now,
+			NextAttempt: now.Add(time.Duration(i-1) * time.Minute),
+		}
+		if id == "second" {
+			msg.NextAttempt = now
+		}
+		if err := outbox.EnqueueOutboxMessage(msg); err != nil {
+			t.Fatalf("enqueuing %s: %v", id, err)
+		}
+	}
+	if ids := pending(now, 10); fmt.Sprint(ids) != "[first second]" {
+		t.Fatalf("pending messages are %v", ids)
+	}
+	if ids := pending(now, 1); fmt.Sprint(ids) != "[first]" {
+		t.Fatalf("pending messages up to 1 are %v", ids)
+	}
+	if ids := pending(now.Add(time.Minute), 10); fmt.Sprint(ids) != "[first second later]" {
+		t.Fatalf("pending messages once due are %v", ids)
+	}
+
+	msgs, err := outbox.PendingOutboxMessages(now, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := msgs[0]
+	if msg.ClientKey != "a" || msg.Method != "PUT" || string(msg.Body) != `{"fields":{}}` {
+		t.Fatalf("enqueued message read back as %+v", msg)
+	}
+	msg.Attempts, msg.LastError, msg.NextAttempt = 1, "boom", now.Add(time.Hour)
+	if err := outbox.UpdateOutboxMessage(msg); err != nil {
+		t.Fatalf("updating: %v", err)
+	}
+	if ids := pending(now, 10); fmt.Sprint(ids) != "[second]" {
+		t.Fatalf("pending messages after rescheduling are %v", ids)
+	}
+	msgs, err = outbox.PendingOutboxMessages(now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs {
+		if m.ID == "first" && (m.Attempts != 1 || m.LastError != "boom") {
+			t.Fatalf("updated message read back as %+v", m)
+		}
+	}
+
+	msg.GaveUp = true
+	if err := outbox.UpdateOutboxMessage(msg); err != nil {
+		t.Fatalf("updating: %v", err)
+	}
+	if err := outbox.DeleteOutboxMessage("second"); err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+	if ids := pending(now.Add(time.Hour), 10); fmt.Sprint(ids) != "[later]" {
+		t.Fatalf("pending messages after giving up and deleting are %v", ids)
+	}
+	if err := outbox.DeleteOutboxMessage("never-enqueued"); err != nil {
+		t.Fatalf("deleting an unknown message: %v", err)
+	}
+}
+
+func testLeases(t *testing.T, st storage.Store) {
+	leases, ok := st.(storage.LeaseStore)
+	if !ok {
+		t.Skip("store does not implement storage.LeaseStore")
+	}
+	acquire := func(name, owner string, ttl time.Duration) bool {
+		t.Helper()
+		acquired, err := leases.AcquireLease(name, owner, ttl)
+		if errors.Is(err, storage.ErrUnsupported) {
+			t.Skip("wrapped store does not implement storage.LeaseStore")
+		}
+		if err != nil {
+			t.Fatalf("acquiring %s for %s: %v", name, owner, err)
+		}
+		return acquired
+	}
+	if !acquire("job/a", "one", time.Minute) {
+		t.Fatal("a free lease was not acquired")
+	}
+	if acquire("job/a", "two", time.Minute) {
+		t.Fatal("a held lease was acquired by another owner")
+	}
+	if !acquire("job/a", "one", time.Minute) {
+		t.Fatal("the owner of a lease could not extend it")
+	}
+	if !acquire("job/b", "two", time.Minute) {
+		t.Fatal("a lease with another name was not acquired")
+	}
+	if err := leases.ReleaseLease("job/a", "two"); err != nil {
+		t.Fatalf("releasing a lease held by another owner: %v", err)
+	}
+	if acquire("job/a", "two", time.Minute) {
+		t.Fatal("a lease was released by another owner")
+	}
+	if err := leases.ReleaseLease("job/a", "one"); err != nil {
+		t.Fatalf("releasing: %v", err)
+	}
+	if !acquire("job/a", "two", 50*time.Millisecond) {
+		t.Fatal("a released lease was not acquired")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !acquire("job/a", "one", time.Minute) {
+		t.Fatal("an expired lease was not acquired")
+	}
+}
+
+// RunDecorator exercises wrap, which returns a store decorating the passed one such as
+// storage.CachedStore does. Besides running Run on decorated memory stores it checks:
+//   - the optional interfaces of the wrapped store are all implemented by the decorator and calls
+//     to them reach the wrapped store.
+//   - decorating a store implementing none of them, calls fail with storage.ErrUnsupported rather
+//     than being silently dropped.
+func RunDecorator(t *testing.T, wrap func(inner storage.Store) storage.Store) {
+	Run(t, func() storage.Store {
+		return wrap(storage.NewMemoryStore(0))
+	})
+	t.Run("KeepsCapabilities", func(t *testing.T) {
+		inner := storage.NewMemoryStore(0)
+		testKeepsCapabilities(t, wrap(inner), inner)
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		testUnsupported(t, wrap(struct{ storage.Store }{storage.NewMemoryStore(0)}))
+	})
+}
+
+func testKeepsCapabilities(t *testing.T, st storage.Store, inner *storage.MemoryStore) {
+	mustSave(t, st, Tenant("a"))
+	mustSave(t, st, Tenant("b"))
+
+	lister, ok := st.(storage.Lister)
+	if !ok {
+		t.Fatalf("%T hides storage.Lister", st)
+	}
+	jiis, _, err := lister.ListInstallations("", 10)
+	if err != nil || len(jiis) != 2 {
+		t.Fatalf("listed %d installations, %v", len(jiis), err)
+	}
+	for _, jii := range jiis {
+		if want := Tenant(jii.ClientKey); jii.SharedSecret != want.SharedSecret {
+			t.Fatalf("listed %s with shared secret %q", jii.ClientKey, jii.SharedSecret)
+		}
+	}
+
+	settings, ok := st.(storage.TenantSettings)
+	if !ok {
+		t.Fatalf("%T hides storage.TenantSettings", st)
+	}
+	if err := settings.SetSetting("a", "color", "blue"); err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+	if v, _ := inner.GetSetting("a", "color"); v != "blue" {
+		t.Fatalf("setting did not reach the wrapped store, read %q", v)
+	}
+
+	history, ok := st.(storage.InstallHistory)
+	if !ok {
+		t.Fatalf("%T hides storage.InstallHistory", st)
+	}
+	if err := history.RecordInstall(storage.NewInstallRecord(Tenant("a"), "", time.Now())); err != nil {
+		t.Fatalf("recording install: %v", err)
+	}
+	if records, err := inner.InstallHistory("a"); err != nil || len(records) != 1 {
+		t.Fatalf("install history of the wrapped store has %d records, %v", len(records), err)
+	}
+
+	tokens, ok := st.(storage.TokenStore)
+	if !ok {
+		t.Fatalf("%T hides storage.TokenStore", st)
+	}
+	token := &storage.AccessToken{AccessToken: "token", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+	if err := tokens.SaveAccessToken("a", "account", "READ", token); err != nil {
+		t.Fatalf("saving access token: %v", err)
+	}
+	if got, err := inner.AccessToken("a", "account", "READ"); err != nil || got == nil || got.AccessToken != "token" {
+		t.Fatalf("access token of the wrapped store read as %+v, %v", got, err)
+	}
+
+	letters, ok := st.(storage.DeadLetterStore)
+	if !ok {
+		t.Fatalf("%T hides storage.DeadLetterStore", st)
+	}
+	if err := letters.SaveDeadLetter(&storage.DeadLetter{ID: "letter", ClientKey: "a"}); err != nil {
+		t.Fatalf("saving dead letter: %v", err)
+	}
+	if got, err := inner.DeadLetter("letter"); err != nil || got == nil {
+		t.Fatalf("dead letter of the wrapped store read as %+v, %v", got, err)
+	}
+
+	users, ok := st.(storage.UserMappingStore)
+	if !ok {
+		t.Fatalf("%T hides storage.UserMappingStore", st)
+	}
+	if err := users.SaveAccountIDs("a", map[string]string{"admin": "account"}); err != nil {
+		t.Fatalf("saving account ids: %v", err)
+	}
+	if got, err := inner.AccountIDs("a", []string{"admin"}); err != nil || got["admin"] != "account" {
+		t.Fatalf("account ids of the wrapped store read as %v, %v", got, err)
+	}
+
+	if _, ok := st.(storage.Locker); !ok {
+		t.Fatalf("%T hides storage.Locker", st)
+	}
+	ran := false
+	if err := storage.WithLock(st, "a", func() error { ran = true; return nil }); err != nil || !ran {
+		t.Fatalf("locking ran %v, %v", ran, err)
+	}
+
+	deleter, ok := st.(storage.Deleter)
+	if !ok {
+		t.Fatalf("%T hides storage.Deleter", st)
+	}
+	if err := deleter.DeleteJiraInstallInformation("b"); err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+	if jii, _ := inner.JiraInstallInformation("b"); jii != nil {
+		t.Fatal("deleting did not reach the wrapped store")
+	}
+}
+
+func testUnsupported(t *testing.T, st storage.Store) {
+	mustSave(t, st, Tenant("a"))
+	calls := map[string]error{}
+	if lister, ok := st.(storage.Lister); ok {
+		_, _, calls["ListInstallations"] = lister.ListInstallations("", 10)
+	}
+	if settings, ok := st.(storage.TenantSettings); ok {
+		calls["SetSetting"] = settings.SetSetting("a", "color", "blue")
+	}
+	if history, ok := st.(storage.InstallHistory); ok {
+		calls["RecordInstall"] = history.RecordInstall(storage.NewInstallRecord(Tenant("a"), "", time.Now()))
+	}
+	if tokens, ok := st.(storage.TokenStore); ok {
+		calls["SaveAccessToken"] = tokens.SaveAccessToken("a", "account", "READ", &storage.AccessToken{})
+	}
+	if letters, ok := st.(storage.DeadLetterStore); ok {
+		calls["SaveDeadLetter"] = letters.SaveDeadLetter(&storage.DeadLetter{ID: "letter", ClientKey: "a"})
+	}
+	if users, ok := st.(storage.UserMappingStore); ok {
+		calls["SaveAccountIDs"] = users.SaveAccountIDs("a", map[string]string{"admin": "account"})
+	}
+	for call, err := range calls {
+		if !errors.Is(err, storage.ErrUnsupported) {
+			t.Errorf("%s returned %v, expected storage.ErrUnsupported", call, err)
+		}
+	}
+	if jii := mustRead(t, st, "a"); jii == nil {
+		t.Fatal("saved tenant not read back")
+	}
+}
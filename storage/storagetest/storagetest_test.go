@@ -0,0 +1,16 @@
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+func TestMemoryStore(t *testing.T) {
+	Run(t, func() storage.Store { return storage.NewMemoryStore(time.Hour) })
+}
+
+func TestCachedStore(t *testing.T) {
+	Run(t, func() storage.Store { return storage.NewCachedStore(storage.NewMemoryStore(0), time.Minute) })
+}
@@ -0,0 +1,39 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import "time"
+
+// AccessToken is an oauth2 access token obtained to impersonate a user of a tenant.
+type AccessToken struct {
+	AccessToken string    `json:"accessToken"`
+	TokenType   string    `json:"tokenType"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// TokenStore can be implemented by stores to share the access tokens obtained to impersonate users
+// across replicas and restarts, rather than negotiating them again in each process. scopes is the
+// space separated list the token was requested for.
+type TokenStore interface {
+	SaveAccessToken(clientKey, accountID, scopes string, token *AccessToken) error
+	// AccessToken returns the token saved for the user and scopes or nil if there is none, it may
+	// have expired.
+	AccessToken(clientKey, accountID, scopes string) (*AccessToken, error)
+}
+
+// tokenKey identifies the token of a user for a set of scopes.
+type tokenKey struct {
+	clientKey, accountID, scopes string
+}
@@ -0,0 +1,32 @@
+package storage
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// UserMappingStore can be implemented by stores to remember the accountId of users referenced by
+// the user key or username they had before atlassian's GDPR changes, so data saved by older
+// versions of an app can be resolved without asking jira every time. Keys and usernames share a
+// namespace, see apicommunication.ResolveAccountIDs.
+type UserMappingStore interface {
+	// SaveAccountIDs saves the accountId each legacy user key or username in mapping belongs to.
+	SaveAccountIDs(clientKey string, mapping map[string]string) error
+	// AccountIDs returns the accountId of the passed legacy user keys or usernames, the ones that
+	// are not known are missing from the result.
+	AccountIDs(clientKey string, legacyIDs []string) (map[string]string, error)
+}
+
+// userMappingKey identifies a legacy user key or username in a tenant.
+type userMappingKey struct {
+	clientKey, legacyID string
+}
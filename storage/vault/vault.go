@@ -0,0 +1,266 @@
+// Package vault implements a storage.Store keeping the shared secret of tenants in the KV version 2
+// secrets engine of HashiCorp Vault, the rest of the install information is kept in another store.
+package vault
+
+//    Copyright 2020 ShiftLeft Inc.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+)
+
+const (
+	// DefaultMount is the mount path of the KV engine if Config has none.
+	DefaultMount = "secret"
+	// DefaultPathPrefix is the path under the mount secrets are written to if Config has none.
+	DefaultPathPrefix = "atlassian-connect"
+)
+
+// Config holds how to reach Vault.
+type Config struct {
+	// Address is the URL of the Vault server, ie https://vault.example.com:8200.
+	Address string
+	Token   string
+	// Namespace is sent in the X-Vault-Namespace header if set, for Vault Enterprise.
+	Namespace  string
+	Mount      string
+	PathPrefix string
+	// HTTPClient defaults to a client with a 10 seconds timeout.
+	HTTPClient *http.Client
+}
+
+// Store is a storage.Store that saves the shared secret of tenants in Vault and the rest of their
+// install information, with an empty SharedSecret, in the wrapped store. Listed and looked up
+// installations get their secrets from vault too, the other optional interfaces of the wrapped store
+// are forwarded to it, see storage.Delegate.
+type Store struct {
+	storage.Delegate
+	inner  storage.Store
+	config Config
+	client *http.Client
+}
+
+var (
+	_ storage.Store      = (*Store)(nil)
+	_ storage.Pinger     = (*Store)(nil)
+	_ storage.Deleter    = (*Store)(nil)
+	_ storage.Lister     = (*Store)(nil)
+	_ storage.SiteLookup = (*Store)(nil)
+	_ storage.Preloader  = (*Store)(nil)
+)
+
+// New returns a Store keeping shared secrets in the Vault described by config and everything else
+// in inner.
+func New(inner storage.Store, config Config) (*Store, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("vault address is required")
+	}
+	if _, err := url.Parse(config.Address); err != nil {
+		return nil, fmt.Errorf("parsing vault address: %w", err)
+	}
+	if config.Mount == "" {
+		config.Mount = DefaultMount
+	}
+	if config.PathPrefix == "" {
+		config.PathPrefix = DefaultPathPrefix
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Store{Delegate: storage.NewDelegate(inner), inner: inner, config: config, client: client}, nil
+}
+
+// secretPath returns the API path of the secret of the tenant.
+func (s *Store) secretPath(clientKey string) string {
+	return fmt.Sprintf("/v1/%s/data/%s/%s", strings.Trim(s.config.Mount, "/"),
+		strings.Trim(s.config.PathPrefix, "/"), url.PathEscape(clientKey))
+}
+
+func (s *Store) do(ctx context.Context, method, path string, body interface{}, target interface{}) (int, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return 0, fmt.Errorf("marshaling vault request: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(s.config.Address, "/")+path,
+		bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, fmt.Errorf("building vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.config.Token)
+	if s.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("querying vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("vault answered %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if target != nil {
+		if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+			return resp.StatusCode, fmt.Errorf("decoding vault response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+type kvData struct {
+	SharedSecret         string `json:"sharedSecret"`
+	PreviousSharedSecret string `json:"previousSharedSecret,omitempty"`
+}
+
+// SaveJiraInstallInformation implements storage.Store, the secret is written to vault before the
+// rest of the information so a tenant is never left without one. jii is not modified.
+func (s *Store) SaveJiraInstallInformation(jii *storage.JiraInstallInformation) error {
+	_, err := s.do(context.Background(), http.MethodPost, s.secretPath(jii.ClientKey),
+		map[string]interface{}{"data": kvData{
+			SharedSecret:         jii.SharedSecret,
+			PreviousSharedSecret: jii.PreviousSharedSecret,
+		}}, nil)
+	if err != nil {
+		return fmt.Errorf("saving shared secret of %s: %w", jii.ClientKey, err)
+	}
+	withoutSecret := *jii
+	withoutSecret.SharedSecret, withoutSecret.PreviousSharedSecret = "", ""
+	return s.inner.SaveJiraInstallInformation(&withoutSecret)
+}
+
+// JiraInstallInformation implements storage.Store, the tenant is considered not installed if
+// vault holds no secret for it.
+func (s *Store) JiraInstallInformation(clientKey string) (*storage.JiraInstallInformation, error) {
+	jii, err := s.inner.JiraInstallInformation(clientKey)
+	if err != nil || jii == nil {
+		return jii, err
+	}
+	return s.withSecret(jii)
+}
+
+// withSecret returns a copy of jii with the secrets vault holds for it, nil if there are none.
+func (s *Store) withSecret(jii *storage.JiraInstallInformation) (*storage.JiraInstallInformation, error) {
+	secret := struct {
+		Data struct {
+			Data kvData `json:"data"`
+		} `json:"data"`
+	}{}
+	code, err := s.do(context.Background(), http.MethodGet, s.secretPath(jii.ClientKey), nil, &secret)
+	if err != nil {
+		return nil, fmt.Errorf("reading shared secret of %s: %w", jii.ClientKey, err)
+	}
+	if code == http.StatusNotFound || secret.Data.Data.SharedSecret == "" {
+		return nil, nil
+	}
+	withSecret := *jii
+	withSecret.SharedSecret = secret.Data.Data.SharedSecret
+	withSecret.PreviousSharedSecret = secret.Data.Data.PreviousSharedSecret
+	return &withSecret, nil
+}
+
+// withSecrets returns the installations in jiis with the secrets vault holds for them, dropping
+// those it holds none for.
+func (s *Store) withSecrets(jiis []*storage.JiraInstallInformation) ([]*storage.JiraInstallInformation, error) {
+	found := make([]*storage.JiraInstallInformation, 0, len(jiis))
+	for _, jii := range jiis {
+		withSecret, err := s.withSecret(jii)
+		if err != nil {
+			return nil, err
+		}
+		if withSecret != nil {
+			found = append(found, withSecret)
+		}
+	}
+	return found, nil
+}
+
+// ListInstallations implements storage.Lister reading the secret of every listed tenant from vault.
+func (s *Store) ListInstallations(cursor string, limit int) ([]*storage.JiraInstallInformation, string, error) {
+	jiis, next, err := s.Delegate.ListInstallations(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if jiis, err = s.withSecrets(jiis); err != nil {
+		return nil, "", err
+	}
+	return jiis, next, nil
+}
+
+// JiraInstallInformationByHost implements storage.SiteLookup reading the secrets of the tenants
+// found from vault.
+func (s *Store) JiraInstallInformationByHost(host string) ([]*storage.JiraInstallInformation, error) {
+	jiis, err := s.Delegate.JiraInstallInformationByHost(host)
+	if err != nil {
+		return nil, err
+	}
+	return s.withSecrets(jiis)
+}
+
+// Preload implements storage.Preloader, the installations are handed to the wrapped store without
+// their secrets, as it would have read them.
+func (s *Store) Preload(jiis ...*storage.JiraInstallInformation) {
+	withoutSecrets := make([]*storage.JiraInstallInformation, 0, len(jiis))
+	for _, jii := range jiis {
+		withoutSecret := *jii
+		withoutSecret.SharedSecret, withoutSecret.PreviousSharedSecret = "", ""
+		withoutSecrets = append(withoutSecrets, &withoutSecret)
+	}
+	s.Delegate.Preload(withoutSecrets...)
+}
+
+// DeleteJiraInstallInformation implements storage.Deleter deleting every version of the secret of
+// the tenant and, if it implements storage.Deleter, its install information in the wrapped store.
+func (s *Store) DeleteJiraInstallInformation(clientKey string) error {
+	if d, ok := s.inner.(storage.Deleter); ok {
+		if err := d.DeleteJiraInstallInformation(clientKey); err != nil {
+			return err
+		}
+	}
+	metadataPath := strings.Replace(s.secretPath(clientKey), "/data/", "/metadata/", 1)
+	if _, err := s.do(context.Background(), http.MethodDelete, metadataPath, nil, nil); err != nil {
+		return fmt.Errorf("deleting shared secret of %s: %w", clientKey, err)
+	}
+	return nil
+}
+
+// Ping implements storage.Pinger checking vault health and, if it implements it, the wrapped store.
+func (s *Store) Ping(ctx context.Context) error {
+	if _, err := s.do(ctx, http.MethodGet, "/v1/sys/health?standbyok=true&perfstandbyok=true", nil, nil); err != nil {
+		return err
+	}
+	if p, ok := s.inner.(storage.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage"
+	"github.com/ShiftLeftSecurity/atlassian-connect-go/storage/storagetest"
+)
+
+// fakeVault mimics the KV version 2 API.
+func fakeVault(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	secrets := map[string]json.RawMessage{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v1/secret/data/atlassian-connect/") &&
+			!(r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/atlassian-connect/")) {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			body := struct {
+				Data json.RawMessage `json:"data"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			secrets[r.URL.Path] = body.Data
+		case http.MethodGet:
+			data, ok := secrets[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case http.MethodDelete:
+			delete(secrets, strings.Replace(r.URL.Path, "/metadata/", "/data/", 1))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestStore(t *testing.T) {
+	srv := fakeVault(t)
+	defer srv.Close()
+	inner := storage.NewMemoryStore(0)
+	s, err := New(inner, Config{Address: srv.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jii := &storage.JiraInstallInformation{ClientKey: "a", SharedSecret: "shared", BaseURL: "https://a.atlassian.net"}
+	if err := s.SaveJiraInstallInformation(jii); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := inner.JiraInstallInformation("a"); stored.SharedSecret != "" {
+		t.Fatal("the shared secret was saved in the inner store")
+	}
+	got, err := s.JiraInstallInformation("a")
+	if err != nil || got == nil || *got != *jii {
+		t.Fatalf("read %+v, %v", got, err)
+	}
+
+	// without a secret in vault the tenant is not installed
+	inner.Preload(&storage.JiraInstallInformation{ClientKey: "b"})
+	if got, err := s.JiraInstallInformation("b"); got != nil || err != nil {
+		t.Fatalf("read %+v, %v", got, err)
+	}
+
+	denied, _ := New(inner, Config{Address: srv.URL, Token: "wrong"})
+	if _, err := denied.JiraInstallInformation("a"); err == nil {
+		t.Fatal("reading with a wrong token succeeded")
+	}
+}
+
+func TestStoreConformance(t *testing.T) {
+	srv := fakeVault(t)
+	defer srv.Close()
+	stores := 0
+	storagetest.Run(t, func() storage.Store {
+		// every store gets its own prefix so they start empty on the shared fake
+		stores++
+		s, err := New(storage.NewMemoryStore(0), Config{
+			Address:    srv.URL,
+			Token:      "token",
+			PathPrefix: fmt.Sprintf("atlassian-connect/%d", stores),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestStoreDecorator(t *testing.T) {
+	srv := fakeVault(t)
+	defer srv.Close()
+	stores := 0
+	storagetest.RunDecorator(t, func(inner storage.Store) storage.Store {
+		stores++
+		s, err := New(inner, Config{
+			Address:    srv.URL,
+			Token:      "token",
+			PathPrefix: fmt.Sprintf("atlassian-connect/decorator-%d", stores),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}